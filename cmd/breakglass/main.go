@@ -0,0 +1,72 @@
+// cmd/breakglass/main.go
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// Signs the tokens activating the break-glass account, offline: nothing but the key is needed.
+//
+//	go run ./cmd/breakglass keygen
+//	go run ./cmd/breakglass sign -hours 4 -reason "SSO outage, INC-1234"
+//
+// keygen prints a new key pair: the public key goes to the BREAK_GLASS_PUBLIC_KEY of the API,
+// the private key stays with the security team. sign reads the private key from
+// BREAK_GLASS_PRIVATE_KEY and prints the token, used once with "go run . break-glass activate <token>"
+// before it lapses (BREAK_GLASS_TOKEN_TTL of the API, 15m by default).
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "keygen":
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("BREAK_GLASS_PUBLIC_KEY=%s\n", base64.StdEncoding.EncodeToString(public))
+		fmt.Printf("BREAK_GLASS_PRIVATE_KEY=%s\n", base64.StdEncoding.EncodeToString(private))
+	case "sign":
+		flags := flag.NewFlagSet("sign", flag.ExitOnError)
+		hours := flags.Int("hours", 1, "hours the account stays active")
+		reason := flags.String("reason", "", "why the account is needed, recorded and alerted")
+		username := flags.String("username", initializers.GetEnv("BREAK_GLASS_USERNAME", "breakglass"), "the break-glass account")
+		flags.Parse(os.Args[2:])
+		if *reason == "" {
+			log.Fatal("-reason must be set")
+		}
+
+		key, err := utils.ParseBreakGlassPrivateKey(os.Getenv("BREAK_GLASS_PRIVATE_KEY"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		token, err := utils.SignBreakGlassToken(key, utils.BreakGlassClaims{
+			Username: *username,
+			Hours:    *hours,
+			Reason:   *reason,
+			IssuedAt: time.Now().Unix(),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(token)
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: breakglass keygen | breakglass sign -reason <reason> [-hours n] [-username name]")
+	os.Exit(2)
+}
@@ -0,0 +1,88 @@
+// cmd/loadtest/main.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/loadtest"
+)
+
+// Runs load test scenarios against a running API and reports their latencies, e.g.
+//
+//	go run ./cmd/loadtest -rate 100 -duration 1m get-user-cached list-users
+//
+// The account is LOADTEST_USERNAME / LOADTEST_PASSWORD. With -json the results are also
+// written to a file, to compare the runs before and after a change. The same paths have Go
+// benchmarks without a deployment: go test ./src/router -run '^$' -bench .
+func main() {
+	target := &loadtest.Target{
+		Username: initializers.GetEnv("LOADTEST_USERNAME", ""),
+		Password: initializers.GetEnv("LOADTEST_PASSWORD", ""),
+	}
+	flag.StringVar(&target.BaseURL, "target", initializers.GetEnv("LOADTEST_TARGET", "http://localhost:8080"), "base URL of the API")
+	rate := flag.Int("rate", 50, "requests per second")
+	duration := flag.Duration("duration", 30*time.Second, "duration of each scenario")
+	workers := flag.Int("workers", 100, "maximum concurrent requests")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	output := flag.String("json", "", "file the results are written to as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: loadtest [flags] scenario...\n\nScenarios:\n")
+		for _, scenario := range loadtest.Scenarios {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %-16s %s\n", scenario.Name, scenario.Description)
+		}
+		fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || *rate <= 0 || *workers <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if target.Username == "" || target.Password == "" {
+		log.Fatal("LOADTEST_USERNAME and LOADTEST_PASSWORD must be set")
+	}
+
+	var scenarios []loadtest.Scenario
+	for _, name := range flag.Args() {
+		scenario, err := loadtest.FindScenario(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scenarios = append(scenarios, scenario)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := loadtest.Options{Rate: *rate, Duration: *duration, Workers: *workers, Timeout: *timeout}
+	var results []*loadtest.Result
+	for _, scenario := range scenarios {
+		result, err := loadtest.Run(ctx, target, scenario, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result.Report(os.Stdout)
+		results = append(results, result)
+	}
+
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		for _, result := range results {
+			if err := result.WriteJSON(file); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
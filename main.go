@@ -2,31 +2,349 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/lifecycle"
 	"github.com/nabazesmail/gopher/src/migrate"
+	"github.com/nabazesmail/gopher/src/mockserver"
 	"github.com/nabazesmail/gopher/src/router"
+	"github.com/nabazesmail/gopher/src/scheduler"
+	"github.com/nabazesmail/gopher/src/server"
+	"github.com/nabazesmail/gopher/src/services"
+	"github.com/nabazesmail/gopher/src/utils"
 )
 
-// Run the migration logic
+// Run the migration logic, the mock server runs without a database
 func init() {
+	for _, arg := range os.Args[1:] {
+		if arg == "mock-serve" {
+			return
+		}
+	}
 	migrate.Migration()
 }
 
+// startup roles, selecting the subsystems the process runs
+const (
+	roleAPI       = "api"       // HTTP API
+	roleWorker    = "worker"    // background job workers
+	roleScheduler = "scheduler" // periodic jobs
+	roleAll       = "all"       // everything in one process
+)
+
+// parseRoles reads the comma separated roles, e.g. "api,worker".
+func parseRoles(value string) (map[string]bool, error) {
+	roles := map[string]bool{}
+	for _, role := range strings.Split(value, ",") {
+		switch role = strings.TrimSpace(role); role {
+		case roleAll:
+			roles[roleAPI], roles[roleWorker], roles[roleScheduler] = true, true, true
+		case roleAPI, roleWorker, roleScheduler:
+			roles[role] = true
+		default:
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+	}
+	return roles, nil
+}
+
+// runBreakGlass runs a break-glass command: provision creates the account or rotates its
+// password, activate opens it with a token signed by cmd/breakglass, seal closes it early
+func runBreakGlass(ctx context.Context, command, token string) error {
+	switch command {
+	case "provision":
+		password, err := services.ProvisionBreakGlass(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Break-glass account provisioned, sealed. Its password, shown once:\n%s\n", password)
+	case "activate":
+		activation, err := services.ActivateBreakGlass(ctx, token)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Break-glass account active until %s\n", activation.ExpiresAt.Format(time.RFC3339))
+	case "seal":
+		if err := services.SealBreakGlass(ctx); err != nil {
+			return err
+		}
+		fmt.Println("Break-glass account sealed")
+	default:
+		return fmt.Errorf("usage: break-glass provision | activate <token> | seal")
+	}
+	return nil
+}
+
+// runDoctor prints the findings of the integrity checks and returns how many weren't fixed
+func runDoctor(ctx context.Context, fix bool) (int, error) {
+	// the cached users are decoded with the custom roles
+	if err := services.LoadRoles(ctx); err != nil {
+		return 0, fmt.Errorf("loading roles: %w", err)
+	}
+
+	remaining := 0
+	for _, finding := range services.RunDoctor(ctx, fix) {
+		status := "FOUND"
+		if finding.Fixed {
+			status = "FIXED"
+		} else {
+			remaining++
+		}
+		fmt.Printf("%s  %-16s %s: %s\n", status, finding.Check, finding.Subject, finding.Problem)
+	}
+	fmt.Printf("%d findings left\n", remaining)
+	return remaining, nil
+}
+
+// runBootstrap applies the bootstrap document of the JSON file and prints the changes
+func runBootstrap(ctx context.Context, path string, dryRun bool) error {
+	// the roles of the document are validated against the custom roles
+	if err := services.LoadRoles(ctx); err != nil {
+		return fmt.Errorf("loading roles: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc services.BootstrapDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	report, err := services.ApplyBootstrap(ctx, &doc, dryRun)
+	if report != nil {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	}
+	return err
+}
+
+// runMockServer serves the API from the fixtures of the file, the default ones when empty,
+// until SIGINT or SIGTERM
+func runMockServer(fixturesPath string) error {
+	fixtures := mockserver.DefaultFixtures()
+	if fixturesPath != "" {
+		var err error
+		if fixtures, err = mockserver.LoadFixtures(fixturesPath); err != nil {
+			return err
+		}
+	}
+	store, err := mockserver.NewStore(fixtures)
+	if err != nil {
+		return err
+	}
+	for _, user := range fixtures.Users {
+		fmt.Printf("Mock user %s (%s)\n", user.Username, user.Role)
+	}
+
+	lifecycle.Register(lifecycle.Hook{
+		Name:  "mock http server",
+		Start: func(ctx context.Context) error { return server.Start(mockserver.NewRouter(store)) },
+		Stop:  server.Stop,
+	})
+	return lifecycle.Run()
+}
+
 func main() {
+	// The same binary runs as --role=api, worker, scheduler or all (APP_ROLE, all by default)
+	roleFlag := flag.String("role", initializers.GetEnv("APP_ROLE", roleAll), "subsystems to start: api, worker, scheduler or all (comma separated)")
+	flag.Parse()
+
+	// "reindex" rebuilds the search indexes from the database and exits
+	if flag.Arg(0) == "reindex" {
+		if err := services.ReindexSearch(context.Background()); err != nil {
+			log.Fatal("Error reindexing: ", err)
+		}
+		return
+	}
+
+	// "restore-archive <category> [key]" inserts archived rows back and exits
+	if flag.Arg(0) == "restore-archive" {
+		restored, err := services.RestoreArchive(context.Background(), flag.Arg(1), flag.Arg(2))
+		if err != nil {
+			log.Fatal("Error restoring the archive: ", err)
+		}
+		fmt.Printf("Restored %d rows\n", restored)
+		return
+	}
+
+	// "doctor [-fix]" checks the schema and data integrity, repairing the safe findings with -fix,
+	// and exits with 1 when findings remain
+	if flag.Arg(0) == "doctor" {
+		doctor := flag.NewFlagSet("doctor", flag.ExitOnError)
+		fix := doctor.Bool("fix", false, "repair the safe findings")
+		doctor.Parse(flag.Args()[1:])
+
+		initializers.InitRedis()
+		remaining, err := runDoctor(context.Background(), *fix)
+		initializers.CloseRedis()
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		if remaining > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "break-glass provision|activate <token>|seal" manages the emergency admin account and exits
+	if flag.Arg(0) == "break-glass" {
+		initializers.InitRedis() // the sessions are revoked and the alerts queued in Redis
+		err := runBreakGlass(context.Background(), flag.Arg(1), flag.Arg(2))
+		initializers.CloseRedis()
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		return
+	}
+
+	// "bootstrap [-dry-run] <file.json>" provisions the admin, roles and features of the document,
+	// printing the changes, and exits; applying it again changes nothing
+	if flag.Arg(0) == "bootstrap" {
+		bootstrap := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+		dryRun := bootstrap.Bool("dry-run", false, "print the changes without applying them")
+		bootstrap.Parse(flag.Args()[1:])
+		if bootstrap.NArg() != 1 {
+			log.Fatal("usage: bootstrap [-dry-run] <file.json>")
+		}
+
+		initializers.InitRedis() // the caches of the changed users and roles are in Redis
+		err := runBootstrap(context.Background(), bootstrap.Arg(0), *dryRun)
+		initializers.CloseRedis()
+		if err != nil {
+			log.Fatal("Error bootstrapping: ", err)
+		}
+		return
+	}
+
+	// "mock-serve [-fixtures users.json]" serves the routes of the client package from in-memory
+	// fixtures on PORT, without MySQL or Redis, for the contract tests of the client teams
+	if flag.Arg(0) == "mock-serve" {
+		mock := flag.NewFlagSet("mock-serve", flag.ExitOnError)
+		fixturesPath := mock.String("fixtures", "", "JSON file of the users, an admin and an operator by default")
+		mock.Parse(flag.Args()[1:])
+
+		if err := runMockServer(*fixturesPath); err != nil {
+			log.Fatal("Error running the mock server: ", err)
+		}
+		return
+	}
+
+	roles, err := parseRoles(*roleFlag)
+	if err != nil {
+		log.Fatal("Error parsing the role: ", err)
+	}
+
 	cwd, err := os.Getwd()
 	if err != nil {
 		log.Fatal("Error getting current working directory:", err)
 	}
 	fmt.Println("Current working directory:", cwd)
 
-	initializers.InitRedis() // Initialize Redis
+	// The database is connected by the migration, it closes last
+	lifecycle.Register(lifecycle.Hook{
+		Name: "database",
+		Stop: func(ctx context.Context) error { return initializers.CloseDB() },
+	})
+
+	lifecycle.Register(lifecycle.Hook{
+		Name: "redis",
+		Start: func(ctx context.Context) error {
+			initializers.InitRedis() // Initialize Redis
+
+			// initializers.ResetCache()  <<//uncomment and reset the cache if needed!
+			return nil
+		},
+		Stop: func(ctx context.Context) error { return initializers.CloseRedis() },
+	})
 
-	// initializers.ResetCache()  <<//uncomment and reset the cache if needed!
+	lifecycle.Register(lifecycle.Hook{
+		Name: "services",
+		Start: func(ctx context.Context) error {
+			// Load the token signing keys
+			if err := utils.LoadSigningKeys(); err != nil {
+				return fmt.Errorf("loading JWT signing keys: %w", err)
+			}
 
-	r := router.SetupRouter()
-	r.Run()
+			// Load the roles and the permissions they grant
+			if err := services.LoadRoles(ctx); err != nil {
+				return fmt.Errorf("loading roles: %w", err)
+			}
+
+			services.InitUserValidators() // Register the custom user validation hooks
+			services.InitSyncAdapters()   // Register the external directory sync adapters
+			services.InitSearchIndex()    // Mirror the users and audit logs into the search index
+			services.InitNotifications()  // Register the notification delivery job
+			services.InitBreakGlass()     // Register the break-glass alert job
+
+			// Report the integrity findings of the doctor command on startup, without fixing them
+			if initializers.GetEnvBool("DOCTOR_ON_STARTUP", false) {
+				for _, finding := range services.RunDoctor(ctx, false) {
+					log.Printf("Doctor %s: %s: %s", finding.Check, finding.Subject, finding.Problem)
+				}
+			}
+			return nil
+		},
+	})
+
+	// The background job workers stop consuming before Redis closes
+	if roles[roleWorker] {
+		lifecycle.Register(lifecycle.Hook{
+			Name:  "job workers",
+			Start: func(ctx context.Context) error { jobs.Start(); return nil },
+			Stop:  jobs.Stop,
+		})
+	}
+
+	// The periodic jobs
+	if roles[roleScheduler] {
+		lifecycle.Register(lifecycle.Hook{
+			Name: "scheduler",
+			Start: func(ctx context.Context) error {
+				services.ScheduleAccessReview()
+				services.ScheduleNotificationDigest()
+				services.ScheduleAccountPurge()
+				services.ScheduleWarehouseExport()
+				services.ScheduleRetentionPurge()
+				services.ScheduleBreakGlassExpiry()
+				services.ScheduleUserCacheAudit()
+				jobs.ScheduleDeadJobExpiry()
+				scheduler.Start()
+				return nil
+			},
+			Stop: scheduler.Stop,
+		})
+
+		// The binlog listener evicting the users changed outside of the API, one per deployment
+		lifecycle.Register(lifecycle.Hook{
+			Name:  "user cache cdc",
+			Start: func(ctx context.Context) error { return services.StartUserCacheCDC() },
+			Stop:  services.StopUserCacheCDC,
+		})
+	}
+
+	// The HTTP API stops first, draining the in-flight requests for up to SHUTDOWN_TIMEOUT
+	if roles[roleAPI] {
+		lifecycle.Register(lifecycle.Hook{
+			Name:    "http server",
+			Start:   func(ctx context.Context) error { return server.Start(router.SetupRouter()) },
+			Stop:    server.Stop,
+			Timeout: initializers.GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		})
+	}
+
+	// Start everything, then stop in reverse order on SIGINT or SIGTERM
+	if err := lifecycle.Run(); err != nil {
+		log.Fatal("Error starting the application: ", err)
+	}
 }
@@ -0,0 +1,75 @@
+// apierrors/apierrors.go
+package apierrors
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code is an error code of the API: the "code" field of its error responses, stable for the
+// clients to map, with the HTTP status it comes with.
+type Code struct {
+	Code        string `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Code{}
+)
+
+// Register adds the code to the catalog, it panics when the code is already registered.
+func Register(code string, status int, description string) Code {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[code]; ok {
+		panic(fmt.Sprintf("apierrors: the %s code is registered twice", code))
+	}
+	registry[code] = Code{Code: code, Status: status, Description: description}
+	return registry[code]
+}
+
+// Catalog returns every registered code, sorted.
+func Catalog() []Code {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	codes := make([]Code, 0, len(registry))
+	for _, code := range registry {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// Body is the error response of the code, with the message for people to read.
+func (c Code) Body(message string) gin.H {
+	return New(c, message).Envelope()
+}
+
+// the codes the API emits
+var (
+	InvalidRequest       = Register("invalid_request", http.StatusBadRequest, "The body or the parameters of the request are invalid")
+	Unauthenticated      = Register("unauthenticated", http.StatusUnauthorized, "The request has no valid credentials")
+	AccessDenied         = Register("access_denied", http.StatusForbidden, "The caller lacks the permission the route requires")
+	NotFound             = Register("not_found", http.StatusNotFound, "The resource doesn't exist")
+	RouteNotFound        = Register("route_not_found", http.StatusNotFound, "No route matches the path")
+	MethodNotAllowed     = Register("method_not_allowed", http.StatusMethodNotAllowed, "The route doesn't accept the method, see allowed_methods")
+	Conflict             = Register("conflict", http.StatusConflict, "The request conflicts with the current state of the resource")
+	PreconditionFailed   = Register("precondition_failed", http.StatusPreconditionFailed, "The resource changed, If-Match no longer matches its ETag")
+	PayloadTooLarge      = Register("payload_too_large", http.StatusRequestEntityTooLarge, "The request carries too many items")
+	ValidationFailed     = Register("validation_failed", http.StatusUnprocessableEntity, "A value breaks a validation rule or a policy")
+	DisposableEmail      = Register("disposable_email", http.StatusUnprocessableEntity, "Signing up with a disposable email address is not allowed")
+	PreconditionRequired = Register("precondition_required", http.StatusPreconditionRequired, "The route requires If-Match with the ETag of the resource")
+	RateLimited          = Register("rate_limited", http.StatusTooManyRequests, "Too many requests from the client, retry after Retry-After seconds")
+	LoginRateLimited     = Register("login_rate_limited", http.StatusTooManyRequests, "Too many login attempts, retry after Retry-After seconds")
+	SignupRateLimited    = Register("signup_rate_limited", http.StatusTooManyRequests, "Too many signups from the client IP, retry after Retry-After seconds")
+	InternalError        = Register("internal_error", http.StatusInternalServerError, "An unexpected error, the request may be retried")
+	QueryBudgetExceeded  = Register("query_budget_exceeded", http.StatusInternalServerError, "The request ran more database queries than its budget (development only)")
+	ServerBusy           = Register("server_busy", http.StatusServiceUnavailable, "The server is saturated, retry after Retry-After seconds")
+	InjectedFault        = Register("injected_fault", http.StatusServiceUnavailable, "A fault injected for resilience testing (development and staging only)")
+)
@@ -0,0 +1,99 @@
+// apierrors/errors.go
+package apierrors
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error is an error the services return with the code the API answers it with, the message
+// for people to read and the details of the problem, e.g. the fields breaking a rule.
+type Error struct {
+	Code    Code
+	Message string
+	Details []interface{}
+}
+
+// New returns an error of the code.
+func New(code Code, message string, details ...interface{}) *Error {
+	return &Error{Code: code, Message: message, Details: details}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code.Description
+	}
+	return e.Message
+}
+
+// Is makes every error of a code match the generic error of the code (the Err* errors), so
+// errors.Is(err, ErrNotFound) holds for any resource not found.
+func (e *Error) Is(target error) bool {
+	generic, ok := target.(*Error)
+	return ok && generic.Message == "" && generic.Code.Code == e.Code.Code
+}
+
+// Envelope is the error response of the API: {"code": ..., "message": ..., "details": [...]}.
+func (e *Error) Envelope() gin.H {
+	details := e.Details
+	if details == nil {
+		details = []interface{}{}
+	}
+	return gin.H{"code": e.Code.Code, "message": e.Error(), "details": details}
+}
+
+// the generic errors of the codes the services return the most
+var (
+	ErrNotFound     = &Error{Code: NotFound}
+	ErrConflict     = &Error{Code: Conflict}
+	ErrValidation   = &Error{Code: ValidationFailed}
+	ErrUnauthorized = &Error{Code: Unauthenticated}
+)
+
+// From returns the API error err is or wraps, with the message of err when wrapped with more
+// context. Any other error is an internal error, whose message isn't leaked to the client.
+func From(err error) *Error {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return New(InternalError, "Internal server error")
+	}
+	if apiErr.Message == "" || err.Error() == apiErr.Error() {
+		return apiErr
+	}
+	return &Error{Code: apiErr.Code, Message: err.Error(), Details: apiErr.Details}
+}
+
+// ForStatus returns the code of the error responses of the status, for the handlers that
+// answer without one.
+func ForStatus(status int) Code {
+	switch status {
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return AccessDenied
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusMethodNotAllowed:
+		return MethodNotAllowed
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusPreconditionFailed:
+		return PreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return PayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return ValidationFailed
+	case http.StatusPreconditionRequired:
+		return PreconditionRequired
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusServiceUnavailable:
+		return ServerBusy
+	}
+	if status >= 500 {
+		return InternalError
+	}
+	return InvalidRequest
+}
@@ -0,0 +1,74 @@
+// client/auth.go
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nabazesmail/gopher/src/dto"
+)
+
+// Tokens are the answer of a login or a refresh. When the account has the SMS second factor
+// the login answers with an OTPChallenge instead, completed by VerifyLoginOTP.
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // in seconds, the code lifetime for a challenge
+	OTPRequired  bool   `json:"otp_required"`
+	OTPChallenge string `json:"otp_challenge"`
+}
+
+// Login logs in with the username and password, POST /login. The client uses the access
+// token from then on, unless the login waits for the SMS code.
+func (c *Client) Login(ctx context.Context, username, password string, rememberMe bool) (*Tokens, error) {
+	var tokens Tokens
+	body := dto.LoginRequest{Username: username, Password: password, RememberMe: rememberMe}
+	if err := c.do(ctx, http.MethodPost, "/login", nil, body, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.AccessToken != "" {
+		c.SetToken(tokens.AccessToken)
+	}
+	return &tokens, nil
+}
+
+// VerifyLoginOTP completes the login of the challenge with the code texted to the user,
+// POST /login/otp. The client uses the access token from then on.
+func (c *Client) VerifyLoginOTP(ctx context.Context, challenge, code string) (*Tokens, error) {
+	var tokens Tokens
+	body := map[string]string{"otp_challenge": challenge, "code": code}
+	if err := c.do(ctx, http.MethodPost, "/login/otp", nil, body, &tokens); err != nil {
+		return nil, err
+	}
+	c.SetToken(tokens.AccessToken)
+	return &tokens, nil
+}
+
+// Refresh trades the refresh token for new tokens, POST /refresh; the refresh token can't be
+// used again. The client uses the new access token from then on.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	var tokens Tokens
+	body := map[string]string{"refresh_token": refreshToken}
+	if err := c.do(ctx, http.MethodPost, "/refresh", nil, body, &tokens); err != nil {
+		return nil, err
+	}
+	c.SetToken(tokens.AccessToken)
+	return &tokens, nil
+}
+
+// Logout revokes the access token of the client and the refresh token when not empty,
+// POST /logout.
+func (c *Client) Logout(ctx context.Context, refreshToken string) error {
+	body := map[string]string{"refresh_token": refreshToken}
+	return c.do(ctx, http.MethodPost, "/logout", nil, body, &message{})
+}
+
+// Register creates an account, POST /register, with the invite of the request when
+// registration requires one.
+func (c *Client) Register(ctx context.Context, req dto.CreateUserRequest) (*dto.User, error) {
+	var answer userAnswer
+	if err := c.do(ctx, http.MethodPost, "/register", nil, req, &answer); err != nil {
+		return nil, err
+	}
+	return answer.User, nil
+}
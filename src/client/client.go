@@ -0,0 +1,161 @@
+// client/client.go
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/dto"
+)
+
+// Client calls the API as the user or machine client of its token: an access token, a
+// personal access token or, with NewAPIKeyClient, an API key. It is safe for concurrent use,
+// except for the methods setting the token: SetToken, Login, VerifyLoginOTP and Refresh.
+type Client struct {
+	// HTTPClient sends the requests, a 30 seconds timeout by default
+	HTTPClient *http.Client
+
+	baseURL string
+	token   string
+	apiKey  bool
+}
+
+// NewClient returns a client of the API at baseURL, e.g. "https://api.example.com",
+// authenticating with the bearer token. The token can be empty for the public routes and set
+// later by Login.
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+	}
+}
+
+// NewAPIKeyClient returns a client of the API at baseURL authenticating with the API key, in
+// the X-API-Key header.
+func NewAPIKeyClient(baseURL, apiKey string) *Client {
+	c := NewClient(baseURL, apiKey)
+	c.apiKey = true
+	return c
+}
+
+// SetToken replaces the bearer token of the requests.
+func (c *Client) SetToken(token string) {
+	c.token = token
+	c.apiKey = false
+}
+
+// Error is an error answer of the API: its status, the stable code and the message for people
+// to read. The details of a 422 validation_failed are the fields breaking the rules.
+type Error struct {
+	StatusCode int
+	Code       string           `json:"code"`
+	Message    string           `json:"message"`
+	Details    []dto.FieldError `json:"details"`
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("api: %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("api: %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 answer of the API.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// newRequest builds the request of the path, with the body encoded as JSON when not nil
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.token == "":
+	case c.apiKey:
+		req.Header.Set("X-API-Key", c.token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// send sends the request and decodes the answer into out when not nil, the answers outside
+// of 2xx are returned as *Error
+func (c *Client) send(req *http.Request, out interface{}) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decoding the answer of %s %s: %w", req.Method, req.URL.Path, err)
+		}
+	}
+	return nil
+}
+
+// do builds and sends the request, see newRequest and send
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	return c.send(req, out)
+}
+
+// doIfMatch is do with the If-Match of the ETag when not empty, for the updates of a resource
+// unchanged since it was read
+func (c *Client) doIfMatch(ctx context.Context, method, path, etag string, body, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, nil, body)
+	if err != nil {
+		return err
+	}
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	return c.send(req, out)
+}
+
+// message is the answer of the routes answering with a message only
+type message struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,242 @@
+// client/users.go
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// the answers wrapping a user or users
+type userAnswer struct {
+	User *dto.User `json:"user"`
+}
+
+type usersAnswer struct {
+	Users []*dto.User `json:"users"`
+}
+
+// UserListOptions filters, sorts and pages the users of ListUsers, the zero values are the
+// defaults of the API.
+type UserListOptions struct {
+	Page           int
+	PerPage        int // at most 100
+	Role           models.Role
+	Status         models.Status
+	PhonePrefix    string // the start of an E.164 number, e.g. +44
+	Sort           string // e.g. "-created_at"
+	IncludeDeleted bool   // needs the permission to delete users
+
+	// Cursor pages by cursor instead of Page: "" for the first page, then the NextCursor of
+	// the previous one
+	Cursor    string
+	UseCursor bool
+}
+
+// UserPage is a page of users. A page by cursor has NextCursor, empty after the last page,
+// and no totals.
+type UserPage struct {
+	Users      []*dto.User `json:"users"`
+	Total      int64       `json:"total"`
+	TotalExact bool        `json:"total_exact"` // false when the total comes from the count cache
+	Page       int         `json:"page"`
+	PerPage    int         `json:"per_page"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+// ListUsers returns a page of the users, GET /users.
+func (c *Client) ListUsers(ctx context.Context, opts UserListOptions) (*UserPage, error) {
+	query := url.Values{}
+	if opts.Page > 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.PerPage > 0 {
+		query.Set("per_page", strconv.Itoa(opts.PerPage))
+	}
+	if opts.Role != "" {
+		query.Set("role", string(opts.Role))
+	}
+	if opts.Status != "" {
+		query.Set("status", string(opts.Status))
+	}
+	if opts.PhonePrefix != "" {
+		query.Set("phone_prefix", opts.PhonePrefix)
+	}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	if opts.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+	if opts.UseCursor {
+		query.Set("cursor", opts.Cursor)
+	}
+
+	var page UserPage
+	if err := c.do(ctx, http.MethodGet, "/users", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetUser returns the user of the ID, GET /users/:id; IsNotFound tells a missing user.
+func (c *Client) GetUser(ctx context.Context, id uint) (*dto.User, error) {
+	var answer userAnswer
+	if err := c.do(ctx, http.MethodGet, userPath(id), nil, nil, &answer); err != nil {
+		return nil, err
+	}
+	return answer.User, nil
+}
+
+// GetUserByUsername returns the user of the username, GET /users/by-username/:username; a
+// former username returns the user under its current one.
+func (c *Client) GetUserByUsername(ctx context.Context, username string) (*dto.User, error) {
+	var answer userAnswer
+	if err := c.do(ctx, http.MethodGet, "/users/by-username/"+url.PathEscape(username), nil, nil, &answer); err != nil {
+		return nil, err
+	}
+	return answer.User, nil
+}
+
+// GetUsers returns the users of the IDs in one request, GET /users/batch, in the order of
+// the IDs; missing lists the IDs of no user.
+func (c *Client) GetUsers(ctx context.Context, ids []uint) (users []*dto.User, missing []string, err error) {
+	encoded := make([]string, len(ids))
+	for i, id := range ids {
+		encoded[i] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	var answer struct {
+		Users   []*dto.User `json:"users"`
+		Missing []string    `json:"missing"`
+	}
+	query := url.Values{"ids": {strings.Join(encoded, ",")}}
+	if err := c.do(ctx, http.MethodGet, "/users/batch", query, nil, &answer); err != nil {
+		return nil, nil, err
+	}
+	return answer.Users, answer.Missing, nil
+}
+
+// GetOnlineUsers returns the users seen within the presence window, GET /users/online.
+func (c *Client) GetOnlineUsers(ctx context.Context) ([]*dto.User, error) {
+	var answer usersAnswer
+	if err := c.do(ctx, http.MethodGet, "/users/online", nil, nil, &answer); err != nil {
+		return nil, err
+	}
+	return answer.Users, nil
+}
+
+// UserSearchPage is a page of the users matching a search, the best matches first.
+type UserSearchPage struct {
+	Users      []*dto.UserSummary `json:"users"`
+	Total      int64              `json:"total"`
+	TotalExact bool               `json:"total_exact"`
+	Page       int                `json:"page"`
+	PerPage    int                `json:"per_page"`
+}
+
+// SearchUsers searches the users by full name or username, GET /users/search.
+func (c *Client) SearchUsers(ctx context.Context, q string, page, perPage int) (*UserSearchPage, error) {
+	query := url.Values{"q": {q}}
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if perPage > 0 {
+		query.Set("per_page", strconv.Itoa(perPage))
+	}
+
+	var answer UserSearchPage
+	if err := c.do(ctx, http.MethodGet, "/users/search", query, nil, &answer); err != nil {
+		return nil, err
+	}
+	return &answer, nil
+}
+
+// CreateUsers creates the users in one request, POST /users/bulk; every user has a result,
+// its error is the reason it was left out.
+func (c *Client) CreateUsers(ctx context.Context, users []dto.UserRequest) ([]dto.BulkUserResult, error) {
+	var answer struct {
+		Results []dto.BulkUserResult `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/users/bulk", nil, users, &answer); err != nil {
+		return nil, err
+	}
+	return answer.Results, nil
+}
+
+// UpdateUser updates the user with the fields set in the request, PUT /users/:id. With the
+// ETag of the user (dto.User.ETag) the update fails with 412 when the user changed since.
+func (c *Client) UpdateUser(ctx context.Context, id uint, req dto.UserRequest, etag string) (*dto.User, error) {
+	var answer userAnswer
+	if err := c.doIfMatch(ctx, http.MethodPut, userPath(id), etag, req, &answer); err != nil {
+		return nil, err
+	}
+	return answer.User, nil
+}
+
+// PatchUser changes the fields of the patch, PATCH /users/:id with a JSON Merge Patch: null
+// clears the email, the phone or the profile picture. See UpdateUser for the ETag.
+func (c *Client) PatchUser(ctx context.Context, id uint, patch map[string]interface{}, etag string) (*dto.User, error) {
+	var answer userAnswer
+	if err := c.doIfMatch(ctx, http.MethodPatch, userPath(id), etag, patch, &answer); err != nil {
+		return nil, err
+	}
+	return answer.User, nil
+}
+
+// DeleteUser deletes the user, DELETE /users/:id; it can be restored. See UpdateUser for the
+// ETag.
+func (c *Client) DeleteUser(ctx context.Context, id uint, etag string) error {
+	return c.doIfMatch(ctx, http.MethodDelete, userPath(id), etag, nil, &message{})
+}
+
+// RestoreUser restores the deleted user, POST /users/:id/restore.
+func (c *Client) RestoreUser(ctx context.Context, id uint) (*dto.User, error) {
+	var answer userAnswer
+	if err := c.do(ctx, http.MethodPost, userPath(id)+"/restore", nil, nil, &answer); err != nil {
+		return nil, err
+	}
+	return answer.User, nil
+}
+
+// Me returns the user of the token, GET /me.
+func (c *Client) Me(ctx context.Context) (*dto.UserSummary, error) {
+	var answer struct {
+		User *dto.UserSummary `json:"user"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/me", nil, nil, &answer); err != nil {
+		return nil, err
+	}
+	return answer.User, nil
+}
+
+// GetMyPreferences returns the preferences of the user of the token, GET /me/preferences.
+func (c *Client) GetMyPreferences(ctx context.Context) (*models.UserPreferences, error) {
+	var answer struct {
+		Preferences *models.UserPreferences `json:"preferences"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/me/preferences", nil, nil, &answer); err != nil {
+		return nil, err
+	}
+	return answer.Preferences, nil
+}
+
+// UpdateMyPreferences replaces the preferences of the user of the token, PUT /me/preferences.
+func (c *Client) UpdateMyPreferences(ctx context.Context, preferences models.UserPreferences) (*models.UserPreferences, error) {
+	var answer struct {
+		Preferences *models.UserPreferences `json:"preferences"`
+	}
+	if err := c.do(ctx, http.MethodPut, "/me/preferences", nil, preferences, &answer); err != nil {
+		return nil, err
+	}
+	return answer.Preferences, nil
+}
+
+func userPath(id uint) string {
+	return "/users/" + strconv.FormatUint(uint64(id), 10)
+}
@@ -2,42 +2,220 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/dto"
 	"github.com/nabazesmail/gopher/src/middleware"
 	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
 	"github.com/nabazesmail/gopher/src/services"
-	"github.com/nabazesmail/gopher/src/utils"
 )
 
-// create user
+// create user, with an invite when registration requires one
 func CreateUser(c *gin.Context) {
-	var body models.User
+	var body dto.CreateUserRequest
 
 	if err := c.ShouldBindJSON(&body); err != nil {
 		middleware.Logger.Printf("Error parsing request body: %s", err)
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
 		c.JSON(400, gin.H{"error": "Invalid request body"})
 		return
 	}
 
 	// Create the user using the services package
-	user, err := services.CreateUser(&body)
+	user, err := services.CreateUser(c.Request.Context(), body.ToUser(), body.InviteToken, body.Email)
 	if err != nil {
 		middleware.Logger.Printf("Error creating user: %s", err)
+		if errors.Is(err, services.ErrInvalidInvite) {
+			c.JSON(403, gin.H{"error": "A valid invite is required"})
+			return
+		}
+		if respondValidationError(c, err) {
+			return
+		}
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		var signupErr *services.SignupRejectedError
+		if errors.As(err, &signupErr) {
+			if signupErr.RetryAfter > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(signupErr.RetryAfter.Seconds()))))
+				c.JSON(429, gin.H{"error": signupErr.Reason, "code": signupErr.Code, "retry_after": int(math.Ceil(signupErr.RetryAfter.Seconds()))})
+				return
+			}
+			c.JSON(422, gin.H{"error": signupErr.Reason, "code": signupErr.Code})
+			return
+		}
+		var policyErr *services.PolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(422, gin.H{"error": policyErr.Reason})
+			return
+		}
+		if errors.Is(err, services.ErrPasswordHashingBusy) {
+			c.Header("Retry-After", "1")
+			c.JSON(503, apierrors.ServerBusy.Body("Server busy, please try again"))
+			return
+		}
+		if errors.Is(err, repository.ErrConstraintViolation) {
+			c.JSON(400, gin.H{"error": "Invalid role or status value"})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidEmail) || errors.Is(err, services.ErrInvalidPhone) || errors.Is(err, services.ErrInvalidMetadata) ||
+			errors.Is(err, services.ErrInvalidUsername) {
+			c.JSON(400, apierrors.InvalidRequest.Body(err.Error()))
+			return
+		}
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(409, apierrors.Conflict.Body("The username or email is already taken"))
+			return
+		}
 		c.JSON(500, gin.H{"error": "Internal server error"})
 		return
 	}
 
 	c.JSON(201, gin.H{
-		"user": user,
+		"user": dto.FromUser(user),
 	})
 }
 
+// creating users in bulk, with a result for each of them
+func CreateUsersBulk(c *gin.Context) {
+	var body []*dto.UserRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		middleware.Logger.Printf("Error parsing request body: %s", err)
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": "Invalid request body, expected an array of users"})
+		return
+	}
+	if len(body) == 0 {
+		c.JSON(400, gin.H{"error": "At least one user must be provided"})
+		return
+	}
+	for _, user := range body {
+		if user == nil {
+			c.JSON(400, gin.H{"error": "Invalid request body, expected an array of users"})
+			return
+		}
+	}
+
+	users := make([]*models.User, len(body))
+	for i, user := range body {
+		users[i] = user.ToUser()
+	}
+
+	results, err := services.CreateUsersBulk(c.Request.Context(), users)
+	if err != nil {
+		if errors.Is(err, services.ErrBulkTooLarge) {
+			c.JSON(413, gin.H{"error": "Too many users in one request"})
+			return
+		}
+		if errors.Is(err, services.ErrPasswordHashingBusy) {
+			c.Header("Retry-After", "1")
+			c.JSON(503, apierrors.ServerBusy.Body("Server busy, please try again"))
+			return
+		}
+		if errors.Is(err, repository.ErrConstraintViolation) {
+			c.JSON(400, gin.H{"error": "Invalid role or status value"})
+			return
+		}
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(409, apierrors.Conflict.Body("An email of the request is already taken, no user was created"))
+			return
+		}
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	created := 0
+	mapped := make([]dto.BulkUserResult, len(results))
+	for i, result := range results {
+		if result.User != nil {
+			created++
+		}
+		mapped[i] = dto.BulkUserResult{Index: result.Index, User: dto.FromUser(result.User), Error: result.Error}
+	}
+	c.JSON(200, gin.H{"results": mapped, "created": created, "failed": len(results) - created})
+}
+
+// importing users from the CSV file of the multipart upload (file field)
+func ImportUsers(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "A CSV file must be uploaded in the file field"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer file.Close()
+
+	report, err := services.ImportUsersCSV(c.Request.Context(), file)
+	if err != nil {
+		middleware.Logger.Printf("Error importing users: %s", err)
+		if errors.Is(err, services.ErrInvalidCSV) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"report": report})
+}
+
+// exporting the users matching the filter as a csv or xlsx download, streamed from the database
+func ExportUsers(c *gin.Context) {
+	format := c.DefaultQuery("format", services.ExportCSV)
+	contentType, ok := services.ExportContentTypes[format]
+	if !ok {
+		c.JSON(400, gin.H{"error": services.ErrUnknownExportFormat.Error()})
+		return
+	}
+	filter, ok := parseUserFilter(c)
+	if !ok {
+		return
+	}
+	if err := repository.ValidateUserSort(filter.Sort); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := services.ExportUsers(c.Request.Context(), c.Writer, format, filter); err != nil {
+		// the download is cut short, the status is sent
+		c.Error(err)
+	}
+}
+
 // user login
 func Login(c *gin.Context) {
-	var body models.User
+	var body dto.LoginRequest
 
 	if err := c.ShouldBindJSON(&body); err != nil {
 		middleware.Logger.Printf("Error parsing request body: %s", err)
@@ -52,83 +230,532 @@ func Login(c *gin.Context) {
 	}
 
 	// Authenticate user using the services package
-	token, err := services.AuthenticateUser(&body)
+	tokens, err := services.AuthenticateUser(c.Request.Context(), &models.User{Username: body.Username, Password: body.Password}, body.RememberMe)
+	if errors.Is(err, services.ErrPasswordHashingBusy) {
+		c.Header("Retry-After", "1")
+		c.JSON(503, apierrors.ServerBusy.Body("Server busy, please try again"))
+		return
+	}
 	if err != nil {
 		c.JSON(401, gin.H{"error": "User not authenticated"})
 		return
 	}
+	middleware.LoginSucceeded(c)
+
+	// The password was right, the login completes at /login/otp with the code texted to the user
+	if tokens.OTPChallenge != "" {
+		c.JSON(200, gin.H{
+			"otp_required":  true,
+			"otp_challenge": tokens.OTPChallenge,
+			"expires_in":    tokens.ExpiresIn,
+		})
+		return
+	}
+
+	answerLogin(c, tokens, body.Cookie)
+}
+
+// refreshing the access token with a refresh token
+func RefreshToken(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+		c.JSON(400, gin.H{"error": "Refresh token must be provided"})
+		return
+	}
+
+	tokens, err := services.RefreshTokens(c.Request.Context(), body.RefreshToken)
+	if errors.Is(err, services.ErrRefreshTokenReused) {
+		c.JSON(401, gin.H{"error": "Refresh token already used, please log in again"})
+		return
+	}
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid refresh token"})
+		return
+	}
 
 	c.JSON(200, gin.H{
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
-// getting all users
+// logging out, revokes the current access token and the given refresh token
+func Logout(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// The body is optional
+	_ = c.ShouldBindJSON(&body)
+
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token claims not found in context"})
+		return
+	}
+
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid token claims in context"})
+		return
+	}
+
+	// Tokens bound to a session end the whole session
+	if sid, ok := mapClaims["sid"].(float64); ok {
+		user, _ := c.Get("user")
+		sessionID := strconv.FormatUint(uint64(sid), 10)
+		if _, err := services.RevokeUserSession(c.Request.Context(), user.(*models.User).ID, sessionID); err != nil {
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		if token := middleware.SessionCookie(c); token != "" {
+			_ = services.EndCookieSession(c.Request.Context(), token)
+			middleware.ClearSessionCookies(c)
+		}
+		c.JSON(200, gin.H{"message": "Logged out successfully"})
+		return
+	}
+
+	jti, _ := mapClaims["jti"].(string)
+	exp, _ := mapClaims["exp"].(float64)
+
+	if err := services.RevokeToken(c.Request.Context(), jti, time.Unix(int64(exp), 0), body.RefreshToken); err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Logged out successfully"})
+}
+
+// getting the users, a page at a time, filtered by ?role= and ?status= and sorted by ?sort=,
+// with the deleted ones when ?include_deleted=true; ?fields= keeps only the fields listed and
+// ?cursor= pages by cursor instead of ?page=
 func GetAllUsers(c *gin.Context) {
-	users, err := services.GetAllUsers()
+	page, perPage := parsePagination(c)
+
+	filter, ok := parseUserFilter(c)
+	if !ok {
+		return
+	}
+	if fields := c.Query("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				filter.Fields = append(filter.Fields, field)
+			}
+		}
+	}
+
+	if middleware.WantsNDJSON(c) {
+		streamUsers(c, filter)
+		return
+	}
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		usersAfterCursor(c, filter, cursor, perPage)
+		return
+	}
+
+	users, count, err := services.GetAllUsers(c.Request.Context(), filter, page, perPage)
 	if err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
 		c.JSON(500, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	c.JSON(200, gin.H{"users": users})
+	projected, err := services.ProjectUsers(users, filter.Fields)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(count.Total, 10))
+	c.JSON(200, gin.H{"users": projected, "total": count.Total, "total_exact": count.Exact, "page": page, "per_page": perPage})
+}
+
+// getting a page of the users after the cursor, the first one when it is empty, for the clients
+// paging deep into the listing: next_cursor is empty after the last page
+func usersAfterCursor(c *gin.Context, filter repository.UserFilter, cursor string, perPage int) {
+	users, next, err := services.GetUsersByCursor(c.Request.Context(), filter, cursor, perPage)
+	if err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			c.JSON(400, gin.H{"error": "Invalid cursor, it must come from a listing with the same sort"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	projected, err := services.ProjectUsers(users, filter.Fields)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"users": projected, "next_cursor": next, "per_page": perPage})
+}
+
+// parsing the ?role=, ?status=, ?phone_prefix=, ?sort= and ?include_deleted= filter of the users listings,
+// answering the request when they are invalid
+func parseUserFilter(c *gin.Context) (repository.UserFilter, bool) {
+	filter := repository.UserFilter{Sort: c.Query("sort")}
+	if c.Query("include_deleted") == "true" {
+		// the deleted users are listed to those who can delete users
+		user, _ := c.Get("user")
+		allowed, err := middleware.HasPermission(c.Request.Context(), user.(*models.User).Role, models.PermUsersDelete)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return filter, false
+		}
+		if !allowed {
+			c.JSON(403, gin.H{"error": "Access denied."})
+			return filter, false
+		}
+		filter.IncludeDeleted = true
+	}
+	if role := c.Query("role"); role != "" {
+		parsed, err := models.ParseRole(role)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return filter, false
+		}
+		filter.Role = parsed
+	}
+	if status := c.Query("status"); status != "" {
+		parsed, err := models.ParseStatus(status)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return filter, false
+		}
+		filter.Status = parsed
+	}
+	if prefix := c.Query("phone_prefix"); prefix != "" {
+		normalized, err := services.NormalizePhonePrefix(prefix)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid phone_prefix, expected the start of an E.164 number, e.g. +44"})
+			return filter, false
+		}
+		filter.PhonePrefix = normalized
+	}
+	return filter, true
+}
+
+// streaming every user matching the filter as NDJSON, one line per user, as they are read
+// from the database; the pagination is ignored
+func streamUsers(c *gin.Context, filter repository.UserFilter) {
+	encoder := json.NewEncoder(c.Writer)
+	started := false
+	err := services.StreamUsers(c.Request.Context(), filter, func(users []*models.User) error {
+		if !started {
+			c.Header("Content-Type", middleware.NDJSONContentType)
+			c.Status(200)
+			started = true
+		}
+		for _, user := range users {
+			projected, err := services.ProjectUser(user, filter.Fields)
+			if err != nil {
+				return err
+			}
+			if err := encoder.Encode(projected); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err == nil && !started {
+		// no users, an empty stream
+		c.Header("Content-Type", middleware.NDJSONContentType)
+		c.Status(200)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	if err != nil && !started {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err != nil {
+		// the status is sent, the client sees the stream cut short
+		c.Error(err)
+	}
+}
+
+// getting the users seen within the presence window
+func GetOnlineUsers(c *gin.Context) {
+	users, err := services.GetOnlineUsers(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"users": dto.FromUsers(users)})
 }
 
 // getting one user by Id
 func GetUserByID(c *gin.Context) {
 	userID := c.Param("id")
+	if c.Query("as_of") != "" {
+		getUserAsOf(c, userID)
+		return
+	}
 
-	user, err := services.GetUserByID(userID)
+	user, err := services.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", user.ETag())
+	if middleware.NotModified(c, user.ETag()) {
+		c.Status(304)
+		return
+	}
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
+}
+
+// getting many users at once, by the comma separated ?ids= or, with POST, the ids of the body;
+// the IDs not found are listed as missing
+func GetUsersBatch(c *gin.Context) {
+	var ids []string
+	if c.Request.Method == http.MethodPost {
+		var body bulkUserIDs
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+		ids = body.IDs
+	} else {
+		for _, id := range strings.Split(c.Query("ids"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	for _, id := range ids {
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			c.JSON(400, apierrors.InvalidRequest.Body("ids must be user IDs, "+id+" isn't"))
+			return
+		}
+	}
+	if len(ids) == 0 {
+		c.JSON(400, gin.H{"error": "ids must list at least one user"})
+		return
+	}
+
+	users, missing, err := services.GetUsersByIDs(c.Request.Context(), ids)
+	if errors.Is(err, services.ErrBulkTooLarge) {
+		c.JSON(413, apierrors.PayloadTooLarge.Body("Too many users in one request"))
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Internal server error"})
 		return
 	}
 
+	c.JSON(200, gin.H{"users": dto.FromUsers(users), "missing": missing})
+}
+
+// getting a user as it was at the ?as_of= time, to those who can view the history of users
+func getUserAsOf(c *gin.Context, userID string) {
+	user, _ := c.Get("user")
+	allowed, err := middleware.HasPermission(c.Request.Context(), user.(*models.User).Role, models.PermUsersHistory)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !allowed {
+		c.JSON(403, apierrors.AccessDenied.Body("Access denied."))
+		return
+	}
+
+	asOf, err := time.Parse(time.RFC3339, c.Query("as_of"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid as_of time, expected RFC 3339"})
+		return
+	}
+	if asOf.After(time.Now()) {
+		c.JSON(400, gin.H{"error": "The as_of time must not be in the future"})
+		return
+	}
+
+	past, err := services.GetUserAsOf(c.Request.Context(), userID, asOf)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if past == nil {
+		c.JSON(404, gin.H{"error": "User not found at that time"})
+		return
+	}
+
+	c.JSON(200, dto.UserAsOf{User: dto.FromUser(past.User), AsOf: past.AsOf, ChangesUndone: past.ChangesUndone})
+}
+
+// getting a user by username; a former username, when resolved, answers with the user under
+// its current username and a Location to it, like a permanent redirect
+func GetUserByUsername(c *gin.Context) {
+	user, movedFrom, err := services.GetUserByUsername(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
 	if user == nil {
 		c.JSON(404, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(200, gin.H{"user": user})
+	c.Header("ETag", user.ETag())
+	if movedFrom != "" {
+		c.Header("Location", "/users/by-username/"+url.PathEscape(user.Username))
+		c.JSON(200, gin.H{"user": dto.FromUser(user), "moved_permanently": true, "former_username": movedFrom})
+		return
+	}
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
+}
+
+// getting the former usernames of a user
+func GetUsernameHistory(c *gin.Context) {
+	history, err := services.GetUsernameHistory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if history == nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"username_history": history})
 }
 
 // updating user
 func UpdateUserByID(c *gin.Context) {
 	userID := c.Param("id")
 
-	var body models.User
+	var body dto.UserRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
 		c.JSON(400, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	user, err := services.UpdateUserByID(userID, &body)
+	user, err := services.UpdateUserByID(c.Request.Context(), userID, body.ToUser())
+	respondUserUpdate(c, user, err)
+}
+
+// patching user with a JSON Merge Patch (RFC 7386): the members set change the fields, null
+// clears the email or the profile picture, the fields left out are kept
+func PatchUserByID(c *gin.Context) {
+	var document map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&document); err != nil {
+		c.JSON(400, gin.H{"error": "The body must be a JSON object"})
+		return
+	}
+
+	patch, err := services.ParseUserMergePatch(document)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Internal server error"})
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	if user == nil {
-		c.JSON(404, gin.H{"error": "User not found"})
+	user, err := services.PatchUserByID(c.Request.Context(), c.Param("id"), patch)
+	respondUserUpdate(c, user, err)
+}
+
+// respondValidationError answers the *services.ValidationError of a request with a 422 listing
+// the fields breaking the rules, false for the other errors
+func respondValidationError(c *gin.Context, err error) bool {
+	var validationErr *services.ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+	c.JSON(422, apierrors.From(validationErr).Envelope())
+	return true
+}
+
+// answering an update of a user with the user and its new ETag, or the error
+func respondUserUpdate(c *gin.Context, user *models.User, err error) {
+	if err != nil {
+		if respondApprovalRequired(c, err) {
+			return
+		}
+		var policyErr *services.PolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(422, gin.H{"error": policyErr.Reason})
+			return
+		}
+		if errors.Is(err, services.ErrPasswordHashingBusy) {
+			c.Header("Retry-After", "1")
+			c.JSON(503, apierrors.ServerBusy.Body("Server busy, please try again"))
+			return
+		}
+		if errors.Is(err, repository.ErrConstraintViolation) {
+			c.JSON(400, gin.H{"error": "Invalid role or status value"})
+			return
+		}
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(409, apierrors.Conflict.Body("The username or email is already taken"))
+			return
+		}
+		// not found, precondition failed, invalid values and internal errors
+		c.Error(err)
 		return
 	}
 
-	c.JSON(200, gin.H{"user": user})
+	c.Header("ETag", user.ETag())
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
 }
 
 // deleting user
 func DeleteUserByID(c *gin.Context) {
 	userID := c.Param("id")
 
-	err := services.DeleteUserByID(userID)
+	err := services.DeleteUserByID(c.Request.Context(), userID)
+	if respondApprovalRequired(c, err) {
+		return
+	}
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Internal server error"})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(200, gin.H{"message": "User deleted successfully"})
 }
 
+// restoring a deleted user
+func RestoreUserByID(c *gin.Context) {
+	user, err := services.RestoreUserByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if user == nil {
+		c.JSON(404, gin.H{"error": "Deleted user not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
+}
+
 // getting user profile only with token
 func GetUserProfile(c *gin.Context) {
 	// Extract the user from the context
@@ -145,13 +772,16 @@ func GetUserProfile(c *gin.Context) {
 		return
 	}
 
-	// Create a UserResponse struct without the password field
-	userResponse := utils.UserResponse{
+	// The short form of the user, without the password hash
+	services.ApplyOnline(c.Request.Context(), u)
+	userResponse := dto.UserSummary{
 		ID:       u.ID,
 		FullName: u.FullName,
 		Username: u.Username,
+		Email:    u.Email,
 		Status:   string(u.Status),
 		Role:     string(u.Role),
+		Online:   u.Online,
 	}
 
 	// Return the user's profile
@@ -173,7 +803,7 @@ func UploadProfilePicture(c *gin.Context) {
 	defer file.Close()
 
 	// Update the user's profile picture
-	user, err := services.UpdateUserProfilePicture(userID, fileHeader)
+	user, err := services.UpdateUserProfilePicture(c.Request.Context(), userID, fileHeader)
 	if err != nil {
 		log.Printf("Error updating user's profile picture: %s", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile picture"})
@@ -185,7 +815,7 @@ func UploadProfilePicture(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": dto.FromUser(user)})
 }
 
 // fetching profile pic
@@ -193,7 +823,7 @@ func GetProfilePicture(c *gin.Context) {
 	userID := c.Param("id")
 
 	// Retrieve the user's profile picture data using the services package
-	data, err := services.GetProfilePictureByID(userID)
+	data, err := services.GetProfilePictureByID(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to fetch profile picture"})
 		return
@@ -0,0 +1,99 @@
+// controllers/accountController.go
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// deactivating the authenticated user's account, it is deleted after the grace period unless the user logs in again
+func DeleteMyAccount(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	purgeAt, err := services.DeactivateAccount(c.Request.Context(), user.(*models.User))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":  "Account scheduled for deletion, log in again to keep it",
+		"purge_at": purgeAt,
+	})
+}
+
+// updating the authenticated user's own account: the full name and username, the password
+// having its own route; changing their role or status takes the users:update permission
+func UpdateMe(c *gin.Context) {
+	user, _ := c.Get("user")
+	me := user.(*models.User)
+
+	var body struct {
+		FullName *string        `json:"full_name"`
+		Username *string        `json:"username"`
+		Password *string        `json:"password"`
+		Status   *models.Status `json:"status"`
+		Role     *models.Role   `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if body.Password != nil {
+		c.JSON(400, gin.H{"error": "The password is changed with PUT /me/password"})
+		return
+	}
+	if (body.Status != nil && *body.Status != me.Status) || (body.Role != nil && *body.Role != me.Role) {
+		allowed, err := middleware.HasPermission(c.Request.Context(), me.Role, models.PermUsersUpdate)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		if !allowed {
+			c.JSON(403, apierrors.AccessDenied.Body("Changing your own role or status requires the users:update permission"))
+			return
+		}
+	}
+
+	updated, err := services.PatchUserByID(c.Request.Context(), strconv.FormatUint(uint64(me.ID), 10), &services.UserPatch{
+		FullName: body.FullName,
+		Username: body.Username,
+		Status:   body.Status,
+		Role:     body.Role,
+	})
+	respondUserUpdate(c, updated, err)
+}
+
+// getting the authenticated user's own profile picture
+func GetMyAvatar(c *gin.Context) {
+	user, _ := c.Get("user")
+	me := user.(*models.User)
+	if me.ProfilePicture == "" {
+		c.JSON(404, gin.H{"error": "Profile picture not found"})
+		return
+	}
+
+	data, err := services.GetProfilePictureByID(c.Request.Context(), strconv.FormatUint(uint64(me.ID), 10))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch profile picture"})
+		return
+	}
+	if data == nil {
+		c.JSON(404, gin.H{"error": "Profile picture not found"})
+		return
+	}
+
+	c.Data(200, http.DetectContentType(data), data)
+}
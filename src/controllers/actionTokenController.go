@@ -0,0 +1,60 @@
+// controllers/actionTokenController.go
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// minting a short-lived token granting a single action
+func CreateActionToken(c *gin.Context) {
+	var body struct {
+		Action     string `json:"action"`
+		Resource   string `json:"resource"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	token, err := services.MintActionToken(c.Request.Context(), user.(*models.User), body.Action, body.Resource, time.Duration(body.TTLSeconds)*time.Second)
+	if errors.Is(err, services.ErrUnknownAction) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrActionForbidden) {
+		c.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(201, gin.H{"token": token.Token, "expires_at": token.ExpiresAt})
+}
+
+// downloading a stored report with an action token
+func DownloadReport(c *gin.Context) {
+	data, err := services.GetStoredReport(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if data == nil {
+		c.JSON(404, gin.H{"error": "Report not found"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", c.Param("name")))
+	c.Data(200, "text/csv", data)
+}
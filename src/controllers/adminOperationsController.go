@@ -0,0 +1,82 @@
+// controllers/adminOperationsController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// the users of a bulk operation, by ID
+type bulkUserIDs struct {
+	IDs []string `json:"ids"`
+}
+
+// answering the report of an operation, or its error
+func respondOperation(c *gin.Context, report *services.OperationReport, err error) {
+	if err != nil {
+		if respondApprovalRequired(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrBulkTooLarge) {
+			c.JSON(413, apierrors.PayloadTooLarge.Body("Too many users in one request"))
+			return
+		}
+		// a role the user lacks the permissions of, and internal errors
+		c.Error(err)
+		return
+	}
+	c.JSON(200, report)
+}
+
+// soft deleting users in bulk; with ?dry_run=true nothing is deleted, the answer lists what would be
+func DeleteUsersBulk(c *gin.Context) {
+	var body bulkUserIDs
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.IDs) == 0 {
+		c.JSON(400, gin.H{"error": "ids must list at least one user"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	report, err := services.DeleteUsersBulk(c.Request.Context(), user.(*models.User), body.IDs, c.Query("dry_run") == "true")
+	respondOperation(c, report, err)
+}
+
+// changing the role of users in bulk; with ?dry_run=true nothing is changed, the answer lists what would be
+func ChangeRoleBulk(c *gin.Context) {
+	var body struct {
+		bulkUserIDs
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.IDs) == 0 {
+		c.JSON(400, gin.H{"error": "ids must list at least one user"})
+		return
+	}
+	role, err := models.ParseRole(body.Role)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, _ := c.Get("user")
+	report, err := services.ChangeRoleBulk(c.Request.Context(), user.(*models.User), body.IDs, role, c.Query("dry_run") == "true")
+	respondOperation(c, report, err)
+}
+
+// erasing a user and its records for a GDPR request; with ?dry_run=true nothing is deleted,
+// the answer counts the records that would be
+func EraseUser(c *gin.Context) {
+	report, err := services.EraseUser(c.Request.Context(), c.Param("id"), c.Query("dry_run") == "true")
+	if errors.Is(err, services.ErrLegalHold) {
+		c.JSON(409, apierrors.Conflict.Body("The user is under legal hold and can't be erased"))
+		return
+	}
+	if err == nil && report == nil {
+		c.JSON(404, apierrors.NotFound.Body("User not found"))
+		return
+	}
+	respondOperation(c, report, err)
+}
@@ -0,0 +1,64 @@
+// controllers/apiKeyController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// minting an api key, the plain key is only shown in this response
+func CreateAPIKey(c *gin.Context) {
+	var body struct {
+		Name   string   `json:"name"`
+		UserID uint     `json:"user_id"`
+		Scopes []string `json:"scopes"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	admin, _ := c.Get("user")
+	key, plainKey, err := services.CreateAPIKey(c.Request.Context(), body.Name, body.UserID, body.Scopes, admin.(*models.User))
+	if errors.Is(err, services.ErrInvalidAPIKeyRequest) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(201, gin.H{"api_key": key, "key": plainKey})
+}
+
+// getting all api keys
+func GetAllAPIKeys(c *gin.Context) {
+	keys, err := services.GetAllAPIKeys(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"api_keys": keys})
+}
+
+// revoking an api key
+func RevokeAPIKey(c *gin.Context) {
+	key, err := services.RevokeAPIKey(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if key == nil {
+		c.JSON(404, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"api_key": key})
+}
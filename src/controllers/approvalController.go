@@ -0,0 +1,68 @@
+// controllers/approvalController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// answering a 202 with the approval when the action was held for one, false otherwise
+func respondApprovalRequired(c *gin.Context, err error) bool {
+	var held *services.ApprovalRequiredError
+	if !errors.As(err, &held) {
+		return false
+	}
+	c.JSON(202, gin.H{"message": "The action awaits the approval of another admin", "approval": held.Approval})
+	return true
+}
+
+// getting the approvals, ?status= pending, approved, failed, rejected or expired
+func GetApprovals(c *gin.Context) {
+	page, perPage := parsePagination(c)
+
+	approvals, total, err := services.GetApprovals(c.Request.Context(), c.Query("status"), page, perPage)
+	if errors.Is(err, services.ErrInvalidApprovalStatus) {
+		c.JSON(400, gin.H{"error": "Status must be pending, approved, failed, rejected or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"approvals": approvals, "total": total, "page": page, "per_page": perPage})
+}
+
+// approving an action requested by another admin, which runs it
+func ApproveAction(c *gin.Context) {
+	user, _ := c.Get("user")
+	approval, err := services.ApproveAction(c.Request.Context(), user.(*models.User), c.Param("id"))
+	respondApprovalDecision(c, approval, err)
+}
+
+// rejecting an action held for an approval
+func RejectAction(c *gin.Context) {
+	user, _ := c.Get("user")
+	approval, err := services.RejectAction(c.Request.Context(), user.(*models.User), c.Param("id"))
+	respondApprovalDecision(c, approval, err)
+}
+
+// answering the decided approval, or the error
+func respondApprovalDecision(c *gin.Context, approval *models.Approval, err error) {
+	switch {
+	case errors.Is(err, services.ErrSelfApproval):
+		c.JSON(403, apierrors.AccessDenied.Body(err.Error()))
+	case errors.Is(err, services.ErrApprovalNotPending):
+		c.JSON(409, apierrors.Conflict.Body("The approval was already decided or has expired"))
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Internal server error"})
+	case approval == nil:
+		c.JSON(404, apierrors.NotFound.Body("Approval not found"))
+	default:
+		c.JSON(200, gin.H{"approval": approval})
+	}
+}
@@ -0,0 +1,79 @@
+// controllers/authCheckController.go
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// the most checks of one request
+const maxAuthChecks = 100
+
+type authCheck struct {
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+}
+
+type authCheckResult struct {
+	Action     string `json:"action"`
+	Resource   string `json:"resource"`
+	Permission string `json:"permission"`
+	Allowed    bool   `json:"allowed"`
+}
+
+// checking in one request which actions the caller may take, for the frontends to show only
+// what is allowed: the permission of a pair is resource:action (users:delete), or the resource
+// alone without an action (search). An API key also needs the scope of the action, read for
+// the read action and write for the others.
+func CheckPermissions(c *gin.Context) {
+	var body struct {
+		Checks []authCheck `json:"checks"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(body.Checks) > maxAuthChecks {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("At most %d checks can be made at once", maxAuthChecks)})
+		return
+	}
+
+	user, _ := c.Get("user")
+	role := user.(*models.User).Role
+	var apiKey *models.APIKey
+	if key, ok := c.Get("apiKey"); ok {
+		apiKey = key.(*models.APIKey)
+	}
+
+	results := make([]authCheckResult, len(body.Checks))
+	for i, check := range body.Checks {
+		if check.Resource == "" {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Check %d has no resource", i)})
+			return
+		}
+
+		permission := check.Resource
+		if check.Action != "" {
+			permission += ":" + check.Action
+		}
+		allowed, err := middleware.HasPermission(c.Request.Context(), role, permission)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		if allowed && apiKey != nil {
+			scope := models.ScopeWrite
+			if check.Action == "read" {
+				scope = models.ScopeRead
+			}
+			allowed = apiKey.HasScope(scope)
+		}
+
+		results[i] = authCheckResult{Action: check.Action, Resource: check.Resource, Permission: permission, Allowed: allowed}
+	}
+
+	c.JSON(200, gin.H{"results": results})
+}
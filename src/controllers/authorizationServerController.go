@@ -0,0 +1,159 @@
+// controllers/authorizationServerController.go
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// authorization endpoint, redirecting the signed in user back to the client with a code
+func OAuthAuthorize(c *gin.Context) {
+	req := &services.AuthorizeRequest{
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		ResponseType:        c.Query("response_type"),
+		State:               c.Query("state"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	}
+
+	client, err := services.ValidateAuthorizeRequest(c.Request.Context(), req)
+	var oauthErr *services.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.JSON(400, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "server_error"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	c.Redirect(http.StatusFound, services.Authorize(c.Request.Context(), user.(*models.User), client, req))
+}
+
+// token endpoint, exchanging an authorization code or a refresh token for tokens
+func OAuthToken(c *gin.Context) {
+	req := &services.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		ClientID:     c.PostForm("client_id"),
+		ClientSecret: c.PostForm("client_secret"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		CodeVerifier: c.PostForm("code_verifier"),
+		RefreshToken: c.PostForm("refresh_token"),
+	}
+	// confidential clients may authenticate with HTTP basic auth
+	if clientID, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = clientID, secret
+	}
+
+	c.Header("Cache-Control", "no-store")
+
+	tokens, err := services.ExchangeToken(c.Request.Context(), req)
+	var oauthErr *services.OAuthError
+	if errors.As(err, &oauthErr) {
+		status := 400
+		if oauthErr.Code == "invalid_client" {
+			status = 401
+		}
+		c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"access_token":  tokens.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    tokens.ExpiresIn,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
+
+// introspection endpoint, telling a confidential client whether an access token is active
+func OAuthIntrospect(c *gin.Context) {
+	clientID, secret := c.PostForm("client_id"), c.PostForm("client_secret")
+	if basicID, basicSecret, ok := c.Request.BasicAuth(); ok {
+		clientID, secret = basicID, basicSecret
+	}
+
+	c.Header("Cache-Control", "no-store")
+
+	introspection, err := services.IntrospectToken(c.Request.Context(), clientID, secret, c.PostForm("token"))
+	var oauthErr *services.OAuthError
+	if errors.As(err, &oauthErr) {
+		status := 400
+		if oauthErr.Code == "invalid_client" {
+			status = 401
+		}
+		c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(200, introspection)
+}
+
+// registering an oauth client, the secret is only shown in this response
+func CreateOAuthClient(c *gin.Context) {
+	var body struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+		Trusted      bool     `json:"trusted"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	client, secret, err := services.CreateOAuthClient(c.Request.Context(), body.Name, body.RedirectURIs, body.Confidential, body.Trusted)
+	if errors.Is(err, services.ErrInvalidOAuthClient) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(201, gin.H{"client": client, "client_secret": secret})
+}
+
+// getting all oauth clients
+func GetAllOAuthClients(c *gin.Context) {
+	clients, err := services.GetAllOAuthClients(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"clients": clients})
+}
+
+// revoking an oauth client
+func RevokeOAuthClient(c *gin.Context) {
+	client, err := services.RevokeOAuthClient(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if client == nil {
+		c.JSON(404, gin.H{"error": "OAuth client not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"client": client})
+}
@@ -0,0 +1,45 @@
+// controllers/bootstrapController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// bringing the environment to the bootstrap document of the body, answering the changes
+// applied; with ?dry_run=true nothing is saved, the answer lists what would be
+func Bootstrap(c *gin.Context) {
+	var doc services.BootstrapDocument
+	if err := c.ShouldBindJSON(&doc); err != nil {
+		c.JSON(400, apierrors.InvalidRequest.Body("The body must be a bootstrap document"))
+		return
+	}
+
+	report, err := services.ApplyBootstrap(c.Request.Context(), &doc, c.Query("dry_run") == "true")
+	if err != nil {
+		if respondValidationError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidBootstrap) {
+			c.JSON(400, apierrors.InvalidRequest.Body(err.Error()))
+			return
+		}
+		var policyErr *services.PolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(422, gin.H{"error": policyErr.Reason})
+			return
+		}
+		if report != nil {
+			// some changes were applied, the document can be applied again
+			c.JSON(500, gin.H{"error": "Internal server error", "report": report})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, report)
+}
@@ -0,0 +1,118 @@
+// controllers/broadcastController.go
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// queueing a message to every active user or the users of some roles, right away or at send_at
+func CreateBroadcast(c *gin.Context) {
+	var body struct {
+		Subject  string     `json:"subject"`
+		Body     string     `json:"body"`
+		Priority string     `json:"priority"`
+		Roles    []string   `json:"roles"`
+		SendAt   *time.Time `json:"send_at"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	admin, _ := c.Get("user")
+	request := &services.BroadcastRequest{
+		Subject:  body.Subject,
+		Body:     body.Body,
+		Priority: body.Priority,
+		Roles:    body.Roles,
+		SendAt:   body.SendAt,
+	}
+	broadcast, err := services.CreateBroadcast(c.Request.Context(), request, admin.(*models.User))
+	if errors.Is(err, services.ErrInvalidBroadcast) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(202, gin.H{"broadcast": broadcast})
+}
+
+// counting the users a broadcast to the roles would reach
+func PreviewBroadcast(c *gin.Context) {
+	var body struct {
+		Roles []string `json:"roles"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	recipients, err := services.PreviewBroadcast(c.Request.Context(), body.Roles)
+	if errors.Is(err, services.ErrInvalidBroadcast) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"recipients": recipients})
+}
+
+// getting all broadcasts (paginated)
+func GetAllBroadcasts(c *gin.Context) {
+	page, perPage := parsePagination(c)
+
+	broadcasts, total, err := services.GetAllBroadcasts(c.Request.Context(), page, perPage)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"broadcasts": broadcasts, "total": total, "page": page, "per_page": perPage})
+}
+
+// getting a broadcast with its delivery statistics
+func GetBroadcast(c *gin.Context) {
+	broadcast, reads, err := services.GetBroadcast(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if broadcast == nil {
+		c.JSON(404, gin.H{"error": "Broadcast not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"broadcast": broadcast, "read": reads})
+}
+
+// canceling a scheduled broadcast
+func CancelBroadcast(c *gin.Context) {
+	broadcast, err := services.CancelBroadcast(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, services.ErrBroadcastNotScheduled) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if broadcast == nil {
+		c.JSON(404, gin.H{"error": "Broadcast not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"broadcast": broadcast})
+}
@@ -0,0 +1,34 @@
+// controllers/cookieSession.go
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// answerLogin answers a completed login with the tokens, or with the session cookie when the
+// client asked for it and cookie sessions are enabled. The CSRF token is in the body and in
+// the csrf_token cookie, to send back in the X-CSRF-Token header.
+func answerLogin(c *gin.Context, tokens *services.AuthTokens, useCookie bool) {
+	if !useCookie || !middleware.CookieSessionsEnabled() {
+		c.JSON(200, gin.H{
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_in":    tokens.ExpiresIn,
+		})
+		return
+	}
+
+	session, err := services.StartCookieSession(c.Request.Context(), tokens)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	middleware.SetSessionCookies(c, session.Token, session.CSRFToken, int(session.ExpiresIn))
+	c.JSON(200, gin.H{
+		"csrf_token": session.CSRFToken,
+		"expires_in": session.ExpiresIn,
+	})
+}
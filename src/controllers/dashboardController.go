@@ -0,0 +1,18 @@
+// controllers/dashboardController.go
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// getting the widgets of the admin dashboard in one call
+func GetAdminDashboard(c *gin.Context) {
+	dashboard, err := services.GetDashboard(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to build dashboard"})
+		return
+	}
+
+	c.JSON(200, gin.H{"dashboard": dashboard})
+}
@@ -0,0 +1,68 @@
+// controllers/deviceController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// registering the push token of one of the authenticated user's devices
+func RegisterMyDevice(c *gin.Context) {
+	var body struct {
+		Platform string `json:"platform"`
+		Token    string `json:"token"`
+		Name     string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, _ := c.Get("user")
+
+	device, err := services.RegisterDevice(c.Request.Context(), user.(*models.User), body.Platform, body.Token, body.Name)
+	if errors.Is(err, services.ErrInvalidDevice) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(201, gin.H{"device": device})
+}
+
+// listing the authenticated user's devices
+func GetMyDevices(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	devices, err := services.GetDevices(c.Request.Context(), user.(*models.User).ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"devices": devices})
+}
+
+// unregistering one of the authenticated user's devices
+func DeleteMyDevice(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	found, err := services.DeleteDevice(c.Request.Context(), user.(*models.User).ID, c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if !found {
+		c.JSON(404, gin.H{"error": "Device not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Device unregistered successfully"})
+}
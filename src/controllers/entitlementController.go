@@ -0,0 +1,81 @@
+// controllers/entitlementController.go
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// listing the feature grants, of one feature with ?feature=
+func GetEntitlements(c *gin.Context) {
+	entitlements, err := services.GetEntitlements(c.Request.Context(), c.Query("feature"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"entitlements": entitlements})
+}
+
+// granting a feature to a user or to a role, until expires_at when set
+func GrantEntitlement(c *gin.Context) {
+	var body struct {
+		Feature   string      `json:"feature"`
+		UserID    uint        `json:"user_id"`
+		Role      models.Role `json:"role"`
+		ExpiresAt *time.Time  `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	admin, _ := c.Get("user")
+	entitlement, err := services.GrantEntitlement(c.Request.Context(), body.Feature, body.UserID, body.Role, body.ExpiresAt, admin.(*models.User).ID)
+	if errors.Is(err, services.ErrInvalidEntitlement) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(201, gin.H{"entitlement": entitlement})
+}
+
+// revoking a feature grant
+func RevokeEntitlement(c *gin.Context) {
+	deleted, err := services.RevokeEntitlement(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !deleted {
+		c.JSON(404, gin.H{"error": "Entitlement not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Entitlement revoked"})
+}
+
+// listing the features the authenticated user is entitled to
+func GetMyFeatures(c *gin.Context) {
+	user, _ := c.Get("user")
+	features, err := services.GetUserFeatures(c.Request.Context(), user.(*models.User))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"features": features})
+}
@@ -0,0 +1,37 @@
+// controllers/fallbackController.go
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+)
+
+// answering unknown routes with a JSON error instead of the plain-text default
+func NotFound(c *gin.Context) {
+	body := apierrors.RouteNotFound.Body("Route not found")
+	body["path"] = c.Request.URL.Path
+	c.JSON(http.StatusNotFound, body)
+}
+
+// answering routes that exist with another method, the router sets the Allow header
+func MethodNotAllowed(c *gin.Context) {
+	var allowed []string
+	for _, method := range strings.Split(c.Writer.Header().Get("Allow"), ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			allowed = append(allowed, method)
+		}
+	}
+
+	body := apierrors.MethodNotAllowed.Body("Method not allowed")
+	body["method"] = c.Request.Method
+	body["allowed_methods"] = allowed
+	c.JSON(http.StatusMethodNotAllowed, body)
+}
+
+// listing the error codes the API can answer with, for the client SDKs to map them
+func GetErrorCatalog(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"errors": apierrors.Catalog()})
+}
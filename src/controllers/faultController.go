@@ -0,0 +1,70 @@
+// controllers/faultController.go
+package controllers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+)
+
+// getting the faults being injected on this instance
+func GetFaults(c *gin.Context) {
+	c.JSON(200, gin.H{"faults": initializers.Faults(), "targets": initializers.FaultTargets})
+}
+
+// injecting a fault in a target (requests, mysql or redis) for a while, 5 minutes by default
+func SetFault(c *gin.Context) {
+	var body struct {
+		Percent  int    `json:"percent"`
+		Latency  string `json:"latency"`  // e.g. "500ms"
+		Error    bool   `json:"error"`    // fail the affected calls after the latency
+		Duration string `json:"duration"` // e.g. "10m"
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	fault := initializers.Fault{Target: c.Param("target"), Percent: body.Percent, Error: body.Error}
+	if body.Latency != "" {
+		latency, err := time.ParseDuration(body.Latency)
+		if err != nil || latency < 0 {
+			c.JSON(400, gin.H{"error": "Invalid latency, expected a duration such as 500ms"})
+			return
+		}
+		fault.Latency = latency
+	}
+	duration := 5 * time.Minute
+	if body.Duration != "" {
+		parsed, err := time.ParseDuration(body.Duration)
+		if err != nil || parsed <= 0 {
+			c.JSON(400, gin.H{"error": "Invalid duration, expected a duration such as 10m"})
+			return
+		}
+		duration = parsed
+	}
+	fault.ExpiresAt = time.Now().Add(duration)
+
+	if err := initializers.SetFault(fault); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.Logger.Printf("Injecting fault in %s: %d%% of the calls, latency %s, error %t, until %s",
+		fault.Target, fault.Percent, fault.Latency, fault.Error, fault.ExpiresAt.Format(time.RFC3339))
+	c.JSON(200, gin.H{"fault": fault})
+}
+
+// clearing the fault of a target
+func ClearFault(c *gin.Context) {
+	initializers.ClearFaults(c.Param("target"))
+	c.JSON(200, gin.H{"message": "Fault cleared"})
+}
+
+// clearing every fault
+func ClearFaults(c *gin.Context) {
+	initializers.ClearFaults("")
+	c.JSON(200, gin.H{"message": "Faults cleared"})
+}
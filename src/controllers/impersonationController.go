@@ -0,0 +1,38 @@
+// controllers/impersonationController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// minting a short-lived token acting as another user
+func ImpersonateUser(c *gin.Context) {
+	admin, _ := c.Get("user")
+
+	token, user, err := services.ImpersonateUser(c.Request.Context(), admin.(*models.User), c.Param("id"))
+	if errors.Is(err, services.ErrCannotImpersonate) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrImpersonationForbidden) {
+		c.JSON(403, apierrors.AccessDenied.Body("Impersonating this user would grant permissions you lack"))
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if user == nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(201, gin.H{"token": token.Token, "expires_at": token.ExpiresAt, "user": dto.FromUser(user)})
+}
@@ -0,0 +1,56 @@
+// controllers/inviteController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// creating an invite, the token is emailed and only shown in this response
+func CreateInvite(c *gin.Context) {
+	var body struct {
+		Email string      `json:"email"`
+		Role  models.Role `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if body.Role == "" {
+		body.Role = models.Operator
+	}
+
+	admin, _ := c.Get("user")
+	invite, token, err := services.CreateInvite(c.Request.Context(), body.Email, body.Role, admin.(*models.User))
+	if err != nil {
+		var enumErr *models.EnumError
+		if errors.Is(err, services.ErrInvalidInviteRequest) || errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(201, gin.H{"invite": invite, "token": token})
+}
+
+// listing the invites
+func GetAllInvites(c *gin.Context) {
+	invites, err := services.GetAllInvites(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"invites": invites})
+}
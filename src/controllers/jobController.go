@@ -0,0 +1,120 @@
+// controllers/jobController.go
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/scheduler"
+)
+
+// getting the job queue counts and the recent failures (?limit=, 20 by default)
+func GetJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 || limit > maxPerPage {
+		limit = defaultPerPage
+	}
+
+	ctx := c.Request.Context()
+	depth, err := jobs.QueueDepth(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching job queue depth: %s", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	dead, _, err := jobs.DeadJobs(ctx, "", limit, 0)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching dead jobs: %s", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	retrying, err := jobs.RetryingJobs(ctx, limit)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching jobs to retry: %s", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"queue": depth, "dead": dead, "retrying": retrying})
+}
+
+// retrying a failed job now
+func RetryJob(c *gin.Context) {
+	found, err := jobs.Retry(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		middleware.Logger.Printf("Error retrying job %s: %s", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !found {
+		c.JSON(404, gin.H{"error": "Failed job not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Job queued for retry"})
+}
+
+// listing the dead jobs, of the ?name= job only when set
+func GetDeadJobs(c *gin.Context) {
+	page, perPage := parsePagination(c)
+
+	dead, total, err := jobs.DeadJobs(c.Request.Context(), c.Query("name"), perPage, (page-1)*perPage)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching dead jobs: %s", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"jobs": dead, "total": total, "page": page, "per_page": perPage})
+}
+
+// getting a dead job with its payload
+func GetDeadJob(c *gin.Context) {
+	dead, err := jobs.GetDeadJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		middleware.Logger.Printf("Error fetching dead job %s: %s", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if dead == nil {
+		c.JSON(404, gin.H{"error": "Dead job not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"job": dead})
+}
+
+// retrying every dead job, of the ?name= job only when set
+func RetryDeadJobs(c *gin.Context) {
+	requeued, err := jobs.RetryDeadJobs(c.Request.Context(), c.Query("name"))
+	if err != nil {
+		middleware.Logger.Printf("Error retrying dead jobs: %s", err)
+		c.JSON(500, gin.H{"error": "Internal server error", "requeued": requeued})
+		return
+	}
+
+	c.JSON(200, gin.H{"requeued": requeued})
+}
+
+// discarding a dead job
+func DiscardDeadJob(c *gin.Context) {
+	found, err := jobs.DiscardDeadJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		middleware.Logger.Printf("Error discarding dead job %s: %s", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !found {
+		c.JSON(404, gin.H{"error": "Dead job not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Dead job discarded"})
+}
+
+// getting the scheduled jobs of this instance with their next and last runs
+func GetSchedules(c *gin.Context) {
+	c.JSON(200, gin.H{"schedules": scheduler.Schedules()})
+}
@@ -0,0 +1,32 @@
+// controllers/legalHoldController.go
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// placing a user under legal hold or lifting it
+func UpdateLegalHold(c *gin.Context) {
+	var body struct {
+		LegalHold *bool `json:"legal_hold"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.LegalHold == nil {
+		c.JSON(400, gin.H{"error": "legal_hold must be provided"})
+		return
+	}
+
+	user, err := services.SetLegalHold(c.Request.Context(), c.Param("id"), *body.LegalHold)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if user == nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
+}
@@ -0,0 +1,85 @@
+// controllers/loginEventController.go
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// parseLoginEventFilter reads the ?method=, ?outcome=, ?ip= and ?since=/?until= (RFC 3339) filters
+func parseLoginEventFilter(c *gin.Context) (repository.LoginEventFilter, bool) {
+	filter := repository.LoginEventFilter{
+		Method:  c.Query("method"),
+		Outcome: c.Query("outcome"),
+		IP:      c.Query("ip"),
+	}
+
+	if outcome := filter.Outcome; outcome != "" && outcome != models.LoginSucceeded && outcome != models.LoginFailed {
+		c.JSON(400, gin.H{"error": "Outcome must be success or failure"})
+		return filter, false
+	}
+
+	for param, value := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if c.Query(param) == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, c.Query(param))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid " + param + " time, expected RFC 3339"})
+			return filter, false
+		}
+		*value = parsed
+	}
+
+	return filter, true
+}
+
+func listLoginEvents(c *gin.Context, filter repository.LoginEventFilter) {
+	page, perPage := parsePagination(c)
+
+	events, total, err := services.GetLoginEvents(c.Request.Context(), filter, page, perPage)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"logins": events, "total": total, "page": page, "per_page": perPage})
+}
+
+// listing the authenticated user's login history, failed attempts included
+func GetMyLogins(c *gin.Context) {
+	filter, ok := parseLoginEventFilter(c)
+	if !ok {
+		return
+	}
+
+	user, _ := c.Get("user")
+	filter.UserID = user.(*models.User).ID
+
+	listLoginEvents(c, filter)
+}
+
+// listing the login history of all users, also filtered by ?user_id= and ?username=
+func GetLogins(c *gin.Context) {
+	filter, ok := parseLoginEventFilter(c)
+	if !ok {
+		return
+	}
+
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil || id == 0 {
+			c.JSON(400, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		filter.UserID = uint(id)
+	}
+	filter.Username = c.Query("username")
+
+	listLoginEvents(c, filter)
+}
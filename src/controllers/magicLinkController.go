@@ -0,0 +1,93 @@
+// controllers/magicLinkController.go
+package controllers
+
+import (
+	"errors"
+	"html/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// requesting a magic login link
+func RequestMagicLink(c *gin.Context) {
+	var body struct {
+		Username string `json:"username"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.Username == "" {
+		c.JSON(400, gin.H{"error": "Username must be provided"})
+		return
+	}
+
+	err := services.SendMagicLink(c.Request.Context(), body.Username)
+	if errors.Is(err, services.ErrMagicLinkNotConfigured) {
+		c.JSON(404, gin.H{"error": "Magic link login is not enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Same answer whether the user exists or not
+	c.JSON(200, gin.H{"message": "If the account exists, a login link has been sent"})
+}
+
+// the page the link opens: it only posts the token back, so the mail link scanners opening
+// the link neither consume the token nor receive the tokens of the login
+var magicLinkPage = template.Must(template.New("magic").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Log in</title></head>
+<body>
+<form method="post" action="/login/magic/verify">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+// rendering the confirmation page of a magic link, without consuming its token
+func MagicLinkPage(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Status(200)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := magicLinkPage.Execute(c.Writer, c.Query("token")); err != nil {
+		c.Error(err)
+	}
+}
+
+// exchanging a magic link token for the tokens of a normal login, the token posted as JSON
+// or by the form of the confirmation page
+func VerifyMagicLink(c *gin.Context) {
+	var body struct {
+		Token string `json:"token" form:"token"`
+	}
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	tokens, err := services.VerifyMagicLink(c.Request.Context(), body.Token)
+	if errors.Is(err, services.ErrInvalidMagicLink) {
+		c.JSON(401, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+	if errors.Is(err, services.ErrAccountInactive) {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
@@ -0,0 +1,12 @@
+// controllers/metricsController.go
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// getting the application counters (deprecated route usage...)
+func GetMetrics(c *gin.Context) {
+	c.JSON(200, gin.H{"metrics": metrics.Snapshot()})
+}
@@ -0,0 +1,79 @@
+// controllers/notificationController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// getting the authenticated user's notification preferences
+func GetMyNotificationPreferences(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	preference, err := services.GetNotificationPreference(c.Request.Context(), user.(*models.User).ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"preferences": preference})
+}
+
+// replacing the authenticated user's notification preferences
+func UpdateMyNotificationPreferences(c *gin.Context) {
+	var preference models.NotificationPreference
+	if err := c.ShouldBindJSON(&preference); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	preference.UserID = user.(*models.User).ID
+
+	err := services.UpdateNotificationPreference(c.Request.Context(), &preference)
+	if errors.Is(err, services.ErrInvalidPreference) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"preferences": preference})
+}
+
+// listing the authenticated user's in-app notifications
+func GetMyNotifications(c *gin.Context) {
+	user, _ := c.Get("user")
+	page, perPage := parsePagination(c)
+
+	notifications, total, err := services.GetInAppNotifications(c.Request.Context(), user.(*models.User).ID, page, perPage)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"notifications": notifications, "total": total, "page": page, "per_page": perPage})
+}
+
+// marking one of the authenticated user's notifications as read
+func ReadMyNotification(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	found, err := services.MarkNotificationRead(c.Request.Context(), user.(*models.User).ID, c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if !found {
+		c.JSON(404, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Notification marked as read"})
+}
@@ -0,0 +1,50 @@
+// controllers/oauthController.go
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// redirecting to the OAuth2 provider login page
+func OAuthLogin(c *gin.Context) {
+	url, err := services.OAuthLoginURL(c.Request.Context(), c.Param("provider"))
+	if errors.Is(err, services.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown OAuth provider"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+// handling the OAuth2 provider callback and logging the user in
+func OAuthCallback(c *gin.Context) {
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code and state must be provided"})
+		return
+	}
+
+	tokens, err := services.OAuthCallback(c.Request.Context(), c.Param("provider"), code, state)
+	if errors.Is(err, services.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown OAuth provider"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
@@ -0,0 +1,110 @@
+// controllers/passwordController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// requesting a password reset token
+func ForgotPassword(c *gin.Context) {
+	var body struct {
+		Username string `json:"username"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.Username == "" {
+		c.JSON(400, gin.H{"error": "Username must be provided"})
+		return
+	}
+
+	if err := services.ForgotPassword(c.Request.Context(), body.Username); err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Same answer whether the user exists or not
+	c.JSON(200, gin.H{"message": "If the account exists, a password reset token has been sent"})
+}
+
+// resetting the password with a reset token
+func ResetPassword(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.Token == "" || body.Password == "" {
+		c.JSON(400, gin.H{"error": "Token and password must be provided"})
+		return
+	}
+
+	err := services.ResetPassword(c.Request.Context(), body.Token, body.Password)
+	if errors.Is(err, services.ErrInvalidResetToken) {
+		c.JSON(400, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	var policyErr *services.PolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(422, gin.H{"error": policyErr.Reason})
+		return
+	}
+	if errors.Is(err, services.ErrPasswordHashingBusy) {
+		c.Header("Retry-After", "1")
+		c.JSON(503, apierrors.ServerBusy.Body("Server busy, please try again"))
+		return
+	}
+	if errors.Is(err, services.ErrPasswordLength) {
+		c.JSON(400, gin.H{"error": "Password must be between 8 and 15 characters"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Password has been reset"})
+}
+
+// changing the authenticated user's password, other sessions are signed out
+func ChangeMyPassword(c *gin.Context) {
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.CurrentPassword == "" || body.NewPassword == "" {
+		c.JSON(400, gin.H{"error": "Current and new password must be provided"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	err := services.ChangePassword(c.Request.Context(), user.(*models.User), currentSessionID(c), body.CurrentPassword, body.NewPassword)
+	if errors.Is(err, services.ErrWrongPassword) {
+		c.JSON(401, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	var policyErr *services.PolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(422, gin.H{"error": policyErr.Reason})
+		return
+	}
+	if errors.Is(err, services.ErrPasswordHashingBusy) {
+		c.Header("Retry-After", "1")
+		c.JSON(503, apierrors.ServerBusy.Body("Server busy, please try again"))
+		return
+	}
+	if errors.Is(err, services.ErrPasswordLength) {
+		c.JSON(400, gin.H{"error": "Password must be between 8 and 15 characters"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Password has been changed"})
+}
@@ -0,0 +1,70 @@
+// controllers/personalTokenController.go
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// creating a personal access token, the plain token is only shown in this response
+func CreateMyToken(c *gin.Context) {
+	var body struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	expiresIn := time.Duration(body.ExpiresInDays) * 24 * time.Hour
+	key, plainToken, err := services.CreatePersonalToken(c.Request.Context(), user.(*models.User), body.Name, body.Scopes, expiresIn)
+	if errors.Is(err, services.ErrInvalidAPIKeyRequest) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(201, gin.H{"personal_token": key, "token": plainToken})
+}
+
+// listing the authenticated user's personal access tokens
+func GetMyTokens(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	keys, err := services.GetPersonalTokens(c.Request.Context(), user.(*models.User).ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"personal_tokens": keys})
+}
+
+// revoking one of the authenticated user's personal access tokens
+func DeleteMyToken(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	key, err := services.RevokePersonalToken(c.Request.Context(), user.(*models.User).ID, c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if key == nil {
+		c.JSON(404, gin.H{"error": "Personal access token not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Personal access token revoked successfully"})
+}
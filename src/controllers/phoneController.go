@@ -0,0 +1,115 @@
+// controllers/phoneController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// texting a verification code to the phone number the user wants to use
+func StartMyPhoneVerification(c *gin.Context) {
+	var body struct {
+		Phone string `json:"phone"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, _ := c.Get("user")
+
+	err := services.StartPhoneVerification(c.Request.Context(), user.(*models.User), body.Phone)
+	if errors.Is(err, services.ErrInvalidPhone) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "A verification code has been sent"})
+}
+
+// confirming the phone number with the code texted to it
+func VerifyMyPhone(c *gin.Context) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Code == "" {
+		c.JSON(400, gin.H{"error": "Code must be provided"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	u := user.(*models.User)
+
+	err := services.VerifyPhone(c.Request.Context(), u, body.Code)
+	if errors.Is(err, services.ErrInvalidCode) {
+		c.JSON(400, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"phone": u.Phone, "phone_verified_at": u.PhoneVerifiedAt})
+}
+
+// enabling or disabling the SMS code as second login factor
+func UpdateMySMSOTP(c *gin.Context) {
+	var body struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, _ := c.Get("user")
+
+	err := services.SetSMSOTP(c.Request.Context(), user.(*models.User), body.Enabled)
+	if errors.Is(err, services.ErrPhoneNotVerified) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"sms_otp_enabled": body.Enabled})
+}
+
+// completing a login with the code texted to the user
+func VerifyLoginOTP(c *gin.Context) {
+	var body struct {
+		OTPChallenge string `json:"otp_challenge"`
+		Code         string `json:"code"`
+		Cookie       bool   `json:"cookie"` // session cookie instead of tokens, for browsers
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.OTPChallenge == "" || body.Code == "" {
+		c.JSON(400, gin.H{"error": "Challenge and code must be provided"})
+		return
+	}
+
+	tokens, err := services.VerifyLoginOTP(c.Request.Context(), body.OTPChallenge, body.Code)
+	if errors.Is(err, services.ErrInvalidCode) {
+		c.JSON(401, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+	if errors.Is(err, services.ErrAccountInactive) {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	answerLogin(c, tokens, body.Cookie)
+}
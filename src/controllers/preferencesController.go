@@ -0,0 +1,47 @@
+// controllers/preferencesController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// getting the authenticated user's preferences: theme, language and notification display
+func GetMyPreferences(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	preferences, err := services.GetUserPreferences(c.Request.Context(), user.(*models.User).ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"preferences": preferences})
+}
+
+// replacing the authenticated user's preferences
+func UpdateMyPreferences(c *gin.Context) {
+	var preferences models.UserPreferences
+	if err := c.ShouldBindJSON(&preferences); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	preferences.UserID = user.(*models.User).ID
+
+	err := services.UpdateUserPreferences(c.Request.Context(), &preferences)
+	if errors.Is(err, services.ErrInvalidUserPreferences) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"preferences": preferences})
+}
@@ -0,0 +1,50 @@
+// controllers/publicProfileController.go
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// getting the public profile of a user, without authentication
+func GetPublicProfile(c *gin.Context) {
+	profile, err := services.GetPublicProfile(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if profile == nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.Header("Cache-Control", publicCacheControl())
+	c.JSON(200, gin.H{"user": profile})
+}
+
+// getting the profile picture of a user for its public profile, without authentication
+func GetPublicAvatar(c *gin.Context) {
+	data, err := services.GetPublicAvatar(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch profile picture"})
+		return
+	}
+	if data == nil {
+		c.JSON(404, gin.H{"error": "Profile picture not found"})
+		return
+	}
+
+	c.Header("Cache-Control", publicCacheControl())
+	c.Data(200, http.DetectContentType(data), data)
+}
+
+// the public profiles may be cached by browsers and CDNs for PUBLIC_PROFILE_MAX_AGE (5m by default)
+func publicCacheControl() string {
+	maxAge := initializers.GetEnvDuration("PUBLIC_PROFILE_MAX_AGE", 5*time.Minute)
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+}
@@ -0,0 +1,44 @@
+// controllers/reportController.go
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// exporting the access review report as json or csv
+func GetAccessReviewReport(c *gin.Context) {
+	entries, err := services.BuildAccessReview(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(200, gin.H{"users": entries})
+		return
+	}
+
+	filename := fmt.Sprintf("access-review-%s.csv", time.Now().UTC().Format("20060102"))
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := services.WriteAccessReviewCSV(c.Writer, entries); err != nil {
+		middleware.Logger.Printf("Error writing access review report: %s", err)
+	}
+}
+
+// delivering the access review report by email or to the storage backend
+func DeliverAccessReviewReport(c *gin.Context) {
+	destination, err := services.DeliverAccessReview(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deliver access review report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"delivered_to": destination})
+}
@@ -0,0 +1,106 @@
+// controllers/roleController.go
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+type roleBody struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// roleError answers the errors of the role services, it reports false when there was none
+func roleError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrInvalidRole):
+		c.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRoleExists), errors.Is(err, services.ErrRoleInUse):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBuiltInRole):
+		c.JSON(403, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": "Internal server error"})
+	}
+	return true
+}
+
+// listing the permissions roles can grant
+func GetAllPermissions(c *gin.Context) {
+	permissions, err := services.GetAllPermissions(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"permissions": permissions})
+}
+
+// listing the roles with their permissions
+func GetAllRoles(c *gin.Context) {
+	roles, err := services.GetAllRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"roles": roles})
+}
+
+// defining a custom role
+func CreateRole(c *gin.Context) {
+	var body roleBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	role, err := services.CreateRole(c.Request.Context(), body.Name, body.Description, body.Permissions)
+	if roleError(c, err) {
+		return
+	}
+
+	c.JSON(201, gin.H{"role": role})
+}
+
+// replacing the description and permissions of a role
+func UpdateRole(c *gin.Context) {
+	var body roleBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	role, err := services.UpdateRole(c.Request.Context(), c.Param("name"), body.Description, body.Permissions)
+	if roleError(c, err) {
+		return
+	}
+
+	if role == nil {
+		c.JSON(404, gin.H{"error": "Role not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"role": role})
+}
+
+// deleting a custom role no user has
+func DeleteRole(c *gin.Context) {
+	role, err := services.DeleteRole(c.Request.Context(), c.Param("name"))
+	if roleError(c, err) {
+		return
+	}
+
+	if role == nil {
+		c.JSON(404, gin.H{"error": "Role not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Role deleted successfully"})
+}
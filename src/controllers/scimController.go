@@ -0,0 +1,330 @@
+// controllers/scimController.go
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+const (
+	scimUserSchema = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimListSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+)
+
+// scimUser is the SCIM representation of a user (RFC 7643), only the attributes mapped on
+// the users are kept.
+type scimUser struct {
+	Schemas     []string  `json:"schemas"`
+	ID          string    `json:"id,omitempty"`
+	UserName    string    `json:"userName"`
+	Name        *scimName `json:"name,omitempty"`
+	DisplayName string    `json:"displayName,omitempty"`
+	Active      *bool     `json:"active,omitempty"`
+	Meta        *scimMeta `json:"meta,omitempty"`
+}
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// fullName returns the full name of the SCIM user, the display name or the formatted name
+// or the given and family names.
+func (u *scimUser) fullName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name == nil {
+		return ""
+	}
+	if u.Name.Formatted != "" {
+		return u.Name.Formatted
+	}
+	return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+}
+
+func toSCIMUser(c *gin.Context, provisioned *services.ProvisionedUser) scimUser {
+	user := provisioned.User
+	id := strconv.FormatUint(uint64(user.ID), 10)
+	active := user.Status != models.Inactive
+
+	return scimUser{
+		Schemas:     []string{scimUserSchema},
+		ID:          id,
+		UserName:    provisioned.UserName,
+		Name:        &scimName{Formatted: user.FullName},
+		DisplayName: user.FullName,
+		Active:      &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     baseURL(c) + "/scim/v2/Users/" + id,
+		},
+	}
+}
+
+func baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+// provisioningError answers the errors of the provisioning services, it reports false when there was none
+func provisioningError(c *gin.Context, err error) bool {
+	var policyErr *services.PolicyError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrInvalidProvisioning), errors.As(err, &policyErr):
+		middleware.SCIMError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrAlreadyProvisioned):
+		middleware.SCIMError(c, http.StatusConflict, err.Error())
+	default:
+		middleware.SCIMError(c, http.StatusInternalServerError, "Internal server error")
+	}
+	return true
+}
+
+// provisioning a user from the identity provider
+func SCIMCreateUser(c *gin.Context) {
+	var body scimUser
+	if err := c.ShouldBindJSON(&body); err != nil {
+		middleware.SCIMError(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	active := body.Active == nil || *body.Active
+	provisioned, err := services.ProvisionUser(c.Request.Context(), body.UserName, body.fullName(), active)
+	if provisioningError(c, err) {
+		return
+	}
+
+	scimJSON(c, http.StatusCreated, toSCIMUser(c, provisioned))
+}
+
+// the filters identity providers use to find a user before provisioning it
+var scimFilterRegex = regexp.MustCompile(`^userName eq "((?:[^"\\]|\\.)*)"$`)
+
+// listing the provisioned users, filtered with userName eq "..." and paginated with startIndex and count
+func SCIMGetUsers(c *gin.Context) {
+	var userName string
+	if filter := strings.TrimSpace(c.Query("filter")); filter != "" {
+		match := scimFilterRegex.FindStringSubmatch(filter)
+		if match == nil {
+			middleware.SCIMError(c, http.StatusBadRequest, `Only the userName eq "value" filter is supported`)
+			return
+		}
+		if err := json.Unmarshal([]byte(`"`+match[1]+`"`), &userName); err != nil {
+			middleware.SCIMError(c, http.StatusBadRequest, "Invalid filter value")
+			return
+		}
+	}
+
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", "100"))
+	if err != nil || count < 0 || count > 100 {
+		count = 100
+	}
+
+	users, total, err := services.FindProvisionedUsers(c.Request.Context(), userName, startIndex-1, count)
+	if provisioningError(c, err) {
+		return
+	}
+
+	resources := make([]scimUser, len(users))
+	for i, user := range users {
+		resources[i] = toSCIMUser(c, user)
+	}
+
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
+
+// getting a provisioned user by ID
+func SCIMGetUser(c *gin.Context) {
+	provisioned, err := services.GetProvisionedUser(c.Request.Context(), c.Param("id"))
+	if provisioningError(c, err) {
+		return
+	}
+	if provisioned == nil {
+		middleware.SCIMError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	scimJSON(c, http.StatusOK, toSCIMUser(c, provisioned))
+}
+
+// replacing the attributes of a provisioned user
+func SCIMReplaceUser(c *gin.Context) {
+	var body scimUser
+	if err := c.ShouldBindJSON(&body); err != nil {
+		middleware.SCIMError(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	provisioned, err := services.GetProvisionedUser(c.Request.Context(), c.Param("id"))
+	if provisioningError(c, err) {
+		return
+	}
+	if provisioned == nil {
+		middleware.SCIMError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	fullName := body.fullName()
+	active := body.Active == nil || *body.Active
+	changes := services.ProvisioningChanges{UserName: &body.UserName, FullName: &fullName, Active: &active}
+	if provisioningError(c, services.UpdateProvisionedUser(c.Request.Context(), provisioned, changes)) {
+		return
+	}
+
+	scimJSON(c, http.StatusOK, toSCIMUser(c, provisioned))
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patching a provisioned user, e.g. {"op": "replace", "path": "active", "value": false} to deactivate it
+func SCIMPatchUser(c *gin.Context) {
+	var body struct {
+		Schemas    []string             `json:"schemas"`
+		Operations []scimPatchOperation `json:"Operations"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.Operations) == 0 {
+		middleware.SCIMError(c, http.StatusBadRequest, "Invalid patch request")
+		return
+	}
+
+	provisioned, err := services.GetProvisionedUser(c.Request.Context(), c.Param("id"))
+	if provisioningError(c, err) {
+		return
+	}
+	if provisioned == nil {
+		middleware.SCIMError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	var changes services.ProvisioningChanges
+	for _, operation := range body.Operations {
+		if err := applySCIMPatch(&changes, operation); err != nil {
+			middleware.SCIMError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if provisioningError(c, services.UpdateProvisionedUser(c.Request.Context(), provisioned, changes)) {
+		return
+	}
+
+	scimJSON(c, http.StatusOK, toSCIMUser(c, provisioned))
+}
+
+// applySCIMPatch collects the changes of an add or replace operation. Without path the value
+// holds the attributes, and Azure AD sends the booleans as strings ("False").
+func applySCIMPatch(changes *services.ProvisioningChanges, operation scimPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" {
+		return errors.New("only the add and replace operations are supported")
+	}
+
+	values := map[string]json.RawMessage{}
+	if operation.Path == "" {
+		if err := json.Unmarshal(operation.Value, &values); err != nil {
+			return errors.New("the value of an operation without path must be an object")
+		}
+	} else {
+		values[operation.Path] = operation.Value
+	}
+
+	for path, value := range values {
+		switch strings.ToLower(path) {
+		case "active":
+			var active bool
+			if err := json.Unmarshal(value, &active); err != nil {
+				var text string
+				if err := json.Unmarshal(value, &text); err != nil {
+					return errors.New("active must be a boolean")
+				}
+				if active, err = strconv.ParseBool(text); err != nil {
+					return errors.New("active must be a boolean")
+				}
+			}
+			changes.Active = &active
+		case "username", "displayname", "name.formatted":
+			var text string
+			if err := json.Unmarshal(value, &text); err != nil {
+				return errors.New(path + " must be a string")
+			}
+			if strings.ToLower(path) == "username" {
+				changes.UserName = &text
+			} else {
+				changes.FullName = &text
+			}
+		case "name":
+			var name scimName
+			if err := json.Unmarshal(value, &name); err != nil {
+				return errors.New("name must be an object")
+			}
+			fullName := (&scimUser{Name: &name}).fullName()
+			changes.FullName = &fullName
+		}
+		// the attributes not mapped on the users (emails, title...) are ignored
+	}
+
+	return nil
+}
+
+// deprovisioning a user, identity providers usually deactivate users first with a patch
+func SCIMDeleteUser(c *gin.Context) {
+	provisioned, err := services.GetProvisionedUser(c.Request.Context(), c.Param("id"))
+	if provisioningError(c, err) {
+		return
+	}
+	if provisioned == nil {
+		middleware.SCIMError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if provisioningError(c, services.DeprovisionUser(c.Request.Context(), provisioned)) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+// controllers/searchController.go
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// searching users, audit logs and active sessions for incident response
+func AdminSearch(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(400, gin.H{"error": "Search query must be provided"})
+		return
+	}
+
+	page, perPage := parsePagination(c)
+
+	groups, err := services.AdminSearch(c.Request.Context(), query, page, perPage)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"query": query, "results": groups})
+}
+
+// searching users by full name or username
+func AdminSearchUsers(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(400, gin.H{"error": "Search query must be provided"})
+		return
+	}
+
+	page, perPage := parsePagination(c)
+
+	group, err := services.SearchUsers(c.Request.Context(), query, page, perPage)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"query": query, "results": group})
+}
+
+// searching audit logs by action, target, ip or details
+func AdminSearchAuditLogs(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(400, gin.H{"error": "Search query must be provided"})
+		return
+	}
+
+	page, perPage := parsePagination(c)
+
+	group, err := services.SearchAuditLogs(c.Request.Context(), query, page, perPage)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"query": query, "results": group})
+}
+
+// searching users by full name or username, the best matches first
+func SearchUsers(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(400, gin.H{"error": "Search query must be provided"})
+		return
+	}
+
+	page, perPage := parsePagination(c)
+
+	group, err := services.SearchUsers(c.Request.Context(), query, page, perPage)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"users": group.Items, "total": group.Total, "total_exact": group.Exact, "page": page, "per_page": perPage})
+}
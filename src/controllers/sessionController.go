@@ -0,0 +1,50 @@
+// controllers/sessionController.go
+package controllers
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+// currentSessionID returns the session of the request token, 0 for API keys and tokens without session
+func currentSessionID(c *gin.Context) uint {
+	claims, ok := c.Get("claims")
+	if !ok {
+		return 0
+	}
+	sid, _ := claims.(jwt.MapClaims)["sid"].(float64)
+	return uint(sid)
+}
+
+// listing the authenticated user's active sessions
+func GetMySessions(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	sessions, err := services.GetUserSessions(c.Request.Context(), user.(*models.User).ID, currentSessionID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{"sessions": sessions})
+}
+
+// revoking one of the authenticated user's sessions
+func DeleteMySession(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	session, err := services.RevokeUserSession(c.Request.Context(), user.(*models.User).ID, c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if session == nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Session revoked successfully"})
+}
@@ -0,0 +1,89 @@
+// controllers/wellKnownController.go
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// serving /.well-known/security.txt (RFC 9116) from the SECURITY_* env variables
+func SecurityTxt(c *gin.Context) {
+	contacts := initializers.GetEnvList("SECURITY_CONTACT")
+	if len(contacts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	var b strings.Builder
+	for _, contact := range contacts {
+		b.WriteString("Contact: " + contact + "\n")
+	}
+
+	// Expires is required, default to one year from now when not configured
+	expires := initializers.GetEnv("SECURITY_EXPIRES", time.Now().AddDate(1, 0, 0).UTC().Format(time.RFC3339))
+	b.WriteString("Expires: " + expires + "\n")
+
+	optionalFields := []struct{ field, env string }{
+		{"Encryption", "SECURITY_ENCRYPTION_URL"},
+		{"Acknowledgments", "SECURITY_ACKNOWLEDGMENTS_URL"},
+		{"Preferred-Languages", "SECURITY_PREFERRED_LANGUAGES"},
+		{"Canonical", "SECURITY_CANONICAL_URL"},
+		{"Policy", "SECURITY_POLICY_URL"},
+		{"Hiring", "SECURITY_HIRING_URL"},
+	}
+	for _, f := range optionalFields {
+		if value := initializers.GetEnv(f.env, ""); value != "" {
+			b.WriteString(f.field + ": " + value + "\n")
+		}
+	}
+
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(b.String()))
+}
+
+// redirecting /.well-known/change-password to CHANGE_PASSWORD_URL so password managers find the page
+func ChangePasswordRedirect(c *gin.Context) {
+	url := initializers.GetEnv("CHANGE_PASSWORD_URL", "")
+	if url == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+// serving the public keys used to sign tokens, empty when tokens are signed with a shared HMAC secret
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": utils.JWKS()})
+}
+
+// serving the authorization server metadata (RFC 8414), the issuer is OAUTH_ISSUER or the requested host
+func OAuthServerMetadata(c *gin.Context) {
+	issuer := initializers.GetEnv("OAUTH_ISSUER", "")
+	if issuer == "" {
+		scheme := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		issuer = scheme + "://" + c.Request.Host
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
@@ -0,0 +1,107 @@
+// dto/user.go
+package dto
+
+import (
+	"time"
+
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// User is a user as the API returns it: the fields of models.User under the same JSON names,
+// the password hash left out.
+type User struct {
+	ID             uint          `json:"id"`
+	FullName       string        `json:"full_name"`
+	Username       string        `json:"username"`
+	Email          *string       `json:"email"`
+	Status         models.Status `json:"status"`
+	Role           models.Role   `json:"role"`
+	ProfilePicture string        `json:"profile_picture"`
+	LastLoginAt    *time.Time    `json:"last_login_at"`
+	LastSeenAt     *time.Time    `json:"last_seen_at"`
+	Online         bool          `json:"online"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	DeletedAt      *time.Time    `json:"deleted_at"`
+
+	Phone               string          `json:"phone"`
+	PhoneVerifiedAt     *time.Time      `json:"phone_verified_at"`
+	SMSOTPEnabled       bool            `json:"sms_otp_enabled"`
+	DeletionRequestedAt *time.Time      `json:"deletion_requested_at"`
+	LegalHold           bool            `json:"legal_hold"`
+	BreakGlass          bool            `json:"break_glass"`
+	Metadata            models.Metadata `json:"metadata"`
+}
+
+// FromUser maps the user to its response, nil for a nil user.
+func FromUser(u *models.User) *User {
+	if u == nil {
+		return nil
+	}
+	user := &User{
+		ID:                  u.ID,
+		FullName:            u.FullName,
+		Username:            u.Username,
+		Email:               u.Email,
+		Status:              u.Status,
+		Role:                u.Role,
+		ProfilePicture:      u.ProfilePicture,
+		LastLoginAt:         u.LastLoginAt,
+		LastSeenAt:          u.LastSeenAt,
+		Online:              u.Online,
+		CreatedAt:           u.CreatedAt,
+		UpdatedAt:           u.UpdatedAt,
+		Phone:               u.Phone,
+		PhoneVerifiedAt:     u.PhoneVerifiedAt,
+		SMSOTPEnabled:       u.SMSOTPEnabled,
+		DeletionRequestedAt: u.DeletionRequestedAt,
+		LegalHold:           u.LegalHold,
+		BreakGlass:          u.BreakGlass,
+		Metadata:            u.Metadata,
+	}
+	if u.DeletedAt.Valid {
+		deletedAt := u.DeletedAt.Time
+		user.DeletedAt = &deletedAt
+	}
+	return user
+}
+
+// ETag returns the weak entity tag of the user, the one the API sends in the ETag header, for
+// the If-Match of an update.
+func (u *User) ETag() string {
+	return (&models.User{ID: u.ID, UpdatedAt: u.UpdatedAt}).ETag()
+}
+
+// FromUsers maps the users to their responses.
+func FromUsers(users []*models.User) []*User {
+	mapped := make([]*User, len(users))
+	for i, u := range users {
+		mapped[i] = FromUser(u)
+	}
+	return mapped
+}
+
+// UserSummary is the short form of a user, in the search results and the profile of the token.
+type UserSummary struct {
+	ID       uint    `json:"id"`
+	FullName string  `json:"full_name"`
+	Username string  `json:"username"`
+	Email    *string `json:"email"`
+	Status   string  `json:"status"`
+	Role     string  `json:"role"`
+	Online   bool    `json:"online"`
+}
+
+// BulkUserResult is the outcome of one user of a bulk creation, in the order of the request.
+type BulkUserResult struct {
+	Index int    `json:"index"`
+	User  *User  `json:"user,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// UserAsOf is a user as it was at a point in time.
+type UserAsOf struct {
+	User          *User     `json:"user"`
+	AsOf          time.Time `json:"as_of"`
+	ChangesUndone int       `json:"changes_undone"`
+}
@@ -0,0 +1,64 @@
+// dto/userRequests.go
+package dto
+
+import "github.com/nabazesmail/gopher/src/models"
+
+// UserRequest is the body creating or updating a user, the fields a client may set; the
+// others (ID, legal hold, login times...) are only set by the service. The empty fields are
+// left out, an update keeps them. The validate tags are the rules of a creation, checked by
+// services.ValidateRequest; the username, email, phone, metadata, status and role rules are
+// registered by the services.
+type UserRequest struct {
+	FullName string          `json:"full_name,omitempty" validate:"required,max=255"`
+	Username string          `json:"username,omitempty" validate:"required,username"`
+	Email    *string         `json:"email,omitempty" validate:"omitempty,email_address"`
+	Phone    string          `json:"phone,omitempty" validate:"omitempty,phone"`
+	Password string          `json:"password,omitempty" validate:"required,min=8,max=15"`
+	Status   models.Status   `json:"status,omitempty" validate:"required,status"`
+	Role     models.Role     `json:"role,omitempty" validate:"required,role"`
+	Metadata models.Metadata `json:"metadata,omitempty" validate:"omitempty,metadata"`
+}
+
+// RequestFromUser returns the request with the fields of the user a client may set, to
+// validate a user the services received as a model.
+func RequestFromUser(u *models.User) *UserRequest {
+	return &UserRequest{
+		FullName: u.FullName,
+		Username: u.Username,
+		Email:    u.Email,
+		Phone:    u.Phone,
+		Password: u.Password,
+		Status:   u.Status,
+		Role:     u.Role,
+		Metadata: u.Metadata,
+	}
+}
+
+// ToUser maps the request to the user it creates or updates with.
+func (r *UserRequest) ToUser() *models.User {
+	return &models.User{
+		FullName: r.FullName,
+		Username: r.Username,
+		Email:    r.Email,
+		Phone:    r.Phone,
+		Password: r.Password,
+		Status:   r.Status,
+		Role:     r.Role,
+		Metadata: r.Metadata,
+	}
+}
+
+// CreateUserRequest is the body of a registration, with an invite when registration requires one.
+type CreateUserRequest struct {
+	UserRequest
+	InviteToken string `json:"invite_token,omitempty"`
+	Email       string `json:"email,omitempty"` // address the invite was sent to, the user's email
+}
+
+// LoginRequest is the body of a login with username and password.
+type LoginRequest struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	RememberMe bool   `json:"remember_me"` // long-lived refresh token
+	Cookie     bool   `json:"cookie"`      // session cookie instead of tokens, for browsers
+}
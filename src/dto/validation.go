@@ -0,0 +1,10 @@
+// dto/validation.go
+package dto
+
+// FieldError is a field of a request breaking a rule of its validate tag, in the fields of a
+// 422 answer.
+type FieldError struct {
+	Field   string `json:"field"`   // JSON name, e.g. full_name
+	Rule    string `json:"rule"`    // the rule of the tag, e.g. required, max or username
+	Message string `json:"message"` // for people to read
+}
@@ -0,0 +1,64 @@
+// golden/golden.go
+
+// Package golden compares the JSON the tests render with the golden files of the testdata/golden
+// directory of their package. go test -update rewrites the golden files from the current output,
+// the diff of the golden files is then the change of the contract to review.
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata/golden")
+
+// AssertJSON fails the test when the JSON of got differs from the golden file name.json.
+func AssertJSON(t testing.TB, name string, got interface{}) {
+	t.Helper()
+
+	// the HTML bodies are kept readable, < and > unescaped
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(got); err != nil {
+		t.Fatalf("encoding %s: %s", name, err)
+	}
+	data := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s (run go test -update to create it): %s", path, err)
+	}
+	if !bytes.Equal(want, data) {
+		t.Errorf("%s doesn't match the golden file %s (run go test -update when the change is intended)\ngot:\n%s\nwant:\n%s", name, path, data, want)
+	}
+}
+
+// DecodeJSON decodes a response body for AssertJSON, keeping the numbers as written.
+func DecodeJSON(t testing.TB, body []byte) interface{} {
+	t.Helper()
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		t.Fatalf("decoding %q: %s", body, err)
+	}
+	return document
+}
@@ -18,5 +18,25 @@ func ConnectToDB() {
 		log.Fatal("failed to connect to MySQL:", err)
 	}
 	log.Println("database connected!")
+
+	// Count the queries of every request for the query budget middleware
+	if err := registerQueryCounter(db); err != nil {
+		log.Fatal("failed to register query counter:", err)
+	}
+	// Fail or slow down the queries for resilience testing when FAULT_INJECTION_ENABLED is set
+	if FaultsEnabled() {
+		if err := registerFaultInjector(db); err != nil {
+			log.Fatal("failed to register fault injector:", err)
+		}
+	}
 	DB = db // Assign the DB instance to the exported variable
 }
+
+// CloseDB closes the connections of the database pool.
+func CloseDB() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
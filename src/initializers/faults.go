@@ -0,0 +1,155 @@
+package initializers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// the dependencies faults can be injected in
+const (
+	FaultRequests = "requests" // the HTTP requests, answered with a 503
+	FaultMySQL    = "mysql"
+	FaultRedis    = "redis"
+)
+
+// FaultTargets lists the targets of the injected faults.
+var FaultTargets = []string{FaultRequests, FaultMySQL, FaultRedis}
+
+// ErrInjectedFault is the error of the calls failed by the fault injector.
+var ErrInjectedFault = errors.New("injected fault")
+
+// Fault affects Percent of the calls to its target until ExpiresAt: they are delayed by
+// Latency, then fail when Error is set. The faults expire on their own, the admin routes
+// clearing them need MySQL and Redis too.
+type Fault struct {
+	Target    string        `json:"target"`
+	Percent   int           `json:"percent"`
+	Latency   time.Duration `json:"latency_ns"`
+	Error     bool          `json:"error"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+var (
+	faultsMu sync.RWMutex
+	faults   = map[string]Fault{}
+)
+
+// FaultsEnabled reports whether faults can be injected, for resilience testing in the
+// development and staging environments only: FAULT_INJECTION_ENABLED is ignored in release mode.
+func FaultsEnabled() bool {
+	return GetEnvBool("FAULT_INJECTION_ENABLED", false) && GetEnv("GIN_MODE", "debug") != "release"
+}
+
+// SetFault starts injecting the fault in its target on this instance, replacing the former one.
+func SetFault(fault Fault) error {
+	known := false
+	for _, target := range FaultTargets {
+		known = known || fault.Target == target
+	}
+	if !known {
+		return fmt.Errorf("unknown fault target %q", fault.Target)
+	}
+	if fault.Percent < 0 || fault.Percent > 100 {
+		return errors.New("fault percent must be between 0 and 100")
+	}
+
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	faults[fault.Target] = fault
+	return nil
+}
+
+// ClearFaults stops injecting faults in the target, in every target when empty.
+func ClearFaults(target string) {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	if target == "" {
+		faults = map[string]Fault{}
+		return
+	}
+	delete(faults, target)
+}
+
+// Faults returns the faults being injected.
+func Faults() []Fault {
+	faultsMu.RLock()
+	defer faultsMu.RUnlock()
+
+	active := []Fault{}
+	for _, target := range FaultTargets {
+		if fault, ok := faults[target]; ok && time.Now().Before(fault.ExpiresAt) {
+			active = append(active, fault)
+		}
+	}
+	return active
+}
+
+// InjectFault applies the fault of the target to the call, if any and drawn: it sleeps for
+// the latency and returns ErrInjectedFault when the call must fail.
+func InjectFault(target string) error {
+	faultsMu.RLock()
+	fault, ok := faults[target]
+	faultsMu.RUnlock()
+	if !ok || time.Now().After(fault.ExpiresAt) || rand.Intn(100) >= fault.Percent {
+		return nil
+	}
+
+	time.Sleep(fault.Latency)
+	if fault.Error {
+		return fmt.Errorf("%w: %s", ErrInjectedFault, target)
+	}
+	return nil
+}
+
+// registerFaultInjector adds gorm callbacks injecting the mysql faults before the statements run.
+func registerFaultInjector(db *gorm.DB) error {
+	inject := func(tx *gorm.DB) {
+		if err := InjectFault(FaultMySQL); err != nil {
+			tx.AddError(err)
+		}
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("app:inject_faults", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("app:inject_faults", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("app:inject_faults", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("app:inject_faults", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("app:inject_faults", inject); err != nil {
+		return err
+	}
+	return callbacks.Raw().Before("gorm:raw").Register("app:inject_faults", inject)
+}
+
+// redisFaultHook injects the redis faults before the commands are sent
+type redisFaultHook struct{}
+
+func (redisFaultHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, InjectFault(FaultRedis)
+}
+
+func (redisFaultHook) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (redisFaultHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, InjectFault(FaultRedis)
+}
+
+func (redisFaultHook) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
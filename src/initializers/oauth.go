@@ -0,0 +1,53 @@
+package initializers
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// OAuthProvider holds the OAuth2 configuration of a social login provider.
+type OAuthProvider struct {
+	Name        string
+	Config      *oauth2.Config
+	UserInfoURL string
+}
+
+// known providers and their endpoints, the credentials come from <NAME>_CLIENT_ID,
+// <NAME>_CLIENT_SECRET and <NAME>_REDIRECT_URL
+var oauthProviders = map[string]struct {
+	endpoint    oauth2.Endpoint
+	scopes      []string
+	userInfoURL string
+}{
+	"google": {endpoints.Google, []string{"openid", "profile", "email"}, "https://openidconnect.googleapis.com/v1/userinfo"},
+	"github": {endpoints.GitHub, []string{"read:user", "user:email"}, "https://api.github.com/user"},
+}
+
+// GetOAuthProvider returns the configured provider, or nil when it is unknown or has no client ID.
+func GetOAuthProvider(name string) *OAuthProvider {
+	provider, ok := oauthProviders[name]
+	if !ok {
+		return nil
+	}
+
+	prefix := strings.ToUpper(name) + "_"
+	clientID := os.Getenv(prefix + "CLIENT_ID")
+	if clientID == "" {
+		return nil
+	}
+
+	return &OAuthProvider{
+		Name: name,
+		Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Endpoint:     provider.endpoint,
+			Scopes:       provider.scopes,
+		},
+		UserInfoURL: provider.userInfoURL,
+	}
+}
@@ -0,0 +1,43 @@
+package initializers
+
+import (
+	"context"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+type queryCounterKey struct{}
+
+// WithQueryCounter returns a context that counts the database queries run with it.
+func WithQueryCounter(ctx context.Context) (context.Context, *int64) {
+	counter := new(int64)
+	return context.WithValue(ctx, queryCounterKey{}, counter), counter
+}
+
+// registerQueryCounter adds gorm callbacks incrementing the counter of the statement context.
+func registerQueryCounter(db *gorm.DB) error {
+	count := func(tx *gorm.DB) {
+		if counter, ok := tx.Statement.Context.Value(queryCounterKey{}).(*int64); ok {
+			atomic.AddInt64(counter, 1)
+		}
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("app:count_queries", count); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("app:count_queries", count); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("app:count_queries", count); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("app:count_queries", count); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("app:count_queries", count); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("app:count_queries", count)
+}
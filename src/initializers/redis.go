@@ -25,6 +25,11 @@ func InitRedis() {
 	if err != nil {
 		panic("Failed to connect to Redis: " + err.Error())
 	}
+
+	// Fail or slow down the commands for resilience testing when FAULT_INJECTION_ENABLED is set
+	if FaultsEnabled() {
+		RedisClient.AddHook(redisFaultHook{})
+	}
 }
 
 func ResetCache() {
@@ -39,3 +44,8 @@ func ResetCache() {
 
 	log.Printf("Cache reset: %s", result)
 }
+
+// CloseRedis closes the connections of the Redis client.
+func CloseRedis() error {
+	return RedisClient.Close()
+}
@@ -0,0 +1,177 @@
+// jobs/deadLetters.go
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/scheduler"
+)
+
+// DeadLetter is a dead job with its payload, for inspection.
+type DeadLetter struct {
+	Info
+	Payload json.RawMessage `json:"payload"`
+}
+
+// deadLetter is a dead job with its entry in the dead letter list, which removes it
+type deadLetter struct {
+	job
+	data string
+}
+
+// deadLetters returns the dead jobs named name (all of them when empty), most recent first
+func deadLetters(ctx context.Context, name string) ([]deadLetter, error) {
+	entries, err := initializers.RedisClient.LRange(ctx, deadKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var letters []deadLetter
+	for _, data := range entries {
+		var j job
+		if json.Unmarshal([]byte(data), &j) != nil || (name != "" && j.Name != name) {
+			continue
+		}
+		letters = append(letters, deadLetter{job: j, data: data})
+	}
+	return letters, nil
+}
+
+func findDeadLetter(ctx context.Context, id string) (*deadLetter, error) {
+	letters, err := deadLetters(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range letters {
+		if letters[i].ID == id {
+			return &letters[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// remove takes the dead job off the list, false when another request removed it first
+func (l *deadLetter) remove(ctx context.Context) (bool, error) {
+	removed, err := initializers.RedisClient.LRem(ctx, deadKey, 1, l.data).Result()
+	return removed > 0, err
+}
+
+// requeue removes the dead job and puts it back in the queue with its attempts back
+func (l *deadLetter) requeue(ctx context.Context) (bool, error) {
+	if removed, err := l.remove(ctx); !removed || err != nil {
+		return false, err
+	}
+	j := l.job
+	j.Attempts = 0
+	j.DeadAt = nil
+	return true, push(ctx, &j)
+}
+
+// DeadJobs returns a page of the dead jobs named name (all of them when empty), most recent
+// first, with their total.
+func DeadJobs(ctx context.Context, name string, limit, offset int) ([]Info, int, error) {
+	letters, err := deadLetters(ctx, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	infos := []Info{}
+	for i := offset; i < len(letters) && len(infos) < limit; i++ {
+		infos = append(infos, letters[i].info())
+	}
+	return infos, len(letters), nil
+}
+
+// GetDeadJob returns the dead job with the ID, nil when not found.
+func GetDeadJob(ctx context.Context, id string) (*DeadLetter, error) {
+	letter, err := findDeadLetter(ctx, id)
+	if err != nil || letter == nil {
+		return nil, err
+	}
+	return &DeadLetter{Info: letter.info(), Payload: letter.Payload}, nil
+}
+
+// RetryDeadJob puts the dead job with the ID back in the queue, reporting whether it was found.
+func RetryDeadJob(ctx context.Context, id string) (bool, error) {
+	letter, err := findDeadLetter(ctx, id)
+	if err != nil || letter == nil {
+		return false, err
+	}
+	return letter.requeue(ctx)
+}
+
+// RetryDeadJobs puts the dead jobs named name (all of them when empty) back in the queue, once
+// the downstream service they failed on is back. It returns the number of requeued jobs.
+func RetryDeadJobs(ctx context.Context, name string) (int, error) {
+	letters, err := deadLetters(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for i := range letters {
+		ok, err := letters[i].requeue(ctx)
+		if err != nil {
+			return requeued, err
+		}
+		if ok {
+			requeued++
+		}
+	}
+	return requeued, nil
+}
+
+// DiscardDeadJob deletes the dead job with the ID, reporting whether it was found.
+func DiscardDeadJob(ctx context.Context, id string) (bool, error) {
+	letter, err := findDeadLetter(ctx, id)
+	if err != nil || letter == nil {
+		return false, err
+	}
+	return letter.remove(ctx)
+}
+
+// ExpireDeadJobs deletes the jobs dead for longer than maxAge and returns their number. The
+// jobs dead before their time was recorded are kept.
+func ExpireDeadJobs(ctx context.Context, maxAge time.Duration) (int, error) {
+	letters, err := deadLetters(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	cutoff := time.Now().Add(-maxAge)
+	for i := range letters {
+		if letters[i].DeadAt == nil || letters[i].DeadAt.After(cutoff) {
+			continue
+		}
+		ok, err := letters[i].remove(ctx)
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// ScheduleDeadJobExpiry registers the expiry of the jobs dead for longer than JOB_DEAD_TTL
+// (7 days by default, 0 keeps them), checked every hour.
+func ScheduleDeadJobExpiry() {
+	ttl := initializers.GetEnvDuration("JOB_DEAD_TTL", 7*24*time.Hour)
+	if ttl <= 0 {
+		return
+	}
+
+	scheduler.Every("dead-job-expiry", time.Hour, func() error {
+		expired, err := ExpireDeadJobs(context.Background(), ttl)
+		if expired > 0 {
+			log.Printf("Expired %d dead jobs older than %s", expired, ttl)
+		}
+		return err
+	})
+}
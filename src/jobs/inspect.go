@@ -0,0 +1,99 @@
+// jobs/inspect.go
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+)
+
+// Depth counts the jobs of the queue: waiting for a worker, being processed, waiting for a
+// retry or their scheduled time, and dead letters.
+type Depth struct {
+	Pending  int64 `json:"pending"`
+	Active   int64 `json:"active"`
+	Retrying int64 `json:"retrying"`
+	Dead     int64 `json:"dead"`
+}
+
+// QueueDepth returns the depth of the queue.
+func QueueDepth(ctx context.Context) (Depth, error) {
+	pipe := initializers.RedisClient.Pipeline()
+	pending := pipe.LLen(ctx, queueKey)
+	active := pipe.HLen(ctx, activeKey)
+	retrying := pipe.ZCard(ctx, retryKey)
+	dead := pipe.LLen(ctx, deadKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Depth{}, err
+	}
+
+	return Depth{Pending: pending.Val(), Active: active.Val(), Retrying: retrying.Val(), Dead: dead.Val()}, nil
+}
+
+// Info describes a job that failed, RetryAt is set while it waits for its next attempt and
+// DeadAt once it was moved to the dead letter queue.
+type Info struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+	DeadAt    *time.Time `json:"dead_at,omitempty"`
+}
+
+func (j *job) info() Info {
+	return Info{ID: j.ID, Name: j.Name, Attempts: j.Attempts, LastError: j.LastError, DeadAt: j.DeadAt}
+}
+
+// RetryingJobs returns the next limit jobs waiting for a retry after a failure, the scheduled
+// jobs that never ran are left out.
+func RetryingJobs(ctx context.Context, limit int) ([]Info, error) {
+	entries, err := initializers.RedisClient.ZRangeWithScores(ctx, retryKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []Info{}
+	for _, entry := range entries {
+		var j job
+		if data, ok := entry.Member.(string); !ok || json.Unmarshal([]byte(data), &j) != nil || j.Attempts == 0 {
+			continue
+		}
+		info := j.info()
+		retryAt := time.Unix(int64(entry.Score), 0)
+		info.RetryAt = &retryAt
+		if infos = append(infos, info); len(infos) == limit {
+			break
+		}
+	}
+	return infos, nil
+}
+
+// Retry puts the failed job with the ID back in the queue right away: a dead job gets its
+// attempts back, a job waiting for a retry doesn't wait anymore. It reports whether the job
+// was found.
+func Retry(ctx context.Context, id string) (bool, error) {
+	if found, err := RetryDeadJob(ctx, id); found || err != nil {
+		return found, err
+	}
+
+	retrying, err := initializers.RedisClient.ZRange(ctx, retryKey, 0, -1).Result()
+	if err != nil {
+		return false, err
+	}
+	for _, data := range retrying {
+		var j job
+		if json.Unmarshal([]byte(data), &j) != nil || j.ID != id || j.Attempts == 0 {
+			continue
+		}
+		// only the request that removes the job requeues it
+		if removed, err := initializers.RedisClient.ZRem(ctx, retryKey, data).Result(); err != nil || removed == 0 {
+			return false, err
+		}
+		return true, initializers.RedisClient.LPush(ctx, queueKey, data).Err()
+	}
+
+	return false, nil
+}
@@ -0,0 +1,246 @@
+// jobs/jobs.go
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// Redis keys of the queue: pending jobs, jobs waiting for a retry or their scheduled
+// time (sorted by the time of their next attempt), jobs that failed too many times
+// (dead letters) and the jobs being processed by the workers (by ID).
+const (
+	queueKey  = "jobs:queue"
+	retryKey  = "jobs:retry"
+	deadKey   = "jobs:dead"
+	activeKey = "jobs:active"
+)
+
+// Handler processes the payload of a job, returning an error retries the job.
+type Handler func(ctx context.Context, payload []byte) error
+
+type job struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError,omitempty"`
+	DeadAt    *time.Time      `json:"deadAt,omitempty"` // moved to the dead letter queue
+}
+
+var (
+	mu       sync.RWMutex
+	handlers = map[string]Handler{}
+
+	// stopping the workers
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
+)
+
+// Register sets the handler of the jobs named name.
+func Register(name string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[name] = h
+}
+
+func handler(name string) (Handler, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	h, ok := handlers[name]
+	return h, ok
+}
+
+// Enqueue adds a job to the queue, the payload is marshalled to JSON.
+func Enqueue(ctx context.Context, name string, payload interface{}) error {
+	j, err := newJob(name, payload)
+	if err != nil {
+		return err
+	}
+
+	return push(ctx, j)
+}
+
+// EnqueueAt adds a job to run at the given time, it waits with the jobs due for a retry.
+func EnqueueAt(ctx context.Context, name string, payload interface{}, at time.Time) error {
+	j, err := newJob(name, payload)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return initializers.RedisClient.ZAdd(ctx, retryKey, &redis.Z{Score: float64(at.Unix()), Member: data}).Err()
+}
+
+func newJob(name string, payload interface{}) (*job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &job{ID: hex.EncodeToString(id), Name: name, Payload: data}, nil
+}
+
+func push(ctx context.Context, j *job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return initializers.RedisClient.LPush(ctx, queueKey, data).Err()
+}
+
+// Start runs JOB_WORKERS workers (2 by default) and moves the jobs due for a retry back to the queue.
+func Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopWorkers = cancel
+
+	for i := 0; i < initializers.GetEnvInt("JOB_WORKERS", 2); i++ {
+		workers.Add(1)
+		go work(ctx)
+	}
+	workers.Add(1)
+	go promoteRetries(ctx)
+}
+
+// Stop stops fetching jobs and waits for the jobs being processed to finish.
+func Stop(ctx context.Context) error {
+	if stopWorkers == nil {
+		return nil
+	}
+	stopWorkers()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func work(ctx context.Context) {
+	defer workers.Done()
+	for ctx.Err() == nil {
+		result, err := initializers.RedisClient.BRPop(ctx, 5*time.Second, queueKey).Result()
+		if err == redis.Nil || ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error fetching job: %s", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		var j job
+		if err := json.Unmarshal([]byte(result[1]), &j); err != nil {
+			log.Printf("Dropping malformed job: %s", err)
+			continue
+		}
+		// a job being processed is not interrupted by Stop
+		initializers.RedisClient.HSet(context.Background(), activeKey, j.ID, result[1])
+		run(context.Background(), &j)
+		initializers.RedisClient.HDel(context.Background(), activeKey, j.ID)
+	}
+}
+
+func run(ctx context.Context, j *job) {
+	h, ok := handler(j.Name)
+	if !ok {
+		j.LastError = "no handler registered"
+		bury(ctx, j)
+		return
+	}
+
+	err := h(ctx, j.Payload)
+	if err == nil {
+		metrics.Inc("jobs_processed_total", "job="+j.Name)
+		return
+	}
+
+	j.Attempts++
+	j.LastError = err.Error()
+	log.Printf("Job %s (%s) failed, attempt %d: %s", j.ID, j.Name, j.Attempts, err)
+
+	if j.Attempts >= initializers.GetEnvInt("JOB_MAX_ATTEMPTS", 5) {
+		bury(ctx, j)
+		return
+	}
+
+	// exponential backoff, JOB_RETRY_BACKOFF (30s by default) doubled on every attempt
+	delay := initializers.GetEnvDuration("JOB_RETRY_BACKOFF", 30*time.Second) << (j.Attempts - 1)
+	data, _ := json.Marshal(j)
+	due := float64(time.Now().Add(delay).Unix())
+	if err := initializers.RedisClient.ZAdd(ctx, retryKey, &redis.Z{Score: due, Member: data}).Err(); err != nil {
+		log.Printf("Error scheduling retry of job %s: %s", j.ID, err)
+	}
+	metrics.Inc("jobs_retried_total", "job="+j.Name)
+}
+
+// bury moves a job to the dead letter list, where it stays for inspection.
+func bury(ctx context.Context, j *job) {
+	log.Printf("Job %s (%s) moved to the dead letter queue: %s", j.ID, j.Name, j.LastError)
+	now := time.Now()
+	j.DeadAt = &now
+	data, _ := json.Marshal(j)
+	if err := initializers.RedisClient.LPush(ctx, deadKey, data).Err(); err != nil {
+		log.Printf("Error burying job %s: %s", j.ID, err)
+	}
+	metrics.Inc("jobs_dead_total", "job="+j.Name)
+}
+
+func promoteRetries(ctx context.Context) {
+	defer workers.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		due, err := initializers.RedisClient.ZRangeByScore(ctx, retryKey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(time.Now().Unix(), 10),
+		}).Result()
+		if err != nil {
+			log.Printf("Error fetching jobs to retry: %s", err)
+			continue
+		}
+
+		for _, data := range due {
+			// only the instance that removes the job requeues it
+			if removed, err := initializers.RedisClient.ZRem(ctx, retryKey, data).Result(); err != nil || removed == 0 {
+				continue
+			}
+			// not cancelled by Stop, the job was already removed from the retries
+			if err := initializers.RedisClient.LPush(context.Background(), queueKey, data).Err(); err != nil {
+				log.Printf("Error requeueing job: %s", err)
+			}
+		}
+	}
+}
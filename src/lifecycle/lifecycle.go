@@ -0,0 +1,114 @@
+// lifecycle/lifecycle.go
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// default time a hook gets to start or stop
+const defaultTimeout = 30 * time.Second
+
+// Hook starts and stops a subsystem. Either function may be nil.
+type Hook struct {
+	Name    string
+	Start   func(ctx context.Context) error
+	Stop    func(ctx context.Context) error
+	Timeout time.Duration // for Start and for Stop, 30s when zero
+}
+
+var (
+	mu      sync.Mutex
+	hooks   []Hook
+	started []Hook
+)
+
+// Register adds a hook. Hooks start in registration order and stop in reverse order, so a
+// subsystem should be registered after the subsystems it depends on (e.g. the job workers
+// after Redis, so they stop consuming before Redis closes).
+func Register(h Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, h)
+}
+
+// Start runs the Start hooks in order. When one fails, the hooks already started are
+// stopped and the error is returned.
+func Start() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, h := range hooks {
+		if h.Start != nil {
+			if err := call(h, h.Start); err != nil {
+				stop()
+				return fmt.Errorf("starting %s: %w", h.Name, err)
+			}
+		}
+		started = append(started, h)
+		log.Printf("Started %s", h.Name)
+	}
+	return nil
+}
+
+// Stop runs the Stop hooks of the started subsystems in reverse order. A failing or slow
+// hook is logged and doesn't prevent the next ones from stopping.
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+	stop()
+}
+
+func stop() {
+	for i := len(started) - 1; i >= 0; i-- {
+		h := started[i]
+		if h.Stop != nil {
+			if err := call(h, h.Stop); err != nil {
+				log.Printf("Error stopping %s: %s", h.Name, err)
+				continue
+			}
+		}
+		log.Printf("Stopped %s", h.Name)
+	}
+	started = nil
+}
+
+// call runs fn with the timeout of the hook.
+func call(h Hook, fn func(ctx context.Context) error) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() { errs <- fn(ctx) }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// Run starts the hooks, waits for SIGINT or SIGTERM and stops them.
+func Run() error {
+	if err := Start(); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("Received %s, shutting down", <-signals)
+
+	Stop()
+	return nil
+}
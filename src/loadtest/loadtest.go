@@ -0,0 +1,172 @@
+// loadtest/loadtest.go
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Options sets the load of a run: Rate requests per second for Duration, sent by at most
+// Workers concurrent requests (the requests due while every worker is busy are counted as
+// dropped, the target can't keep up with the rate).
+type Options struct {
+	Rate     int
+	Duration time.Duration
+	Workers  int
+	Timeout  time.Duration
+}
+
+// Result sums up a run, the latencies are those of the answered requests.
+type Result struct {
+	Scenario   string         `json:"scenario"`
+	Rate       int            `json:"rate"`
+	Duration   time.Duration  `json:"duration_ns"`
+	Requests   int            `json:"requests"`
+	Dropped    int            `json:"dropped"`
+	Errors     int            `json:"errors"` // transport errors, no answer
+	Statuses   map[int]int    `json:"statuses"`
+	Throughput float64        `json:"throughput"` // answered requests per second
+	Latency    LatencySummary `json:"latency"`
+	StartedAt  time.Time      `json:"started_at"`
+}
+
+// LatencySummary gives the latency percentiles of a run.
+type LatencySummary struct {
+	Min  time.Duration `json:"min_ns"`
+	Mean time.Duration `json:"mean_ns"`
+	P50  time.Duration `json:"p50_ns"`
+	P90  time.Duration `json:"p90_ns"`
+	P99  time.Duration `json:"p99_ns"`
+	Max  time.Duration `json:"max_ns"`
+}
+
+// Run sends the requests of the scenario at the rate of the options and measures the answers.
+func Run(ctx context.Context, target *Target, scenario Scenario, opts Options) (*Result, error) {
+	next, err := scenario.Prepare(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("preparing %s: %w", scenario.Name, err)
+	}
+
+	client := &http.Client{Timeout: opts.Timeout}
+	result := &Result{Scenario: scenario.Name, Rate: opts.Rate, Duration: opts.Duration, Statuses: map[int]int{}, StartedAt: time.Now()}
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		wg        sync.WaitGroup
+	)
+	slots := make(chan struct{}, opts.Workers)
+
+	ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+	defer ticker.Stop()
+	deadline := time.After(opts.Duration)
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+		}
+
+		result.Requests++
+		select {
+		case slots <- struct{}{}:
+		default:
+			result.Dropped++
+			continue
+		}
+
+		req, err := next()
+		if err != nil {
+			<-slots
+			return nil, err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+
+			start := time.Now()
+			resp, err := client.Do(req.WithContext(ctx))
+			if err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			elapsed := time.Since(start)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Errors++
+				return
+			}
+			result.Statuses[resp.StatusCode]++
+			latencies = append(latencies, elapsed)
+		}()
+	}
+	wg.Wait()
+
+	result.Throughput = float64(len(latencies)) / time.Since(result.StartedAt).Seconds()
+	result.Latency = summarize(latencies)
+	return result, nil
+}
+
+func summarize(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+
+	return LatencySummary{
+		Min:  latencies[0],
+		Mean: total / time.Duration(len(latencies)),
+		P50:  percentile(0.50),
+		P90:  percentile(0.90),
+		P99:  percentile(0.99),
+		Max:  latencies[len(latencies)-1],
+	}
+}
+
+// Report writes the result for people to read.
+func (r *Result) Report(w io.Writer) {
+	fmt.Fprintf(w, "%s: %d req/s for %s\n", r.Scenario, r.Rate, r.Duration)
+	fmt.Fprintf(w, "  requests   %d (dropped %d, errors %d)\n", r.Requests, r.Dropped, r.Errors)
+	fmt.Fprintf(w, "  throughput %.1f/s\n", r.Throughput)
+
+	codes := make([]int, 0, len(r.Statuses))
+	for code := range r.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "  status %d %d\n", code, r.Statuses[code])
+	}
+
+	l := r.Latency
+	fmt.Fprintf(w, "  latency    min %s, mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		l.Min, l.Mean, l.P50, l.P90, l.P99, l.Max)
+}
+
+// WriteJSON writes the result as JSON, to compare runs before and after a change.
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
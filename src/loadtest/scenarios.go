@@ -0,0 +1,224 @@
+// loadtest/scenarios.go
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Target is the API under load and the account the scenarios use, it must be allowed to
+// read the users. The login scenario needs the login rate limit and the CAPTCHA disabled
+// (LOGIN_RATE_LIMIT_USERNAME=0, LOGIN_RATE_LIMIT_IP=0, no CAPTCHA_PROVIDER).
+type Target struct {
+	BaseURL  string
+	Username string
+	Password string
+}
+
+// Scenario is a request pattern on a hot path. Prepare runs once before the load, it returns
+// the function building each request.
+type Scenario struct {
+	Name        string
+	Description string
+	Prepare     func(ctx context.Context, target *Target) (func() (*http.Request, error), error)
+}
+
+// Scenarios lists the scenarios, by name.
+var Scenarios = []Scenario{
+	{Name: "login", Description: "POST /login with the password of the account (bcrypt bound)", Prepare: prepareLogin},
+	{Name: "get-user-cached", Description: "GET /users/:id of the same user, served from the user cache", Prepare: prepareGetUserCached},
+	{Name: "get-user-spread", Description: "GET /users/:id cycling through the users, missing the cache on the first pass", Prepare: prepareGetUserSpread},
+	{Name: "list-users", Description: "GET /users cycling through the pages", Prepare: prepareListUsers},
+	{Name: "avatar", Description: "GET /users/:id/profile_picture of the account", Prepare: prepareAvatar},
+}
+
+// FindScenario returns the scenario with the name.
+func FindScenario(name string) (Scenario, error) {
+	names := make([]string, len(Scenarios))
+	for i, scenario := range Scenarios {
+		if scenario.Name == name {
+			return scenario, nil
+		}
+		names[i] = scenario.Name
+	}
+	return Scenario{}, fmt.Errorf("unknown scenario %q, the scenarios are: %s", name, strings.Join(names, ", "))
+}
+
+func (t *Target) url(path string) string {
+	return strings.TrimSuffix(t.BaseURL, "/") + path
+}
+
+func (t *Target) loginRequest() (*http.Request, error) {
+	body, err := json.Marshal(map[string]string{"username": t.Username, "password": t.Password})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.url("/login"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// get runs an authenticated GET before the load and decodes the answer into out
+func (t *Target) get(ctx context.Context, token, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url(path), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s answered %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// login returns an access token of the account
+func (t *Target) login(ctx context.Context) (string, error) {
+	req, err := t.loginRequest()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("login answered %s", resp.Status)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token == "" {
+		return "", errors.New("login answered no token, the account must not use a second factor")
+	}
+	return body.Token, nil
+}
+
+// authenticated returns a function building GET requests of the paths in turn
+func authenticated(token string, paths []string, target *Target) func() (*http.Request, error) {
+	var n uint64
+	return func() (*http.Request, error) {
+		path := paths[(atomic.AddUint64(&n, 1)-1)%uint64(len(paths))]
+		req, err := http.NewRequest(http.MethodGet, target.url(path), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req, nil
+	}
+}
+
+// profileID returns the ID of the account
+func profileID(ctx context.Context, target *Target, token string) (uint, error) {
+	var profile struct {
+		User struct {
+			ID uint `json:"id"`
+		} `json:"user"`
+	}
+	if err := target.get(ctx, token, "/profile", &profile); err != nil {
+		return 0, err
+	}
+	return profile.User.ID, nil
+}
+
+func prepareLogin(ctx context.Context, target *Target) (func() (*http.Request, error), error) {
+	// fail early on bad credentials
+	if _, err := target.login(ctx); err != nil {
+		return nil, err
+	}
+	return target.loginRequest, nil
+}
+
+func prepareGetUserCached(ctx context.Context, target *Target) (func() (*http.Request, error), error) {
+	token, err := target.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := profileID(ctx, target, token)
+	if err != nil {
+		return nil, err
+	}
+	return authenticated(token, []string{fmt.Sprintf("/users/%d", id)}, target), nil
+}
+
+func prepareGetUserSpread(ctx context.Context, target *Target) (func() (*http.Request, error), error) {
+	token, err := target.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Users []struct {
+			ID uint `json:"id"`
+		} `json:"users"`
+	}
+	if err := target.get(ctx, token, "/users?per_page=100", &list); err != nil {
+		return nil, err
+	}
+	if len(list.Users) == 0 {
+		return nil, errors.New("no users to fetch")
+	}
+
+	paths := make([]string, len(list.Users))
+	for i, user := range list.Users {
+		paths[i] = fmt.Sprintf("/users/%d", user.ID)
+	}
+	return authenticated(token, paths, target), nil
+}
+
+func prepareListUsers(ctx context.Context, target *Target) (func() (*http.Request, error), error) {
+	token, err := target.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Total   int64 `json:"total"`
+		PerPage int64 `json:"per_page"`
+	}
+	if err := target.get(ctx, token, "/users", &list); err != nil {
+		return nil, err
+	}
+
+	pages := int((list.Total + list.PerPage - 1) / list.PerPage)
+	if pages < 1 {
+		pages = 1
+	}
+	paths := make([]string, pages)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/users?page=%d", i+1)
+	}
+	return authenticated(token, paths, target), nil
+}
+
+func prepareAvatar(ctx context.Context, target *Target) (func() (*http.Request, error), error) {
+	token, err := target.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := profileID(ctx, target, token)
+	if err != nil {
+		return nil, err
+	}
+	return authenticated(token, []string{fmt.Sprintf("/users/%d/profile_picture", id)}, target), nil
+}
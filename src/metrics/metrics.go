@@ -0,0 +1,43 @@
+// metrics/metrics.go
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	mu       sync.Mutex
+	counters = map[string]int64{}
+)
+
+func key(name string, labels []string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// Inc increments the counter identified by name and optional label values.
+func Inc(name string, labels ...string) {
+	Add(name, 1, labels...)
+}
+
+// Add adds delta to the counter identified by name and optional label values.
+func Add(name string, delta int64, labels ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	counters[key(name, labels)] += delta
+}
+
+// Snapshot returns a copy of all counters.
+func Snapshot() map[string]int64 {
+	mu.Lock()
+	defer mu.Unlock()
+
+	snapshot := make(map[string]int64, len(counters))
+	for k, v := range counters {
+		snapshot[k] = v
+	}
+	return snapshot
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+const usedActionTokenPrefix = "action_token:used:"
+
+// ActionToken authorizes the request with an action token minted for the action, passed in
+// the ?token= query parameter (email links) or the X-Action-Token header (browser uploads).
+// The resource of the token must match the route parameter param, and every token can be
+// used only once.
+func ActionToken(action, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.Query("token")
+		if tokenString == "" {
+			tokenString = c.GetHeader("X-Action-Token")
+		}
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Action token not provided"})
+			c.Abort()
+			return
+		}
+
+		claims, err := utils.VerifyActionToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid action token"})
+			c.Abort()
+			return
+		}
+
+		if claims.Action != action || claims.Resource != c.Param(param) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Action token does not grant this action"})
+			c.Abort()
+			return
+		}
+
+		// Mark the token as used until it expires
+		first, err := initializers.RedisClient.SetNX(context.Background(), usedActionTokenPrefix+claims.ID, "1", time.Until(claims.ExpiresAt)).Result()
+		if err != nil {
+			Logger.Printf("Error checking action token use: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify action token"})
+			c.Abort()
+			return
+		}
+		if !first {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Action token has already been used"})
+			c.Abort()
+			return
+		}
+
+		c.Set("actionToken", claims)
+
+		c.Next()
+	}
+}
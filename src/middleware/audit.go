@@ -0,0 +1,128 @@
+// middleware/audit.go
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/search"
+)
+
+type auditDiffKey struct{}
+
+// auditDiff is the change recorded by the services during the request
+type auditDiff struct {
+	targetID string
+	changes  map[string]models.FieldChange
+}
+
+// Audit records every mutating request (anything but GET, HEAD and OPTIONS) in the audit log,
+// and every request made with an impersonation token or by the break-glass account.
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		diff := &auditDiff{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), auditDiffKey{}, diff))
+		c.Next()
+
+		var actor *models.User
+		if user, ok := c.Get("user"); ok {
+			actor, _ = user.(*models.User)
+		}
+		breakGlass := actor != nil && actor.BreakGlass
+
+		impersonatorID := ImpersonatorID(c)
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if impersonatorID == 0 && !breakGlass {
+				return
+			}
+		}
+
+		entry := &models.AuditLog{
+			Action:     c.Request.Method + " " + c.FullPath(),
+			TargetID:   c.Param("id"),
+			StatusCode: c.Writer.Status(),
+			IP:         c.ClientIP(),
+		}
+		if actor != nil {
+			entry.ActorID = &actor.ID
+		}
+		if breakGlass {
+			entry.Details = "break-glass account"
+		}
+
+		if impersonatorID != 0 {
+			entry.ImpersonatorID = &impersonatorID
+		}
+
+		if len(diff.changes) > 0 {
+			encoded, err := json.Marshal(diff.changes)
+			if err != nil {
+				Logger.Printf("Error encoding the audit diff: %s", err)
+			} else {
+				entry.TargetID = diff.targetID
+				entry.Diff = string(encoded)
+			}
+		}
+
+		if err := repository.CreateAuditLog(c.Request.Context(), entry); err != nil {
+			Logger.Printf("Error writing audit log: %s", err)
+			return
+		}
+
+		// Mirror the entry into the search index
+		if search.Enabled() {
+			if err := jobs.Enqueue(c.Request.Context(), search.AuditLogJob, entry); err != nil {
+				Logger.Printf("Error queueing the indexing of audit log %d: %s", entry.ID, err)
+			}
+		}
+	}
+}
+
+// RecordAuditDiff adds the changed fields of the target to the audit log entry of the request,
+// the user history is rebuilt from them. Outside of an audited request it does nothing.
+func RecordAuditDiff(ctx context.Context, targetID string, changes map[string]models.FieldChange) {
+	diff, ok := ctx.Value(auditDiffKey{}).(*auditDiff)
+	if !ok || len(changes) == 0 {
+		return
+	}
+	diff.targetID = targetID
+	if diff.changes == nil {
+		diff.changes = map[string]models.FieldChange{}
+	}
+	for field, change := range changes {
+		if previous, ok := diff.changes[field]; ok {
+			change.From = previous.From
+		}
+		diff.changes[field] = change
+	}
+}
+
+// ImpersonatorID returns the admin impersonating the user of the request, 0 when not impersonated.
+func ImpersonatorID(c *gin.Context) uint {
+	claims, ok := c.Get("claims")
+	if !ok {
+		return 0
+	}
+	impersonatedBy, _ := claims.(jwt.MapClaims)["impersonated_by"].(float64)
+	return uint(impersonatedBy)
+}
+
+// DenyImpersonation rejects impersonation tokens on routes an admin must not use as someone
+// else, like minting long-lived credentials or changing the password.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ImpersonatorID(c) != 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating a user"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,22 +1,40 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
 	"github.com/nabazesmail/gopher/src/models"
 	"github.com/nabazesmail/gopher/src/repository"
 	"github.com/nabazesmail/gopher/src/utils"
+	"gorm.io/gorm"
 )
 
-// AuthMiddleware is a custom middleware that checks if the request contains a valid JWT token.
+// AuthMiddleware is a custom middleware that checks if the request contains a valid JWT token
+// or personal access token, or a valid API key in the X-API-Key header for machine clients,
+// or the session cookie of a browser when AUTH_COOKIE_ENABLED is set.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" && c.GetHeader("Authorization") == "" {
+			authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
+
+		// Browser clients logged in with a session cookie
+		if token := SessionCookie(c); authHeader == "" && token != "" {
+			authenticateCookie(c, token)
+			return
+		}
+
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header not provided"})
 			c.Abort()
@@ -34,14 +52,43 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Get the token from the authorization header
 		tokenString := authHeaderParts[1]
 
+		// Personal access tokens are API keys sent as bearer credentials
+		if strings.HasPrefix(tokenString, models.PersonalTokenPrefix) {
+			authenticateAPIKey(c, tokenString)
+			return
+		}
+
 		// Verify the token using the secret key
-		claims, err := utils.VerifyJWTToken(tokenString, []byte(os.Getenv("JWT_SECRET_KEY")))
+		claims, err := utils.VerifyJWTToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		// Reject tokens that have been revoked (logout, revoked session)
+		var revocationKeys []string
+		if jti, ok := claims["jti"].(string); ok {
+			revocationKeys = append(revocationKeys, utils.RevokedTokenPrefix+jti)
+		}
+		if sid, ok := claims["sid"].(float64); ok {
+			revocationKeys = append(revocationKeys, utils.RevokedSessionPrefix+strconv.FormatUint(uint64(sid), 10))
+		}
+		if len(revocationKeys) > 0 {
+			revoked, err := initializers.RedisClient.Exists(context.Background(), revocationKeys...).Result()
+			if err != nil {
+				Logger.Printf("Error checking token revocation: %s", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+				c.Abort()
+				return
+			}
+			if revoked > 0 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
 		// Extract user information from the token claims and store it in the context
 		userIDFloat, ok := claims["sub"].(float64) // Use float64 instead of uint for type assertion
 		if !ok {
@@ -54,26 +101,120 @@ func AuthMiddleware() gin.HandlerFunc {
 		userID := uint(userIDFloat)
 
 		// Fetch the user from the database using the userID
-		user, err := repository.GetUserByID(strconv.FormatUint(uint64(userID), 10)) // Convert uint to string
+		user, err := repository.GetUserByID(c.Request.Context(), strconv.FormatUint(uint64(userID), 10)) // Convert uint to string
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
 			c.Abort()
 			return
 		}
 
-		// Set the user in the context
-		c.Set("user", user)
+		// Accounts pending deletion are reactivated by a login, not by their remaining tokens
+		if user.DeletionRequestedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account pending deletion"})
+			c.Abort()
+			return
+		}
+
+		if breakGlassSealed(c, user) {
+			return
+		}
+
+		// Set the user and the token claims in the context
+		setUser(c, user)
+		c.Set("claims", claims)
 
 		c.Next()
 	}
 }
 
+// authenticateAPIKey authenticates the request as the user the API key belongs to.
+func authenticateAPIKey(c *gin.Context, plainKey string) {
+	key, err := repository.GetAPIKeyByHash(c.Request.Context(), utils.HashToken(plainKey))
+	if err != nil || key.RevokedAt != nil || key.Expired() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	// read scope allows safe methods only, write allows the others
+	requiredScope := models.ScopeWrite
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		requiredScope = models.ScopeRead
+	}
+	if !key.HasScope(requiredScope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + requiredScope + " scope"})
+		c.Abort()
+		return
+	}
+
+	user, err := repository.GetUserByID(c.Request.Context(), strconv.FormatUint(uint64(key.UserID), 10))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		c.Abort()
+		return
+	}
+	if user.DeletionRequestedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account pending deletion"})
+		c.Abort()
+		return
+	}
+
+	// Track the usage at most once a minute
+	if now := time.Now(); key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		if err := repository.UpdateAPIKeyLastUsed(c.Request.Context(), key, now); err != nil {
+			Logger.Printf("Error updating api key last use: %s", err)
+		}
+	}
+
+	if breakGlassSealed(c, user) {
+		return
+	}
+
+	setUser(c, user)
+	c.Set("apiKey", key)
+
+	c.Next()
+}
+
+// breakGlassSealed rejects the break-glass account outside of its activation, its tokens and
+// API keys don't outlive it
+func breakGlassSealed(c *gin.Context, user *models.User) bool {
+	if !user.BreakGlass {
+		return false
+	}
+	_, err := repository.GetActiveBreakGlassActivation(c.Request.Context(), user.ID)
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "The break-glass account is sealed"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+	}
+	c.Abort()
+	return true
+}
+
+type userKey struct{}
+
+// setUser stores the authenticated user for the handlers, and in the request context for the services
+func setUser(c *gin.Context, user *models.User) {
+	c.Set("user", user)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), userKey{}, user))
+}
+
+// UserFromContext returns the authenticated user of the request, nil outside of an authenticated request.
+func UserFromContext(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userKey{}).(*models.User)
+	return user
+}
+
 // GetUserFromContext is a helper function to extract the user ID from the context.
 func GetUserFromContext(c *gin.Context) *models.User {
 	if userID, ok := c.Get("userID"); ok {
 		if userIDInt, ok := userID.(uint); ok {
 			// Convert the userID from uint to string
-			user, err := repository.GetUserByID(fmt.Sprintf("%d", userIDInt))
+			user, err := repository.GetUserByID(c.Request.Context(), fmt.Sprintf("%d", userIDInt))
 			if err != nil {
 				return nil
 			}
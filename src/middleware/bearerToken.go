@@ -0,0 +1,38 @@
+// middleware/bearerToken.go
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// StaticBearerAuth authenticates a machine client with the bearer token set in the env
+// variable. The routes are answered with a 404 ("<feature> is not enabled") when it is not set;
+// respond writes the errors in the format of the routes.
+func StaticBearerAuth(env, feature string, respond func(c *gin.Context, status int, message string)) gin.HandlerFunc {
+	expected := utils.HashToken(initializers.GetEnv(env, ""))
+	enabled := initializers.GetEnv(env, "") != ""
+
+	return func(c *gin.Context) {
+		if !enabled {
+			respond(c, http.StatusNotFound, feature+" is not enabled")
+			c.Abort()
+			return
+		}
+
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		// comparing the hashes keeps the comparison constant-time whatever the token length
+		if subtle.ConstantTimeCompare([]byte(utils.HashToken(token)), []byte(expected)) != 1 {
+			respond(c, http.StatusUnauthorized, "Invalid bearer token")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
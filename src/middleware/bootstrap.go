@@ -0,0 +1,16 @@
+// middleware/bootstrap.go
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+)
+
+// BootstrapAuth authenticates the automation bootstrapping an environment (Terraform, CI) with
+// the bearer token of BOOTSTRAP_TOKEN, before any admin can log in. The bootstrap endpoint is
+// disabled when it is not set.
+func BootstrapAuth() gin.HandlerFunc {
+	return StaticBearerAuth("BOOTSTRAP_TOKEN", "Bootstrap", func(c *gin.Context, status int, message string) {
+		c.JSON(status, apierrors.ForStatus(status).Body(message))
+	})
+}
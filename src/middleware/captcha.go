@@ -0,0 +1,141 @@
+// middleware/captcha.go
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// CaptchaVerifier checks the CAPTCHA token a client got from the widget of the provider.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// the verification endpoints of the supported providers, they share the same API
+var captchaEndpoints = map[string]string{
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+}
+
+// DefaultCaptchaVerifier returns the verifier of CAPTCHA_PROVIDER (recaptcha or hcaptcha) with
+// the CAPTCHA_SECRET key, nil when no provider is configured. CAPTCHA_MIN_SCORE rejects the
+// reCAPTCHA v3 tokens scored below it (0.0 to 1.0).
+func DefaultCaptchaVerifier() CaptchaVerifier {
+	provider := strings.ToLower(initializers.GetEnv("CAPTCHA_PROVIDER", ""))
+	if provider == "" {
+		return nil
+	}
+
+	endpoint, ok := captchaEndpoints[provider]
+	if !ok {
+		Logger.Printf("CAPTCHA disabled: unknown provider %s", provider)
+		return nil
+	}
+	minScore, _ := strconv.ParseFloat(initializers.GetEnv("CAPTCHA_MIN_SCORE", "0"), 64)
+
+	return &siteVerifier{
+		endpoint: initializers.GetEnv("CAPTCHA_VERIFY_URL", endpoint),
+		secret:   initializers.GetEnv("CAPTCHA_SECRET", ""),
+		minScore: minScore,
+		client:   &http.Client{Timeout: initializers.GetEnvDuration("CAPTCHA_TIMEOUT", 5*time.Second)},
+	}
+}
+
+// siteVerifier calls the siteverify API of reCAPTCHA and hCaptcha.
+type siteVerifier struct {
+	endpoint string
+	secret   string
+	minScore float64
+	client   *http.Client
+}
+
+func (v *siteVerifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {v.secret}, "response": {token}, "remoteip": {remoteIP}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha provider answered %s", resp.Status)
+	}
+
+	var answer struct {
+		Success bool     `json:"success"`
+		Score   *float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return false, err
+	}
+
+	// only reCAPTCHA v3 scores the tokens
+	if answer.Score != nil && *answer.Score < v.minScore {
+		return false, nil
+	}
+	return answer.Success, nil
+}
+
+// Captcha rejects the requests without a valid CAPTCHA token, sent in the X-Captcha-Token header
+// or the captcha_token field of the JSON body. It lets every request through when verifier is
+// nil, and answers 503 when the provider cannot be reached as the token cannot be checked.
+func Captcha(verifier CaptchaVerifier) gin.HandlerFunc {
+	if verifier == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Captcha-Token")
+		if token == "" {
+			// Read the token and put the body back for the handler
+			data, _ := io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			var body struct {
+				CaptchaToken string `json:"captcha_token"`
+			}
+			_ = json.Unmarshal(data, &body)
+			token = body.CaptchaToken
+		}
+
+		if token == "" {
+			metrics.Inc("captcha_failed_total")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "CAPTCHA token must be provided"})
+			c.Abort()
+			return
+		}
+
+		valid, err := verifier.Verify(c.Request.Context(), token, c.ClientIP())
+		if err != nil {
+			Logger.Printf("Error verifying CAPTCHA: %s", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "CAPTCHA verification unavailable, please try again later"})
+			c.Abort()
+			return
+		}
+		if !valid {
+			metrics.Inc("captcha_failed_total")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "CAPTCHA verification failed"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,160 @@
+// middleware/coalesce.go
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// coalescedCall is a GET being handled, whose response is shared with identical requests.
+type coalescedCall struct {
+	done   chan struct{}
+	shared bool // a JSON response, the others are served to each request
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Coalesce runs identical concurrent GET requests (same path, query and credentials) only once
+// and fans the JSON response out to all of them; the attachments (e.g. the user exports) and
+// the streams are written through and the identical requests handled on their own. Enabled
+// with COALESCE_GETS=true. It runs after the authentication and the rate limits, which every
+// request goes through.
+func Coalesce() gin.HandlerFunc {
+	if !initializers.GetEnvBool("COALESCE_GETS", false) {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	var (
+		mu    sync.Mutex
+		calls = map[string]*coalescedCall{}
+	)
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || WantsNDJSON(c) {
+			c.Next()
+			return
+		}
+
+		// The credentials (bearer token, API key, session cookie) are part of the key so responses
+		// are never shared between principals
+		credentials := sha256.Sum256([]byte(c.GetHeader("Authorization") + "\x00" + c.GetHeader("X-API-Key") + "\x00" + SessionCookie(c)))
+		key := c.Request.URL.RequestURI() + "\x00" + hex.EncodeToString(credentials[:])
+		// a conditional GET may be answered with a 304, only shared with the same condition
+		key += "\x00" + c.GetHeader("If-None-Match")
+
+		mu.Lock()
+		if call, ok := calls[key]; ok {
+			mu.Unlock()
+			<-call.done
+
+			if !call.shared {
+				c.Next()
+				return
+			}
+			metrics.Inc("coalesced_requests", c.FullPath())
+			for name, values := range call.header {
+				c.Writer.Header()[name] = values
+			}
+			c.Writer.WriteHeader(call.status)
+			c.Writer.Write(call.body)
+			c.Abort()
+			return
+		}
+
+		call := &coalescedCall{done: make(chan struct{})}
+		calls[key] = call
+		mu.Unlock()
+
+		writer := &coalescingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			// an error returned without answering is shared like any response (see bufferResponse)
+			renderError(c)
+			c.Writer = writer.ResponseWriter
+
+			call.shared = !writer.through
+			if call.shared {
+				call.status = writer.Status()
+				call.header = writer.Header().Clone()
+				call.body = writer.body.Bytes()
+			}
+
+			mu.Lock()
+			delete(calls, key)
+			mu.Unlock()
+			close(call.done)
+
+			if call.shared && len(call.body) > 0 {
+				writer.ResponseWriter.Write(call.body)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+// coalescingWriter holds the JSON body of the response to share it. The other bodies, the
+// flushed and the hijacked responses are written through from their first byte and not shared.
+type coalescingWriter struct {
+	gin.ResponseWriter
+	body    bytes.Buffer
+	decided bool
+	through bool
+}
+
+// decide settles, at the first write, whether the response is held
+func (w *coalescingWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	header := w.Header()
+	w.through = !strings.HasPrefix(header.Get("Content-Type"), "application/json") ||
+		strings.HasPrefix(header.Get("Content-Disposition"), "attachment")
+}
+
+func (w *coalescingWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.through {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *coalescingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written reports the body held as written, so an error isn't rendered after it
+func (w *coalescingWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Flush streams the response: what was held is written and the rest written through
+func (w *coalescingWriter) Flush() {
+	w.decide()
+	if !w.through {
+		w.through = true
+		if w.body.Len() > 0 {
+			w.ResponseWriter.Write(w.body.Bytes())
+			w.body.Reset()
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *coalescingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.decided, w.through = true, true
+	return w.ResponseWriter.Hijack()
+}
@@ -0,0 +1,87 @@
+// middleware/coalesce_test.go
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestCoalesce sends two identical GETs, the second once the first is being handled: only the
+// JSON responses are shared, the attachments and the streams are served to each request.
+func TestCoalesce(t *testing.T) {
+	t.Setenv("COALESCE_GETS", "true")
+
+	tests := []struct {
+		name    string
+		handler func(c *gin.Context)
+		calls   int32 // the requests handled
+		header  string
+		body    string
+	}{
+		{name: "json", calls: 1, header: "application/json; charset=utf-8", body: `{"total":2}`,
+			handler: func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"total": 2}) }},
+		{name: "attachment", calls: 2, header: "attachment; filename=\"users.csv\"", body: "id,username\n1,ada\n",
+			handler: func(c *gin.Context) {
+				c.Header("Content-Disposition", `attachment; filename="users.csv"`)
+				c.Data(http.StatusOK, "application/json", []byte("id,username\n1,ada\n"))
+			}},
+		{name: "stream", calls: 2, header: NDJSONContentType, body: "{\"id\":1}\n{\"id\":2}\n",
+			handler: func(c *gin.Context) {
+				c.Header("Content-Type", NDJSONContentType)
+				c.Writer.WriteString("{\"id\":1}\n")
+				c.Writer.Flush()
+				c.Writer.WriteString("{\"id\":2}\n")
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			entered := make(chan struct{}, 2)
+			release := make(chan struct{})
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(Coalesce())
+			r.GET("/users/export", func(c *gin.Context) {
+				atomic.AddInt32(&calls, 1)
+				entered <- struct{}{}
+				<-release
+				tt.handler(c)
+			})
+
+			recorders := []*httptest.ResponseRecorder{httptest.NewRecorder(), httptest.NewRecorder()}
+			var wg sync.WaitGroup
+			serve := func(rec *httptest.ResponseRecorder) {
+				defer wg.Done()
+				r.ServeHTTP(rec, httptest.NewRequest("GET", "/users/export", nil))
+			}
+			wg.Add(2)
+			go serve(recorders[0])
+			<-entered
+			go serve(recorders[1])
+			time.Sleep(50 * time.Millisecond) // the second request waits for the first
+			close(release)
+			wg.Wait()
+
+			if got := atomic.LoadInt32(&calls); got != tt.calls {
+				t.Fatalf("%d requests handled, want %d", got, tt.calls)
+			}
+			for i, rec := range recorders {
+				header := rec.Header().Get("Content-Type")
+				if tt.name == "attachment" {
+					header = rec.Header().Get("Content-Disposition")
+				}
+				if rec.Code != http.StatusOK || header != tt.header || rec.Body.String() != tt.body {
+					t.Errorf("response %d: status %d, header %q, body %q", i, rec.Code, header, rec.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// middleware/cookieSession.go
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// the CSRF token of a cookie session is readable by the scripts of the page, which send it back in the header
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// CookieSessionsEnabled reports whether the browser clients may log in with a session cookie
+// instead of bearer tokens (AUTH_COOKIE_ENABLED).
+func CookieSessionsEnabled() bool {
+	return initializers.GetEnvBool("AUTH_COOKIE_ENABLED", false)
+}
+
+// SessionCookieName is the name of the session cookie, AUTH_COOKIE_NAME ("session" by default).
+func SessionCookieName() string {
+	return initializers.GetEnv("AUTH_COOKIE_NAME", "session")
+}
+
+// SessionCookie returns the session cookie of the request, empty when there is none or
+// cookie sessions are disabled.
+func SessionCookie(c *gin.Context) string {
+	if !CookieSessionsEnabled() {
+		return ""
+	}
+	token, _ := c.Cookie(SessionCookieName())
+	return token
+}
+
+// the attributes of the session and CSRF cookies: Secure unless AUTH_COOKIE_SECURE is false,
+// SameSite from AUTH_COOKIE_SAMESITE (lax, strict or none, lax by default), AUTH_COOKIE_DOMAIN
+func sessionCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(initializers.GetEnv("AUTH_COOKIE_SAMESITE", "lax")) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   initializers.GetEnv("AUTH_COOKIE_DOMAIN", ""),
+		MaxAge:   maxAge,
+		Secure:   initializers.GetEnvBool("AUTH_COOKIE_SECURE", true),
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	}
+}
+
+// SetSessionCookies sets the httpOnly session cookie and the CSRF cookie for maxAge seconds.
+func SetSessionCookies(c *gin.Context, token, csrfToken string, maxAge int) {
+	http.SetCookie(c.Writer, sessionCookie(SessionCookieName(), token, maxAge, true))
+	http.SetCookie(c.Writer, sessionCookie(CSRFCookieName, csrfToken, maxAge, false))
+}
+
+// ClearSessionCookies deletes the session and CSRF cookies from the browser.
+func ClearSessionCookies(c *gin.Context) {
+	http.SetCookie(c.Writer, sessionCookie(SessionCookieName(), "", -1, true))
+	http.SetCookie(c.Writer, sessionCookie(CSRFCookieName, "", -1, false))
+}
+
+// authenticateCookie authenticates the request with the cookie session. Unsafe methods must
+// carry the CSRF token of the session in the X-CSRF-Token header.
+func authenticateCookie(c *gin.Context, token string) {
+	stored, err := initializers.RedisClient.HGetAll(c.Request.Context(), utils.CookieSessionPrefix+utils.HashToken(token)).Result()
+	if err != nil {
+		Logger.Printf("Error fetching cookie session: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+		c.Abort()
+		return
+	}
+	if stored["session_id"] == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		c.Abort()
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(CSRFHeaderName)), []byte(stored["csrf"])) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+			c.Abort()
+			return
+		}
+	}
+
+	// Revoked sessions (logout, password change, admin) end their cookie session too
+	session, err := repository.GetSessionByID(c.Request.Context(), stored["session_id"])
+	if err != nil || session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		c.Abort()
+		return
+	}
+
+	user, err := repository.GetUserByID(c.Request.Context(), strconv.FormatUint(uint64(session.UserID), 10))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		c.Abort()
+		return
+	}
+	if user.DeletionRequestedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account pending deletion"})
+		c.Abort()
+		return
+	}
+
+	if breakGlassSealed(c, user) {
+		return
+	}
+
+	// The claims of a bearer token of the session, for the handlers reading them
+	setUser(c, user)
+	c.Set("claims", jwt.MapClaims{"sub": float64(user.ID), "sid": float64(session.ID)})
+
+	c.Next()
+}
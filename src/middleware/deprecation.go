@@ -0,0 +1,119 @@
+// middleware/deprecation.go
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// Deprecation describes a deprecated route.
+type Deprecation struct {
+	Since     time.Time // when the route was deprecated
+	Sunset    time.Time // when the route will be removed, zero if not planned yet
+	Successor string    // URL of the replacing route, optional
+	Message   string    // warning added to the response body, optional
+}
+
+// Deprecated marks a route as deprecated. It sets the Deprecation, Sunset and Link headers,
+// adds a "warning" field to JSON object responses and counts the usage of the route.
+func Deprecated(d Deprecation) gin.HandlerFunc {
+	warning := d.Message
+	if warning == "" {
+		warning = "This endpoint is deprecated"
+		if !d.Sunset.IsZero() {
+			warning += " and will be removed on " + d.Sunset.UTC().Format("2006-01-02")
+		}
+		if d.Successor != "" {
+			warning += ", use " + d.Successor + " instead"
+		}
+	}
+	encodedWarning, _ := json.Marshal(warning)
+
+	return func(c *gin.Context) {
+		metrics.Inc("deprecated_route_requests", c.Request.Method+" "+c.FullPath())
+
+		c.Header("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+		if !d.Sunset.IsZero() {
+			c.Header("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Successor != "" {
+			c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", d.Successor))
+		}
+
+		// Buffer the response so the warning can be added to the JSON body
+		writer := bufferResponse(c)
+
+		body := writer.body.Bytes()
+		if strings.HasPrefix(writer.Header().Get("Content-Type"), "application/json") {
+			body = addJSONField(body, "warning", encodedWarning)
+		}
+		writer.release(body)
+	}
+}
+
+// bufferedWriter holds the response body until the handler chain is done.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// Written reports the body held as written, so an error isn't rendered after it
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Flush writes nothing, the body is held until the chain is done and flushing would write the
+// status before the middleware settles it. The streams (NDJSON) aren't buffered.
+func (w *bufferedWriter) Flush() {}
+
+// bufferResponse runs the rest of the chain with the response body held. The error a handler
+// returned without answering is rendered into the buffer (see ErrorEnvelope), as the body
+// released by the middleware would otherwise hide it behind an empty 200.
+func bufferResponse(c *gin.Context) *bufferedWriter {
+	writer := &bufferedWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	defer func() { c.Writer = writer.ResponseWriter }()
+	c.Next()
+	renderError(c)
+	return writer
+}
+
+// release writes the body through, an empty one is left to gin so the status set by the
+// handler (e.g. a 204 or 304) is still written with it
+func (w *bufferedWriter) release(body []byte) {
+	if len(body) > 0 {
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// addJSONField adds a field to a JSON object body, other bodies are returned unchanged.
+func addJSONField(body []byte, name string, value []byte) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) < 2 || trimmed[0] != '{' {
+		return body
+	}
+
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("{%q:", name))
+	out.Write(value)
+	if rest := bytes.TrimSpace(trimmed[1:]); rest[0] != '}' {
+		out.WriteByte(',')
+	}
+	out.Write(trimmed[1:])
+	return out.Bytes()
+}
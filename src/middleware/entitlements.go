@@ -0,0 +1,54 @@
+// middleware/entitlements.go
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// RequireEntitlement is a middleware that checks the user is entitled to the feature, the
+// routes of a feature being rolled out answer 403 to the others.
+func RequireEntitlement(feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found in context"})
+			c.Abort()
+			return
+		}
+
+		entitled, err := HasEntitlement(c.Request.Context(), user.(*models.User), feature)
+		if err != nil {
+			Logger.Printf("Error loading entitlements: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		if !entitled {
+			c.JSON(http.StatusForbidden, apierrors.AccessDenied.Body("The "+feature+" feature is not enabled for your account"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HasEntitlement reports whether the user is entitled to the feature, directly or through its role.
+func HasEntitlement(ctx context.Context, user *models.User, feature string) (bool, error) {
+	features, err := repository.GetUserFeatures(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range features {
+		if f == feature {
+			return true, nil
+		}
+	}
+	return false, nil
+}
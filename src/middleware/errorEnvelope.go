@@ -0,0 +1,119 @@
+// middleware/errorEnvelope.go
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+)
+
+// ErrorEnvelope is the error mapping of the API: every error response is rendered as
+// {"code": ..., "message": ..., "details": [...]}. A handler returns the error of a service with
+// c.Error(err) and without answering, it is rendered with the status of its apierrors code (500
+// when it carries none). The {"error": ...} bodies of the handlers are rewritten to the
+// envelope, their code given by the status when missing, their fields detailing the problem and
+// their other fields (e.g. allowed_methods, retry_after) kept. Only the routes whose errors are
+// specified are left alone: the token and introspection endpoints of the authorization server
+// (RFC 6749, RFC 7662) and SCIM (RFC 7644).
+func ErrorEnvelope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if path == "/oauth/token" || path == "/oauth/introspect" || strings.HasPrefix(path, "/scim/") {
+			c.Next()
+			return
+		}
+
+		writer := &errorWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.buffered {
+			writer.ResponseWriter.Write(envelope(writer.Status(), writer.body.Bytes()))
+			return
+		}
+		renderError(c)
+	}
+}
+
+// renderError renders the last error of the handlers when none of them answered. The
+// middlewares buffering the response render it into their buffer before releasing it.
+func renderError(c *gin.Context) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+	apiErr := apierrors.From(c.Errors.Last().Err)
+	if apiErr.Code.Status >= 500 {
+		Logger.Printf("Error handling %s %s: %s", c.Request.Method, c.FullPath(), c.Errors.Last().Err)
+	}
+	// drop the headers of the answer the handler gave up on, e.g. a download
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Disposition")
+	c.JSON(apiErr.Code.Status, apiErr.Envelope())
+}
+
+// errorWriter holds the JSON error bodies so they can be rewritten, the other bodies (the
+// streams among them) are written through.
+type errorWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	buffered bool
+}
+
+func (w *errorWriter) Write(data []byte) (int, error) {
+	if w.Status() < 400 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(data)
+	}
+	w.buffered = true
+	return w.body.Write(data)
+}
+
+func (w *errorWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// envelope rewrites an error body to the envelope, the bodies that aren't JSON objects are
+// returned unchanged
+func envelope(status int, body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // keep large IDs exact
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil || fields == nil {
+		return body
+	}
+
+	code, _ := fields["code"].(string)
+	if code == "" {
+		code = apierrors.ForStatus(status).Code
+	}
+	message, _ := fields["message"].(string)
+	if message == "" {
+		message, _ = fields["error"].(string)
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	details, ok := fields["details"]
+	if !ok {
+		details, ok = fields["fields"]
+	}
+	if !ok || details == nil {
+		details = []interface{}{}
+	}
+	for _, name := range []string{"code", "message", "error", "details", "fields"} {
+		delete(fields, name)
+	}
+
+	fields["code"] = code
+	fields["message"] = message
+	fields["details"] = details
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+// middleware/errorEnvelope_test.go
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+)
+
+// errorEnvelopeRouter serves an error returned with c.Error, a 204 and a JSON answer behind
+// the error envelope and the middlewares buffering the response, in the order of the router
+func errorEnvelopeRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorEnvelope(), QueryBudget(), LegacyFieldNames(), Coalesce())
+
+	deprecated := Deprecated(Deprecation{})
+	missing := func(c *gin.Context) {
+		c.Error(apierrors.New(apierrors.NotFound, "User not found"))
+	}
+	r.GET("/users/7", missing)
+	r.GET("/deprecated/users/7", deprecated, missing)
+	r.DELETE("/users/7", func(c *gin.Context) {
+		c.Error(apierrors.New(apierrors.PreconditionFailed, "the user was modified"))
+	})
+	r.DELETE("/sessions/7", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/users/8", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user": gin.H{"full_name": "Ada Lovelace"}})
+	})
+	return r
+}
+
+func TestErrorEnvelopeBehindBufferingMiddlewares(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		header       string // X-Field-Names
+		method, path string
+		status       int
+		code         string // the code of the envelope, no body when empty
+	}{
+		{name: "plain", method: "GET", path: "/users/7", status: 404, code: "not_found"},
+		{name: "coalesced", env: map[string]string{"COALESCE_GETS": "true"}, method: "GET", path: "/users/7", status: 404, code: "not_found"},
+		{name: "legacy field names", header: "legacy", method: "DELETE", path: "/users/7", status: 412, code: "precondition_failed"},
+		{name: "query budget", env: map[string]string{"QUERY_BUDGET_FAIL": "true"}, method: "DELETE", path: "/users/7", status: 412, code: "precondition_failed"},
+		{name: "deprecated", method: "GET", path: "/deprecated/users/7", status: 404, code: "not_found"},
+		{name: "all", env: map[string]string{"COALESCE_GETS": "true", "QUERY_BUDGET_FAIL": "true"}, header: "legacy", method: "GET", path: "/users/7", status: 404, code: "not_found"},
+		{name: "no content", env: map[string]string{"QUERY_BUDGET_FAIL": "true"}, header: "legacy", method: "DELETE", path: "/sessions/7", status: 204},
+		{name: "answered", env: map[string]string{"COALESCE_GETS": "true", "QUERY_BUDGET_FAIL": "true"}, method: "GET", path: "/users/8", status: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Field-Names", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			errorEnvelopeRouter().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d, body %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.code == "" {
+				if tt.status == http.StatusNoContent && rec.Body.Len() > 0 {
+					t.Fatalf("body %s, want none", rec.Body)
+				}
+				return
+			}
+			var envelope struct {
+				Code    string        `json:"code"`
+				Message string        `json:"message"`
+				Details []interface{} `json:"details"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("body %q isn't JSON: %s", rec.Body, err)
+			}
+			if envelope.Code != tt.code || envelope.Message == "" || envelope.Details == nil {
+				t.Fatalf("envelope %+v, want the code %s", envelope, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// middleware/faults.go
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// FaultInjection delays or fails the requests as set by the requests fault when
+// FAULT_INJECTION_ENABLED is set. The fault admin routes are spared, the faults can always
+// be cleared.
+func FaultInjection() gin.HandlerFunc {
+	if !initializers.FaultsEnabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/admin/faults") {
+			c.Next()
+			return
+		}
+
+		if err := initializers.InjectFault(initializers.FaultRequests); err != nil {
+			metrics.Inc("injected_faults_total", initializers.FaultRequests)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, apierrors.InjectedFault.Body("Injected fault"))
+			return
+		}
+		c.Next()
+	}
+}
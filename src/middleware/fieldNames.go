@@ -0,0 +1,154 @@
+// middleware/fieldNames.go
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// legacyFieldNames maps the snake_case field names of the API to the camelCase names
+// they had before, for the clients that haven't migrated yet.
+var legacyFieldNames = map[string]string{
+	"full_name":        "fullName",
+	"profile_picture":  "profilePicture",
+	"last_login_at":    "lastLoginAt",
+	"last_seen_at":     "lastSeenAt",
+	"created_at":       "createdAt",
+	"updated_at":       "updatedAt",
+	"deleted_at":       "deletedAt",
+	"refresh_token":    "refreshToken",
+	"expires_in":       "expiresIn",
+	"expires_at":       "expiresAt",
+	"expires_in_days":  "expiresInDays",
+	"ttl_seconds":      "ttlSeconds",
+	"current_password": "currentPassword",
+	"new_password":     "newPassword",
+	"remember_me":      "rememberMe",
+	"user_id":          "userId",
+	"actor_id":         "actorId",
+	"impersonator_id":  "impersonatorId",
+	"target_id":        "targetId",
+	"status_code":      "statusCode",
+	"client_id":        "clientId",
+	"client_secret":    "clientSecret",
+	"redirect_uris":    "redirectUris",
+	"created_by_id":    "createdById",
+	"last_used_at":     "lastUsedAt",
+	"revoked_at":       "revokedAt",
+	"api_key":          "apiKey",
+	"api_keys":         "apiKeys",
+	"personal_token":   "personalToken",
+	"personal_tokens":  "personalTokens",
+	"total_exact":      "totalExact",
+	"per_page":         "perPage",
+	"delivered_to":     "deliveredTo",
+	"allowed_methods":  "allowedMethods",
+}
+
+// currentFieldNames maps the lowercased legacy names back to the snake_case names. Lowercased
+// because the JSON decoding was case-insensitive, clients sent FullName as well as fullName.
+var currentFieldNames = func() map[string]string {
+	names := make(map[string]string, len(legacyFieldNames))
+	for current, legacy := range legacyFieldNames {
+		names[strings.ToLower(legacy)] = current
+	}
+	return names
+}()
+
+// LegacyFieldNames keeps the former camelCase field names during the transition to snake_case.
+// Clients opt in with the "X-Field-Names: legacy" header, or all of them when
+// JSON_LEGACY_FIELD_NAMES is enabled ("X-Field-Names: snake_case" then opts out). Bodies are
+// translated both ways: requests to the new names, responses to the legacy ones. The OAuth,
+// SCIM and well-known routes follow their specifications and are never translated, nor are the
+// NDJSON streams nor the keys of the free-form metadata, which belong to the clients.
+func LegacyFieldNames() gin.HandlerFunc {
+	legacyByDefault := initializers.GetEnvBool("JSON_LEGACY_FIELD_NAMES", false)
+
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "X-Field-Names")
+
+		legacy := legacyByDefault
+		switch c.GetHeader("X-Field-Names") {
+		case "legacy":
+			legacy = true
+		case "snake_case":
+			legacy = false
+		}
+		path := c.Request.URL.Path
+		if !legacy || strings.HasPrefix(path, "/oauth/") || strings.HasPrefix(path, "/scim/") || strings.HasPrefix(path, "/.well-known/") || WantsNDJSON(c) {
+			c.Next()
+			return
+		}
+		metrics.Inc("legacy_field_names_requests")
+
+		if c.Request.Body != nil && strings.HasPrefix(c.ContentType(), "application/json") {
+			data, _ := io.ReadAll(c.Request.Body)
+			if translated, ok := renameJSONFields(data, func(name string) string {
+				return currentFieldNames[strings.ToLower(name)]
+			}); ok {
+				data = translated
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			c.Request.ContentLength = int64(len(data))
+		}
+
+		// Buffer the response so its fields can be renamed
+		writer := bufferResponse(c)
+
+		body := writer.body.Bytes()
+		if strings.HasPrefix(writer.Header().Get("Content-Type"), "application/json") {
+			if translated, ok := renameJSONFields(body, func(name string) string {
+				return legacyFieldNames[name]
+			}); ok {
+				body = translated
+			}
+		}
+		writer.release(body)
+	}
+}
+
+// renameJSONFields renames the object keys of a JSON document at any depth, rename returning
+// the new name or "" to keep the key. It reports false when the document isn't valid JSON.
+func renameJSONFields(data []byte, rename func(string) string) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keep large IDs exact
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, false
+	}
+
+	out, err := json.Marshal(renameFields(document, rename))
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func renameFields(value interface{}, rename func(string) string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for name, field := range v {
+			if newName := rename(name); newName != "" {
+				name = newName
+			}
+			if strings.EqualFold(name, "metadata") {
+				renamed[name] = field
+				continue
+			}
+			renamed[name] = renameFields(field, rename)
+		}
+		return renamed
+	case []interface{}:
+		for i, item := range v {
+			v[i] = renameFields(item, rename)
+		}
+	}
+	return value
+}
@@ -0,0 +1,120 @@
+// middleware/fieldNames_test.go
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/golden"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// the user of the responses, with every field set so each name is pinned
+func fieldNamesUser() *models.User {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	email := "ada@example.com"
+	return &models.User{
+		ID:              7,
+		FullName:        "Ada Lovelace",
+		Username:        "ada",
+		Email:           &email,
+		Status:          models.Active,
+		Role:            models.Operator,
+		ProfilePicture:  "ada.png",
+		LastLoginAt:     &at,
+		LastSeenAt:      &at,
+		CreatedAt:       at,
+		UpdatedAt:       at,
+		Phone:           "+15551234567",
+		PhoneVerifiedAt: &at,
+		Metadata:        models.Metadata{"team": "analytics", "user_id": "u-7", "createdAt": "2020"},
+	}
+}
+
+// fieldNamesRouter serves a user, a token pair and the field names of the request body behind
+// LegacyFieldNames, and an OAuth route that is never translated
+func fieldNamesRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LegacyFieldNames())
+
+	r.GET("/users/7", func(c *gin.Context) {
+		c.JSON(200, gin.H{"user": dto.FromUser(fieldNamesUser())})
+	})
+	r.POST("/refresh", func(c *gin.Context) {
+		c.JSON(200, gin.H{"token": "access", "refresh_token": "refresh", "expires_in": 900})
+	})
+	r.POST("/echo", func(c *gin.Context) {
+		var body map[string]interface{}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+		// the names as the handler received them, as values so the response isn't translated
+		names := func(fields map[string]interface{}) []string {
+			received := make([]string, 0, len(fields))
+			for name := range fields {
+				received = append(received, name)
+			}
+			sort.Strings(received)
+			return received
+		}
+		metadata, _ := body["metadata"].(map[string]interface{})
+		c.JSON(200, gin.H{"received": names(body), "received_metadata": names(metadata)})
+	})
+	r.GET("/oauth/userinfo", func(c *gin.Context) {
+		c.JSON(200, gin.H{"user_id": 7, "full_name": "Ada Lovelace"})
+	})
+	return r
+}
+
+func TestLegacyFieldNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		legacyDefault string // JSON_LEGACY_FIELD_NAMES
+		header        string // X-Field-Names
+		method, path  string
+		body          string
+	}{
+		{name: "field_names_user_snake_case", method: "GET", path: "/users/7"},
+		{name: "field_names_user_legacy", header: "legacy", method: "GET", path: "/users/7"},
+		{name: "field_names_user_legacy_by_default", legacyDefault: "true", method: "GET", path: "/users/7"},
+		{name: "field_names_user_opt_out", legacyDefault: "true", header: "snake_case", method: "GET", path: "/users/7"},
+		{name: "field_names_tokens_snake_case", method: "POST", path: "/refresh"},
+		{name: "field_names_tokens_legacy", header: "legacy", method: "POST", path: "/refresh"},
+		{name: "field_names_request_legacy", header: "legacy", method: "POST", path: "/echo",
+			body: `{"fullName": "Ada", "FullName": "Ada", "currentPassword": "old", "newPassword": "new", "unknownField": 1}`},
+		{name: "field_names_request_legacy_metadata", header: "legacy", method: "POST", path: "/echo",
+			body: `{"fullName": "Ada", "metadata": {"userId": "u-7", "full_name": "kept", "createdAt": "2020"}}`},
+		{name: "field_names_request_snake_case", method: "POST", path: "/echo",
+			body: `{"full_name": "Ada", "fullName": "Ada"}`},
+		{name: "field_names_oauth_untranslated", header: "legacy", method: "GET", path: "/oauth/userinfo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JSON_LEGACY_FIELD_NAMES", tt.legacyDefault)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Field-Names", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			fieldNamesRouter().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			golden.AssertJSON(t, tt.name, golden.DecodeJSON(t, rec.Body.Bytes()))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// middleware/ifMatch.go
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+)
+
+type ifMatchKey struct{}
+
+// IfMatch stores the ETags of the If-Match header in the request context, for the services to
+// compare with the resource before changing it. With IF_MATCH_REQUIRED=true the requests
+// without the header are answered with a 428, so the clients can't skip the check.
+func IfMatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("If-Match")
+		if header == "" {
+			if initializers.GetEnvBool("IF_MATCH_REQUIRED", false) {
+				c.JSON(428, apierrors.PreconditionRequired.Body("The If-Match header with the ETag of the resource is required"))
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		var etags []string
+		for _, etag := range strings.Split(header, ",") {
+			if etag = strings.TrimSpace(etag); etag != "" {
+				etags = append(etags, etag)
+			}
+		}
+		ctx := context.WithValue(c.Request.Context(), ifMatchKey{}, etags)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// IfMatchFromContext reports whether the ETag satisfies the If-Match header stored by IfMatch,
+// always true without the header. The tags are compared weakly: the ETags of the users are weak,
+// they tell the versions apart but not the derived fields.
+func IfMatchFromContext(ctx context.Context, etag string) bool {
+	etags, ok := ctx.Value(ifMatchKey{}).([]string)
+	if !ok {
+		return true
+	}
+	return etagListMatches(etags, etag)
+}
+
+// NotModified reports whether the If-None-Match header of the request lists the ETag, the
+// client already has the resource and can be answered with a 304.
+func NotModified(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	var etags []string
+	for _, candidate := range strings.Split(header, ",") {
+		etags = append(etags, strings.TrimSpace(candidate))
+	}
+	return etagListMatches(etags, etag)
+}
+
+// etagListMatches compares the ETag with a list of the headers, weakly
+func etagListMatches(etags []string, etag string) bool {
+	for _, candidate := range etags {
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
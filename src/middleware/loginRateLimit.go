@@ -0,0 +1,121 @@
+// middleware/loginRateLimit.go
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+const loginRateLimitPrefix = "ratelimit:login:"
+
+// slidingWindow records an attempt in the sorted set KEYS[1] unless ARGV[3] attempts were
+// already made in the last ARGV[2] milliseconds. It returns 0 when the attempt is allowed,
+// else the milliseconds until the oldest attempt leaves the window.
+var slidingWindow = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= limit then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	return tonumber(oldest[2]) + window - now
+end
+redis.call('ZADD', KEYS[1], now, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], window)
+return 0
+`)
+
+type attemptLimit struct {
+	key   string
+	limit int
+}
+
+// LoginRateLimit limits the login attempts per client IP (LOGIN_RATE_LIMIT_IP, 20 by default)
+// and per username (LOGIN_RATE_LIMIT_USERNAME, 5 by default) within a sliding window of
+// LOGIN_RATE_LIMIT_WINDOW (15m by default). Limited requests get a 429 with Retry-After.
+// Every attempt counts, but the attempts of a username are forgotten when its login succeeds
+// (LoginSucceeded) so others can't lock the account out by logging in less often than its
+// owner. Redis errors let the request through.
+func LoginRateLimit() gin.HandlerFunc {
+	window := initializers.GetEnvDuration("LOGIN_RATE_LIMIT_WINDOW", 15*time.Minute)
+	ipLimit := initializers.GetEnvInt("LOGIN_RATE_LIMIT_IP", 20)
+	usernameLimit := initializers.GetEnvInt("LOGIN_RATE_LIMIT_USERNAME", 5)
+
+	return func(c *gin.Context) {
+		// Read the username and put the body back for the handler
+		data, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		var body struct {
+			Username string `json:"username"`
+		}
+		_ = json.Unmarshal(data, &body)
+
+		limits := []attemptLimit{{loginRateLimitPrefix + "ip:" + c.ClientIP(), ipLimit}}
+		usernameKey := ""
+		if username := strings.ToLower(body.Username); username != "" {
+			usernameKey = loginRateLimitPrefix + "user:" + utils.HashToken(username)
+			limits = append(limits, attemptLimit{usernameKey, usernameLimit})
+		}
+
+		for _, l := range limits {
+			if l.limit <= 0 {
+				continue
+			}
+
+			retryAfter, err := allowAttempt(c, l.key, window, l.limit)
+			if err != nil {
+				Logger.Printf("Error checking login rate limit: %s", err)
+				continue
+			}
+			if retryAfter > 0 {
+				metrics.Inc("login_rate_limited_total")
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				c.JSON(http.StatusTooManyRequests, apierrors.LoginRateLimited.Body("Too many login attempts, please try again later"))
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+
+		if usernameKey != "" && c.GetBool(loginSucceededKey) {
+			if err := initializers.RedisClient.Del(c.Request.Context(), usernameKey).Err(); err != nil {
+				Logger.Printf("Error resetting login rate limit: %s", err)
+			}
+		}
+	}
+}
+
+const loginSucceededKey = "login_succeeded"
+
+// LoginSucceeded tells LoginRateLimit the credentials of the request were right.
+func LoginSucceeded(c *gin.Context) {
+	c.Set(loginSucceededKey, true)
+}
+
+// allowAttempt records an attempt on key, it returns how long to wait when the limit is reached.
+func allowAttempt(c *gin.Context, key string, window time.Duration, limit int) (time.Duration, error) {
+	now := time.Now()
+	member := strconv.FormatInt(now.UnixNano(), 10)
+
+	wait, err := slidingWindow.Run(c.Request.Context(), initializers.RedisClient, []string{key},
+		now.UnixMilli(), window.Milliseconds(), limit, member).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,17 @@
+// middleware/ndjson.go
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NDJSONContentType is the media type of the streamed listings, one JSON document per line.
+const NDJSONContentType = "application/x-ndjson"
+
+// WantsNDJSON reports whether the client asked for a streamed listing. The streams are written
+// as they are read, the middlewares buffering the responses let them through.
+func WantsNDJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), NDJSONContentType)
+}
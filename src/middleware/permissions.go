@@ -0,0 +1,122 @@
+// middleware/permissions.go
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// the permissions of each role, reloaded from the database every PERMISSIONS_CACHE_TTL
+var permissionCache struct {
+	sync.Mutex
+	grants   map[models.Role]map[string]bool
+	loadedAt time.Time
+}
+
+// RequirePermission is a middleware that checks the role of the user grants the permission.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found in context"})
+			c.Abort()
+			return
+		}
+
+		allowed, err := HasPermission(c.Request.Context(), user.(*models.User).Role, permission)
+		if err != nil {
+			Logger.Printf("Error loading role permissions: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, apierrors.AccessDenied.Body("Access denied."))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the role grants the permission.
+func HasPermission(ctx context.Context, role models.Role, permission string) (bool, error) {
+	grants, err := rolePermissions(ctx)
+	if err != nil {
+		return false, err
+	}
+	return grants[role][permission], nil
+}
+
+// IsEscalation reports whether the role to grants a permission the role from lacks.
+func IsEscalation(ctx context.Context, from, to models.Role) (bool, error) {
+	grants, err := rolePermissions(ctx)
+	if err != nil {
+		return false, err
+	}
+	for permission := range grants[to] {
+		if !grants[from][permission] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LoadPermissions loads the roles and their permissions, making the roles known to
+// the validation of the role fields. Changes made by other instances are picked up
+// after PERMISSIONS_CACHE_TTL (30s by default).
+func LoadPermissions(ctx context.Context) error {
+	roles, err := repository.GetAllRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	grants := make(map[models.Role]map[string]bool, len(roles))
+	names := make([]models.Role, len(roles))
+	for i, role := range roles {
+		names[i] = models.Role(role.Name)
+		grants[names[i]] = map[string]bool{}
+		for _, permission := range role.Permissions {
+			grants[names[i]][permission.Name] = true
+		}
+	}
+	models.SetRoles(names)
+
+	permissionCache.Lock()
+	defer permissionCache.Unlock()
+	permissionCache.grants = grants
+	permissionCache.loadedAt = time.Now()
+	return nil
+}
+
+func rolePermissions(ctx context.Context) (map[models.Role]map[string]bool, error) {
+	permissionCache.Lock()
+	grants, loadedAt := permissionCache.grants, permissionCache.loadedAt
+	permissionCache.Unlock()
+
+	if grants != nil && time.Since(loadedAt) < initializers.GetEnvDuration("PERMISSIONS_CACHE_TTL", 30*time.Second) {
+		return grants, nil
+	}
+
+	if err := LoadPermissions(ctx); err != nil {
+		// keep serving the last known permissions when the database is unavailable
+		if grants != nil {
+			Logger.Printf("Error reloading role permissions: %s", err)
+			return grants, nil
+		}
+		return nil, err
+	}
+
+	permissionCache.Lock()
+	defer permissionCache.Unlock()
+	return permissionCache.grants, nil
+}
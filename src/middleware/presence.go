@@ -0,0 +1,76 @@
+// middleware/presence.go
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// PresenceKey is the Redis sorted set holding the last seen unix time of every user.
+const PresenceKey = "presence:last_seen"
+
+const presenceThrottlePrefix = "presence:throttle:"
+
+// TrackPresence records when the authenticated user was last seen. Updates are throttled
+// through Redis to one per PRESENCE_THROTTLE (1 minute by default) per user.
+func TrackPresence() gin.HandlerFunc {
+	throttle := initializers.GetEnvDuration("PRESENCE_THROTTLE", time.Minute)
+
+	return func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.Next()
+			return
+		}
+		u, ok := user.(*models.User)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		userID := strconv.FormatUint(uint64(u.ID), 10)
+
+		// Only the first request in the throttle window updates the last seen time
+		first, err := initializers.RedisClient.SetNX(ctx, presenceThrottlePrefix+userID, "1", throttle).Result()
+		if err != nil {
+			Logger.Printf("Error throttling presence update: %s", err)
+		}
+
+		if first {
+			now := time.Now()
+			err := initializers.RedisClient.ZAdd(ctx, PresenceKey, &redis.Z{Score: float64(now.Unix()), Member: userID}).Err()
+			if err != nil {
+				Logger.Printf("Error updating presence: %s", err)
+			}
+			if err := repository.UpdateLastSeen(ctx, u, now); err != nil {
+				Logger.Printf("Error updating last seen: %s", err)
+			}
+		}
+
+		// Sessions keep their own last seen time, throttled the same way
+		if claims, ok := c.Get("claims"); ok {
+			if sid, ok := claims.(jwt.MapClaims)["sid"].(float64); ok {
+				sessionID := strconv.FormatUint(uint64(sid), 10)
+				first, err := initializers.RedisClient.SetNX(ctx, presenceThrottlePrefix+"session:"+sessionID, "1", throttle).Result()
+				if err != nil {
+					Logger.Printf("Error throttling session presence update: %s", err)
+				}
+				if first {
+					if err := repository.UpdateSessionLastSeen(ctx, uint(sid), time.Now()); err != nil {
+						Logger.Printf("Error updating session last seen: %s", err)
+					}
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
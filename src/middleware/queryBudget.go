@@ -0,0 +1,54 @@
+// middleware/queryBudget.go
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// QueryBudget counts the database queries run by each request and logs the requests using
+// more than QUERY_BUDGET queries (20 by default, 0 disables the check), catching N+1 patterns.
+// With QUERY_BUDGET_FAIL=true (meant for development) those requests fail with a 500.
+func QueryBudget() gin.HandlerFunc {
+	budget := int64(initializers.GetEnvInt("QUERY_BUDGET", 20))
+	fail := initializers.GetEnvBool("QUERY_BUDGET_FAIL", false)
+
+	return func(c *gin.Context) {
+		if budget <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, counter := initializers.WithQueryCounter(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+
+		if !fail || WantsNDJSON(c) {
+			c.Next()
+			if queries := atomic.LoadInt64(counter); queries > budget {
+				overBudget(c, queries, budget)
+			}
+			return
+		}
+
+		// Buffer the response so it can be replaced when the budget is exceeded
+		writer := bufferResponse(c)
+
+		if queries := atomic.LoadInt64(counter); queries > budget {
+			overBudget(c, queries, budget)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Query budget exceeded", "code": apierrors.QueryBudgetExceeded.Code, "queries": queries, "budget": budget})
+			return
+		}
+		writer.release(writer.body.Bytes())
+	}
+}
+
+func overBudget(c *gin.Context, queries, budget int64) {
+	route := c.Request.Method + " " + c.FullPath()
+	metrics.Inc("query_budget_exceeded", route)
+	Logger.Printf("Query budget exceeded by %s: %d queries (budget %d)", route, queries, budget)
+}
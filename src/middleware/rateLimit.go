@@ -0,0 +1,38 @@
+// middleware/rateLimit.go
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// IPRateLimit limits the requests of a client IP to limit within a sliding window, counted
+// apart for each name. Limited requests get a 429 with Retry-After, Redis errors let the
+// request through and a limit of 0 disables it.
+func IPRateLimit(name string, limit int, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		retryAfter, err := allowAttempt(c, "ratelimit:"+name+":ip:"+c.ClientIP(), window, limit)
+		if err != nil {
+			Logger.Printf("Error checking %s rate limit: %s", name, err)
+		} else if retryAfter > 0 {
+			metrics.Inc("rate_limited_total", name)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, apierrors.RateLimited.Body("Too many requests, please try again later"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,23 @@
+// middleware/scim.go
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMErrorSchema is the schema of the SCIM error answers.
+const SCIMErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+// SCIMError answers a SCIM error (RFC 7644, section 3.12).
+func SCIMError(c *gin.Context, status int, detail string) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, gin.H{"schemas": []string{SCIMErrorSchema}, "status": strconv.Itoa(status), "detail": detail})
+}
+
+// SCIMAuth authenticates the provisioning client of the identity provider with the bearer
+// token of SCIM_BEARER_TOKEN. The SCIM endpoints are disabled when it is not set.
+func SCIMAuth() gin.HandlerFunc {
+	return StaticBearerAuth("SCIM_BEARER_TOKEN", "SCIM provisioning", SCIMError)
+}
@@ -0,0 +1,93 @@
+// middleware/shadow.go
+package middleware
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// the credential headers, sent to the shadow only with SHADOW_FORWARD_CREDENTIALS
+var credentialHeaders = []string{"Authorization", "Cookie", "X-API-Key"}
+
+// the routes never mirrored, their URL carries a single-use token the shadow would redeem
+var unshadowedRoutes = map[string]bool{
+	"/login/magic/verify":   true,
+	"/oauth/authorize":      true,
+	"/action/reports/:name": true,
+}
+
+// Shadow mirrors a percentage of read requests (GET/HEAD) to SHADOW_BASE_URL and logs
+// when the shadow status code differs from ours. The mirrored calls run asynchronously
+// and never affect the response. SHADOW_PERCENT sets the mirrored share (default 10).
+// The credentials (bearer token, API key, cookies) are stripped and the requests
+// authenticated with them aren't mirrored, unless SHADOW_FORWARD_CREDENTIALS=true trusts the
+// shadow with them.
+func Shadow() gin.HandlerFunc {
+	baseURL := strings.TrimSuffix(initializers.GetEnv("SHADOW_BASE_URL", ""), "/")
+	percent := initializers.GetEnvInt("SHADOW_PERCENT", 10)
+	forwardCredentials := initializers.GetEnvBool("SHADOW_FORWARD_CREDENTIALS", false)
+	if baseURL == "" || percent <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	client := &http.Client{Timeout: initializers.GetEnvDuration("SHADOW_TIMEOUT", 5*time.Second)}
+
+	return func(c *gin.Context) {
+		if (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) || rand.Intn(100) >= percent {
+			c.Next()
+			return
+		}
+		if unshadowedRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+		// without its credentials the request would only exercise the 401 of the shadow
+		authenticated := c.GetHeader("Authorization") != "" || c.GetHeader("X-API-Key") != "" || SessionCookie(c) != ""
+		if authenticated && !forwardCredentials {
+			c.Next()
+			return
+		}
+
+		// Build the mirrored request before the handlers run
+		shadowReq, err := http.NewRequest(c.Request.Method, baseURL+c.Request.URL.RequestURI(), nil)
+		if err != nil {
+			Logger.Printf("Error building shadow request: %s", err)
+			c.Next()
+			return
+		}
+		shadowReq.Header = c.Request.Header.Clone()
+		if !forwardCredentials {
+			for _, name := range credentialHeaders {
+				shadowReq.Header.Del(name)
+			}
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		route := c.Request.Method + " " + c.FullPath()
+		go func() {
+			resp, err := client.Do(shadowReq)
+			if err != nil {
+				metrics.Inc("shadow_requests_failed", route)
+				Logger.Printf("Shadow request %s %s failed: %s", shadowReq.Method, shadowReq.URL, err)
+				return
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != status {
+				metrics.Inc("shadow_status_mismatch", route)
+				Logger.Printf("Shadow status mismatch for %s %s: primary=%d shadow=%d",
+					shadowReq.Method, shadowReq.URL.RequestURI(), status, resp.StatusCode)
+				return
+			}
+			metrics.Inc("shadow_status_match", route)
+		}()
+	}
+}
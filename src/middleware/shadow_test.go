@@ -0,0 +1,77 @@
+// middleware/shadow_test.go
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shadowRouter mirrors every read request to a shadow server, which sends the headers of the
+// mirrored requests on the returned channel
+func shadowRouter(t *testing.T, forwardCredentials string) (*gin.Engine, <-chan http.Header) {
+	mirrored := make(chan http.Header, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- r.Header
+	}))
+	t.Cleanup(shadow.Close)
+
+	t.Setenv("SHADOW_BASE_URL", shadow.URL)
+	t.Setenv("SHADOW_PERCENT", "100")
+	t.Setenv("SHADOW_FORWARD_CREDENTIALS", forwardCredentials)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Shadow())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/users/7", ok)
+	r.GET("/login/magic/verify", ok)
+	r.GET("/action/reports/:name", ok)
+	return r, mirrored
+}
+
+// mirroredHeaders serves the request and returns the headers the shadow received, nil when it
+// wasn't mirrored
+func mirroredHeaders(r *gin.Engine, mirrored <-chan http.Header, path string, header http.Header) http.Header {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header = header
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case received := <-mirrored:
+		return received
+	case <-time.After(200 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestShadowCredentials(t *testing.T) {
+	credentials := http.Header{"Authorization": {"Bearer secret"}, "X-Api-Key": {"key"}, "Cookie": {"theme=dark"}}
+
+	r, mirrored := shadowRouter(t, "false")
+	if received := mirroredHeaders(r, mirrored, "/users/7", credentials.Clone()); received != nil {
+		t.Fatalf("authenticated request mirrored without SHADOW_FORWARD_CREDENTIALS, headers %v", received)
+	}
+	received := mirroredHeaders(r, mirrored, "/users/7", http.Header{"Cookie": {"theme=dark"}, "Accept": {"application/json"}})
+	if received == nil || received.Get("Cookie") != "" || received.Get("Accept") != "application/json" {
+		t.Fatalf("anonymous request mirrored with headers %v, want the cookies stripped", received)
+	}
+
+	r, mirrored = shadowRouter(t, "true")
+	received = mirroredHeaders(r, mirrored, "/users/7", credentials.Clone())
+	if received == nil || received.Get("Authorization") != "Bearer secret" || received.Get("X-API-Key") != "key" {
+		t.Fatalf("request mirrored with headers %v, want the credentials forwarded", received)
+	}
+}
+
+func TestShadowSingleUseTokenRoutes(t *testing.T) {
+	r, mirrored := shadowRouter(t, "true")
+	for _, path := range []string{"/login/magic/verify?token=abc", "/action/reports/users.csv?token=abc"} {
+		if received := mirroredHeaders(r, mirrored, path, http.Header{}); received != nil {
+			t.Errorf("%s mirrored, its token would be redeemed by the shadow", path)
+		}
+	}
+}
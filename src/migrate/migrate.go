@@ -4,14 +4,46 @@ package migrate
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
 	"github.com/nabazesmail/gopher/src/initializers"
 	"github.com/nabazesmail/gopher/src/models"
 )
 
+// models kept in sync with the database schema
+var migratedModels = []interface{}{
+	&models.User{},
+	&models.AuditLog{},
+	&models.UserIdentity{},
+	&models.APIKey{},
+	&models.Session{},
+	&models.OAuthClient{},
+	&models.LoginEvent{},
+	&models.Invite{},
+	&models.Permission{},
+	&models.RoleDefinition{},
+	&models.Notification{},
+	&models.NotificationPreference{},
+	&models.DeviceToken{},
+	&models.Broadcast{},
+	&models.BroadcastStat{},
+	&models.ExportWatermark{},
+	&models.UsernameHistory{},
+	&models.Entitlement{},
+	&models.Approval{},
+	&models.BreakGlassActivation{},
+	&models.UserPreferences{},
+}
+
+// Models returns the models kept in sync with the database schema.
+func Models() []interface{} {
+	return migratedModels
+}
+
 func Migration() {
 	// Load environment variables and connect to the database
 	initializers.LoadEnvVariables()
@@ -30,16 +62,127 @@ func Migration() {
 	migrator := initializers.DB.WithContext(initializers.DB.Statement.Context)
 	migrator.Logger = migrationLogger
 
-	// this Checks if the User table exists in the database
-	if migrator.Migrator().HasTable(&models.User{}) {
-		fmt.Println("Database schema is up to date. No migration needed.")
-	} else {
-		// this Runs the auto migration for the User model
-		err := migrator.AutoMigrate(&models.User{})
+	// this Runs the auto migration for all models, it only adds missing tables and columns
+	err := migrator.AutoMigrate(migratedModels...)
+	if err != nil {
+		log.Fatalf("Failed to run auto migration: %v", err)
+	}
+
+	if err := SeedRoles(migrator); err != nil {
+		log.Fatalf("Failed to seed the roles: %v", err)
+	}
+	ensureUserConstraints(migrator)
+	ensureUserSearchIndex(migrator)
+
+	fmt.Println("Database schema is up to date.")
+}
+
+// OperatorPermissions are the operator permissions when the role is first created, admins can
+// change them afterwards.
+var OperatorPermissions = []string{models.PermUsersRead, models.PermProfileRead}
+
+// SeedRoles makes sure every permission of the catalog exists, as well as the built-in
+// roles: admin, always granted every permission, and operator
+func SeedRoles(db *gorm.DB) error {
+	for _, permission := range models.PermissionCatalog {
+		p := permission
+		err := db.Where(models.Permission{Name: p.Name}).Assign(models.Permission{Description: p.Description}).FirstOrCreate(&p).Error
 		if err != nil {
-			log.Fatalf("Failed to run auto migration: %v", err)
+			return fmt.Errorf("seeding the %s permission: %w", p.Name, err)
 		}
+	}
+
+	var all, operator []models.Permission
+	if err := db.Order("id").Find(&all).Error; err != nil {
+		return fmt.Errorf("reading the permissions: %w", err)
+	}
+	for _, p := range all {
+		for _, name := range OperatorPermissions {
+			if p.Name == name {
+				operator = append(operator, p)
+			}
+		}
+	}
 
-		fmt.Println("Database schema updated successfully.")
+	builtIn := []struct {
+		role        models.RoleDefinition
+		permissions []models.Permission
+		always      bool // granted on every migration, not only on creation
+	}{
+		{models.RoleDefinition{Name: string(models.Admin), Description: "Full access", BuiltIn: true}, all, true},
+		{models.RoleDefinition{Name: string(models.Operator), Description: "Read access to the users", BuiltIn: true}, operator, false},
+	}
+	for _, b := range builtIn {
+		role := b.role
+		result := db.Where(models.RoleDefinition{Name: role.Name}).Attrs(role).FirstOrCreate(&role)
+		if result.Error != nil {
+			return fmt.Errorf("seeding the %s role: %w", role.Name, result.Error)
+		}
+		if b.always || result.RowsAffected > 0 {
+			if err := db.Model(&role).Association("Permissions").Replace(b.permissions); err != nil {
+				return fmt.Errorf("granting the %s role permissions: %w", role.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// database level guarantees for the status column, behind the services validation
+var userCheckConstraints = []struct{ name, check string }{
+	{"chk_users_status", "status IN ('active', 'inactive')"},
+}
+
+// ensureUserConstraints makes sure status is an ENUM column with a CHECK constraint and role
+// a column referencing the roles table
+func ensureUserConstraints(db *gorm.DB) {
+	columnTypes, err := db.Migrator().ColumnTypes(&models.User{})
+	if err != nil {
+		log.Fatalf("Failed to read users column types: %v", err)
+	}
+
+	for _, column := range columnTypes {
+		isEnum := strings.EqualFold(column.DatabaseTypeName(), "enum")
+		if (column.Name() == "status" && !isEnum) || (column.Name() == "role" && isEnum) {
+			if err := db.Migrator().AlterColumn(&models.User{}, column.Name()); err != nil {
+				log.Fatalf("Failed to convert users.%s: %v", column.Name(), err)
+			}
+			fmt.Printf("Converted users.%s to its model column type.\n", column.Name())
+		}
+	}
+
+	// custom roles replaced the fixed list of the former role constraint
+	if db.Migrator().HasConstraint(&models.User{}, "chk_users_role") {
+		if err := db.Exec("ALTER TABLE users DROP CHECK chk_users_role").Error; err != nil {
+			log.Fatalf("Failed to drop the chk_users_role constraint: %v", err)
+		}
+		fmt.Println("Dropped the chk_users_role constraint.")
+	}
+	if !db.Migrator().HasConstraint(&models.User{}, "fk_users_role") {
+		err := db.Exec("ALTER TABLE users ADD CONSTRAINT fk_users_role FOREIGN KEY (role) REFERENCES roles (name) ON UPDATE CASCADE").Error
+		if err != nil {
+			log.Fatalf("Failed to add the fk_users_role constraint: %v", err)
+		}
+		fmt.Println("Added the fk_users_role constraint.")
+	}
+
+	for _, constraint := range userCheckConstraints {
+		if db.Migrator().HasConstraint(&models.User{}, constraint.name) {
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE users ADD CONSTRAINT %s CHECK (%s)", constraint.name, constraint.check)).Error; err != nil {
+			log.Fatalf("Failed to add the %s constraint: %v", constraint.name, err)
+		}
+		fmt.Printf("Added the %s constraint.\n", constraint.name)
+	}
+}
+
+// ensureUserSearchIndex adds the FULLTEXT index ranking the user search results
+func ensureUserSearchIndex(db *gorm.DB) {
+	if db.Migrator().HasIndex(&models.User{}, "ft_users_search") {
+		return
+	}
+	if err := db.Exec("ALTER TABLE users ADD FULLTEXT INDEX ft_users_search (full_name, username)").Error; err != nil {
+		log.Fatalf("Failed to add the ft_users_search index: %v", err)
 	}
+	fmt.Println("Added the ft_users_search index.")
 }
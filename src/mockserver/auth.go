@@ -0,0 +1,167 @@
+// mockserver/auth.go
+package mockserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// registering a user; the invites aren't served, the registrations are open
+func (s *server) register(c *gin.Context) {
+	var body dto.CreateUserRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user := body.ToUser()
+	if body.Email != "" {
+		user.Email = &body.Email
+	}
+	if err := s.createUser(user); err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(201, gin.H{"user": dto.FromUser(user)})
+}
+
+// createUser validates the user like the API, hashes its password and saves it
+func (s *server) createUser(user *models.User) error {
+	if err := services.ValidateNewUser(user); err != nil {
+		return err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hashed)
+	return s.store.create(user)
+}
+
+// logging in with username and password, the SMS second factor and the cookie sessions aren't
+// served
+func (s *server) login(c *gin.Context) {
+	var body dto.LoginRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if body.Username == "" || body.Password == "" {
+		c.JSON(400, gin.H{"error": "Username and password must be provided"})
+		return
+	}
+
+	user := s.store.userByUsername(body.Username)
+	if user == nil || user.Status != models.Active ||
+		bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)) != nil {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	s.store.touch(user.ID, true)
+	s.answerTokens(c, user.ID)
+}
+
+// refreshing the access token with a refresh token, which can't be used again
+func (s *server) refresh(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+		c.JSON(400, gin.H{"error": "Refresh token must be provided"})
+		return
+	}
+
+	userID, ok, reused := s.store.redeemRefresh(body.RefreshToken)
+	if reused {
+		c.JSON(401, gin.H{"error": "Refresh token already used, please log in again"})
+		return
+	}
+	if !ok || s.store.user(userID, false) == nil {
+		c.JSON(401, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	s.answerTokens(c, userID)
+}
+
+// answering a login or a refresh with a new token pair of the user
+func (s *server) answerTokens(c *gin.Context, userID uint) {
+	access, refresh, err := s.store.issueTokens(userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"token":         access,
+		"refresh_token": refresh,
+		"expires_in":    accessTokenExpiresIn,
+	})
+}
+
+// logging out, revokes the access token of the request and the given refresh token
+func (s *server) logout(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// The body is optional
+	_ = c.ShouldBindJSON(&body)
+
+	s.store.revoke(c.GetString("token"), body.RefreshToken)
+	c.JSON(200, gin.H{"message": "Logged out successfully"})
+}
+
+// getting the short form of the user of the token
+func (s *server) me(c *gin.Context) {
+	user, _ := c.Get("user")
+	u := user.(*models.User)
+	applyOnline(u)
+
+	c.JSON(http.StatusOK, gin.H{"user": dto.UserSummary{
+		ID:       u.ID,
+		FullName: u.FullName,
+		Username: u.Username,
+		Email:    u.Email,
+		Status:   string(u.Status),
+		Role:     string(u.Role),
+		Online:   u.Online,
+	}})
+}
+
+// getting the preferences of the user of the token, the defaults when never set
+func (s *server) getMyPreferences(c *gin.Context) {
+	user, _ := c.Get("user")
+	c.JSON(200, gin.H{"preferences": s.store.getPreferences(user.(*models.User).ID)})
+}
+
+// replacing the preferences of the user of the token
+func (s *server) updateMyPreferences(c *gin.Context) {
+	var preferences models.UserPreferences
+	if err := c.ShouldBindJSON(&preferences); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, _ := c.Get("user")
+	preferences.UserID = user.(*models.User).ID
+	if err := services.ValidateUserPreferences(&preferences); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.store.setPreferences(&preferences)
+	c.JSON(200, gin.H{"preferences": preferences})
+}
@@ -0,0 +1,144 @@
+// mockserver/mockserver.go
+package mockserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/controllers"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// the lifetime of the access tokens the mock server answers with, they don't expire
+const accessTokenExpiresIn = 15 * 60
+
+// server answers the routes from the store
+type server struct {
+	store *Store
+}
+
+// NewRouter returns the routes of the mock server: the API surface of the client package
+// (register, login, refresh, logout, /me, /me/preferences and the /users routes) served from
+// the store, without MySQL or Redis. The requests are validated by the services and answered
+// with the bodies, statuses and error codes of the API; the tokens are opaque and only known
+// to the store. The side effects of the API (audit logs, emails, webhooks, search index) and
+// the history of the users (?as_of=) are left out.
+func NewRouter(store *Store) *gin.Engine {
+	gin.SetMode(initializers.GetEnv("GIN_MODE", gin.DebugMode))
+
+	s := &server{store: store}
+	r := gin.Default()
+
+	//  the same JSON answers as the API for the unknown routes and methods
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(controllers.NotFound)
+	r.NoMethod(controllers.MethodNotAllowed)
+
+	//  the same error envelope as the API
+	r.Use(middleware.ErrorEnvelope())
+
+	r.GET("/errors", controllers.GetErrorCatalog)
+
+	r.POST("/register", s.register)
+	r.POST("/login", s.login)
+	r.POST("/refresh", s.refresh)
+
+	protected := r.Group("/", s.authenticate)
+	protected.POST("/logout", s.logout)
+
+	protected.GET("/me", requirePermission(models.PermProfileRead), s.me)
+	protected.GET("/profile", requirePermission(models.PermProfileRead), s.me)
+	protected.GET("/me/preferences", s.getMyPreferences)
+	protected.PUT("/me/preferences", s.updateMyPreferences)
+
+	protected.POST("/users/bulk", requirePermission(models.PermUsersCreate), s.createUsersBulk)
+	protected.GET("/users", requirePermission(models.PermUsersRead), s.getAllUsers)
+	protected.GET("/users/batch", requirePermission(models.PermUsersRead), s.getUsersBatch)
+	protected.POST("/users/batch", requirePermission(models.PermUsersRead), s.getUsersBatch)
+	protected.GET("/users/online", requirePermission(models.PermUsersRead), s.getOnlineUsers)
+	protected.GET("/users/search", requirePermission(models.PermUsersRead), s.searchUsers)
+	protected.GET("/users/by-username/:username", requirePermission(models.PermUsersRead), s.getUserByUsername)
+	protected.GET("/users/:id", requirePermission(models.PermUsersRead), s.getUserByID)
+	protected.PUT("/users/:id", requirePermission(models.PermUsersUpdate), middleware.IfMatch(), s.updateUserByID)
+	protected.PATCH("/users/:id", requirePermission(models.PermUsersUpdate), middleware.IfMatch(), s.patchUserByID)
+	protected.DELETE("/users/:id", requirePermission(models.PermUsersDelete), middleware.IfMatch(), s.deleteUserByID)
+	protected.POST("/users/:id/restore", requirePermission(models.PermUsersDelete), s.restoreUserByID)
+
+	return r
+}
+
+// authenticate is the AuthMiddleware of the mock server: the bearer token must be one the
+// store issued, the user is set in the context
+func (s *server) authenticate(c *gin.Context) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header not provided"})
+		c.Abort()
+		return
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header || token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header"})
+		c.Abort()
+		return
+	}
+
+	userID, ok := s.store.tokenUser(token)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+	user := s.store.user(userID, false)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+
+	s.store.touch(user.ID, false)
+	c.Set("user", user)
+	c.Set("token", token)
+	c.Next()
+}
+
+// requirePermission is RequirePermission with the grants of the built-in roles
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, apierrors.AccessDenied.Body("Access denied."))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// hasPermission reports whether the role of the user of the request grants the permission
+func hasPermission(c *gin.Context, permission string) bool {
+	user, _ := c.Get("user")
+	return grants[user.(*models.User).Role][permission]
+}
+
+// applyOnline sets the Online flag of the users seen within PRESENCE_WINDOW, like the API
+func applyOnline(users ...*models.User) {
+	window := initializers.GetEnvDuration("PRESENCE_WINDOW", 5*time.Minute)
+	for _, user := range users {
+		user.Online = user.LastSeenAt != nil && time.Since(*user.LastSeenAt) < window
+	}
+}
+
+// parseUserID reads the ID of the path, 0 for one that isn't a user ID
+func parseUserID(c *gin.Context) uint {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
@@ -0,0 +1,355 @@
+// mockserver/store.go
+package mockserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/migrate"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// errTaken is returned when the username or the email of a user belongs to another one
+var errTaken = errors.New("the username or email is already taken")
+
+// Fixtures are the data the mock server starts with. The passwords of the users are in clear,
+// they are hashed on load; the IDs are given in order when left out.
+type Fixtures struct {
+	Users []*models.User `json:"users"`
+}
+
+// DefaultFixtures are served without a fixtures file: an admin (admin / Admin12345) and an
+// operator (operator / Operator123).
+func DefaultFixtures() *Fixtures {
+	adminEmail, operatorEmail := "admin@example.com", "operator@example.com"
+	return &Fixtures{Users: []*models.User{
+		{FullName: "Mock Admin", Username: "admin", Email: &adminEmail, Password: "Admin12345", Status: models.Active, Role: models.Admin},
+		{FullName: "Mock Operator", Username: "operator", Email: &operatorEmail, Password: "Operator123", Status: models.Active, Role: models.Operator},
+	}}
+}
+
+// LoadFixtures reads the fixtures of the JSON file, e.g. {"users": [{"username": "alice", ...}]}.
+func LoadFixtures(path string) (*Fixtures, error) {
+	useBuiltInRoles() // the roles of the users are validated on decoding
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures Fixtures
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return &fixtures, nil
+}
+
+// the permissions of the built-in roles, as the migration first grants them: the mock
+// server has no custom roles
+var grants = map[models.Role]map[string]bool{
+	models.Admin:    {},
+	models.Operator: {},
+}
+
+func init() {
+	for _, permission := range models.PermissionCatalog {
+		grants[models.Admin][permission.Name] = true
+	}
+	for _, name := range migrate.OperatorPermissions {
+		grants[models.Operator][name] = true
+	}
+}
+
+// useBuiltInRoles makes the built-in roles the known ones, for the validation of the role fields
+func useBuiltInRoles() {
+	models.SetRoles([]models.Role{models.Admin, models.Operator})
+}
+
+// Store holds the users, their preferences and tokens in memory, for one mock server.
+type Store struct {
+	mu            sync.Mutex
+	users         map[uint]*models.User
+	nextID        uint
+	preferences   map[uint]*models.UserPreferences
+	accessTokens  map[string]uint
+	refreshTokens map[string]uint
+	usedRefresh   map[string]bool
+}
+
+// NewStore returns a store with the users of the fixtures.
+func NewStore(fixtures *Fixtures) (*Store, error) {
+	useBuiltInRoles()
+
+	s := &Store{
+		users:         map[uint]*models.User{},
+		nextID:        1,
+		preferences:   map[uint]*models.UserPreferences{},
+		accessTokens:  map[string]uint{},
+		refreshTokens: map[string]uint{},
+		usedRefresh:   map[string]bool{},
+	}
+	now := time.Now()
+	for _, fixture := range fixtures.Users {
+		user := *fixture
+		// the fixtures are trusted, the cheapest cost keeps the startup fast
+		hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.MinCost)
+		if err != nil {
+			return nil, fmt.Errorf("hashing the password of %s: %w", user.Username, err)
+		}
+		user.Password = string(hashed)
+		if user.Status == "" {
+			user.Status = models.Active
+		}
+		if user.Role == "" {
+			user.Role = models.Operator
+		}
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = now
+		}
+		if user.UpdatedAt.IsZero() {
+			user.UpdatedAt = user.CreatedAt
+		}
+		if user.ID == 0 {
+			user.ID = s.nextID
+		}
+		if _, exists := s.users[user.ID]; exists {
+			return nil, fmt.Errorf("two users with the ID %d", user.ID)
+		}
+		if s.taken(&user) {
+			return nil, fmt.Errorf("the username or email of %s is already taken", user.Username)
+		}
+		s.users[user.ID] = &user
+		if user.ID >= s.nextID {
+			s.nextID = user.ID + 1
+		}
+	}
+	return s, nil
+}
+
+// taken reports whether another user has the username, case insensitive like the column, or
+// the email of the user; the store is locked
+func (s *Store) taken(user *models.User) bool {
+	for _, other := range s.users {
+		if other.ID == user.ID {
+			continue
+		}
+		if strings.EqualFold(other.Username, user.Username) {
+			return true
+		}
+		if user.Email != nil && other.Email != nil && *other.Email == *user.Email {
+			return true
+		}
+	}
+	return false
+}
+
+// user returns a copy of the user of the ID, nil when there is none or it is deleted unless
+// deleted is set
+func (s *Store) user(id uint, deleted bool) *models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok || (user.DeletedAt.Valid && !deleted) {
+		return nil
+	}
+	copied := *user
+	return &copied
+}
+
+// userByUsername returns a copy of the user of the username, nil when there is none
+func (s *Store) userByUsername(username string) *models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if !user.DeletedAt.Valid && strings.EqualFold(user.Username, username) {
+			copied := *user
+			return &copied
+		}
+	}
+	return nil
+}
+
+// allUsers returns copies of the users, with the deleted ones when deleted is set
+func (s *Store) allUsers(deleted bool) []*models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]*models.User, 0, len(s.users))
+	for _, user := range s.users {
+		if user.DeletedAt.Valid && !deleted {
+			continue
+		}
+		copied := *user
+		users = append(users, &copied)
+	}
+	return users
+}
+
+// create saves a new user, giving it an ID, or returns errTaken
+func (s *Store) create(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.taken(user) {
+		return errTaken
+	}
+	user.ID = s.nextID
+	s.nextID++
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	copied := *user
+	s.users[user.ID] = &copied
+	return nil
+}
+
+// save replaces the user, unless it was deleted meanwhile (false) or its username or email is
+// taken (errTaken); its update time is set
+func (s *Store) save(user *models.User) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[user.ID]
+	if !ok || current.DeletedAt.Valid {
+		return false, nil
+	}
+	if s.taken(user) {
+		return true, errTaken
+	}
+	user.UpdatedAt = time.Now()
+	copied := *user
+	s.users[user.ID] = &copied
+	return true, nil
+}
+
+// remove soft deletes the user, false when there is no such user
+func (s *Store) remove(id uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return false
+	}
+	user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	for token, userID := range s.accessTokens {
+		if userID == id {
+			delete(s.accessTokens, token)
+		}
+	}
+	return true
+}
+
+// restore brings back the deleted user, nil when there is no deleted user with the ID
+func (s *Store) restore(id uint) *models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok || !user.DeletedAt.Valid {
+		return nil
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+	user.UpdatedAt = time.Now()
+	copied := *user
+	return &copied
+}
+
+// touch records a login or an authenticated request of the user
+func (s *Store) touch(id uint, login bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[id]; ok {
+		now := time.Now()
+		user.LastSeenAt = &now
+		if login {
+			user.LastLoginAt = &now
+		}
+	}
+}
+
+// getPreferences returns the preferences of the user, the defaults when never set
+func (s *Store) getPreferences(userID uint) *models.UserPreferences {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if preferences, ok := s.preferences[userID]; ok {
+		copied := *preferences
+		return &copied
+	}
+	return models.DefaultUserPreferences(userID)
+}
+
+// setPreferences replaces the preferences of the user, setting their update time
+func (s *Store) setPreferences(preferences *models.UserPreferences) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preferences.UpdatedAt = time.Now()
+	copied := *preferences
+	s.preferences[preferences.UserID] = &copied
+}
+
+// issueTokens returns a new access token and refresh token of the user
+func (s *Store) issueTokens(userID uint) (string, string, error) {
+	access, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	refresh, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens[access] = userID
+	s.refreshTokens[refresh] = userID
+	return access, refresh, nil
+}
+
+// tokenUser returns the ID of the user of the access token, false for an unknown or revoked one
+func (s *Store) tokenUser(token string) (uint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, ok := s.accessTokens[token]
+	return userID, ok
+}
+
+// redeemRefresh consumes the refresh token, it can't be used twice: reused reports a token
+// already consumed
+func (s *Store) redeemRefresh(token string) (userID uint, ok, reused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usedRefresh[token] {
+		return 0, false, true
+	}
+	userID, ok = s.refreshTokens[token]
+	if ok {
+		delete(s.refreshTokens, token)
+		s.usedRefresh[token] = true
+	}
+	return userID, ok, false
+}
+
+// revoke revokes the access token and the refresh token when not empty
+func (s *Store) revoke(access, refresh string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.accessTokens, access)
+	if refresh != "" {
+		delete(s.refreshTokens, refresh)
+	}
+}
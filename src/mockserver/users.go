@@ -0,0 +1,569 @@
+// mockserver/users.go
+package mockserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/services"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// respondUserError answers a user creation or update refused by the validation, with the
+// statuses and codes of the API
+func respondUserError(c *gin.Context, err error) {
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(422, apierrors.From(validationErr).Envelope())
+		return
+	}
+	var enumErr *models.EnumError
+	if errors.As(err, &enumErr) {
+		c.JSON(400, gin.H{"error": enumErr.Error()})
+		return
+	}
+	var policyErr *services.PolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(422, gin.H{"error": policyErr.Reason})
+		return
+	}
+	if errors.Is(err, services.ErrPreconditionFailed) {
+		c.JSON(412, apierrors.PreconditionFailed.Body(err.Error()))
+		return
+	}
+	if errors.Is(err, services.ErrInvalidEmail) || errors.Is(err, services.ErrInvalidPhone) || errors.Is(err, services.ErrInvalidMetadata) ||
+		errors.Is(err, services.ErrInvalidUsername) {
+		c.JSON(400, apierrors.InvalidRequest.Body(err.Error()))
+		return
+	}
+	if errors.Is(err, errTaken) {
+		c.JSON(409, apierrors.Conflict.Body("The username or email is already taken"))
+		return
+	}
+	c.JSON(500, gin.H{"error": "Internal server error"})
+}
+
+// parsePagination reads the ?page= and ?per_page= query parameters like the API
+func parsePagination(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(c.Query("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	return page, perPage
+}
+
+// creating users in bulk, with a result for each of them
+func (s *server) createUsersBulk(c *gin.Context) {
+	var body []*dto.UserRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": "Invalid request body, expected an array of users"})
+		return
+	}
+	if len(body) == 0 {
+		c.JSON(400, gin.H{"error": "At least one user must be provided"})
+		return
+	}
+	for _, user := range body {
+		if user == nil {
+			c.JSON(400, gin.H{"error": "Invalid request body, expected an array of users"})
+			return
+		}
+	}
+	if len(body) > initializers.GetEnvInt("BULK_USERS_MAX", 100) {
+		c.JSON(413, gin.H{"error": "Too many users in one request"})
+		return
+	}
+
+	created := 0
+	results := make([]dto.BulkUserResult, len(body))
+	for i, request := range body {
+		results[i].Index = i
+		user := request.ToUser()
+		if err := s.createUser(user); err != nil {
+			if errors.Is(err, errTaken) {
+				results[i].Error = "username already taken"
+			} else {
+				results[i].Error = err.Error()
+			}
+			continue
+		}
+		results[i].User = dto.FromUser(user)
+		created++
+	}
+
+	c.JSON(200, gin.H{"results": results, "created": created, "failed": len(results) - created})
+}
+
+// getting the users, a page at a time, with the filters, the sort, the ?fields= projection and
+// the ?cursor= of the API
+func (s *server) getAllUsers(c *gin.Context) {
+	page, perPage := parsePagination(c)
+
+	filter, ok := parseUserFilter(c)
+	if !ok {
+		return
+	}
+	if fields := c.Query("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			if _, known := repository.UserFields[field]; !known {
+				allowed := make([]string, 0, len(repository.UserFields))
+				for name := range repository.UserFields {
+					allowed = append(allowed, name)
+				}
+				sort.Strings(allowed)
+				c.JSON(400, gin.H{"error": (&models.EnumError{Field: "field", Value: field, Allowed: allowed}).Error()})
+				return
+			}
+			filter.Fields = append(filter.Fields, field)
+		}
+	}
+	if err := repository.ValidateUserSort(filter.Sort); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	users := s.usersMatching(filter)
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		offset := 0
+		if cursor != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+			if err == nil {
+				offset, err = strconv.Atoi(string(decoded))
+			}
+			if err != nil || offset < 0 {
+				c.JSON(400, gin.H{"error": "Invalid cursor, it must come from a listing with the same sort"})
+				return
+			}
+		}
+		pageUsers := usersPage(users, offset, perPage)
+		next := ""
+		if offset+perPage < len(users) {
+			next = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset + perPage)))
+		}
+		projected, err := services.ProjectUsers(pageUsers, filter.Fields)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(200, gin.H{"users": projected, "next_cursor": next, "per_page": perPage})
+		return
+	}
+
+	projected, err := services.ProjectUsers(usersPage(users, (page-1)*perPage, perPage), filter.Fields)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(len(users)))
+	c.JSON(200, gin.H{"users": projected, "total": len(users), "total_exact": true, "page": page, "per_page": perPage})
+}
+
+// parsing the ?role=, ?status=, ?phone_prefix=, ?sort= and ?include_deleted= filter of the
+// listing, answering the request when they are invalid
+func parseUserFilter(c *gin.Context) (repository.UserFilter, bool) {
+	filter := repository.UserFilter{Sort: c.Query("sort")}
+	if c.Query("include_deleted") == "true" {
+		// the deleted users are listed to those who can delete users
+		if !hasPermission(c, models.PermUsersDelete) {
+			c.JSON(403, gin.H{"error": "Access denied."})
+			return filter, false
+		}
+		filter.IncludeDeleted = true
+	}
+	if role := c.Query("role"); role != "" {
+		parsed, err := models.ParseRole(role)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return filter, false
+		}
+		filter.Role = parsed
+	}
+	if status := c.Query("status"); status != "" {
+		parsed, err := models.ParseStatus(status)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return filter, false
+		}
+		filter.Status = parsed
+	}
+	if prefix := c.Query("phone_prefix"); prefix != "" {
+		normalized, err := services.NormalizePhonePrefix(prefix)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid phone_prefix, expected the start of an E.164 number, e.g. +44"})
+			return filter, false
+		}
+		filter.PhonePrefix = normalized
+	}
+	return filter, true
+}
+
+// usersMatching returns the users of the filter in its order, the ID breaking the ties
+func (s *server) usersMatching(filter repository.UserFilter) []*models.User {
+	var users []*models.User
+	for _, user := range s.store.allUsers(filter.IncludeDeleted) {
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if filter.Status != "" && user.Status != filter.Status {
+			continue
+		}
+		if filter.PhonePrefix != "" && !strings.HasPrefix(user.Phone, filter.PhonePrefix) {
+			continue
+		}
+		users = append(users, user)
+	}
+	applyOnline(users...)
+
+	var order []string
+	for _, field := range strings.Split(filter.Sort, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			order = append(order, field)
+		}
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		for _, field := range order {
+			column := strings.TrimPrefix(field, "-")
+			if cmp := compareUsers(users[i], users[j], column); cmp != 0 {
+				if strings.HasPrefix(field, "-") {
+					return cmp > 0
+				}
+				return cmp < 0
+			}
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// compareUsers compares the column of two users, the empty times first like MySQL
+func compareUsers(a, b *models.User, column string) int {
+	switch column {
+	case "id":
+		return compareUint(a.ID, b.ID)
+	case "full_name":
+		return strings.Compare(strings.ToLower(a.FullName), strings.ToLower(b.FullName))
+	case "username":
+		return strings.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username))
+	case "role":
+		return strings.Compare(string(a.Role), string(b.Role))
+	case "status":
+		return strings.Compare(string(a.Status), string(b.Status))
+	case "created_at":
+		return compareTimes(&a.CreatedAt, &b.CreatedAt)
+	case "updated_at":
+		return compareTimes(&a.UpdatedAt, &b.UpdatedAt)
+	case "deleted_at":
+		var ta, tb *time.Time
+		if a.DeletedAt.Valid {
+			ta = &a.DeletedAt.Time
+		}
+		if b.DeletedAt.Valid {
+			tb = &b.DeletedAt.Time
+		}
+		return compareTimes(ta, tb)
+	case "last_login_at":
+		return compareTimes(a.LastLoginAt, b.LastLoginAt)
+	case "last_seen_at":
+		return compareTimes(a.LastSeenAt, b.LastSeenAt)
+	}
+	return 0
+}
+
+func compareUint(a, b uint) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	}
+	return 0
+}
+
+// usersPage returns the users of the page starting at offset
+func usersPage(users []*models.User, offset, limit int) []*models.User {
+	if offset >= len(users) {
+		return []*models.User{}
+	}
+	end := offset + limit
+	if end > len(users) {
+		end = len(users)
+	}
+	return users[offset:end]
+}
+
+// getting many users at once, by the comma separated ?ids= or, with POST, the ids of the body;
+// the IDs not found are listed as missing
+func (s *server) getUsersBatch(c *gin.Context) {
+	var ids []string
+	if c.Request.Method == http.MethodPost {
+		var body struct {
+			IDs []string `json:"ids"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+		ids = body.IDs
+	} else {
+		for _, id := range strings.Split(c.Query("ids"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	for _, id := range ids {
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			c.JSON(400, apierrors.InvalidRequest.Body("ids must be user IDs, "+id+" isn't"))
+			return
+		}
+	}
+	if len(ids) == 0 {
+		c.JSON(400, gin.H{"error": "ids must list at least one user"})
+		return
+	}
+
+	var unique []string
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > initializers.GetEnvInt("BULK_USERS_MAX", 100) {
+		c.JSON(413, apierrors.PayloadTooLarge.Body("Too many users in one request"))
+		return
+	}
+
+	users := []*models.User{}
+	var missing []string
+	for _, id := range unique {
+		parsed, _ := strconv.ParseUint(id, 10, 64)
+		if user := s.store.user(uint(parsed), false); user != nil {
+			users = append(users, user)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	applyOnline(users...)
+
+	c.JSON(200, gin.H{"users": dto.FromUsers(users), "missing": missing})
+}
+
+// getting the users seen within the presence window
+func (s *server) getOnlineUsers(c *gin.Context) {
+	online := []*models.User{}
+	for _, user := range s.usersMatching(repository.UserFilter{}) {
+		if user.Online {
+			online = append(online, user)
+		}
+	}
+
+	c.JSON(200, gin.H{"users": dto.FromUsers(online)})
+}
+
+// searching the users whose full name or username contains ?q=, case insensitive
+func (s *server) searchUsers(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(400, gin.H{"error": "Search query must be provided"})
+		return
+	}
+	page, perPage := parsePagination(c)
+
+	var matches []*models.User
+	needle := strings.ToLower(query)
+	for _, user := range s.usersMatching(repository.UserFilter{}) {
+		if strings.Contains(strings.ToLower(user.FullName), needle) || strings.Contains(strings.ToLower(user.Username), needle) {
+			matches = append(matches, user)
+		}
+	}
+
+	items := []dto.UserSummary{}
+	for _, u := range usersPage(matches, (page-1)*perPage, perPage) {
+		items = append(items, dto.UserSummary{
+			ID:       u.ID,
+			FullName: u.FullName,
+			Username: u.Username,
+			Status:   string(u.Status),
+			Role:     string(u.Role),
+			Online:   u.Online,
+		})
+	}
+
+	c.JSON(200, gin.H{"users": items, "total": len(matches), "total_exact": true, "page": page, "per_page": perPage})
+}
+
+// getting a user by username, the former usernames aren't kept
+func (s *server) getUserByUsername(c *gin.Context) {
+	user := s.store.userByUsername(c.Param("username"))
+	if user == nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	applyOnline(user)
+
+	c.Header("ETag", user.ETag())
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
+}
+
+// getting one user by ID, with its ETag and If-None-Match
+func (s *server) getUserByID(c *gin.Context) {
+	user := s.store.user(parseUserID(c), false)
+	if user == nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	applyOnline(user)
+
+	c.Header("ETag", user.ETag())
+	if middleware.NotModified(c, user.ETag()) {
+		c.Status(304)
+		return
+	}
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
+}
+
+// updating a user with the fields set in the body
+func (s *server) updateUserByID(c *gin.Context) {
+	var body dto.UserRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		var enumErr *models.EnumError
+		if errors.As(err, &enumErr) {
+			c.JSON(400, gin.H{"error": enumErr.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	s.applyPatch(c, services.PatchFromUser(body.ToUser()))
+}
+
+// patching a user with a JSON Merge Patch (RFC 7386)
+func (s *server) patchUserByID(c *gin.Context) {
+	var document map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&document); err != nil {
+		c.JSON(400, gin.H{"error": "The body must be a JSON object"})
+		return
+	}
+
+	patch, err := services.ParseUserMergePatch(document)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.applyPatch(c, patch)
+}
+
+// applyPatch validates and applies the patch to the user of the path, unless the If-Match of
+// the request misses its ETag, and answers with the user and its new ETag
+func (s *server) applyPatch(c *gin.Context, patch *services.UserPatch) {
+	user := s.store.user(parseUserID(c), false)
+	if user == nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	if !middleware.IfMatchFromContext(c.Request.Context(), user.ETag()) {
+		respondUserError(c, services.ErrPreconditionFailed)
+		return
+	}
+
+	if err := services.ApplyUserPatch(c.Request.Context(), user, patch); err != nil {
+		respondUserError(c, err)
+		return
+	}
+	found, err := s.store.save(user)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	if !found {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	applyOnline(user)
+
+	c.Header("ETag", user.ETag())
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
+}
+
+// deleting a user, unless the If-Match of the request misses its ETag; it can be restored
+func (s *server) deleteUserByID(c *gin.Context) {
+	id := parseUserID(c)
+	user := s.store.user(id, false)
+	if user == nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	if !middleware.IfMatchFromContext(c.Request.Context(), user.ETag()) {
+		respondUserError(c, services.ErrPreconditionFailed)
+		return
+	}
+
+	s.store.remove(id)
+	c.JSON(200, gin.H{"message": "User deleted successfully"})
+}
+
+// restoring a deleted user
+func (s *server) restoreUserByID(c *gin.Context) {
+	user := s.store.restore(parseUserID(c))
+	if user == nil {
+		c.JSON(404, gin.H{"error": "Deleted user not found"})
+		return
+	}
+	applyOnline(user)
+
+	c.JSON(200, gin.H{"user": dto.FromUser(user)})
+}
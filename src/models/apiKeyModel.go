@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// API key scopes, read allows GET/HEAD requests and write allows every other method
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// PersonalTokenPrefix starts every personal access token, telling them apart from JWTs
+// in the Authorization header.
+const PersonalTokenPrefix = "gpat_"
+
+// APIKey authenticates a machine client as the user it belongs to. Personal access tokens
+// are API keys users create for themselves, sent as bearer credentials.
+type APIKey struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	Name        string     `gorm:"size:100;not null" json:"name"`
+	Prefix      string     `gorm:"size:16;not null" json:"prefix"` // first characters of the key, to recognize it
+	KeyHash     string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes      string     `gorm:"size:255;not null" json:"scopes"` // space separated scopes
+	UserID      uint       `gorm:"not null;index" json:"user_id"`   // user the key acts as
+	CreatedByID uint       `json:"created_by_id"`
+	Personal    bool       `gorm:"not null;default:false" json:"personal"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the key was granted the scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range strings.Fields(k.Scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the key has an expiry that has passed.
+func (k *APIKey) Expired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Approval statuses
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved" // approved and executed
+	ApprovalFailed   = "failed"   // approved, its execution failed
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+// The sensitive actions held for the approval of a second admin when listed in APPROVAL_ACTIONS
+const (
+	ApprovalDeleteAdmin    = "delete_admin"    // deleting a user with the admin role
+	ApprovalBulkDelete     = "bulk_delete"     // deleting users in bulk
+	ApprovalRoleEscalation = "role_escalation" // giving a user a role with permissions its role lacks
+)
+
+// ApprovalActions lists the actions that can require an approval.
+var ApprovalActions = []string{ApprovalDeleteAdmin, ApprovalBulkDelete, ApprovalRoleEscalation}
+
+// Approval is a sensitive action requested by an admin, executed once another admin approves
+// it; it lapses at ExpiresAt.
+type Approval struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	Action        string     `gorm:"size:32;not null;index" json:"action"`
+	Summary       string     `gorm:"size:255" json:"summary"`
+	Payload       string     `gorm:"type:text" json:"payload"` // the JSON arguments of the action
+	Status        string     `gorm:"size:16;not null;index" json:"status"`
+	RequestedByID uint       `gorm:"index" json:"requested_by_id"`
+	DecidedByID   *uint      `json:"decided_by_id"`
+	DecidedAt     *time.Time `json:"decided_at"`
+	Result        string     `gorm:"type:text" json:"result,omitempty"` // the error of a failed execution
+	ExpiresAt     time.Time  `gorm:"index" json:"expires_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Pending reports whether the approval can still be decided.
+func (a *Approval) Pending() bool {
+	return a.Status == ApprovalPending && time.Now().Before(a.ExpiresAt)
+}
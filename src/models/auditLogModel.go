@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// AuditLog records an action performed through the API.
+type AuditLog struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+	ActorID        *uint     `gorm:"index" json:"actor_id"`        // user who performed the action, nil when anonymous
+	ImpersonatorID *uint     `gorm:"index" json:"impersonator_id"` // admin acting as the actor, nil when not impersonated
+	Action         string    `gorm:"size:150;index" json:"action"` // e.g. "PUT /users/:id"
+	TargetID       string    `gorm:"size:64;index" json:"target_id"`
+	StatusCode     int       `json:"status_code"`
+	IP             string    `gorm:"size:45" json:"ip"`
+	Details        string    `gorm:"type:text" json:"details"`
+	Diff           string    `gorm:"type:text" json:"diff,omitempty"` // JSON of the FieldChange of each field changed, empty when not recorded
+}
+
+// FieldChange is the value of a field before and after a change, as the JSON of the resource has them.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
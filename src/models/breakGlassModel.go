@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// BreakGlassActivation is the window the break-glass account can log in, opened by a token signed
+// offline; the nonce of the token can't be used twice. The window closes at ExpiresAt, or when
+// sealed earlier.
+type BreakGlassActivation struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	Nonce     string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Reason    string     `gorm:"size:255" json:"reason"`
+	IssuedAt  time.Time  `json:"issued_at"` // when the token was signed
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	SealedAt  *time.Time `json:"sealed_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Active reports whether the break-glass account can be used.
+func (a *BreakGlassActivation) Active() bool {
+	return a.SealedAt == nil && time.Now().Before(a.ExpiresAt)
+}
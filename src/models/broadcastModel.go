@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Broadcast statuses
+const (
+	BroadcastScheduled = "scheduled"
+	BroadcastSending   = "sending"
+	BroadcastSent      = "sent"
+	BroadcastCanceled  = "canceled"
+)
+
+// Broadcast is a message an admin sends to every active user, or to the users with one of
+// the roles, on the channels of their preferences.
+type Broadcast struct {
+	ID          uint            `gorm:"primarykey" json:"id"`
+	Subject     string          `gorm:"size:255;not null" json:"subject"`
+	Body        string          `gorm:"type:text" json:"body"`
+	Priority    string          `gorm:"size:16;not null" json:"priority"`
+	Roles       string          `gorm:"size:255" json:"roles"` // space separated audience roles, empty for every user
+	Status      string          `gorm:"size:16;not null;index" json:"status"`
+	SendAt      time.Time       `json:"send_at"`
+	SentAt      *time.Time      `json:"sent_at"`
+	Recipients  int             `gorm:"not null;default:0" json:"recipients"` // users notified, set once sent
+	CreatedByID uint            `json:"created_by_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Stats       []BroadcastStat `gorm:"foreignKey:BroadcastID" json:"stats,omitempty"`
+}
+
+// AudienceRoles returns the roles of the audience, nil for every user.
+func (b *Broadcast) AudienceRoles() []string {
+	return strings.Fields(b.Roles)
+}
+
+// BroadcastStat counts the deliveries of a broadcast on a channel (email, webhook, push...),
+// the failures being the failed attempts, retried by the job queue.
+type BroadcastStat struct {
+	BroadcastID uint   `gorm:"primarykey" json:"-"`
+	Channel     string `gorm:"primarykey;size:16" json:"channel"`
+	Delivered   int    `gorm:"not null;default:0" json:"delivered"`
+	Failed      int    `gorm:"not null;default:0" json:"failed"`
+}
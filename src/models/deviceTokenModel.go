@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// DeviceToken is the push token of a mobile app installation, a token belongs to the last
+// user who registered it.
+type DeviceToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Platform  string    `gorm:"size:8;not null" json:"platform"` // fcm or apns
+	Token     string    `gorm:"size:255;not null;uniqueIndex" json:"-"`
+	Name      string    `gorm:"size:100" json:"name"` // device name chosen by the app, e.g. "Pixel 8"
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
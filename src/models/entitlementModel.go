@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Entitlement grants a feature to a user, or to every user of a role, for the rollout of a
+// feature customer by customer. Unlike the global settings, it is checked per user.
+type Entitlement struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	Feature   string     `gorm:"size:64;not null;uniqueIndex:idx_entitlement_subject" json:"feature"`
+	UserID    uint       `gorm:"not null;default:0;uniqueIndex:idx_entitlement_subject" json:"user_id,omitempty"` // 0 for a role
+	Role      Role       `gorm:"size:32;not null;default:'';uniqueIndex:idx_entitlement_subject" json:"role,omitempty"`
+	GrantedBy uint       `json:"granted_by"`
+	ExpiresAt *time.Time `json:"expires_at"` // the grant lapses on its own, nil for good
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Active reports whether the entitlement hasn't expired.
+func (e *Entitlement) Active() bool {
+	return e.ExpiresAt == nil || time.Now().Before(*e.ExpiresAt)
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type Status string
+type Role string
+
+const (
+	Active   Status = "active"
+	Inactive Status = "inactive"
+
+	Admin    Role = "admin"
+	Operator Role = "operator"
+)
+
+// allowed statuses, in the order they are listed in error messages
+var Statuses = []Status{Active, Inactive}
+
+// the roles defined in the roles table, the built-in ones until SetRoles is called
+var (
+	rolesMu sync.RWMutex
+	roles   = []Role{Admin, Operator}
+)
+
+// SetRoles replaces the known roles, called when the roles are loaded from the database.
+func SetRoles(defined []Role) {
+	rolesMu.Lock()
+	defer rolesMu.Unlock()
+	roles = defined
+}
+
+// Roles returns the known roles.
+func Roles() []Role {
+	rolesMu.RLock()
+	defer rolesMu.RUnlock()
+	return roles
+}
+
+// EnumError is returned when a value is not one of the allowed values of an enum.
+type EnumError struct {
+	Field   string
+	Value   string
+	Allowed []string
+}
+
+func (e *EnumError) Error() string {
+	return fmt.Sprintf("invalid %s %q, allowed values are: %s", e.Field, e.Value, strings.Join(e.Allowed, ", "))
+}
+
+// IsValid reports whether the status is one of the allowed statuses.
+func (s Status) IsValid() bool {
+	for _, status := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStatus returns the status or an EnumError listing the allowed statuses.
+func ParseStatus(value string) (Status, error) {
+	status := Status(value)
+	if !status.IsValid() {
+		allowed := make([]string, len(Statuses))
+		for i, s := range Statuses {
+			allowed[i] = string(s)
+		}
+		return "", &EnumError{Field: "status", Value: value, Allowed: allowed}
+	}
+	return status, nil
+}
+
+// Value implements driver.Valuer so an invalid status never reaches the database.
+func (s Status) Value() (driver.Value, error) {
+	if _, err := ParseStatus(string(s)); err != nil {
+		return nil, err
+	}
+	return string(s), nil
+}
+
+// Scan implements sql.Scanner.
+func (s *Status) Scan(value interface{}) error {
+	raw, err := scanString(value)
+	if err != nil || raw == "" {
+		*s = ""
+		return err
+	}
+	*s, err = ParseStatus(raw)
+	return err
+}
+
+// UnmarshalJSON rejects unknown statuses.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		raw = string(data)
+	}
+	status, err := ParseStatus(raw)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// IsValid reports whether the role is one of the known roles.
+func (r Role) IsValid() bool {
+	for _, role := range Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRole returns the role or an EnumError listing the known roles.
+func ParseRole(value string) (Role, error) {
+	role := Role(value)
+	if !role.IsValid() {
+		known := Roles()
+		allowed := make([]string, len(known))
+		for i, r := range known {
+			allowed[i] = string(r)
+		}
+		return "", &EnumError{Field: "role", Value: value, Allowed: allowed}
+	}
+	return role, nil
+}
+
+// Value implements driver.Valuer so an invalid role never reaches the database.
+func (r Role) Value() (driver.Value, error) {
+	if _, err := ParseRole(string(r)); err != nil {
+		return nil, err
+	}
+	return string(r), nil
+}
+
+// Scan implements sql.Scanner. Stored roles are trusted, the foreign key on the roles
+// table guarantees them, and a role created by another instance may not be known yet.
+func (r *Role) Scan(value interface{}) error {
+	raw, err := scanString(value)
+	*r = Role(raw)
+	return err
+}
+
+// UnmarshalJSON rejects unknown roles.
+func (r *Role) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		raw = string(data)
+	}
+	role, err := ParseRole(raw)
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// scanString converts a database value to a string.
+func scanString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		return "", fmt.Errorf("unsupported type %T for enum column", value)
+	}
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// ExportWatermark is the position of an export stream: the rows up to LastID were shipped.
+type ExportWatermark struct {
+	Name       string    `gorm:"primarykey;size:64" json:"name"` // e.g. "clickhouse:audit_logs"
+	LastID     uint      `gorm:"not null;default:0" json:"last_id"`
+	ExportedAt time.Time `json:"exported_at"`
+}
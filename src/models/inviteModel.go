@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Invite lets the person owning an email address register with a given role.
+type Invite struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	Email       string     `gorm:"size:191;not null;index" json:"email"`
+	Role        Role       `gorm:"size:32;not null;default:'operator'" json:"role"`
+	TokenHash   string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	CreatedByID uint       `json:"created_by_id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at"`
+	UsedByID    *uint      `json:"used_by_id"` // user registered with the invite
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the invite can still be used to register.
+func (i *Invite) Usable() bool {
+	return i.UsedAt == nil && time.Now().Before(i.ExpiresAt)
+}
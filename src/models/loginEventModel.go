@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Login outcomes
+const (
+	LoginSucceeded = "success"
+	LoginFailed    = "failure"
+)
+
+// LoginEvent records an authentication attempt, successful or not.
+type LoginEvent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UserID    *uint     `gorm:"index" json:"user_id"`            // nil when the attempt matches no user
+	Username  string    `gorm:"size:191;index" json:"username"`  // as submitted, empty for token logins that failed
+	Method    string    `gorm:"size:32;index" json:"method"`     // password, magic_link, oauth:<provider>
+	Outcome   string    `gorm:"size:16;index" json:"outcome"`    // success or failure
+	Reason    string    `gorm:"size:64" json:"reason,omitempty"` // why the attempt failed
+	IP        string    `gorm:"size:45;index" json:"ip"`
+	UserAgent string    `gorm:"size:255" json:"user_agent"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// Notification priorities: low ones go to the daily digest when the user wants one,
+// high ones are delivered during the quiet hours too
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// Notification is a message for a user, listed in the in-app inbox and waiting there for
+// the digest when low priority.
+type Notification struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	UserID        uint       `gorm:"not null;index" json:"-"`
+	Subject       string     `gorm:"size:255;not null" json:"subject"`
+	Body          string     `gorm:"type:text" json:"body"`
+	Priority      string     `gorm:"size:16;not null" json:"priority"`
+	InApp         bool       `gorm:"not null" json:"-"`                     // shown in the inbox
+	DigestPending bool       `gorm:"not null;default:false;index" json:"-"` // waiting for the next digest
+	ReadAt        *time.Time `json:"read_at"`
+	BroadcastID   *uint      `gorm:"index" json:"broadcast_id"` // broadcast the notification was sent for
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// NotificationPreference holds the channels a user is notified on, the quiet hours during
+// which only high priority notifications are pushed, and whether low priority ones are
+// batched in a daily digest email.
+type NotificationPreference struct {
+	UserID          uint      `gorm:"primarykey" json:"-"`
+	Email           bool      `gorm:"not null" json:"email"`
+	InApp           bool      `gorm:"not null" json:"in_app"`
+	Webhook         bool      `gorm:"not null;default:false" json:"webhook"`
+	WebhookURL      string    `gorm:"size:2048" json:"webhook_url"`
+	SMS             bool      `gorm:"not null;default:false" json:"sms"`
+	Push            bool      `gorm:"not null" json:"push"`
+	QuietHoursStart string    `gorm:"size:5" json:"quiet_hours_start"` // "22:00", empty for no quiet hours
+	QuietHoursEnd   string    `gorm:"size:5" json:"quiet_hours_end"`   // "07:00"
+	Timezone        string    `gorm:"size:64;not null;default:'UTC'" json:"timezone"`
+	Digest          bool      `gorm:"not null" json:"digest"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// DefaultNotificationPreference returns the preferences of users who never set theirs.
+func DefaultNotificationPreference(userID uint) *NotificationPreference {
+	return &NotificationPreference{UserID: userID, Email: true, InApp: true, Push: true, Timezone: "UTC", Digest: true}
+}
+
+// QuietUntil reports whether now falls in the quiet hours and when they end.
+func (p *NotificationPreference) QuietUntil(now time.Time) (time.Time, bool) {
+	start, err := time.Parse("15:04", p.QuietHoursStart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := time.Parse("15:04", p.QuietHoursEnd)
+	if err != nil || start.Equal(end) {
+		return time.Time{}, false
+	}
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	startMinute, endMinute := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+
+	// quiet hours may span midnight, e.g. 22:00 to 07:00
+	quiet := minute >= startMinute && minute < endMinute
+	if startMinute > endMinute {
+		quiet = minute >= startMinute || minute < endMinute
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, location)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, true
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuthClient is an application allowed to sign in its users through this service.
+type OAuthClient struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	ClientID     string     `gorm:"size:64;not null;uniqueIndex" json:"client_id"`
+	SecretHash   string     `gorm:"size:64" json:"-"` // empty for public clients (SPAs, mobile apps)
+	Name         string     `gorm:"size:100;not null" json:"name"`
+	RedirectURIs string     `gorm:"type:text;not null" json:"redirect_uris"` // space separated
+	Trusted      bool       `gorm:"not null;default:false" json:"trusted"`   // signs users in without a consent screen
+	CreatedAt    time.Time  `json:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+}
+
+// Confidential reports whether the client authenticates with a secret.
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AllowsRedirect reports whether uri is one of the registered redirect URIs (exact match).
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	for _, registered := range strings.Fields(c.RedirectURIs) {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+// Permissions checked by the API, seeded in the permissions table by the migration
+const (
+	PermUsersRead          = "users:read"
+	PermUsersCreate        = "users:create"
+	PermUsersUpdate        = "users:update"
+	PermUsersDelete        = "users:delete"
+	PermUsersUploadPicture = "users:upload_picture"
+	PermUsersImpersonate   = "users:impersonate"
+	PermProfileRead        = "profile:read"
+	PermReportsRead        = "reports:read"
+	PermReportsDeliver     = "reports:deliver"
+	PermLoginsRead         = "logins:read"
+	PermInvitesManage      = "invites:manage"
+	PermSearch             = "search"
+	PermAPIKeysManage      = "api_keys:manage"
+	PermOAuthClientsManage = "oauth_clients:manage"
+	PermMetricsRead        = "metrics:read"
+	PermRolesManage        = "roles:manage"
+	PermBroadcastsSend     = "broadcasts:send"
+	PermLegalHoldManage    = "legal_hold:manage"
+	PermDashboardRead      = "dashboard:read"
+	PermJobsManage         = "jobs:manage"
+	PermFaultsManage       = "faults:manage"
+	PermEntitlementsManage = "entitlements:manage"
+	PermUsersHistory       = "users:history"
+	PermApprovalsManage    = "approvals:manage"
+)
+
+// PermissionCatalog describes every permission, in the order they are listed.
+var PermissionCatalog = []Permission{
+	{Name: PermUsersRead, Description: "List and view users"},
+	{Name: PermUsersCreate, Description: "Create and import users in bulk"},
+	{Name: PermUsersUpdate, Description: "Update users"},
+	{Name: PermUsersDelete, Description: "Delete users"},
+	{Name: PermUsersUploadPicture, Description: "Upload the profile picture of any user"},
+	{Name: PermUsersImpersonate, Description: "Act as another user"},
+	{Name: PermProfileRead, Description: "View the own profile"},
+	{Name: PermReportsRead, Description: "Export the access review report"},
+	{Name: PermReportsDeliver, Description: "Deliver the access review report"},
+	{Name: PermLoginsRead, Description: "View the login history of all users"},
+	{Name: PermInvitesManage, Description: "Invite people to register"},
+	{Name: PermSearch, Description: "Search users, audit logs and sessions"},
+	{Name: PermAPIKeysManage, Description: "Mint and revoke api keys"},
+	{Name: PermOAuthClientsManage, Description: "Register and revoke oauth clients"},
+	{Name: PermMetricsRead, Description: "View the application metrics"},
+	{Name: PermRolesManage, Description: "Define roles and their permissions"},
+	{Name: PermBroadcastsSend, Description: "Notify every user"},
+	{Name: PermLegalHoldManage, Description: "Place users under legal hold"},
+	{Name: PermDashboardRead, Description: "View the admin dashboard"},
+	{Name: PermJobsManage, Description: "View the background jobs and schedules, retry failed jobs"},
+	{Name: PermFaultsManage, Description: "Inject faults for resilience testing (development and staging)"},
+	{Name: PermEntitlementsManage, Description: "Grant and revoke the features of users and roles"},
+	{Name: PermUsersHistory, Description: "View the past states of users, rebuilt from the audit log"},
+	{Name: PermApprovalsManage, Description: "Approve or reject the sensitive actions requested by other admins"},
+}
+
+// Permission is a right checked by the API, e.g. "users:delete".
+type Permission struct {
+	ID          uint   `gorm:"primarykey" json:"-"`
+	Name        string `gorm:"size:64;not null;uniqueIndex" json:"name"`
+	Description string `gorm:"size:255" json:"description"`
+}
+
+// RoleDefinition is a role users can be given, with the permissions it grants. The built-in
+// admin and operator roles can't be deleted.
+type RoleDefinition struct {
+	ID          uint         `gorm:"primarykey" json:"-"`
+	Name        string       `gorm:"size:32;not null;uniqueIndex" json:"name"`
+	Description string       `gorm:"size:255" json:"description"`
+	BuiltIn     bool         `gorm:"not null;default:false" json:"built_in"`
+	Permissions []Permission `gorm:"many2many:role_permissions;joinForeignKey:RoleID;joinReferences:PermissionID" json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// TableName keeps the roles table name, Role being the type of the role names.
+func (RoleDefinition) TableName() string {
+	return "roles"
+}
+
+// PermissionNames returns the names of the permissions granted by the role.
+func (r *RoleDefinition) PermissionNames() []string {
+	names := make([]string, len(r.Permissions))
+	for i, p := range r.Permissions {
+		names[i] = p.Name
+	}
+	return names
+}
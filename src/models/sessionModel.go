@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device, kept alive by its refresh token.
+type Session struct {
+	ID               uint       `gorm:"primarykey" json:"id"`
+	UserID           uint       `gorm:"not null;index" json:"user_id"`
+	RefreshTokenHash string     `gorm:"size:64;index" json:"-"`
+	AccessTokenID    string     `gorm:"size:32" json:"-"` // jti of the last access token issued for the session
+	AccessExpiresAt  time.Time  `json:"-"`
+	UserAgent        string     `gorm:"size:255" json:"device"`
+	IP               string     `gorm:"size:45" json:"ip"`
+	ClientID         string     `gorm:"size:64" json:"client_id,omitempty"`        // oauth client the session was opened for
+	RememberMe       bool       `gorm:"not null;default:false" json:"remember_me"` // long-lived refresh tokens
+	CreatedAt        time.Time  `json:"created_at"`
+	LastSeenAt       time.Time  `json:"last_seen_at"`
+	ExpiresAt        time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	Current          bool       `gorm:"-" json:"current"` // session of the request listing the sessions
+}
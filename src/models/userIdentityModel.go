@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account of an OAuth2 provider (google, github...).
+type UserIdentity struct {
+	ID         uint   `gorm:"primarykey"`
+	UserID     uint   `gorm:"not null;index"`
+	Provider   string `gorm:"size:32;not null;uniqueIndex:idx_provider_identity"`
+	ProviderID string `gorm:"size:191;not null;uniqueIndex:idx_provider_identity"`
+	CreatedAt  time.Time
+}
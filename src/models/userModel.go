@@ -2,33 +2,53 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type User struct {
-	gorm.Model
-	FullName       string    `gorm:"not null"`
-	Username       string    `gorm:"unique;not null"`
-	Password       string    `gorm:"not null;"`
-	Status         Status    `gorm:"type:ENUM('active', 'inactive');default:'active'"`
-	Role           Role      `gorm:"type:ENUM('admin', 'operator');default:'operator'"`
-	ProfilePicture string    // this field for profile picture name
-	CreatedAt      time.Time //  the type as time.Time for the "created_at" column
-	UpdatedAt      time.Time //  the type as time.Time for the "updated_at" column
-}
+	ID             uint           `gorm:"primarykey" json:"id"`
+	FullName       string         `gorm:"not null" json:"full_name"`
+	Username       string         `gorm:"unique;not null" json:"username"`
+	Email          *string        `gorm:"size:191;uniqueIndex:idx_users_email" json:"email"` // lowercased, nil when unknown
+	Password       string         `gorm:"not null;" json:"password"`
+	Status         Status         `gorm:"type:ENUM('active', 'inactive');default:'active'" json:"status"`
+	Role           Role           `gorm:"size:32;not null;default:'operator'" json:"role"`
+	ProfilePicture string         `json:"profile_picture"` // this field for profile picture name
+	LastLoginAt    *time.Time     `json:"last_login_at"`   // time of the last successful login, nil if the user never logged in
+	LastSeenAt     *time.Time     `json:"last_seen_at"`    // time of the last authenticated request, updated at most once per PRESENCE_THROTTLE
+	Online         bool           `gorm:"-" json:"online"` // derived from the last seen time, not stored
+	CreatedAt      time.Time      `json:"created_at"`      //  the type as time.Time for the "created_at" column
+	UpdatedAt      time.Time      `json:"updated_at"`      //  the type as time.Time for the "updated_at" column
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 
-type Status string
-type Role string
+	// second factor sent by SMS to the phone (E.164), it needs the phone verified; an admin can
+	// set the phone of a user, unverified
+	Phone           string     `gorm:"size:20;index" json:"phone"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	SMSOTPEnabled   bool       `gorm:"column:sms_otp_enabled;not null;default:false" json:"sms_otp_enabled"`
 
-const (
-	Active   Status = "active"
-	Inactive Status = "inactive"
+	// set by DELETE /me, the account is purged after the grace period unless the user logs in again
+	DeletionRequestedAt *time.Time `gorm:"index" json:"deletion_requested_at"`
 
-	Admin    Role = "admin"
-	Operator Role = "operator"
-)
+	// set by an admin, the user's history and account are kept past the retention windows
+	LegalHold bool `gorm:"not null;default:false" json:"legal_hold"`
+
+	// the emergency admin account, inactive unless activated by a signed break-glass token
+	BreakGlass bool `gorm:"not null;default:false" json:"break_glass"`
+
+	// attributes of the integrators, checked against USER_METADATA_KEYS and USER_METADATA_MAX_BYTES
+	Metadata Metadata `gorm:"type:json" json:"metadata"`
+}
+
+// ETag returns the weak entity tag of the user, it changes with every update; it is weak as the
+// derived fields (online) change without one. The update time is rounded to the millisecond like
+// MySQL stores it, the tag of a user just saved matches the one read back.
+func (u *User) ETag() string {
+	return fmt.Sprintf("W/\"%d-%d\"", u.ID, u.UpdatedAt.Round(time.Millisecond).UnixMilli())
+}
 
 // SerializeUser serializes the user data to a JSON string.
 func (u *User) Serialize() (string, error) {
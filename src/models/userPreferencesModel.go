@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Themes of the clients
+const (
+	ThemeSystem = "system" // follows the device
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+)
+
+// Themes lists the themes a user can choose.
+var Themes = []string{ThemeSystem, ThemeLight, ThemeDark}
+
+// UserPreferences holds how the clients present the app to the user: the theme, the language
+// and how the in-app notifications show up. The channels the notifications are delivered on
+// are the NotificationPreference.
+type UserPreferences struct {
+	UserID              uint      `gorm:"primarykey" json:"-"`
+	Theme               string    `gorm:"size:16;not null" json:"theme"`
+	Language            string    `gorm:"size:35;not null" json:"language"` // BCP 47 tag, e.g. "en" or "pt-BR"
+	NotificationSound   bool      `gorm:"not null" json:"notification_sound"`
+	NotificationPreview bool      `gorm:"not null" json:"notification_preview"` // the body shown in the toasts, not only the subject
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// DefaultUserPreferences returns the preferences of users who never set theirs.
+func DefaultUserPreferences(userID uint) *UserPreferences {
+	return &UserPreferences{UserID: userID, Theme: ThemeSystem, Language: "en", NotificationSound: true, NotificationPreview: true}
+}
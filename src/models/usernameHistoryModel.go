@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// UsernameHistory keeps a former username of a user, so the references of external systems
+// to the old name can still be resolved after a rename.
+type UsernameHistory struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Username  string    `gorm:"size:191;not null;index" json:"username"`
+	RenamedAt time.Time `gorm:"not null" json:"renamed_at"`
+}
+
+// TableName keeps the singular table name of the history.
+func (UsernameHistory) TableName() string {
+	return "username_history"
+}
@@ -0,0 +1,126 @@
+// notify/mailer.go
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+)
+
+// Message is an email to be delivered by a Mailer.
+type Message struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a Message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+var (
+	mailer     Mailer
+	mailerOnce sync.Once
+)
+
+// DefaultMailer returns an SMTP mailer when SMTP_HOST is set, otherwise a mailer that only logs messages.
+func DefaultMailer() Mailer {
+	mailerOnce.Do(func() {
+		host := initializers.GetEnv("SMTP_HOST", "")
+		if host == "" {
+			mailer = logMailer{}
+			return
+		}
+
+		var auth smtp.Auth
+		if username := initializers.GetEnv("SMTP_USERNAME", ""); username != "" {
+			auth = smtp.PlainAuth("", username, initializers.GetEnv("SMTP_PASSWORD", ""), host)
+		}
+
+		mailer = &smtpMailer{
+			addr: host + ":" + initializers.GetEnv("SMTP_PORT", "587"),
+			from: initializers.GetEnv("SMTP_FROM", "no-reply@localhost"),
+			auth: auth,
+		}
+	})
+	return mailer
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m *smtpMailer) Send(msg *Message) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(msg.Attachments) == 0 {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(msg.Body)
+		return smtp.SendMail(m.addr, m.auth, m.from, msg.To, buf.Bytes())
+	}
+
+	writer := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return err
+	}
+	part.Write([]byte(msg.Body))
+
+	for _, attachment := range msg.Attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachment.Filename)},
+		})
+		if err != nil {
+			return err
+		}
+
+		// base64 encoded lines must not exceed 76 characters
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.from, msg.To, buf.Bytes())
+}
+
+// logMailer is used when no SMTP server is configured.
+type logMailer struct{}
+
+func (logMailer) Send(msg *Message) error {
+	log.Printf("Mail to %s: %s (%d attachments)", strings.Join(msg.To, ", "), msg.Subject, len(msg.Attachments))
+	return nil
+}
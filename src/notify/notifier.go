@@ -0,0 +1,41 @@
+// notify/notifier.go
+package notify
+
+import (
+	"log"
+	"sync"
+
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// Notifier delivers a message to a user through some channel (email, SMS, chat...).
+type Notifier interface {
+	Notify(user *models.User, subject, body string) error
+}
+
+var (
+	notifierMu sync.RWMutex
+	notifier   Notifier = logNotifier{}
+)
+
+// SetNotifier replaces the notifier used to reach users.
+func SetNotifier(n Notifier) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	notifier = n
+}
+
+// DefaultNotifier returns the notifier used to reach users, it only logs messages unless replaced.
+func DefaultNotifier() Notifier {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+	return notifier
+}
+
+// logNotifier writes the messages to the log, meant for development.
+type logNotifier struct{}
+
+func (logNotifier) Notify(user *models.User, subject, body string) error {
+	log.Printf("Notification for %s: %s\n%s", user.Username, subject, body)
+	return nil
+}
@@ -0,0 +1,281 @@
+// notify/push.go
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"golang.org/x/oauth2"
+	oauthjwt "golang.org/x/oauth2/jwt"
+)
+
+// Push platforms of the device tokens
+const (
+	PlatformFCM  = "fcm"  // Firebase Cloud Messaging, Android and web
+	PlatformAPNs = "apns" // Apple Push Notification service
+)
+
+// ErrInvalidDeviceToken is returned when the provider reports the device token as unregistered
+// or malformed, the token should be forgotten.
+var ErrInvalidDeviceToken = errors.New("invalid device token")
+
+// PushSender delivers push notifications to the device tokens of one platform.
+type PushSender interface {
+	Push(ctx context.Context, deviceToken, title, body string, data map[string]string) error
+}
+
+var (
+	pushSenders     map[string]PushSender
+	pushSendersOnce sync.Once
+)
+
+// DefaultPushSender returns the sender of the platform: FCM when FCM_CREDENTIALS_FILE points to
+// a service account key, APNs when APNS_KEY_FILE points to a .p8 key, otherwise a sender that
+// only logs the notifications.
+func DefaultPushSender(platform string) PushSender {
+	pushSendersOnce.Do(func() {
+		pushSenders = map[string]PushSender{PlatformFCM: logPushSender{PlatformFCM}, PlatformAPNs: logPushSender{PlatformAPNs}}
+
+		if file := initializers.GetEnv("FCM_CREDENTIALS_FILE", ""); file != "" {
+			sender, err := newFCMSender(file)
+			if err != nil {
+				log.Printf("FCM push disabled: %s", err)
+			} else {
+				pushSenders[PlatformFCM] = sender
+			}
+		}
+
+		if file := initializers.GetEnv("APNS_KEY_FILE", ""); file != "" {
+			sender, err := newAPNsSender(file)
+			if err != nil {
+				log.Printf("APNs push disabled: %s", err)
+			} else {
+				pushSenders[PlatformAPNs] = sender
+			}
+		}
+	})
+	return pushSenders[platform]
+}
+
+var pushClient = &http.Client{Timeout: 10 * time.Second}
+
+// fcmSender uses the FCM HTTP v1 API with the OAuth2 token of a service account.
+type fcmSender struct {
+	endpoint string
+	tokens   oauth2.TokenSource
+}
+
+func newFCMSender(file string) (*fcmSender, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var account struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, err
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("the credentials file is not a service account key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	config := &oauthjwt.Config{
+		Email:      account.ClientEmail,
+		PrivateKey: []byte(account.PrivateKey),
+		Scopes:     []string{"https://www.googleapis.com/auth/firebase.messaging"},
+		TokenURL:   account.TokenURI,
+	}
+
+	return &fcmSender{
+		endpoint: "https://fcm.googleapis.com/v1/projects/" + account.ProjectID + "/messages:send",
+		tokens:   config.TokenSource(context.Background()),
+	}, nil
+}
+
+func (s *fcmSender) Push(ctx context.Context, deviceToken, title, body string, data map[string]string) error {
+	token, err := s.tokens.Token()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        deviceToken,
+			"notification": map[string]string{"title": title, "body": body},
+			"data":         data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token.SetAuthHeader(req)
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Error struct {
+			Status string `json:"status"`
+		} `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&answer)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || answer.Error.Status == "UNREGISTERED" || answer.Error.Status == "INVALID_ARGUMENT":
+		return ErrInvalidDeviceToken
+	}
+	return fmt.Errorf("fcm answered %s %s", resp.Status, answer.Error.Status)
+}
+
+// apnsSender uses the APNs HTTP/2 API with token-based authentication, the provider token is
+// renewed every 50 minutes as Apple rejects tokens older than an hour.
+type apnsSender struct {
+	endpoint string
+	topic    string
+	keyID    string
+	teamID   string
+	key      *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	token    string
+	signedAt time.Time
+}
+
+func newAPNsSender(file string) (*apnsSender, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("the key file is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the key is not an ECDSA key")
+	}
+
+	endpoint := "https://api.push.apple.com"
+	if initializers.GetEnvBool("APNS_SANDBOX", false) {
+		endpoint = "https://api.sandbox.push.apple.com"
+	}
+
+	return &apnsSender{
+		endpoint: endpoint,
+		topic:    initializers.GetEnv("APNS_TOPIC", ""),
+		keyID:    initializers.GetEnv("APNS_KEY_ID", ""),
+		teamID:   initializers.GetEnv("APNS_TEAM_ID", ""),
+		key:      key,
+	}, nil
+}
+
+func (s *apnsSender) providerToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Since(s.signedAt) < 50*time.Minute {
+		return s.token, nil
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": s.teamID, "iat": time.Now().Unix()})
+	token.Header["kid"] = s.keyID
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+
+	s.token, s.signedAt = signed, time.Now()
+	return s.token, nil
+}
+
+func (s *apnsSender) Push(ctx context.Context, deviceToken, title, body string, data map[string]string) error {
+	providerToken, err := s.providerToken()
+	if err != nil {
+		return err
+	}
+
+	message := map[string]interface{}{
+		"aps": map[string]interface{}{"alert": map[string]string{"title": title, "body": body}},
+	}
+	for key, value := range data {
+		message[key] = value
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/3/device/"+deviceToken, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", s.topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&answer)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusGone || answer.Reason == "BadDeviceToken" || answer.Reason == "DeviceTokenNotForTopic":
+		return ErrInvalidDeviceToken
+	}
+	return fmt.Errorf("apns answered %s %s", resp.Status, answer.Reason)
+}
+
+// logPushSender is used for the platforms without credentials, meant for development.
+type logPushSender struct {
+	platform string
+}
+
+func (s logPushSender) Push(ctx context.Context, deviceToken, title, body string, data map[string]string) error {
+	log.Printf("Push to %s device: %s\n%s", s.platform, title, body)
+	return nil
+}
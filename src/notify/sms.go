@@ -0,0 +1,83 @@
+// notify/sms.go
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+)
+
+// SMSSender delivers text messages to phone numbers (E.164, e.g. +15551234567).
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+var (
+	smsSender     SMSSender
+	smsSenderOnce sync.Once
+)
+
+// DefaultSMSSender returns a sender for the Twilio messages API, or any provider compatible
+// with it (SMS_API_URL), when SMS_ACCOUNT_SID is set, otherwise a sender that only logs messages.
+func DefaultSMSSender() SMSSender {
+	smsSenderOnce.Do(func() {
+		accountSID := initializers.GetEnv("SMS_ACCOUNT_SID", "")
+		if accountSID == "" {
+			smsSender = logSMSSender{}
+			return
+		}
+
+		smsSender = &twilioSender{
+			endpoint:   strings.TrimRight(initializers.GetEnv("SMS_API_URL", "https://api.twilio.com"), "/") + "/2010-04-01/Accounts/" + url.PathEscape(accountSID) + "/Messages.json",
+			accountSID: accountSID,
+			authToken:  initializers.GetEnv("SMS_AUTH_TOKEN", ""),
+			from:       initializers.GetEnv("SMS_FROM", ""),
+			client:     &http.Client{Timeout: initializers.GetEnvDuration("SMS_TIMEOUT", 10*time.Second)},
+		}
+	})
+	return smsSender
+}
+
+type twilioSender struct {
+	endpoint   string
+	accountSID string
+	authToken  string
+	from       string
+	client     *http.Client
+}
+
+func (s *twilioSender) SendSMS(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "From": {s.from}, "Body": {body}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.accountSID, s.authToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sms provider answered %s", resp.Status)
+	}
+	return nil
+}
+
+// logSMSSender is used when no SMS provider is configured, meant for development.
+type logSMSSender struct{}
+
+func (logSMSSender) SendSMS(ctx context.Context, to, body string) error {
+	log.Printf("SMS to %s: %s", to, body)
+	return nil
+}
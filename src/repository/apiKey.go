@@ -0,0 +1,72 @@
+// repository/apiKey.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// inserting api key to db
+func CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	result := initializers.DB.WithContext(ctx).Create(key)
+	return result.Error
+}
+
+// fetching all api keys from db
+func GetAllAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	result := initializers.DB.WithContext(ctx).Order("id").Find(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return keys, nil
+}
+
+// fetching api key by id
+func GetAPIKeyByID(ctx context.Context, keyID string) (*models.APIKey, error) {
+	var key models.APIKey
+	result := initializers.DB.WithContext(ctx).First(&key, keyID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &key, nil
+}
+
+// fetching api key by the hash of the key
+func GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	result := initializers.DB.WithContext(ctx).Where("key_hash = ?", keyHash).First(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &key, nil
+}
+
+// updating the last time the api key was used
+func UpdateAPIKeyLastUsed(ctx context.Context, key *models.APIKey, usedAt time.Time) error {
+	result := initializers.DB.WithContext(ctx).Model(key).UpdateColumn("last_used_at", usedAt)
+	return result.Error
+}
+
+// revoking api key
+func RevokeAPIKey(ctx context.Context, key *models.APIKey, revokedAt time.Time) error {
+	result := initializers.DB.WithContext(ctx).Model(key).UpdateColumn("revoked_at", revokedAt)
+	return result.Error
+}
+
+// fetching the personal access tokens of a user
+func GetPersonalTokensByUser(ctx context.Context, userID uint) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	result := initializers.DB.WithContext(ctx).Where("user_id = ? AND personal = ?", userID, true).Order("id").Find(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return keys, nil
+}
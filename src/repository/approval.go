@@ -0,0 +1,78 @@
+// repository/approval.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// inserting approval to db
+func CreateApproval(ctx context.Context, approval *models.Approval) error {
+	result := initializers.DB.WithContext(ctx).Create(approval)
+	return result.Error
+}
+
+// fetching an approval by ID
+func GetApprovalByID(ctx context.Context, id string) (*models.Approval, error) {
+	var approval models.Approval
+	result := initializers.DB.WithContext(ctx).First(&approval, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &approval, nil
+}
+
+// fetching a page of the approvals, newest first, of a status when set; the pending approvals
+// past their expiry are listed as expired
+func GetApprovals(ctx context.Context, status string, limit, offset int) ([]*models.Approval, int64, error) {
+	approvals := []*models.Approval{}
+	var total int64
+
+	now := time.Now()
+	db := initializers.DB.WithContext(ctx).Model(&models.Approval{})
+	switch status {
+	case "":
+	case models.ApprovalPending:
+		db = db.Where("status = ? AND expires_at > ?", models.ApprovalPending, now)
+	case models.ApprovalExpired:
+		db = db.Where("status = ? OR (status = ? AND expires_at <= ?)", models.ApprovalExpired, models.ApprovalPending, now)
+	default:
+		db = db.Where("status = ?", status)
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := db.Order("id DESC").Limit(limit).Offset(offset).Find(&approvals).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return approvals, total, nil
+}
+
+// deciding a pending approval, false when it was decided meanwhile
+func DecideApproval(ctx context.Context, approval *models.Approval, status string, deciderID uint) (bool, error) {
+	now := time.Now()
+	result := initializers.DB.WithContext(ctx).Model(&models.Approval{}).
+		Where("id = ? AND status = ?", approval.ID, models.ApprovalPending).
+		Updates(map[string]interface{}{"status": status, "decided_by_id": deciderID, "decided_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	approval.Status, approval.DecidedByID, approval.DecidedAt = status, &deciderID, &now
+	return true, nil
+}
+
+// updating the status and result of an approval after its execution
+func UpdateApprovalResult(ctx context.Context, approval *models.Approval, status, result string) error {
+	approval.Status, approval.Result = status, result
+	return initializers.DB.WithContext(ctx).Model(approval).Updates(map[string]interface{}{"status": status, "result": result}).Error
+}
@@ -0,0 +1,87 @@
+// repository/auditLog.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// inserting audit log entry to db
+func CreateAuditLog(ctx context.Context, entry *models.AuditLog) error {
+	result := initializers.DB.WithContext(ctx).Create(entry)
+	return result.Error
+}
+
+// searching audit logs by action, target, ip or details
+func SearchAuditLogs(ctx context.Context, query string, limit, offset int) ([]*models.AuditLog, int64, error) {
+	var logs []*models.AuditLog
+	var total int64
+
+	pattern := likePattern(query)
+	db := initializers.DB.WithContext(ctx).Model(&models.AuditLog{}).
+		Where("action LIKE ? OR target_id LIKE ? OR ip LIKE ? OR details LIKE ?", pattern, pattern, pattern, pattern)
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&logs)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return logs, total, nil
+}
+
+// fetching the audit logs of the given IDs
+func GetAuditLogsByIDs(ctx context.Context, ids []string) ([]*models.AuditLog, error) {
+	var logs []*models.AuditLog
+	if len(ids) == 0 {
+		return logs, nil
+	}
+
+	result := initializers.DB.WithContext(ctx).Where("id IN ?", ids).Find(&logs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return logs, nil
+}
+
+// fetching the audit logs after the given ID, in ID order (batches of a full scan)
+func GetAuditLogsAfter(ctx context.Context, afterID uint, limit int) ([]*models.AuditLog, error) {
+	var logs []*models.AuditLog
+	result := initializers.DB.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&logs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return logs, nil
+}
+
+// fetching the audit logs after the given ID created before the time, in ID order (exports)
+func GetAuditLogsToExport(ctx context.Context, afterID uint, before time.Time, limit int) ([]*models.AuditLog, error) {
+	var logs []*models.AuditLog
+	result := initializers.DB.WithContext(ctx).Where("id > ? AND created_at < ?", afterID, before).Order("id").Limit(limit).Find(&logs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return logs, nil
+}
+
+// fetching the audit logs recording a diff of the target after the given time, newest first
+func GetAuditDiffsSince(ctx context.Context, targetID string, since time.Time) ([]*models.AuditLog, error) {
+	var logs []*models.AuditLog
+	result := initializers.DB.WithContext(ctx).
+		Where("target_id = ? AND diff <> '' AND created_at > ?", targetID, since).
+		Order("created_at DESC, id DESC").Find(&logs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,59 @@
+// repository/breakGlass.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// fetching the break-glass account
+func GetBreakGlassUser(ctx context.Context) (*models.User, error) {
+	var user models.User
+	result := initializers.DB.WithContext(ctx).Where("break_glass = ?", true).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
+}
+
+// inserting break-glass activation to db, ErrDuplicate when its nonce was already used
+func CreateBreakGlassActivation(ctx context.Context, activation *models.BreakGlassActivation) error {
+	result := initializers.DB.WithContext(ctx).Create(activation)
+	return translateError(result.Error)
+}
+
+// fetching the activation of the user open now
+func GetActiveBreakGlassActivation(ctx context.Context, userID uint) (*models.BreakGlassActivation, error) {
+	var activation models.BreakGlassActivation
+	result := initializers.DB.WithContext(ctx).
+		Where("user_id = ? AND sealed_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("expires_at DESC").First(&activation)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &activation, nil
+}
+
+// fetching the activations past their expiry not sealed yet
+func GetExpiredBreakGlassActivations(ctx context.Context) ([]*models.BreakGlassActivation, error) {
+	var activations []*models.BreakGlassActivation
+	result := initializers.DB.WithContext(ctx).
+		Where("sealed_at IS NULL AND expires_at <= ?", time.Now()).Find(&activations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return activations, nil
+}
+
+// sealing every open activation of the user
+func SealBreakGlassActivations(ctx context.Context, userID uint, at time.Time) error {
+	return initializers.DB.WithContext(ctx).Model(&models.BreakGlassActivation{}).
+		Where("user_id = ? AND sealed_at IS NULL", userID).
+		Update("sealed_at", at).Error
+}
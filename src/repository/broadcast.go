@@ -0,0 +1,85 @@
+// repository/broadcast.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// inserting broadcast to db
+func CreateBroadcast(ctx context.Context, broadcast *models.Broadcast) error {
+	result := initializers.DB.WithContext(ctx).Create(broadcast)
+	return result.Error
+}
+
+// fetching broadcast by id with its delivery statistics
+func GetBroadcastByID(ctx context.Context, broadcastID string) (*models.Broadcast, error) {
+	var broadcast models.Broadcast
+	result := initializers.DB.WithContext(ctx).Preload("Stats").First(&broadcast, broadcastID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &broadcast, nil
+}
+
+// listing the broadcasts, most recent first
+func GetAllBroadcasts(ctx context.Context, limit, offset int) ([]*models.Broadcast, int64, error) {
+	var broadcasts []*models.Broadcast
+	var total int64
+
+	db := initializers.DB.WithContext(ctx).Model(&models.Broadcast{})
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := db.Order("id DESC").Limit(limit).Offset(offset).Find(&broadcasts)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return broadcasts, total, nil
+}
+
+// moving a broadcast from one status to another, reporting false when it wasn't in the from status
+func TransitionBroadcast(ctx context.Context, broadcastID uint, from, to string) (bool, error) {
+	result := initializers.DB.WithContext(ctx).Model(&models.Broadcast{}).
+		Where("id = ? AND status = ?", broadcastID, from).Update("status", to)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// recording that a broadcast went out to its recipients
+func MarkBroadcastSent(ctx context.Context, broadcastID uint, recipients int, sentAt time.Time) error {
+	result := initializers.DB.WithContext(ctx).Model(&models.Broadcast{}).Where("id = ?", broadcastID).
+		Updates(map[string]interface{}{"status": models.BroadcastSent, "recipients": recipients, "sent_at": sentAt})
+	return result.Error
+}
+
+// counting a delivery, or a failed attempt, of a broadcast on a channel
+func IncrementBroadcastStat(ctx context.Context, broadcastID uint, channel string, delivered, failed int) error {
+	stat := &models.BroadcastStat{BroadcastID: broadcastID, Channel: channel, Delivered: delivered, Failed: failed}
+	result := initializers.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"delivered": gorm.Expr("delivered + ?", delivered),
+			"failed":    gorm.Expr("failed + ?", failed),
+		}),
+	}).Create(stat)
+	return result.Error
+}
+
+// counting the in-app notifications of a broadcast the recipients read
+func CountBroadcastReads(ctx context.Context, broadcastID uint) (int64, error) {
+	var count int64
+	result := initializers.DB.WithContext(ctx).Model(&models.Notification{}).
+		Where("broadcast_id = ? AND read_at IS NOT NULL", broadcastID).Count(&count)
+	return count, result.Error
+}
@@ -0,0 +1,57 @@
+// repository/countCache.go
+package repository
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"gorm.io/gorm"
+)
+
+// every user mutation bumps this version, which makes the cached counts stale
+const userCountVersionKey = "count:users:version"
+
+// Count is the result of a COUNT query that may come from the cache.
+type Count struct {
+	Total int64
+	Exact bool // false when served from the cache, the value may be up to USER_COUNT_CACHE_TTL old
+}
+
+// cachedUserCount runs the count query of db unless a cached result exists for the
+// signature (the filters of the query). Redis errors fall back to an exact count.
+func cachedUserCount(ctx context.Context, db *gorm.DB, signature string) (Count, error) {
+	ttl := initializers.GetEnvDuration("USER_COUNT_CACHE_TTL", 30*time.Second)
+
+	var key string
+	if ttl > 0 {
+		version, err := initializers.RedisClient.Get(ctx, userCountVersionKey).Result()
+		if err == nil || err == redis.Nil {
+			sum := sha1.Sum([]byte(signature))
+			key = "count:users:" + version + ":" + hex.EncodeToString(sum[:])
+
+			if cached, err := initializers.RedisClient.Get(ctx, key).Int64(); err == nil {
+				return Count{Total: cached, Exact: false}, nil
+			}
+		}
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return Count{}, err
+	}
+
+	if key != "" {
+		initializers.RedisClient.Set(ctx, key, total, ttl)
+	}
+
+	return Count{Total: total, Exact: true}, nil
+}
+
+// invalidateUserCounts is called after every user mutation
+func invalidateUserCounts(ctx context.Context) {
+	initializers.RedisClient.Incr(ctx, userCountVersionKey)
+}
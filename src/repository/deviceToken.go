@@ -0,0 +1,62 @@
+// repository/deviceToken.go
+package repository
+
+import (
+	"context"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm/clause"
+)
+
+// inserting device token to db, a token already registered moves to the user
+func SaveDeviceToken(ctx context.Context, device *models.DeviceToken) error {
+	result := initializers.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "name", "updated_at"}),
+	}).Create(device)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// MySQL doesn't report the id of the row updated on conflict
+	return initializers.DB.WithContext(ctx).Where("token = ?", device.Token).First(device).Error
+}
+
+// listing the user's device tokens
+func GetDeviceTokensByUser(ctx context.Context, userID uint) ([]*models.DeviceToken, error) {
+	var devices []*models.DeviceToken
+	result := initializers.DB.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&devices)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return devices, nil
+}
+
+// fetching device token by id
+func GetDeviceTokenByID(ctx context.Context, deviceID uint) (*models.DeviceToken, error) {
+	var device models.DeviceToken
+	result := initializers.DB.WithContext(ctx).First(&device, deviceID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &device, nil
+}
+
+// deleting one of the user's device tokens, reporting false when not found
+func DeleteDeviceToken(ctx context.Context, userID uint, deviceID string) (bool, error) {
+	result := initializers.DB.WithContext(ctx).Where("id = ? AND user_id = ?", deviceID, userID).Delete(&models.DeviceToken{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// deleting a device token the push provider rejected
+func DeleteInvalidDeviceToken(ctx context.Context, device *models.DeviceToken) error {
+	result := initializers.DB.WithContext(ctx).Delete(device)
+	return result.Error
+}
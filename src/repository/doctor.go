@@ -0,0 +1,50 @@
+// repository/doctor.go
+package repository
+
+import (
+	"context"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// UserEnums are the raw status and role of a user, read without the enum validation
+type UserEnums struct {
+	ID     uint
+	Status string
+	Role   string
+}
+
+// fetching the profile pictures of the users, the deleted users included as they can be restored
+func GetProfilePictures(ctx context.Context) ([]string, error) {
+	var pictures []string
+	result := initializers.DB.WithContext(ctx).Unscoped().Model(&models.User{}).
+		Where("profile_picture <> ''").Distinct().Pluck("profile_picture", &pictures)
+	return pictures, result.Error
+}
+
+// fetching the users whose status isn't one of the statuses or whose role isn't in the roles table
+func GetUsersWithInvalidEnums(ctx context.Context, statuses []models.Status) ([]UserEnums, error) {
+	var users []UserEnums
+	result := initializers.DB.WithContext(ctx).Unscoped().Table("users").
+		Select("users.id, users.status, users.role").
+		Joins("LEFT JOIN roles ON roles.name = users.role").
+		Where("users.status IS NULL OR users.status NOT IN ? OR roles.name IS NULL", statuses).
+		Order("users.id").Scan(&users)
+	return users, result.Error
+}
+
+// counting the rows of the model whose user no longer exists
+func CountOrphanedRecords(ctx context.Context, model interface{}) (int64, error) {
+	var count int64
+	result := initializers.DB.WithContext(ctx).Model(model).
+		Where("user_id NOT IN (SELECT id FROM users)").Count(&count)
+	return count, result.Error
+}
+
+// deleting the rows of the model whose user no longer exists
+func DeleteOrphanedRecords(ctx context.Context, model interface{}) (int64, error) {
+	result := initializers.DB.WithContext(ctx).
+		Where("user_id NOT IN (SELECT id FROM users)").Delete(model)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,62 @@
+// repository/entitlement.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+)
+
+// saving an entitlement, replacing the expiry of the same grant
+func SaveEntitlement(ctx context.Context, entitlement *models.Entitlement) error {
+	var existing models.Entitlement
+	result := initializers.DB.WithContext(ctx).
+		Where("feature = ? AND user_id = ? AND role = ?", entitlement.Feature, entitlement.UserID, entitlement.Role).
+		First(&existing)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return initializers.DB.WithContext(ctx).Create(entitlement).Error
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+
+	entitlement.ID, entitlement.CreatedAt = existing.ID, existing.CreatedAt
+	return initializers.DB.WithContext(ctx).Save(entitlement).Error
+}
+
+// fetching the entitlements, of a feature when feature is set
+func GetEntitlements(ctx context.Context, feature string) ([]*models.Entitlement, error) {
+	entitlements := []*models.Entitlement{}
+	db := initializers.DB.WithContext(ctx).Order("feature, id")
+	if feature != "" {
+		db = db.Where("feature = ?", feature)
+	}
+	if result := db.Find(&entitlements); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return entitlements, nil
+}
+
+// fetching the features granted to the user, directly or through its role, that haven't expired
+func GetUserFeatures(ctx context.Context, user *models.User) ([]string, error) {
+	features := []string{}
+	result := initializers.DB.WithContext(ctx).Model(&models.Entitlement{}).
+		Where("(user_id = ? OR role = ?) AND (expires_at IS NULL OR expires_at > ?)", user.ID, user.Role, time.Now()).
+		Distinct().Order("feature").Pluck("feature", &features)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return features, nil
+}
+
+// deleting an entitlement, false when there was none with the ID
+func DeleteEntitlement(ctx context.Context, id string) (bool, error) {
+	result := initializers.DB.WithContext(ctx).Delete(&models.Entitlement{}, id)
+	return result.RowsAffected > 0, result.Error
+}
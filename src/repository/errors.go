@@ -0,0 +1,43 @@
+// repository/errors.go
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/nabazesmail/gopher/src/apierrors"
+)
+
+// ErrConstraintViolation is returned when MySQL rejects a value through a CHECK, ENUM or foreign key constraint.
+var ErrConstraintViolation = apierrors.New(apierrors.InvalidRequest, "value rejected by a database constraint")
+
+// ErrDuplicate is returned when MySQL rejects a value already taken by another row, through a unique index.
+var ErrDuplicate = apierrors.New(apierrors.Conflict, "value already taken")
+
+// ErrIdentityUserDeleted is returned when the user linked to a provider identity is deleted.
+var ErrIdentityUserDeleted = errors.New("the user of the identity is deleted")
+
+// MySQL error numbers
+const (
+	mysqlErrDupEntry             = 1062
+	mysqlErrDataTruncated        = 1265 // invalid ENUM value in strict mode
+	mysqlErrNoReferencedRow      = 1452 // e.g. a user role missing from the roles table
+	mysqlErrCheckConstraintFails = 3819
+)
+
+// translateError maps the MySQL errors the services care about to repository errors.
+func translateError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return err
+	}
+
+	switch mysqlErr.Number {
+	case mysqlErrDataTruncated, mysqlErrNoReferencedRow, mysqlErrCheckConstraintFails:
+		return fmt.Errorf("%w: %s", ErrConstraintViolation, mysqlErr.Message)
+	case mysqlErrDupEntry:
+		return fmt.Errorf("%w: %s", ErrDuplicate, mysqlErr.Message)
+	}
+	return err
+}
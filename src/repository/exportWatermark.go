@@ -0,0 +1,31 @@
+// repository/exportWatermark.go
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+)
+
+// fetching the watermark of an export stream, a new one starting at 0 when it never ran
+func GetExportWatermark(ctx context.Context, name string) (*models.ExportWatermark, error) {
+	var watermark models.ExportWatermark
+	result := initializers.DB.WithContext(ctx).Where("name = ?", name).First(&watermark)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return &models.ExportWatermark{Name: name}, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &watermark, nil
+}
+
+// saving the watermark of an export stream
+func SaveExportWatermark(ctx context.Context, watermark *models.ExportWatermark) error {
+	result := initializers.DB.WithContext(ctx).Save(watermark)
+	return result.Error
+}
@@ -0,0 +1,71 @@
+// repository/invite.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+)
+
+// inserting invite to db
+func CreateInvite(ctx context.Context, invite *models.Invite) error {
+	result := initializers.DB.WithContext(ctx).Create(invite)
+	return result.Error
+}
+
+// fetching all invites, most recent first
+func GetAllInvites(ctx context.Context) ([]*models.Invite, error) {
+	var invites []*models.Invite
+	result := initializers.DB.WithContext(ctx).Order("created_at DESC").Find(&invites)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return invites, nil
+}
+
+// fetching invite by the hash of its token
+func GetInviteByTokenHash(ctx context.Context, tokenHash string) (*models.Invite, error) {
+	var invite models.Invite
+	result := initializers.DB.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&invite)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &invite, nil
+}
+
+// inserting a user and consuming its invite in one transaction. The invite is claimed with a
+// conditional update so concurrent signups can't both use it, gorm.ErrRecordNotFound is
+// returned when it was already used or has expired.
+func CreateUserWithInvite(ctx context.Context, user *models.User, invite *models.Invite) error {
+	now := time.Now()
+	err := initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		claimed := tx.Model(&models.Invite{}).
+			Where("id = ? AND used_at IS NULL AND expires_at > ?", invite.ID, now).
+			Update("used_at", now)
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Invite{}).Where("id = ?", invite.ID).Update("used_by_id", user.ID).Error
+	})
+	if err != nil {
+		return translateError(err)
+	}
+
+	invite.UsedAt = &now
+	invite.UsedByID = &user.ID
+	invalidateUserCounts(ctx)
+	return nil
+}
@@ -0,0 +1,105 @@
+// repository/loginEvent.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+)
+
+// LoginEventFilter narrows a listing of login events, zero fields don't filter.
+type LoginEventFilter struct {
+	UserID   uint
+	Username string
+	Method   string
+	Outcome  string
+	IP       string
+	Since    time.Time
+	Until    time.Time
+}
+
+// inserting login event to db
+func CreateLoginEvent(ctx context.Context, event *models.LoginEvent) error {
+	result := initializers.DB.WithContext(ctx).Create(event)
+	return result.Error
+}
+
+// listing login events matching the filter, most recent first
+func GetLoginEvents(ctx context.Context, filter LoginEventFilter, limit, offset int) ([]*models.LoginEvent, int64, error) {
+	var events []*models.LoginEvent
+	var total int64
+
+	db := loginEventsMatching(ctx, filter)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&events)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return events, total, nil
+}
+
+// counting login events matching the filter
+func CountLoginEvents(ctx context.Context, filter LoginEventFilter) (int64, error) {
+	var total int64
+	result := loginEventsMatching(ctx, filter).Count(&total)
+	return total, result.Error
+}
+
+func loginEventsMatching(ctx context.Context, filter LoginEventFilter) *gorm.DB {
+	db := initializers.DB.WithContext(ctx).Model(&models.LoginEvent{})
+	if filter.UserID != 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Username != "" {
+		db = db.Where("username = ?", filter.Username)
+	}
+	if filter.Method != "" {
+		db = db.Where("method = ?", filter.Method)
+	}
+	if filter.Outcome != "" {
+		db = db.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.IP != "" {
+		db = db.Where("ip = ?", filter.IP)
+	}
+	if !filter.Since.IsZero() {
+		db = db.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		db = db.Where("created_at < ?", filter.Until)
+	}
+	return db
+}
+
+// fetching the login events after the given ID created before the time, in ID order (exports)
+func GetLoginEventsToExport(ctx context.Context, afterID uint, before time.Time, limit int) ([]*models.LoginEvent, error) {
+	var events []*models.LoginEvent
+	result := initializers.DB.WithContext(ctx).Where("id > ? AND created_at < ?", afterID, before).Order("id").Limit(limit).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return events, nil
+}
+
+// fetching the login events of the given IDs
+func GetLoginEventsByIDs(ctx context.Context, ids []string) ([]*models.LoginEvent, error) {
+	var events []*models.LoginEvent
+	if len(ids) == 0 {
+		return events, nil
+	}
+
+	result := initializers.DB.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return events, nil
+}
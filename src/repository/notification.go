@@ -0,0 +1,105 @@
+// repository/notification.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fetching the user's notification preferences, the defaults when never set
+func GetNotificationPreference(ctx context.Context, userID uint) (*models.NotificationPreference, error) {
+	var preference models.NotificationPreference
+	result := initializers.DB.WithContext(ctx).First(&preference, userID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return models.DefaultNotificationPreference(userID), nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &preference, nil
+}
+
+// inserting or replacing the user's notification preferences
+func SaveNotificationPreference(ctx context.Context, preference *models.NotificationPreference) error {
+	result := initializers.DB.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(preference)
+	return result.Error
+}
+
+// inserting notification to db
+func CreateNotification(ctx context.Context, notification *models.Notification) error {
+	result := initializers.DB.WithContext(ctx).Create(notification)
+	return result.Error
+}
+
+// fetching notification by id
+func GetNotificationByID(ctx context.Context, notificationID uint) (*models.Notification, error) {
+	var notification models.Notification
+	result := initializers.DB.WithContext(ctx).First(&notification, notificationID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &notification, nil
+}
+
+// listing the user's in-app notifications, most recent first
+func GetInAppNotifications(ctx context.Context, userID uint, limit, offset int) ([]*models.Notification, int64, error) {
+	var notifications []*models.Notification
+	var total int64
+
+	db := initializers.DB.WithContext(ctx).Model(&models.Notification{}).Where("user_id = ? AND in_app = ?", userID, true)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&notifications)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return notifications, total, nil
+}
+
+// marking one of the user's notifications as read, reports false when it doesn't exist
+func MarkNotificationRead(ctx context.Context, userID uint, notificationID string, readAt time.Time) (bool, error) {
+	result := initializers.DB.WithContext(ctx).Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND in_app = ?", notificationID, userID, true).
+		Where("read_at IS NULL").
+		UpdateColumn("read_at", readAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// already read
+	var count int64
+	err := initializers.DB.WithContext(ctx).Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND in_app = ?", notificationID, userID, true).Count(&count).Error
+	return count > 0, err
+}
+
+// fetching the notifications waiting for the digest, oldest first
+func GetPendingDigestNotifications(ctx context.Context) ([]*models.Notification, error) {
+	var notifications []*models.Notification
+	result := initializers.DB.WithContext(ctx).Where("digest_pending = ?", true).Order("user_id, created_at").Find(&notifications)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return notifications, nil
+}
+
+// taking notifications out of the digest queue
+func ClearDigestPending(ctx context.Context, notificationIDs []uint) error {
+	result := initializers.DB.WithContext(ctx).Model(&models.Notification{}).Where("id IN ?", notificationIDs).UpdateColumn("digest_pending", false)
+	return result.Error
+}
@@ -0,0 +1,55 @@
+// repository/oauthClient.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// inserting oauth client to db
+func CreateOAuthClient(ctx context.Context, client *models.OAuthClient) error {
+	result := initializers.DB.WithContext(ctx).Create(client)
+	return result.Error
+}
+
+// fetching all oauth clients from db
+func GetAllOAuthClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	var clients []*models.OAuthClient
+	result := initializers.DB.WithContext(ctx).Order("id").Find(&clients)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return clients, nil
+}
+
+// fetching oauth client by id
+func GetOAuthClientByID(ctx context.Context, id string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	result := initializers.DB.WithContext(ctx).First(&client, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &client, nil
+}
+
+// fetching oauth client by its public client id
+func GetOAuthClientByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	result := initializers.DB.WithContext(ctx).Where("client_id = ?", clientID).First(&client)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &client, nil
+}
+
+// revoking oauth client
+func RevokeOAuthClient(ctx context.Context, client *models.OAuthClient, revokedAt time.Time) error {
+	result := initializers.DB.WithContext(ctx).Model(client).UpdateColumn("revoked_at", revokedAt)
+	return result.Error
+}
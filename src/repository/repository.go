@@ -2,31 +2,270 @@
 package repository
 
 import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/nabazesmail/gopher/src/initializers"
 	"github.com/nabazesmail/gopher/src/models"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // inserting user to db
-func CreateUser(user *models.User) error {
-	result := initializers.DB.Create(user)
-	return result.Error
+func CreateUser(ctx context.Context, user *models.User) error {
+	result := initializers.DB.WithContext(ctx).Create(user)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+
+	invalidateUserCounts(ctx)
+	return nil
 }
 
-// fetching all users from db
-func GetAllUsers() ([]*models.User, error) {
-	var users []*models.User
-	result := initializers.DB.Find(&users)
+// inserting users to db in a single transaction, none is inserted when one fails
+func CreateUsersBatch(ctx context.Context, users []*models.User) error {
+	err := initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(users, 100).Error
+	})
+	if err != nil {
+		return translateError(err)
+	}
+
+	invalidateUserCounts(ctx)
+	return nil
+}
+
+// fetching which of the usernames are taken, by deleted users too
+func GetTakenUsernames(ctx context.Context, usernames []string) ([]string, error) {
+	var taken []string
+	if len(usernames) == 0 {
+		return taken, nil
+	}
+
+	result := initializers.DB.WithContext(ctx).Unscoped().Model(&models.User{}).Where("username IN ?", usernames).Pluck("username", &taken)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	return users, nil
+	return taken, nil
+}
+
+// UserFilter narrows a listing of users, zero fields don't filter. Sort lists the columns
+// to order by, e.g. "-created_at,full_name" (a leading - sorts descending), by ID when empty.
+// The deleted users are left out unless IncludeDeleted is set. Fields names the fields of
+// UserFields to read, every column when empty. PhonePrefix is the start of the phones, in the
+// E.164 format.
+type UserFilter struct {
+	Role           models.Role
+	Status         models.Status
+	PhonePrefix    string
+	Sort           string
+	IncludeDeleted bool
+	Fields         []string
+}
+
+// the fields the users can be projected to, with the columns they are read from
+var UserFields = map[string]string{
+	"id":              "id",
+	"full_name":       "full_name",
+	"username":        "username",
+	"email":           "email",
+	"status":          "status",
+	"role":            "role",
+	"profile_picture": "profile_picture",
+	"last_login_at":   "last_login_at",
+	"last_seen_at":    "last_seen_at",
+	"online":          "last_seen_at",
+	"created_at":      "created_at",
+	"updated_at":      "updated_at",
+	"deleted_at":      "deleted_at",
+	"phone":           "phone",
+	"legal_hold":      "legal_hold",
+	"metadata":        "metadata",
+}
+
+// userColumns returns the columns to select for the fields, nil for all of them; the ID is
+// always read, the presence and the order need it
+func userColumns(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	columns := []string{"id"}
+	seen := map[string]bool{"id": true}
+	for _, field := range fields {
+		column, ok := UserFields[field]
+		if !ok {
+			allowed := make([]string, 0, len(UserFields))
+			for name := range UserFields {
+				allowed = append(allowed, name)
+			}
+			sort.Strings(allowed)
+			return nil, &models.EnumError{Field: "field", Value: field, Allowed: allowed}
+		}
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// the columns the users can be sorted by
+var UserSortColumns = []string{"id", "full_name", "username", "role", "status", "created_at", "updated_at", "deleted_at", "last_login_at", "last_seen_at"}
+
+// userOrder translates the sort of the filter to order clauses, rejecting the columns outside of UserSortColumns
+func userOrder(sort string) ([]clause.OrderByColumn, error) {
+	var order []clause.OrderByColumn
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		desc := strings.HasPrefix(field, "-")
+		name := strings.TrimPrefix(field, "-")
+
+		allowed := false
+		for _, column := range UserSortColumns {
+			if name == column {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, &models.EnumError{Field: "sort column", Value: name, Allowed: UserSortColumns}
+		}
+		order = append(order, clause.OrderByColumn{Column: clause.Column{Name: name}, Desc: desc})
+	}
+
+	// the ID breaks the ties, the pages stay stable
+	return append(order, clause.OrderByColumn{Column: clause.Column{Name: "id"}}), nil
+}
+
+// ValidateUserSort returns the *models.EnumError of a sort with a column outside of UserSortColumns.
+func ValidateUserSort(sort string) error {
+	_, err := userOrder(sort)
+	return err
+}
+
+// fetching a page of the users matching the filter from db, all of them when limit is negative
+func GetAllUsers(ctx context.Context, filter UserFilter, limit, offset int) ([]*models.User, Count, error) {
+	var users []*models.User
+
+	db, signature := usersMatching(ctx, filter)
+	order, err := userOrder(filter.Sort)
+	if err != nil {
+		return nil, Count{}, err
+	}
+
+	columns, err := userColumns(filter.Fields)
+	if err != nil {
+		return nil, Count{}, err
+	}
+
+	count, err := cachedUserCount(ctx, db.Session(&gorm.Session{}), signature)
+	if err != nil {
+		return nil, Count{}, err
+	}
+
+	if columns != nil {
+		db = db.Select(columns)
+	}
+	for _, column := range order {
+		db = db.Order(column)
+	}
+	result := db.Limit(limit).Offset(offset).Find(&users)
+	if result.Error != nil {
+		return nil, Count{}, result.Error
+	}
+
+	return users, count, nil
+}
+
+// reading the users matching the filter from a cursor, handing them to fn by batches of size
+func StreamUsers(ctx context.Context, filter UserFilter, size int, fn func([]*models.User) error) error {
+	db, _ := usersMatching(ctx, filter)
+	order, err := userOrder(filter.Sort)
+	if err != nil {
+		return err
+	}
+	columns, err := userColumns(filter.Fields)
+	if err != nil {
+		return err
+	}
+	if columns != nil {
+		db = db.Select(columns)
+	}
+	for _, column := range order {
+		db = db.Order(column)
+	}
+
+	rows, err := db.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batch := make([]*models.User, 0, size)
+	for rows.Next() {
+		var user models.User
+		if err := db.ScanRows(rows, &user); err != nil {
+			return err
+		}
+		if batch = append(batch, &user); len(batch) == size {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = make([]*models.User, 0, size)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// usersMatching returns the query of the users matching the filter, with the signature of its count
+func usersMatching(ctx context.Context, filter UserFilter) (*gorm.DB, string) {
+	db := initializers.DB.WithContext(ctx).Model(&models.User{})
+	signature := "all:" + string(filter.Role) + ":" + string(filter.Status)
+	if filter.Role != "" {
+		db = db.Where("role = ?", filter.Role)
+	}
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if filter.PhonePrefix != "" {
+		db = db.Where("phone LIKE ?", prefixPattern(filter.PhonePrefix))
+		signature += ":phone" + filter.PhonePrefix
+	}
+	if filter.IncludeDeleted {
+		db = db.Unscoped()
+		signature += ":deleted"
+	}
+	return db, signature
 }
 
 // fetching user form db by Id
-func GetUserByID(userID string) (*models.User, error) {
+func GetUserByID(ctx context.Context, userID string) (*models.User, error) {
 	var user models.User
-	result := initializers.DB.First(&user, userID)
+	result := initializers.DB.WithContext(ctx).First(&user, userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
+}
+
+// fetching user form db by Id, the deleted users included
+func GetUserByIDWithDeleted(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	result := initializers.DB.WithContext(ctx).Unscoped().First(&user, userID)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -35,32 +274,331 @@ func GetUserByID(userID string) (*models.User, error) {
 }
 
 // updating user in db
-func UpdateUser(user *models.User) error {
-	result := initializers.DB.Save(user)
+func UpdateUser(ctx context.Context, user *models.User) error {
+	result := initializers.DB.WithContext(ctx).Save(user)
 	if result.Error != nil {
-		return result.Error
+		return translateError(result.Error)
 	}
 
+	invalidateUserCounts(ctx)
 	return nil
 }
 
+// updating the user's password hash
+func UpdatePassword(ctx context.Context, user *models.User, hashedPassword string) error {
+	result := initializers.DB.WithContext(ctx).Model(user).Update("password", hashedPassword)
+	return result.Error
+}
+
 // deleting user from db
-func DeleteUser(user *models.User) error {
-	result := initializers.DB.Delete(user)
+func DeleteUser(ctx context.Context, user *models.User) error {
+	result := initializers.DB.WithContext(ctx).Delete(user)
 	if result.Error != nil {
 		return result.Error
 	}
 
+	invalidateUserCounts(ctx)
 	return nil
 }
 
-// fetching user by username
-func GetUserByUsername(username string) (*models.User, error) {
+// deleting the users from db in one statement
+func DeleteUsers(ctx context.Context, users []*models.User) error {
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	result := initializers.DB.WithContext(ctx).Delete(&models.User{}, ids)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	invalidateUserCounts(ctx)
+	return nil
+}
+
+// updating the role of the users in one statement
+func UpdateUsersRole(ctx context.Context, users []*models.User, role models.Role) error {
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	result := initializers.DB.WithContext(ctx).Model(&models.User{}).Where("id IN ?", ids).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	invalidateUserCounts(ctx)
+	return nil
+}
+
+// restoring a deleted user, gorm.ErrRecordNotFound when there is no deleted user with the ID
+func RestoreUser(ctx context.Context, userID string) (*models.User, error) {
 	var user models.User
-	result := initializers.DB.Where("username = ?", username).First(&user)
+	result := initializers.DB.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").First(&user, userID)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
+	result = initializers.DB.WithContext(ctx).Unscoped().Model(&user).Update("deleted_at", nil)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+
+	invalidateUserCounts(ctx)
 	return &user, nil
 }
+
+// fetching user by username, in the NFKC form the usernames are stored in
+func GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	result := initializers.DB.WithContext(ctx).Where("username = ?", norm.NFKC.String(username)).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
+}
+
+// setting the user's verified phone number
+func UpdatePhone(ctx context.Context, user *models.User, phone string, verifiedAt time.Time) error {
+	result := initializers.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"phone":             phone,
+		"phone_verified_at": verifiedAt,
+	})
+	return result.Error
+}
+
+// enabling or disabling the SMS second factor of the user
+func UpdateSMSOTP(ctx context.Context, user *models.User, enabled bool) error {
+	result := initializers.DB.WithContext(ctx).Model(user).Update("sms_otp_enabled", enabled)
+	return result.Error
+}
+
+// marking the user's account for deletion, nil cancels the deletion
+func UpdateDeletionRequested(ctx context.Context, user *models.User, requestedAt *time.Time) error {
+	var value interface{}
+	if requestedAt != nil {
+		value = *requestedAt
+	}
+	result := initializers.DB.WithContext(ctx).Model(user).Update("deletion_requested_at", value)
+	return result.Error
+}
+
+// placing the user under legal hold or lifting it
+func UpdateLegalHold(ctx context.Context, user *models.User, hold bool) error {
+	result := initializers.DB.WithContext(ctx).Model(user).UpdateColumn("legal_hold", hold)
+	return result.Error
+}
+
+// activating or deactivating the user
+func UpdateUserStatus(ctx context.Context, user *models.User, status models.Status) error {
+	result := initializers.DB.WithContext(ctx).Model(user).Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	invalidateUserCounts(ctx)
+	return nil
+}
+
+// fetching the active users with one of the roles (any role when none), those whose account
+// deletion was requested excepted
+func GetUsersToNotify(ctx context.Context, roles []string) ([]*models.User, error) {
+	var users []*models.User
+	result := usersToNotify(ctx, roles).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return users, nil
+}
+
+// counting the users GetUsersToNotify would return
+func CountUsersToNotify(ctx context.Context, roles []string) (int64, error) {
+	var count int64
+	result := usersToNotify(ctx, roles).Count(&count)
+	return count, result.Error
+}
+
+func usersToNotify(ctx context.Context, roles []string) *gorm.DB {
+	db := initializers.DB.WithContext(ctx).Model(&models.User{}).Where("status = ? AND deletion_requested_at IS NULL", models.Active)
+	if len(roles) > 0 {
+		db = db.Where("role IN ?", roles)
+	}
+	return db
+}
+
+// fetching the users whose account deletion was requested before the time, those under legal hold excepted
+func GetUsersPendingDeletion(ctx context.Context, requestedBefore time.Time) ([]*models.User, error) {
+	var users []*models.User
+	result := initializers.DB.WithContext(ctx).Where("deletion_requested_at < ? AND legal_hold = ?", requestedBefore, false).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return users, nil
+}
+
+// the records of a user deleted with it when purged, by table
+var userRecords = []struct {
+	table string
+	model interface{}
+}{
+	{"sessions", &models.Session{}},
+	{"api_keys", &models.APIKey{}},
+	{"user_identities", &models.UserIdentity{}},
+	{"notifications", &models.Notification{}},
+	{"notification_preferences", &models.NotificationPreference{}},
+	{"user_preferences", &models.UserPreferences{}},
+	{"device_tokens", &models.DeviceToken{}},
+	{"login_events", &models.LoginEvent{}},
+	{"username_history", &models.UsernameHistory{}},
+	{"entitlements", &models.Entitlement{}},
+}
+
+// counting the records a purge of the user would delete, by table
+func CountUserRecords(ctx context.Context, user *models.User) (map[string]int64, error) {
+	counts := map[string]int64{"users": 1}
+	for _, records := range userRecords {
+		var count int64
+		if err := initializers.DB.WithContext(ctx).Model(records.model).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			counts[records.table] = count
+		}
+	}
+	return counts, nil
+}
+
+// permanently deleting the user with their sessions, keys, identities, notifications, preferences, devices,
+// login history, former usernames and entitlements, the audit logs are kept
+func PurgeUser(ctx context.Context, user *models.User) error {
+	err := initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, records := range userRecords {
+			if err := tx.Where("user_id = ?", user.ID).Delete(records.model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(user).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	invalidateUserCounts(ctx)
+	return nil
+}
+
+// updating the user's last login time
+func UpdateLastLogin(ctx context.Context, user *models.User, loginAt time.Time) error {
+	result := initializers.DB.WithContext(ctx).Model(user).UpdateColumn("last_login_at", loginAt)
+	return result.Error
+}
+
+// searching users by full name or username, ranked: exact username, then prefix matches, then
+// by the FULLTEXT relevance (ft_users_search index, added by the migration)
+func SearchUsers(ctx context.Context, query string, limit, offset int) ([]*models.User, Count, error) {
+	var users []*models.User
+
+	pattern := likePattern(query)
+	db := initializers.DB.WithContext(ctx).Model(&models.User{}).Where("full_name LIKE ? OR username LIKE ?", pattern, pattern)
+
+	count, err := cachedUserCount(ctx, db.Session(&gorm.Session{}), "search:"+query)
+	if err != nil {
+		return nil, Count{}, err
+	}
+
+	prefix := strings.TrimPrefix(pattern, "%")
+	rank := clause.OrderBy{Expression: clause.Expr{
+		SQL:                "username = ? DESC, (username LIKE ? OR full_name LIKE ?) DESC, MATCH (full_name, username) AGAINST (? IN NATURAL LANGUAGE MODE) DESC, id",
+		Vars:               []interface{}{query, prefix, prefix, query},
+		WithoutParentheses: true,
+	}}
+	result := db.Order(rank).Limit(limit).Offset(offset).Find(&users)
+	if result.Error != nil {
+		return nil, Count{}, result.Error
+	}
+
+	return users, count, nil
+}
+
+// fetching the users after the given ID, in ID order (batches of a full scan)
+func GetUsersAfter(ctx context.Context, afterID uint, limit int) ([]*models.User, error) {
+	var users []*models.User
+	result := initializers.DB.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return users, nil
+}
+
+// counting the users by status
+func CountUsersByStatus(ctx context.Context) (map[models.Status]int64, error) {
+	var rows []struct {
+		Status models.Status
+		Total  int64
+	}
+	result := initializers.DB.WithContext(ctx).Model(&models.User{}).Select("status, COUNT(*) AS total").Group("status").Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	counts := map[models.Status]int64{}
+	for _, row := range rows {
+		counts[row.Status] = row.Total
+	}
+	return counts, nil
+}
+
+// fetching the most recently registered users, with the number registered since the time
+func GetRecentUsers(ctx context.Context, since time.Time, limit int) ([]*models.User, int64, error) {
+	var users []*models.User
+	var total int64
+
+	db := initializers.DB.WithContext(ctx).Model(&models.User{}).Where("created_at >= ?", since)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := db.Order("created_at DESC").Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return users, total, nil
+}
+
+// likePattern escapes the LIKE wildcards in the query and wraps it for a contains match
+func likePattern(query string) string {
+	return "%" + prefixPattern(query)
+}
+
+// prefixPattern escapes the LIKE wildcards of the query, matching the values starting with it
+func prefixPattern(query string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(query) + "%"
+}
+
+// updating the user's last seen time
+func UpdateLastSeen(ctx context.Context, user *models.User, seenAt time.Time) error {
+	result := initializers.DB.WithContext(ctx).Model(user).UpdateColumn("last_seen_at", seenAt)
+	return result.Error
+}
+
+// fetching users by a list of IDs
+func GetUsersByIDs(ctx context.Context, userIDs []string) ([]*models.User, error) {
+	var users []*models.User
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+
+	result := initializers.DB.WithContext(ctx).Where("id IN ?", userIDs).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return users, nil
+}
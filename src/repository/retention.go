@@ -0,0 +1,45 @@
+// repository/retention.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm/clause"
+)
+
+// fetching the IDs of up to limit rows of the model created before the time, except the rows
+// whose userColumn is a user under legal hold
+func GetExpiredRowIDs(ctx context.Context, model interface{}, userColumn string, before time.Time, limit int) ([]uint, error) {
+	db := initializers.DB.WithContext(ctx)
+	held := db.Unscoped().Model(&models.User{}).Select("id").Where("legal_hold = ?", true) // deleted users included
+
+	var ids []uint
+	result := db.Model(model).
+		Where("created_at < ?", before).
+		Where(userColumn+" IS NULL OR "+userColumn+" NOT IN (?)", held).
+		Order("id").Limit(limit).Pluck("id", &ids)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return ids, nil
+}
+
+// deleting the rows of the model with the given IDs, it returns the number of deleted rows
+func DeleteRowsByIDs(ctx context.Context, model interface{}, ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result := initializers.DB.WithContext(ctx).Where("id IN ?", ids).Delete(model)
+	return result.RowsAffected, result.Error
+}
+
+// inserting archived rows back (a pointer to a slice of models), the rows still present are skipped
+func RestoreRows(ctx context.Context, rows interface{}) (int64, error) {
+	result := initializers.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, 500)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,91 @@
+// repository/role.go
+package repository
+
+import (
+	"context"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+)
+
+// fetching all roles with their permissions
+func GetAllRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	var roles []*models.RoleDefinition
+	result := initializers.DB.WithContext(ctx).Preload("Permissions").Order("id").Find(&roles)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return roles, nil
+}
+
+// fetching role by name with its permissions
+func GetRoleByName(ctx context.Context, name string) (*models.RoleDefinition, error) {
+	var role models.RoleDefinition
+	result := initializers.DB.WithContext(ctx).Preload("Permissions").Where("name = ?", name).First(&role)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &role, nil
+}
+
+// fetching all permissions
+func GetAllPermissions(ctx context.Context) ([]*models.Permission, error) {
+	var permissions []*models.Permission
+	result := initializers.DB.WithContext(ctx).Order("id").Find(&permissions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return permissions, nil
+}
+
+// fetching the permissions with the given names
+func GetPermissionsByName(ctx context.Context, names []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	result := initializers.DB.WithContext(ctx).Where("name IN ?", names).Find(&permissions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return permissions, nil
+}
+
+// inserting role with its permissions to db
+func CreateRole(ctx context.Context, role *models.RoleDefinition) error {
+	result := initializers.DB.WithContext(ctx).Create(role)
+	return translateError(result.Error)
+}
+
+// updating the description and replacing the permissions of a role in one transaction
+func UpdateRole(ctx context.Context, role *models.RoleDefinition, permissions []models.Permission) error {
+	return initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Update("description", role.Description).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(role).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+		role.Permissions = permissions
+		return nil
+	})
+}
+
+// deleting role and its permission grants
+func DeleteRole(ctx context.Context, role *models.RoleDefinition) error {
+	return initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return translateError(tx.Delete(role).Error)
+	})
+}
+
+// counting the users having a role
+func CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	var count int64
+	result := initializers.DB.WithContext(ctx).Model(&models.User{}).Where("role = ?", role).Count(&count)
+	return count, result.Error
+}
@@ -0,0 +1,88 @@
+// repository/session.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// inserting session to db
+func CreateSession(ctx context.Context, session *models.Session) error {
+	result := initializers.DB.WithContext(ctx).Create(session)
+	return result.Error
+}
+
+// fetching session by id
+func GetSessionByID(ctx context.Context, sessionID string) (*models.Session, error) {
+	var session models.Session
+	result := initializers.DB.WithContext(ctx).First(&session, sessionID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &session, nil
+}
+
+// updating session in db
+func UpdateSession(ctx context.Context, session *models.Session) error {
+	result := initializers.DB.WithContext(ctx).Save(session)
+	return result.Error
+}
+
+// updating the session's last seen time
+func UpdateSessionLastSeen(ctx context.Context, sessionID uint, seenAt time.Time) error {
+	result := initializers.DB.WithContext(ctx).Model(&models.Session{}).Where("id = ?", sessionID).UpdateColumn("last_seen_at", seenAt)
+	return result.Error
+}
+
+// fetching the user's sessions that are neither revoked nor expired
+func GetActiveSessionsByUser(ctx context.Context, userID uint) ([]*models.Session, error) {
+	var sessions []*models.Session
+	result := initializers.DB.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return sessions, nil
+}
+
+// fetching the sessions opened for the oauth client that are neither revoked nor expired
+func GetActiveSessionsByClient(ctx context.Context, clientID string) ([]*models.Session, error) {
+	var sessions []*models.Session
+	result := initializers.DB.WithContext(ctx).
+		Where("client_id = ? AND revoked_at IS NULL AND expires_at > ?", clientID, time.Now()).
+		Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return sessions, nil
+}
+
+// searching active sessions by ip or device
+func SearchSessions(ctx context.Context, query string, limit, offset int) ([]*models.Session, int64, error) {
+	var sessions []*models.Session
+	var total int64
+
+	pattern := likePattern(query)
+	db := initializers.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("revoked_at IS NULL AND expires_at > ?", time.Now()).
+		Where("ip LIKE ? OR user_agent LIKE ?", pattern, pattern)
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := db.Order("last_seen_at DESC").Limit(limit).Offset(offset).Find(&sessions)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return sessions, total, nil
+}
@@ -0,0 +1,159 @@
+// repository/userCursor.go
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't issued for the sort of the listing.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// the sort columns a cursor can page by, they are never null so the rows compare with a range
+var cursorColumns = map[string]bool{
+	"id": true, "full_name": true, "username": true, "role": true, "status": true, "created_at": true, "updated_at": true,
+}
+
+// userCursor is the position after the last user of a page, the opaque ?cursor= of the clients
+type userCursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"` // the values of the order columns of the last user, its ID last
+}
+
+// fetching the users matching the filter after the cursor, the first ones when it is empty;
+// next is the cursor of the following page, empty after the last one. The rows are found with
+// a range on the order columns instead of an offset, so the deep pages cost as much as the first.
+func GetUsersByCursor(ctx context.Context, filter UserFilter, cursor string, limit int) (users []*models.User, next string, err error) {
+	order, err := userOrder(filter.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, column := range order {
+		if !cursorColumns[column.Column.Name] {
+			return nil, "", &models.EnumError{Field: "sort column of a cursor", Value: column.Column.Name, Allowed: []string{"id", "full_name", "username", "role", "status", "created_at", "updated_at"}}
+		}
+	}
+
+	db, _ := usersMatching(ctx, filter)
+	columns, err := userColumns(filter.Fields)
+	if err != nil {
+		return nil, "", err
+	}
+	if columns != nil {
+		// the order columns make the next cursor
+		for _, column := range order {
+			columns = append(columns, column.Column.Name)
+		}
+		db = db.Select(columns)
+	}
+
+	if cursor != "" {
+		values, err := decodeUserCursor(cursor, filter.Sort, order)
+		if err != nil {
+			return nil, "", err
+		}
+		db = db.Where(afterPosition(order, values))
+	}
+	for _, column := range order {
+		db = db.Order(column)
+	}
+
+	// one more row tells whether there is a next page
+	if result := db.Limit(limit + 1).Find(&users); result.Error != nil {
+		return nil, "", result.Error
+	}
+	if len(users) > limit {
+		users = users[:limit]
+		next = encodeUserCursor(filter.Sort, order, users[len(users)-1])
+	}
+	return users, next, nil
+}
+
+// afterPosition is the condition of the rows after the position in the order:
+// (a > x) OR (a = x AND b > y) OR ..., the comparisons following the direction of each column
+func afterPosition(order []clause.OrderByColumn, values []interface{}) clause.Expr {
+	var sql []string
+	var vars []interface{}
+	for i, column := range order {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, "? = ?")
+			vars = append(vars, clause.Column{Name: order[j].Column.Name}, values[j])
+		}
+		operator := "? > ?"
+		if column.Desc {
+			operator = "? < ?"
+		}
+		terms = append(terms, operator)
+		vars = append(vars, clause.Column{Name: column.Column.Name}, values[i])
+		sql = append(sql, "("+strings.Join(terms, " AND ")+")")
+	}
+	return clause.Expr{SQL: "(" + strings.Join(sql, " OR ") + ")", Vars: vars}
+}
+
+func encodeUserCursor(sort string, order []clause.OrderByColumn, user *models.User) string {
+	position := userCursor{Sort: sort}
+	for _, column := range order {
+		var value string
+		switch column.Column.Name {
+		case "id":
+			value = strconv.FormatUint(uint64(user.ID), 10)
+		case "full_name":
+			value = user.FullName
+		case "username":
+			value = user.Username
+		case "role":
+			value = string(user.Role)
+		case "status":
+			value = string(user.Status)
+		case "created_at":
+			value = user.CreatedAt.Format(time.RFC3339Nano)
+		case "updated_at":
+			value = user.UpdatedAt.Format(time.RFC3339Nano)
+		}
+		position.Values = append(position.Values, value)
+	}
+	data, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeUserCursor returns the values of the position, typed like their columns
+func decodeUserCursor(cursor, sort string, order []clause.OrderByColumn) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var position userCursor
+	if err := json.Unmarshal(data, &position); err != nil || position.Sort != sort || len(position.Values) != len(order) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(order))
+	for i, column := range order {
+		switch column.Column.Name {
+		case "id":
+			id, err := strconv.ParseUint(position.Values[i], 10, 64)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			values[i] = id
+		case "created_at", "updated_at":
+			t, err := time.Parse(time.RFC3339Nano, position.Values[i])
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			values[i] = t
+		default:
+			values[i] = position.Values[i]
+		}
+	}
+	return values, nil
+}
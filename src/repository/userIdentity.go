@@ -0,0 +1,100 @@
+// repository/userIdentity.go
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+)
+
+// fetching the user linked to a provider account
+func GetUserByIdentity(ctx context.Context, provider, providerID string) (*models.User, error) {
+	var identity models.UserIdentity
+	result := initializers.DB.WithContext(ctx).Where("provider = ? AND provider_id = ?", provider, providerID).First(&identity)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var user models.User
+	result = initializers.DB.WithContext(ctx).First(&user, identity.UserID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrIdentityUserDeleted
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
+}
+
+// inserting a user and its provider identity in one transaction
+func CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	err := initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+	if err != nil {
+		return translateError(err)
+	}
+
+	invalidateUserCounts(ctx)
+	return nil
+}
+
+// checking whether a username is already taken
+func UsernameExists(ctx context.Context, username string) (bool, error) {
+	var count int64
+	result := initializers.DB.WithContext(ctx).Model(&models.User{}).Where("username = ?", username).Count(&count)
+	return count > 0, result.Error
+}
+
+// fetching the provider identity of a user
+func GetIdentityByUser(ctx context.Context, provider string, userID uint) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	result := initializers.DB.WithContext(ctx).Where("provider = ? AND user_id = ?", provider, userID).First(&identity)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &identity, nil
+}
+
+// listing the identities of a provider, optionally only the one of providerID, with the total count
+func GetIdentitiesByProvider(ctx context.Context, provider, providerID string, limit, offset int) ([]*models.UserIdentity, int64, error) {
+	var identities []*models.UserIdentity
+	var total int64
+
+	db := initializers.DB.WithContext(ctx).Model(&models.UserIdentity{}).Where("provider = ?", provider)
+	if providerID != "" {
+		db = db.Where("provider_id = ?", providerID)
+	}
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := db.Order("id").Limit(limit).Offset(offset).Find(&identities)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return identities, total, nil
+}
+
+// changing the account a user is linked to at the provider
+func UpdateIdentityProviderID(ctx context.Context, identity *models.UserIdentity, providerID string) error {
+	result := initializers.DB.WithContext(ctx).Model(identity).Update("provider_id", providerID)
+	return translateError(result.Error)
+}
+
+// deleting a provider identity
+func DeleteIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	result := initializers.DB.WithContext(ctx).Delete(identity)
+	return result.Error
+}
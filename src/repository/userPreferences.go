@@ -0,0 +1,32 @@
+// repository/userPreferences.go
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fetching the user's preferences, the defaults when never set
+func GetUserPreferences(ctx context.Context, userID uint) (*models.UserPreferences, error) {
+	var preferences models.UserPreferences
+	result := initializers.DB.WithContext(ctx).First(&preferences, userID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return models.DefaultUserPreferences(userID), nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &preferences, nil
+}
+
+// inserting or replacing the user's preferences
+func SaveUserPreferences(ctx context.Context, preferences *models.UserPreferences) error {
+	result := initializers.DB.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(preferences)
+	return result.Error
+}
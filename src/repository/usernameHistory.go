@@ -0,0 +1,53 @@
+// repository/usernameHistory.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+	"gorm.io/gorm"
+)
+
+// saving a renamed user and its former username in one transaction
+func RenameUser(ctx context.Context, user *models.User, previousUsername string) error {
+	err := initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UsernameHistory{UserID: user.ID, Username: previousUsername, RenamedAt: time.Now()}).Error
+	})
+	if err != nil {
+		return translateError(err)
+	}
+
+	invalidateUserCounts(ctx)
+	return nil
+}
+
+// fetching the user who last went by the former username, gorm.ErrRecordNotFound when nobody did
+func GetUserByFormerUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	result := initializers.DB.WithContext(ctx).
+		Joins("JOIN username_history ON username_history.user_id = users.id").
+		Where("username_history.username = ?", username).
+		Order("username_history.renamed_at DESC").
+		First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
+}
+
+// fetching the former usernames of the user, the latest first
+func GetUsernameHistory(ctx context.Context, userID uint) ([]models.UsernameHistory, error) {
+	history := []models.UsernameHistory{}
+	result := initializers.DB.WithContext(ctx).Where("user_id = ?", userID).Order("renamed_at DESC").Find(&history)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return history, nil
+}
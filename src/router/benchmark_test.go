@@ -0,0 +1,137 @@
+// router/benchmark_test.go
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/testenv"
+)
+
+// The benchmarks measure the hot paths through SetupRouter, middlewares included, on the
+// in-memory database and Redis of testenv; go test ./src/router -run '^$' -bench . runs them.
+// They compare the changes of a path, the load test harness (cmd/loadtest) measures a deployment.
+
+const benchmarkPassword = "correct horse battery staple"
+
+// benchmarkRouter returns the router on a new test environment and the token of an admin,
+// the login rate limits disabled
+func benchmarkRouter(b *testing.B) (http.Handler, *models.User, string) {
+	b.Helper()
+
+	testenv.Setup(b)
+	b.Setenv("LOGIN_RATE_LIMIT_IP", "0")
+	b.Setenv("LOGIN_RATE_LIMIT_USERNAME", "0")
+	admin := testenv.CreateUser(b, &models.User{FullName: "Ada Lovelace", Username: "ada", Role: models.Admin}, benchmarkPassword)
+
+	r := SetupRouter()
+	rec := serve(b, r, "POST", "/login", "", `{"username": "ada", "password": "`+benchmarkPassword+`"}`)
+	var body struct {
+		Token string `json:"token"`
+	}
+	decode(b, rec, &body)
+	return r, admin, body.Token
+}
+
+// serve serves the request, failing the benchmark unless it is answered with a 200
+func serve(b *testing.B, handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		b.Fatalf("%s %s: status %d, body %s", method, path, rec.Code, rec.Body)
+	}
+	return rec
+}
+
+// decode decodes the JSON body of the response
+func decode(b *testing.B, rec *httptest.ResponseRecorder, v interface{}) {
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		b.Fatalf("decoding %s: %s", rec.Body, err)
+	}
+}
+
+func BenchmarkLogin(b *testing.B) {
+	r, _, _ := benchmarkRouter(b)
+	body := `{"username": "ada", "password": "` + benchmarkPassword + `"}`
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serve(b, r, "POST", "/login", "", body)
+	}
+}
+
+func BenchmarkGetUserByID(b *testing.B) {
+	r, _, token := benchmarkRouter(b)
+	user := testenv.CreateUser(b, &models.User{FullName: "Grace Hopper", Username: "grace"}, benchmarkPassword)
+	path := "/users/" + strconv.FormatUint(uint64(user.ID), 10)
+
+	b.Run("cached", func(b *testing.B) {
+		serve(b, r, "GET", path, token, "")
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			serve(b, r, "GET", path, token, "")
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			testenv.FlushRedis(b)
+			b.StartTimer()
+
+			serve(b, r, "GET", path, token, "")
+		}
+	})
+}
+
+func BenchmarkListUsers(b *testing.B) {
+	r, _, token := benchmarkRouter(b)
+	const users, perPage = 200, 20
+	for i := 0; i < users; i++ {
+		testenv.CreateUser(b, &models.User{FullName: fmt.Sprintf("User %d", i), Username: fmt.Sprintf("user%d", i)}, benchmarkPassword)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		page := i%(users/perPage) + 1
+		serve(b, r, "GET", fmt.Sprintf("/users?page=%d&per_page=%d", page, perPage), token, "")
+	}
+}
+
+func BenchmarkProfilePicture(b *testing.B) {
+	r, _, token := benchmarkRouter(b)
+
+	// the uploads directory is relative to the working directory
+	b.Chdir(b.TempDir())
+	if err := os.MkdirAll(filepath.Join("src", "public", "uploads"), 0755); err != nil {
+		b.Fatal(err)
+	}
+	picture := make([]byte, 64<<10)
+	copy(picture, "\x89PNG\r\n\x1a\n")
+	if err := os.WriteFile(filepath.Join("src", "public", "uploads", "grace.png"), picture, 0644); err != nil {
+		b.Fatal(err)
+	}
+	user := testenv.CreateUser(b, &models.User{FullName: "Grace Hopper", Username: "grace", ProfilePicture: "grace.png"}, benchmarkPassword)
+	path := "/users/" + strconv.FormatUint(uint64(user.ID), 10) + "/profile_picture"
+
+	b.SetBytes(int64(len(picture)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serve(b, r, "GET", path, token, "")
+	}
+}
@@ -0,0 +1,241 @@
+// router/contract_test.go
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabazesmail/gopher/src/golden"
+	"github.com/nabazesmail/gopher/src/mockserver"
+	"github.com/nabazesmail/gopher/src/testenv"
+)
+
+// The contract tests render the responses of the endpoints and compare them with the golden
+// files of testdata/golden, so a change of a DTO, of the error envelope or of an enum can't
+// reach the API consumers unnoticed. go test ./src/router -update rewrites the golden files;
+// review their diff like any change of the API. The tests run without MySQL or Redis, on the
+// in-memory database and Redis of testenv: every route of SetupRouter is rendered without
+// credentials, and the users and auth routes with the users of the mock server fixtures, by
+// the handlers, services and DTOs of the API and by the mock server answering like it.
+
+func TestMain(m *testing.M) {
+	os.Setenv("GIN_MODE", gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	gin.DefaultErrorWriter = io.Discard
+	log.SetOutput(io.Discard) // the cache hits and misses of the services
+	os.Exit(m.Run())
+}
+
+// the volatile fields of the responses, their values are replaced so the golden files are stable
+var volatileFields = map[string]bool{
+	"token":         true,
+	"refresh_token": true,
+	"expires_in":    true,
+	"created_at":    true,
+	"updated_at":    true,
+	"last_login_at": true,
+	"last_seen_at":  true,
+	"deleted_at":    true,
+}
+
+// contractResponse is a rendered response as the golden files hold it
+type contractResponse struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body"`
+}
+
+// render serves the request and returns its response, the volatile fields replaced
+func render(t *testing.T, handler http.Handler, method, path, token, body string) contractResponse {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	response := contractResponse{Status: rec.Code}
+	if rec.Body.Len() > 0 {
+		if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") ||
+			strings.HasPrefix(rec.Header().Get("Content-Type"), "application/scim+json") {
+			response.Body = stabilize(golden.DecodeJSON(t, rec.Body.Bytes()))
+		} else {
+			response.Body = rec.Body.String()
+		}
+	}
+	return response
+}
+
+// stabilize replaces the values of the volatile fields at any depth
+func stabilize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			if volatileFields[name] && field != nil {
+				v[name] = "volatile"
+				continue
+			}
+			v[name] = stabilize(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = stabilize(item)
+		}
+	}
+	return value
+}
+
+// concretePath fills the parameters of a route path
+func concretePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		switch {
+		case strings.HasPrefix(part, ":"):
+			parts[i] = "1"
+		case strings.HasPrefix(part, "*"):
+			parts[i] = "file"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// TestRouteContract pins the endpoints of the API, a removed or renamed route fails it.
+func TestRouteContract(t *testing.T) {
+	routes := []string{}
+	for _, route := range SetupRouter().Routes() {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+	sort.Strings(routes)
+
+	golden.AssertJSON(t, "routes", routes)
+}
+
+// TestRouterContract renders every endpoint of SetupRouter without credentials: the error
+// envelope of the protected routes, the validation of the public ones and the well-known
+// documents.
+func TestRouterContract(t *testing.T) {
+	testenv.Setup(t)
+	r := SetupRouter()
+
+	responses := map[string]contractResponse{}
+	for _, route := range r.Routes() {
+		responses[route.Method+" "+route.Path] = render(t, r, route.Method, concretePath(route.Path), "", "")
+	}
+	responses["GET /unknown"] = render(t, r, "GET", "/unknown", "", "")
+	responses["DELETE /errors"] = render(t, r, "DELETE", "/errors", "", "")
+
+	golden.AssertJSON(t, "router_responses", responses)
+}
+
+// a request of the contract of the users and auth endpoints, rendered by the API and by the
+// mock server
+type contractCase struct {
+	name         string
+	as           string // the fixture user the request is made by, anonymous when empty
+	method, path string
+	body         string
+	mysql        bool // needs MySQL (the FULLTEXT ranking of the search), not rendered by TestAPIContract
+}
+
+var contractCases = []contractCase{
+	{name: "register", method: "POST", path: "/register",
+		body: `{"full_name": "Ada Lovelace", "username": "ada", "email": "ada@example.com", "password": "Secret1234", "status": "active", "role": "operator"}`},
+	{name: "register_invalid", method: "POST", path: "/register",
+		body: `{"full_name": "", "username": "a", "email": "not-an-email", "password": "short", "status": "active", "role": "operator"}`},
+	{name: "register_taken", method: "POST", path: "/register",
+		body: `{"full_name": "Other Operator", "username": "operator", "password": "Secret1234", "status": "active", "role": "operator"}`},
+	{name: "login", method: "POST", path: "/login", body: `{"username": "admin", "password": "Admin12345"}`},
+	{name: "login_invalid", method: "POST", path: "/login", body: `{"username": "admin", "password": "wrong-password"}`},
+	{name: "refresh_invalid", method: "POST", path: "/refresh", body: `{"refresh_token": "unknown"}`},
+	{name: "logout", as: "admin", method: "POST", path: "/logout"},
+	{name: "me", as: "operator", method: "GET", path: "/me"},
+	{name: "me_unauthenticated", method: "GET", path: "/me"},
+	{name: "me_preferences", as: "operator", method: "GET", path: "/me/preferences"},
+	{name: "users_list", as: "admin", method: "GET", path: "/users?sort=id"},
+	{name: "users_get", as: "admin", method: "GET", path: "/users/2"},
+	{name: "users_get_missing", as: "admin", method: "GET", path: "/users/99"},
+	{name: "users_by_username", as: "admin", method: "GET", path: "/users/by-username/operator"},
+	{name: "users_batch", as: "admin", method: "POST", path: "/users/batch", body: `{"ids": ["1", "2", "99"]}`},
+	{name: "users_search", as: "admin", method: "GET", path: "/users/search?q=oper", mysql: true},
+	{name: "users_patch", as: "admin", method: "PATCH", path: "/users/2", body: `{"full_name": "Renamed Operator"}`},
+	{name: "users_delete", as: "admin", method: "DELETE", path: "/users/2"},
+	{name: "users_delete_forbidden", as: "operator", method: "DELETE", path: "/users/1"},
+	{name: "users_bulk", as: "admin", method: "POST", path: "/users/bulk",
+		body: `[{"full_name": "Grace Hopper", "username": "grace", "password": "Secret1234", "status": "active", "role": "operator"}, {"full_name": "Duplicate", "username": "admin", "password": "Secret1234", "status": "active", "role": "operator"}]`},
+}
+
+// TestAPIContract renders the users and auth endpoints of SetupRouter, its handlers, services
+// and DTOs on the test database and Redis holding the users of the mock server fixtures.
+func TestAPIContract(t *testing.T) {
+	for _, tt := range contractCases {
+		if tt.mysql {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			testenv.Setup(t)
+			for _, user := range mockserver.DefaultFixtures().Users {
+				testenv.CreateUser(t, user, user.Password)
+			}
+			r := SetupRouter()
+
+			token := ""
+			if tt.as != "" {
+				token = login(t, r, tt.as)
+			}
+			golden.AssertJSON(t, "api_"+tt.name, render(t, r, tt.method, tt.path, token, tt.body))
+		})
+	}
+}
+
+// TestMockServerContract renders the users and auth endpoints with the fixtures of the mock
+// server, which answers with the DTOs, statuses and error codes of the API.
+func TestMockServerContract(t *testing.T) {
+	for _, tt := range contractCases {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := mockserver.NewStore(mockserver.DefaultFixtures())
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := mockserver.NewRouter(store)
+
+			token := ""
+			if tt.as != "" {
+				token = login(t, r, tt.as)
+			}
+			golden.AssertJSON(t, "mock_"+tt.name, render(t, r, tt.method, tt.path, token, tt.body))
+		})
+	}
+}
+
+// login returns an access token of the fixture user, whose password is its username
+// capitalized followed by digits (see mockserver.DefaultFixtures)
+func login(t *testing.T, handler http.Handler, username string) string {
+	t.Helper()
+
+	passwords := map[string]string{"admin": "Admin12345", "operator": "Operator123"}
+	body, _ := json.Marshal(map[string]string{"username": username, "password": passwords[username]})
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil || tokens.Token == "" {
+		t.Fatalf("logging in as %s: %d %s", username, rec.Code, rec.Body)
+	}
+	return tokens.Token
+}
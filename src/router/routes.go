@@ -2,46 +2,334 @@
 package router
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/nabazesmail/gopher/src/controllers"
+	"github.com/nabazesmail/gopher/src/initializers"
 	"github.com/nabazesmail/gopher/src/middleware"
 	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/utils"
 )
 
 // SetupRouter sets up the Gin router and defines the routes for the application.
 func SetupRouter() *gin.Engine {
+	//  debug (default), release or test, from GIN_MODE
+	gin.SetMode(initializers.GetEnv("GIN_MODE", gin.DebugMode))
+
 	r := gin.Default()
 
-	//  a route to create a new user
-	r.POST("/register", controllers.CreateUser)
+	//  take the client IP from X-Forwarded-For only behind the proxies of TRUSTED_PROXIES (IPs or
+	//  CIDRs), the rate limits are keyed on it and anyone can send the header
+	if err := r.SetTrustedProxies(initializers.GetEnvList("TRUSTED_PROXIES")); err != nil {
+		middleware.Logger.Printf("Invalid TRUSTED_PROXIES, no proxy is trusted: %s", err)
+		r.SetTrustedProxies(nil)
+	}
+
+	//  JSON answers for unknown routes and for routes called with the wrong method (with Allow header)
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(controllers.NotFound)
+	r.NoMethod(controllers.MethodNotAllowed)
+
+	//  render every error as {"code", "message", "details"}, the errors of the services included
+	r.Use(middleware.ErrorEnvelope())
+
+	//  keep the client IP and user agent in the request context (sessions)
+	r.Use(middleware.ClientInfo())
+
+	//  count the database queries of every request
+	r.Use(middleware.QueryBudget())
+
+	//  serve the former camelCase field names to the clients still using them
+	r.Use(middleware.LegacyFieldNames())
+
+	//  mirror a share of the read traffic when SHADOW_BASE_URL is set
+	r.Use(middleware.Shadow())
+
+	//  delay or fail a share of the requests when FAULT_INJECTION_ENABLED is set (resilience testing)
+	r.Use(middleware.FaultInjection())
+
+	//  well-known routes for scanners, browsers and other services
+	wellKnown := r.Group("/.well-known")
+	wellKnown.GET("/security.txt", controllers.SecurityTxt)
+	wellKnown.GET("/change-password", controllers.ChangePasswordRedirect)
+	wellKnown.GET("/jwks.json", controllers.JWKS)
+	wellKnown.GET("/oauth-authorization-server", controllers.OAuthServerMetadata)
+
+	//  the catalog of the error codes of the API, for the client SDKs
+	r.GET("/errors", controllers.GetErrorCatalog)
+
+	//  the CAPTCHA checked on registration and login when CAPTCHA_PROVIDER is set
+	captcha := middleware.Captcha(middleware.DefaultCaptchaVerifier())
+
+	//  a route for the automation creating an environment to provision its admin, roles and features
+	//  from a declarative document, idempotent, with the bearer token of BOOTSTRAP_TOKEN
+	r.POST("/bootstrap", middleware.BootstrapAuth(), controllers.Bootstrap)
+
+	//  a route to create a new user, with an invite when REGISTRATION_REQUIRES_INVITE is enabled
+	r.POST("/register", captcha, controllers.CreateUser)
+
+	//  a route to login the user, rate limited per IP and username against brute force
+	r.POST("/login", middleware.LoginRateLimit(), captcha, controllers.Login)
+
+	//  a route to complete a login with the code texted to the user (SMS second factor)
+	r.POST("/login/otp", middleware.LoginRateLimit(), controllers.VerifyLoginOTP)
+
+	//  routes to log in with a single-use link sent to the user, the link opening a page that
+	//  posts its token back so opening it alone doesn't log in
+	r.POST("/login/magic", middleware.LoginRateLimit(), controllers.RequestMagicLink)
+	r.GET("/login/magic/verify", controllers.MagicLinkPage)
+	r.POST("/login/magic/verify", controllers.VerifyMagicLink)
+
+	//  a route to exchange a refresh token for a new token pair
+	r.POST("/refresh", controllers.RefreshToken)
 
-	//  a route to login the user
-	r.POST("/login", controllers.Login)
+	//  routes to log in with an OAuth2 provider (google, github)
+	r.GET("/auth/:provider", controllers.OAuthLogin)
+	r.GET("/auth/:provider/callback", controllers.OAuthCallback)
+
+	//  the token endpoint of the authorization server (this service acting as identity provider)
+	r.POST("/oauth/token", controllers.OAuthToken)
+
+	//  the introspection endpoint, for the services validating access tokens with their client credentials
+	r.POST("/oauth/introspect", controllers.OAuthIntrospect)
+
+	//  routes to request a password reset token and reset the password
+	r.POST("/password/forgot", controllers.ForgotPassword)
+	r.POST("/password/reset", controllers.ResetPassword)
+
+	//  SCIM 2.0 provisioning of the users by an identity provider (Okta, Azure AD), with its bearer token
+	scimRoutes := r.Group("/scim/v2", middleware.SCIMAuth())
+	scimRoutes.POST("/Users", controllers.SCIMCreateUser)
+	scimRoutes.GET("/Users", controllers.SCIMGetUsers)
+	scimRoutes.GET("/Users/:id", controllers.SCIMGetUser)
+	scimRoutes.PUT("/Users/:id", controllers.SCIMReplaceUser)
+	scimRoutes.PATCH("/Users/:id", controllers.SCIMPatchUser)
+	scimRoutes.DELETE("/Users/:id", controllers.SCIMDeleteUser)
+
+	//  routes to the public profile of a user, its name and avatar, for embedding in other products
+	publicRoutes := r.Group("/users/:id/public", middleware.IPRateLimit("public",
+		initializers.GetEnvInt("PUBLIC_RATE_LIMIT_IP", 120), initializers.GetEnvDuration("PUBLIC_RATE_LIMIT_WINDOW", time.Minute)))
+	publicRoutes.GET("", controllers.GetPublicProfile)
+	publicRoutes.GET("/avatar", controllers.GetPublicAvatar)
+
+	//  routes authorized by a single-use action token instead of a login
+	actionRoutes := r.Group("/action")
+	actionRoutes.POST("/users/:id/profile_picture", middleware.ActionToken(utils.ActionUploadAvatar, "id"), controllers.UploadProfilePicture)
+	actionRoutes.GET("/reports/:name", middleware.ActionToken(utils.ActionDownloadReport, "name"), controllers.DownloadReport)
 
 	//  protected routes using a middleware to authenticate the requests.
 	protectedRoutes := r.Group("/")
 	protectedRoutes.Use(middleware.AuthMiddleware()) // Use the AuthMiddleware for all routes in this group.
+	protectedRoutes.Use(middleware.Audit())          // Record every mutating request in the audit log.
+	protectedRoutes.Use(middleware.TrackPresence())  // Keep track of when users were last seen.
+	protectedRoutes.Use(middleware.Coalesce())       // Run identical concurrent GETs once when COALESCE_GETS is enabled.
+
+	//  a route to logout and revoke the current token (protected route)
+	protectedRoutes.POST("/logout", controllers.Logout)
+
+	//  the authorization endpoint of the authorization server, for the signed in user (protected route)
+	protectedRoutes.GET("/oauth/authorize", middleware.DenyImpersonation(), controllers.OAuthAuthorize)
+
+	//  a route to mint a short-lived token for a single action (uploads, email links)
+	protectedRoutes.POST("/action-tokens", middleware.DenyImpersonation(), controllers.CreateActionToken)
+
+	//  a route to check many permissions of the caller at once, for the frontends (protected route)
+	protectedRoutes.POST("/auth/check", controllers.CheckPermissions)
+
+	//  routes to the authenticated user's own account, without knowing its ID
+	protectedRoutes.GET("/me", middleware.RequirePermission(models.PermProfileRead), controllers.GetUserProfile)
+	protectedRoutes.PUT("/me", middleware.DenyImpersonation(), middleware.IfMatch(), controllers.UpdateMe)
+	protectedRoutes.GET("/me/avatar", controllers.GetMyAvatar)
+
+	//  a route to list the features the user is entitled to (protected route)
+	protectedRoutes.GET("/me/features", controllers.GetMyFeatures)
+
+	//  a route to change the user's own password, signing out the other sessions
+	protectedRoutes.PUT("/me/password", middleware.DenyImpersonation(), controllers.ChangeMyPassword)
+
+	//  a route to delete the user's own account, recoverable by logging in during the grace period
+	protectedRoutes.DELETE("/me", middleware.DenyImpersonation(), controllers.DeleteMyAccount)
+
+	//  routes to verify the user's phone number and use it as second login factor
+	protectedRoutes.POST("/me/phone", middleware.DenyImpersonation(), controllers.StartMyPhoneVerification)
+	protectedRoutes.POST("/me/phone/verify", middleware.DenyImpersonation(), controllers.VerifyMyPhone)
+	protectedRoutes.PUT("/me/sms-otp", middleware.DenyImpersonation(), controllers.UpdateMySMSOTP)
+
+	//  routes to list and revoke the user's own sessions (protected routes)
+	protectedRoutes.GET("/me/sessions", controllers.GetMySessions)
+	protectedRoutes.DELETE("/me/sessions/:id", middleware.DenyImpersonation(), controllers.DeleteMySession)
+
+	//  a route to get the user's own login history, failed attempts included (protected route)
+	protectedRoutes.GET("/me/logins", controllers.GetMyLogins)
+
+	//  routes to get and set the user's theme, language and notification display
+	protectedRoutes.GET("/me/preferences", controllers.GetMyPreferences)
+	protectedRoutes.PUT("/me/preferences", controllers.UpdateMyPreferences)
+
+	//  routes to set the user's notification channels, quiet hours and digest, and read the in-app inbox
+	protectedRoutes.GET("/me/notification-preferences", controllers.GetMyNotificationPreferences)
+	protectedRoutes.PUT("/me/notification-preferences", controllers.UpdateMyNotificationPreferences)
+	protectedRoutes.GET("/me/notifications", controllers.GetMyNotifications)
+	protectedRoutes.POST("/me/notifications/:id/read", controllers.ReadMyNotification)
+
+	//  routes to register, list and unregister the devices push notifications are sent to
+	protectedRoutes.POST("/me/devices", controllers.RegisterMyDevice)
+	protectedRoutes.GET("/me/devices", controllers.GetMyDevices)
+	protectedRoutes.DELETE("/me/devices/:id", controllers.DeleteMyDevice)
+
+	//  routes to create, list and revoke the user's personal access tokens (protected routes)
+	protectedRoutes.POST("/me/tokens", middleware.DenyImpersonation(), controllers.CreateMyToken)
+	protectedRoutes.GET("/me/tokens", controllers.GetMyTokens)
+	protectedRoutes.DELETE("/me/tokens/:id", middleware.DenyImpersonation(), controllers.DeleteMyToken)
+
+	//  a route to create users in bulk (protected route)
+	protectedRoutes.POST("/users/bulk", middleware.RequirePermission(models.PermUsersCreate), controllers.CreateUsersBulk)
 
 	//  a route to get all users (protected route)
-	protectedRoutes.GET("/users", middleware.CheckAccess(models.Operator), controllers.GetAllUsers)
+	protectedRoutes.GET("/users", middleware.RequirePermission(models.PermUsersRead), controllers.GetAllUsers)
+
+	//  routes to get many users by ID at once, ?ids=1,2,3 or a body with POST (protected routes)
+	protectedRoutes.GET("/users/batch", middleware.RequirePermission(models.PermUsersRead), controllers.GetUsersBatch)
+	protectedRoutes.POST("/users/batch", middleware.RequirePermission(models.PermUsersRead), controllers.GetUsersBatch)
+
+	//  a route to get the users currently online (protected route)
+	protectedRoutes.GET("/users/online", middleware.RequirePermission(models.PermUsersRead), controllers.GetOnlineUsers)
+
+	//  a route to search users by full name or username, ?q= (protected route)
+	protectedRoutes.GET("/users/search", middleware.RequirePermission(models.PermUsersRead), controllers.SearchUsers)
+
+	//  a route to get a user by username, or by a former one with USERNAME_ALIASES_ENABLED (protected route)
+	protectedRoutes.GET("/users/by-username/:username", middleware.RequirePermission(models.PermUsersRead), controllers.GetUserByUsername)
 
 	//  a route to get a user by ID (protected route)
-	protectedRoutes.GET("/users/:id", middleware.CheckAccess(models.Operator), controllers.GetUserByID)
+	protectedRoutes.GET("/users/:id", middleware.RequirePermission(models.PermUsersRead), controllers.GetUserByID)
 
-	//  a route to update a user by ID (protected route)
-	protectedRoutes.PUT("/users/:id", middleware.CheckAccess(models.Admin), controllers.UpdateUserByID)
+	//  a route to get the former usernames of a user (protected route)
+	protectedRoutes.GET("/users/:id/username-history", middleware.RequirePermission(models.PermUsersRead), controllers.GetUsernameHistory)
 
-	//  a route to delete a user by ID (protected route)
-	protectedRoutes.DELETE("/users/:id", middleware.CheckAccess(models.Admin), controllers.DeleteUserByID)
+	//  a route to update a user by ID, If-Match with its ETag (protected route)
+	protectedRoutes.PUT("/users/:id", middleware.RequirePermission(models.PermUsersUpdate), middleware.IfMatch(), controllers.UpdateUserByID)
+
+	//  a route to patch a user by ID with a JSON Merge Patch, If-Match with its ETag (protected route)
+	protectedRoutes.PATCH("/users/:id", middleware.RequirePermission(models.PermUsersUpdate), middleware.IfMatch(), controllers.PatchUserByID)
+
+	//  a route to delete a user by ID, If-Match with its ETag (protected route)
+	protectedRoutes.DELETE("/users/:id", middleware.RequirePermission(models.PermUsersDelete), middleware.IfMatch(), controllers.DeleteUserByID)
+
+	//  a route to restore a deleted user (protected route)
+	protectedRoutes.POST("/users/:id/restore", middleware.RequirePermission(models.PermUsersDelete), controllers.RestoreUserByID)
 
 	//  a route to get the user's profile (protected route)
-	protectedRoutes.GET("/profile", middleware.CheckAccess(models.Operator), controllers.GetUserProfile)
+	protectedRoutes.GET("/profile", middleware.RequirePermission(models.PermProfileRead), controllers.GetUserProfile)
 
 	//  a route to handle file uploads and update user profile picture
-	protectedRoutes.POST("/imgUpload/:id", middleware.CheckAccess(models.Admin), controllers.UploadProfilePicture)
+	protectedRoutes.POST("/imgUpload/:id", middleware.RequirePermission(models.PermUsersUploadPicture), controllers.UploadProfilePicture)
 
 	// a route to get and preview the user's profile picture by ID
-	protectedRoutes.GET("/users/:id/profile_picture", middleware.CheckAccess(models.Operator), controllers.GetProfilePicture)
+	protectedRoutes.GET("/users/:id/profile_picture", middleware.RequirePermission(models.PermUsersRead), controllers.GetProfilePicture)
+
+	//  admin routes (protected, each one requiring its permission)
+	adminRoutes := protectedRoutes.Group("/admin")
+
+	//  a route to export the access review report (json or ?format=csv)
+	adminRoutes.GET("/reports/access-review", middleware.RequirePermission(models.PermReportsRead), controllers.GetAccessReviewReport)
+
+	//  a route to deliver the access review report by email or to the storage backend
+	adminRoutes.POST("/reports/access-review/deliver", middleware.RequirePermission(models.PermReportsDeliver), controllers.DeliverAccessReviewReport)
+
+	//  a route to get a short-lived token acting as a user, its requests are all audited
+	adminRoutes.POST("/users/:id/impersonate", middleware.RequirePermission(models.PermUsersImpersonate), middleware.DenyImpersonation(), controllers.ImpersonateUser)
+
+	//  a route to place a user under legal hold, suspending the purge of their history and account
+	adminRoutes.PUT("/users/:id/legal-hold", middleware.RequirePermission(models.PermLegalHoldManage), controllers.UpdateLegalHold)
+
+	//  a route to import users from a CSV upload
+	adminRoutes.POST("/users/import", middleware.RequirePermission(models.PermUsersCreate), controllers.ImportUsers)
+	//  a route to export the users as a csv or xlsx file
+	adminRoutes.GET("/users/export", middleware.RequirePermission(models.PermUsersRead), controllers.ExportUsers)
+
+	//  routes to delete users, change their role and erase a user for a GDPR request; ?dry_run=true
+	//  answers what they would change without saving
+	adminRoutes.POST("/users/bulk-delete", middleware.RequirePermission(models.PermUsersDelete), controllers.DeleteUsersBulk)
+	adminRoutes.POST("/users/bulk-role", middleware.RequirePermission(models.PermUsersUpdate), controllers.ChangeRoleBulk)
+	adminRoutes.POST("/users/:id/erase", middleware.RequirePermission(models.PermUsersDelete), controllers.EraseUser)
+
+	//  routes to approve or reject the actions of APPROVAL_ACTIONS held for a second admin
+	adminRoutes.GET("/approvals", middleware.RequirePermission(models.PermApprovalsManage), controllers.GetApprovals)
+	adminRoutes.POST("/approvals/:id/approve", middleware.RequirePermission(models.PermApprovalsManage), middleware.DenyImpersonation(), controllers.ApproveAction)
+	adminRoutes.POST("/approvals/:id/reject", middleware.RequirePermission(models.PermApprovalsManage), controllers.RejectAction)
+
+	//  routes to invite people to register with a given role
+	adminRoutes.POST("/invites", middleware.RequirePermission(models.PermInvitesManage), controllers.CreateInvite)
+	adminRoutes.GET("/invites", middleware.RequirePermission(models.PermInvitesManage), controllers.GetAllInvites)
+
+	//  a route to get the login history of all users (paginated, filtered)
+	adminRoutes.GET("/logins", middleware.RequirePermission(models.PermLoginsRead), controllers.GetLogins)
+
+	//  routes to search users, audit logs and active sessions, or one type (search index when SEARCH_URL is set)
+	adminRoutes.GET("/search", middleware.RequirePermission(models.PermSearch), controllers.AdminSearch)
+	adminRoutes.GET("/search/users", middleware.RequirePermission(models.PermSearch), controllers.AdminSearchUsers)
+	adminRoutes.GET("/search/audit_logs", middleware.RequirePermission(models.PermSearch), controllers.AdminSearchAuditLogs)
+
+	//  routes to mint, list and revoke api keys for machine clients
+	adminRoutes.POST("/api-keys", middleware.RequirePermission(models.PermAPIKeysManage), controllers.CreateAPIKey)
+	adminRoutes.GET("/api-keys", middleware.RequirePermission(models.PermAPIKeysManage), controllers.GetAllAPIKeys)
+	adminRoutes.DELETE("/api-keys/:id", middleware.RequirePermission(models.PermAPIKeysManage), controllers.RevokeAPIKey)
+
+	//  routes to register, list and revoke the applications signing users in through this service
+	adminRoutes.POST("/oauth-clients", middleware.RequirePermission(models.PermOAuthClientsManage), controllers.CreateOAuthClient)
+	adminRoutes.GET("/oauth-clients", middleware.RequirePermission(models.PermOAuthClientsManage), controllers.GetAllOAuthClients)
+	adminRoutes.DELETE("/oauth-clients/:id", middleware.RequirePermission(models.PermOAuthClientsManage), controllers.RevokeOAuthClient)
+
+	//  routes to grant features to users and roles, for their gradual rollout; the routes of a
+	//  feature check it with middleware.RequireEntitlement
+	adminRoutes.GET("/entitlements", middleware.RequirePermission(models.PermEntitlementsManage), controllers.GetEntitlements)
+	adminRoutes.POST("/entitlements", middleware.RequirePermission(models.PermEntitlementsManage), controllers.GrantEntitlement)
+	adminRoutes.DELETE("/entitlements/:id", middleware.RequirePermission(models.PermEntitlementsManage), controllers.RevokeEntitlement)
+
+	//  routes to define custom roles and the permissions they grant
+	adminRoutes.GET("/permissions", middleware.RequirePermission(models.PermRolesManage), controllers.GetAllPermissions)
+	adminRoutes.GET("/roles", middleware.RequirePermission(models.PermRolesManage), controllers.GetAllRoles)
+	adminRoutes.POST("/roles", middleware.RequirePermission(models.PermRolesManage), controllers.CreateRole)
+	adminRoutes.PUT("/roles/:name", middleware.RequirePermission(models.PermRolesManage), controllers.UpdateRole)
+	adminRoutes.DELETE("/roles/:name", middleware.RequirePermission(models.PermRolesManage), controllers.DeleteRole)
+
+	//  routes to schedule, preview, follow and cancel messages to every active user or some roles
+	adminRoutes.POST("/broadcasts", middleware.RequirePermission(models.PermBroadcastsSend), controllers.CreateBroadcast)
+	adminRoutes.POST("/broadcasts/preview", middleware.RequirePermission(models.PermBroadcastsSend), controllers.PreviewBroadcast)
+	adminRoutes.GET("/broadcasts", middleware.RequirePermission(models.PermBroadcastsSend), controllers.GetAllBroadcasts)
+	adminRoutes.GET("/broadcasts/:id", middleware.RequirePermission(models.PermBroadcastsSend), controllers.GetBroadcast)
+	adminRoutes.DELETE("/broadcasts/:id", middleware.RequirePermission(models.PermBroadcastsSend), controllers.CancelBroadcast)
+
+	//  a route to get the application metrics
+	adminRoutes.GET("/metrics", middleware.RequirePermission(models.PermMetricsRead), controllers.GetMetrics)
+
+	//  a route to get the admin dashboard widgets
+	adminRoutes.GET("/dashboard", middleware.RequirePermission(models.PermDashboardRead), controllers.GetAdminDashboard)
+
+	//  routes to inspect the background jobs and retry the failed ones, and the schedules
+	adminRoutes.GET("/jobs", middleware.RequirePermission(models.PermJobsManage), controllers.GetJobs)
+	adminRoutes.POST("/jobs/:id/retry", middleware.RequirePermission(models.PermJobsManage), controllers.RetryJob)
+	adminRoutes.GET("/schedules", middleware.RequirePermission(models.PermJobsManage), controllers.GetSchedules)
+
+	//  routes to inject faults in the requests, mysql or redis, outside of release mode
+	if initializers.FaultsEnabled() {
+		adminRoutes.GET("/faults", middleware.RequirePermission(models.PermFaultsManage), controllers.GetFaults)
+		adminRoutes.PUT("/faults/:target", middleware.RequirePermission(models.PermFaultsManage), controllers.SetFault)
+		adminRoutes.DELETE("/faults/:target", middleware.RequirePermission(models.PermFaultsManage), controllers.ClearFault)
+		adminRoutes.DELETE("/faults", middleware.RequirePermission(models.PermFaultsManage), controllers.ClearFaults)
+	}
+
+	//  routes to manage the dead letter queue (the jobs that failed too many times)
+	adminRoutes.GET("/jobs/dead", middleware.RequirePermission(models.PermJobsManage), controllers.GetDeadJobs)
+	adminRoutes.GET("/jobs/dead/:id", middleware.RequirePermission(models.PermJobsManage), controllers.GetDeadJob)
+	adminRoutes.POST("/jobs/dead/retry", middleware.RequirePermission(models.PermJobsManage), controllers.RetryDeadJobs)
+	adminRoutes.POST("/jobs/dead/:id/retry", middleware.RequirePermission(models.PermJobsManage), controllers.RetryJob)
+	adminRoutes.DELETE("/jobs/dead/:id", middleware.RequirePermission(models.PermJobsManage), controllers.DiscardDeadJob)
+
+	// Deprecated routes are marked with the Deprecated middleware, e.g.
+	// r.GET("/old", middleware.Deprecated(middleware.Deprecation{Since: since, Successor: "/api/v2/new"}), handler)
 
 	return r
 }
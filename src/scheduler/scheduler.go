@@ -0,0 +1,124 @@
+// scheduler/scheduler.go
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type job struct {
+	name     string
+	interval time.Duration
+	fn       func() error
+
+	// the state reported by Schedules, guarded by mu
+	nextRun time.Time
+	lastRun *Run
+}
+
+// Run is the outcome of a run of a scheduled job.
+type Run struct {
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration_ns"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Schedule describes a registered job, NextRun is zero until the scheduler is started and
+// LastRun nil until the job ran once on this instance.
+type Schedule struct {
+	Name     string        `json:"name"`
+	Interval time.Duration `json:"interval_ns"`
+	NextRun  time.Time     `json:"next_run"`
+	LastRun  *Run          `json:"last_run"`
+}
+
+var (
+	mu   sync.Mutex
+	jobs []*job
+
+	// stopping the jobs
+	stop    chan struct{}
+	running sync.WaitGroup
+)
+
+// Every registers fn to run every interval once the scheduler is started.
+func Every(name string, interval time.Duration, fn func() error) {
+	mu.Lock()
+	defer mu.Unlock()
+	jobs = append(jobs, &job{name: name, interval: interval, fn: fn})
+}
+
+// Schedules returns the registered jobs, in registration order.
+func Schedules() []Schedule {
+	mu.Lock()
+	defer mu.Unlock()
+
+	schedules := make([]Schedule, len(jobs))
+	for i, j := range jobs {
+		schedules[i] = Schedule{Name: j.name, Interval: j.interval, NextRun: j.nextRun, LastRun: j.lastRun}
+	}
+	return schedules
+}
+
+// Start runs every registered job in its own goroutine.
+func Start() {
+	mu.Lock()
+	defer mu.Unlock()
+	stop = make(chan struct{})
+	for _, j := range jobs {
+		j.nextRun = time.Now().Add(j.interval)
+		running.Add(1)
+		go j.run(stop)
+	}
+}
+
+// Stop stops the jobs and waits for the running ones to finish.
+func Stop(ctx context.Context) error {
+	mu.Lock()
+	if stop != nil {
+		close(stop)
+		stop = nil
+	}
+	mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *job) run(stop chan struct{}) {
+	defer running.Done()
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		run := &Run{StartedAt: time.Now()}
+		if err := j.fn(); err != nil {
+			log.Printf("Scheduled job %s failed: %s", j.name, err)
+			run.Error = err.Error()
+		}
+		run.Duration = time.Since(run.StartedAt)
+
+		mu.Lock()
+		j.lastRun = run
+		j.nextRun = run.StartedAt.Add(j.interval)
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,217 @@
+// search/search.go
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+)
+
+// Indexes of the mirrored documents, prefixed with SEARCH_INDEX_PREFIX
+const (
+	UsersIndex     = "users"
+	AuditLogsIndex = "audit_logs"
+)
+
+// AuditLogJob is the job indexing a new audit log entry, its payload is the entry.
+const AuditLogJob = "search_index_audit_log"
+
+// Document is a document to index with its ID.
+type Document struct {
+	ID     string
+	Source interface{}
+}
+
+// Client talks to the REST API shared by Elasticsearch and OpenSearch.
+type Client struct {
+	baseURL  string
+	prefix   string
+	username string
+	password string
+	client   *http.Client
+}
+
+var (
+	defaultClient     *Client
+	defaultClientOnce sync.Once
+)
+
+// Default returns the client of the cluster at SEARCH_URL (with SEARCH_USERNAME and
+// SEARCH_PASSWORD for basic auth), nil when search is disabled.
+func Default() *Client {
+	defaultClientOnce.Do(func() {
+		baseURL := strings.TrimRight(initializers.GetEnv("SEARCH_URL", ""), "/")
+		if baseURL == "" {
+			return
+		}
+
+		defaultClient = &Client{
+			baseURL:  baseURL,
+			prefix:   initializers.GetEnv("SEARCH_INDEX_PREFIX", "gopher_"),
+			username: initializers.GetEnv("SEARCH_USERNAME", ""),
+			password: initializers.GetEnv("SEARCH_PASSWORD", ""),
+			client:   &http.Client{Timeout: initializers.GetEnvDuration("SEARCH_TIMEOUT", 5*time.Second)},
+		}
+	})
+	return defaultClient
+}
+
+// Enabled reports whether SEARCH_URL is set.
+func Enabled() bool {
+	return Default() != nil
+}
+
+func (c *Client) path(index string, parts ...string) string {
+	path := "/" + url.PathEscape(c.prefix+index)
+	for _, part := range parts {
+		path += "/" + url.PathEscape(part)
+	}
+	return path
+}
+
+// do sends the request and decodes the answer into out when not nil, the statuses in
+// allowed are accepted besides 2xx.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}, allowed ...int) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		for _, status := range allowed {
+			if resp.StatusCode == status {
+				return nil
+			}
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("search answered %s: %s", resp.Status, data)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, payload, out interface{}, allowed ...int) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, method, path, "application/json", bytes.NewReader(data), out, allowed...)
+}
+
+// Index creates or replaces the document in the index.
+func (c *Client) Index(ctx context.Context, index string, doc Document) error {
+	return c.doJSON(ctx, http.MethodPut, c.path(index, "_doc", doc.ID), doc.Source, nil)
+}
+
+// Delete removes the document from the index, missing documents are ignored.
+func (c *Client) Delete(ctx context.Context, index, id string) error {
+	return c.do(ctx, http.MethodDelete, c.path(index, "_doc", id), "", nil, nil, http.StatusNotFound)
+}
+
+// DeleteIndex drops the index with all its documents, a missing index is ignored.
+func (c *Client) DeleteIndex(ctx context.Context, index string) error {
+	return c.do(ctx, http.MethodDelete, c.path(index), "", nil, nil, http.StatusNotFound)
+}
+
+// BulkIndex indexes the documents in one request.
+func (c *Client) BulkIndex(ctx context.Context, index string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, doc := range docs {
+		action := map[string]interface{}{"index": map[string]string{"_id": doc.ID}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(doc.Source); err != nil {
+			return err
+		}
+	}
+
+	var answer struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID    string          `json:"_id"`
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.path(index, "_bulk"), "application/x-ndjson", &body, &answer); err != nil {
+		return err
+	}
+	if answer.Errors {
+		for _, item := range answer.Items {
+			for _, result := range item {
+				if len(result.Error) > 0 {
+					return fmt.Errorf("indexing document %s: %s", result.ID, result.Error)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Search matches the query, as words or word prefixes, against the fields. It returns
+// the IDs of the matching documents by relevance, with the total number of matches.
+func (c *Client) Search(ctx context.Context, index, query string, fields []string, limit, offset int) ([]string, int64, error) {
+	payload := map[string]interface{}{
+		"query": map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  query,
+				"fields": fields,
+				"type":   "bool_prefix",
+			},
+		},
+		"from":             offset,
+		"size":             limit,
+		"track_total_hits": true,
+		"_source":          false,
+	}
+
+	var answer struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	// the index is missing until the first document or reindex
+	if err := c.doJSON(ctx, http.MethodPost, c.path(index, "_search"), payload, &answer, http.StatusNotFound); err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]string, len(answer.Hits.Hits))
+	for i, hit := range answer.Hits.Hits {
+		ids[i] = hit.ID
+	}
+	return ids, answer.Hits.Total.Value, nil
+}
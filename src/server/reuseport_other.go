@@ -0,0 +1,14 @@
+//go:build !unix
+
+// server/reuseport_other.go
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePort fails where SO_REUSEPORT isn't available.
+func reusePort(network, address string, conn syscall.RawConn) error {
+	return errors.New("REUSEPORT is not supported on this platform")
+}
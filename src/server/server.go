@@ -0,0 +1,82 @@
+// server/server.go
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+)
+
+// first file descriptor passed by systemd socket activation
+const listenFdsStart = 3
+
+// Listen returns the listener of the HTTP server:
+//   - the socket passed by systemd (socket activation, LISTEN_FDS/LISTEN_PID), so the
+//     socket stays open while the service restarts and connections wait in its backlog,
+//   - or a socket bound to :PORT (8080 by default), with SO_REUSEPORT when REUSEPORT=true
+//     so the new release can listen next to the old one before the old one drains.
+func Listen() (net.Listener, error) {
+	if fds := os.Getenv("LISTEN_FDS"); fds != "" && os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) {
+		if n, err := strconv.Atoi(fds); err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+		}
+		// the descriptors must not leak to child processes
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDNAMES")
+
+		listener, err := net.FileListener(os.NewFile(listenFdsStart, "systemd-socket"))
+		if err != nil {
+			return nil, fmt.Errorf("inheriting the systemd socket: %w", err)
+		}
+		log.Printf("Listening on inherited socket %s", listener.Addr())
+		return listener, nil
+	}
+
+	addr := ":" + initializers.GetEnv("PORT", "8080")
+	config := net.ListenConfig{}
+	if initializers.GetEnvBool("REUSEPORT", false) {
+		config.Control = reusePort
+	}
+
+	listener, err := config.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Listening on %s", listener.Addr())
+	return listener, nil
+}
+
+var srv *http.Server
+
+// Start listens and serves the handler in the background.
+func Start(handler http.Handler) error {
+	listener, err := Listen()
+	if err != nil {
+		return err
+	}
+
+	srv = &http.Server{Handler: handler}
+	go func() {
+		if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Error running the HTTP server: ", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops accepting connections and waits for the in-flight requests to finish,
+// until ctx is done.
+func Stop(ctx context.Context) error {
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
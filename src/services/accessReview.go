@@ -0,0 +1,156 @@
+// services/accessReview.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/notify"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/scheduler"
+	"github.com/nabazesmail/gopher/src/storage"
+)
+
+// AccessReviewEntry is one user row of the access review report.
+type AccessReviewEntry struct {
+	ID          uint       `json:"id"`
+	FullName    string     `json:"full_name"`
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	Status      string     `json:"status"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	Permissions []string   `json:"permissions"`
+}
+
+// BuildAccessReview lists all users with their role, status, last login and permission grants.
+func BuildAccessReview(ctx context.Context) ([]AccessReviewEntry, error) {
+	users, _, err := repository.GetAllUsers(ctx, repository.UserFilter{}, -1, 0)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving users for access review: %s", err)
+		return nil, err
+	}
+
+	// permissions granted by each role, from the roles table
+	roles, err := repository.GetAllRoles(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving roles for access review: %s", err)
+		return nil, err
+	}
+	rolePermissions := make(map[models.Role][]string, len(roles))
+	for _, role := range roles {
+		rolePermissions[models.Role(role.Name)] = role.PermissionNames()
+	}
+
+	entries := make([]AccessReviewEntry, 0, len(users))
+	for _, user := range users {
+		entries = append(entries, AccessReviewEntry{
+			ID:          user.ID,
+			FullName:    user.FullName,
+			Username:    user.Username,
+			Role:        string(user.Role),
+			Status:      string(user.Status),
+			LastLoginAt: user.LastLoginAt,
+			Permissions: rolePermissions[user.Role],
+		})
+	}
+
+	return entries, nil
+}
+
+// WriteAccessReviewCSV writes the access review entries as CSV.
+func WriteAccessReviewCSV(w io.Writer, entries []AccessReviewEntry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"id", "full_name", "username", "role", "status", "last_login_at", "permissions"}); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		lastLogin := ""
+		if entry.LastLoginAt != nil {
+			lastLogin = entry.LastLoginAt.UTC().Format(time.RFC3339)
+		}
+
+		record := []string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.FullName,
+			entry.Username,
+			entry.Role,
+			entry.Status,
+			lastLogin,
+			strings.Join(entry.Permissions, " "),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// DeliverAccessReview generates the report and emails it to ACCESS_REVIEW_RECIPIENTS,
+// or stores it in the storage backend when no recipients are configured.
+// It returns where the report was delivered.
+func DeliverAccessReview(ctx context.Context) (string, error) {
+	entries, err := BuildAccessReview(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := WriteAccessReviewCSV(&buf, entries); err != nil {
+		middleware.Logger.Printf("Error writing access review report: %s", err)
+		return "", err
+	}
+
+	filename := fmt.Sprintf("access-review-%s.csv", time.Now().UTC().Format("20060102-150405"))
+
+	recipients := initializers.GetEnvList("ACCESS_REVIEW_RECIPIENTS")
+	if len(recipients) > 0 {
+		err := notify.DefaultMailer().Send(&notify.Message{
+			To:      recipients,
+			Subject: "Access review report",
+			Body:    fmt.Sprintf("Attached is the access review report covering %d users.", len(entries)),
+			Attachments: []notify.Attachment{
+				{Filename: filename, ContentType: "text/csv", Data: buf.Bytes()},
+			},
+		})
+		if err != nil {
+			middleware.Logger.Printf("Error emailing access review report: %s", err)
+			return "", err
+		}
+		return "email:" + strings.Join(recipients, ","), nil
+	}
+
+	key := "reports/" + filename
+	if err := storage.Backend().Put(key, buf.Bytes()); err != nil {
+		middleware.Logger.Printf("Error storing access review report: %s", err)
+		return "", err
+	}
+	return "storage:" + key, nil
+}
+
+// ScheduleAccessReview registers the periodic access review when ACCESS_REVIEW_INTERVAL is set (e.g. "720h").
+func ScheduleAccessReview() {
+	interval := initializers.GetEnvDuration("ACCESS_REVIEW_INTERVAL", 0)
+	if interval <= 0 {
+		return
+	}
+
+	scheduler.Every("access-review", interval, func() error {
+		destination, err := DeliverAccessReview(context.Background())
+		if err == nil {
+			middleware.Logger.Printf("Access review report delivered to %s", destination)
+		}
+		return err
+	})
+}
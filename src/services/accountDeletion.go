@@ -0,0 +1,95 @@
+// services/accountDeletion.go
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/scheduler"
+)
+
+// accounts are purged ACCOUNT_DELETION_GRACE_DAYS (30 by default) after their deletion was requested
+func accountDeletionGracePeriod() time.Duration {
+	return time.Duration(initializers.GetEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 30)) * 24 * time.Hour
+}
+
+// DeactivateAccount marks the user's account for deletion and signs out all its sessions. The
+// account stays recoverable until the returned purge time: logging in again reactivates it.
+func DeactivateAccount(ctx context.Context, user *models.User) (time.Time, error) {
+	now := time.Now()
+	if err := repository.UpdateDeletionRequested(ctx, user, &now); err != nil {
+		middleware.Logger.Printf("Error marking account %d for deletion: %s", user.ID, err)
+		return time.Time{}, err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+	user.DeletionRequestedAt = &now
+
+	if err := revokeOtherSessions(ctx, user.ID, 0); err != nil {
+		return time.Time{}, err
+	}
+
+	purgeAt := now.Add(accountDeletionGracePeriod())
+	_ = NotifyUser(ctx, user, "Your account will be deleted",
+		fmt.Sprintf("Your account will be permanently deleted on %s. Log in before then to keep it.", purgeAt.Format(time.RFC1123)),
+		models.PriorityHigh)
+
+	return purgeAt, nil
+}
+
+// reactivateAccount cancels the pending deletion of the account of a user logging in.
+func reactivateAccount(ctx context.Context, user *models.User) error {
+	if user.DeletionRequestedAt == nil {
+		return nil
+	}
+
+	if err := repository.UpdateDeletionRequested(ctx, user, nil); err != nil {
+		middleware.Logger.Printf("Error reactivating account %d: %s", user.ID, err)
+		return err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+	user.DeletionRequestedAt = nil
+
+	middleware.Logger.Printf("Account %d reactivated by a login", user.ID)
+	return nil
+}
+
+// ScheduleAccountPurge registers the purge of the accounts past their grace period, run
+// every ACCOUNT_PURGE_INTERVAL (1h by default).
+func ScheduleAccountPurge() {
+	interval := initializers.GetEnvDuration("ACCOUNT_PURGE_INTERVAL", time.Hour)
+	if interval <= 0 {
+		return
+	}
+
+	scheduler.Every("account-purge", interval, func() error {
+		return PurgeDeactivatedAccounts(context.Background())
+	})
+}
+
+// PurgeDeactivatedAccounts permanently deletes the accounts whose deletion was requested
+// longer ago than the grace period.
+func PurgeDeactivatedAccounts(ctx context.Context) error {
+	users, err := repository.GetUsersPendingDeletion(ctx, time.Now().Add(-accountDeletionGracePeriod()))
+	if err != nil {
+		middleware.Logger.Printf("Error fetching the accounts to purge: %s", err)
+		return err
+	}
+
+	for _, user := range users {
+		if err := repository.PurgeUser(ctx, user); err != nil {
+			middleware.Logger.Printf("Error purging account %d: %s", user.ID, err)
+			continue
+		}
+
+		enqueueUserSync(ctx, OperationDelete, user, "")
+		middleware.Logger.Printf("Account %d purged after its grace period", user.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+// services/actionTokens.go
+package services
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/storage"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+var (
+	// ErrUnknownAction is returned when minting a token for an action that can't be delegated.
+	ErrUnknownAction = errors.New("unknown action")
+	// ErrActionForbidden is returned when the user can't perform the action themselves.
+	ErrActionForbidden = errors.New("not allowed to delegate this action")
+)
+
+// MintActionToken creates a single-use token granting the action on the resource. The user
+// can only delegate what they could do: uploading their own avatar (any avatar with the
+// users:upload_picture permission), downloading stored reports with reports:read. The lifetime defaults to ACTION_TOKEN_TTL (5m) and
+// can't exceed ACTION_TOKEN_MAX_TTL (15m).
+func MintActionToken(ctx context.Context, user *models.User, action, resource string, ttl time.Duration) (*utils.AccessToken, error) {
+	var permission string
+	switch action {
+	case utils.ActionUploadAvatar:
+		if resource != strconv.FormatUint(uint64(user.ID), 10) {
+			permission = models.PermUsersUploadPicture
+		}
+	case utils.ActionDownloadReport:
+		permission = models.PermReportsRead
+	default:
+		return nil, ErrUnknownAction
+	}
+	if permission != "" {
+		allowed, err := middleware.HasPermission(ctx, user.Role, permission)
+		if err != nil {
+			middleware.Logger.Printf("Error checking permission %s: %s", permission, err)
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrActionForbidden
+		}
+	}
+
+	if ttl <= 0 {
+		ttl = initializers.GetEnvDuration("ACTION_TOKEN_TTL", 5*time.Minute)
+	}
+	if maxTTL := initializers.GetEnvDuration("ACTION_TOKEN_MAX_TTL", 15*time.Minute); ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	token, err := utils.GenerateActionToken(user.ID, action, resource, ttl)
+	if err != nil {
+		middleware.Logger.Printf("Error generating action token: %s", err)
+		return nil, errors.New("failed to generate action token")
+	}
+
+	return token, nil
+}
+
+// GetStoredReport returns a report stored by the report deliveries, nil when it doesn't exist.
+func GetStoredReport(ctx context.Context, name string) ([]byte, error) {
+	// only plain file names of the reports directory
+	if name == "" || path.Base(name) != name || name == ".." {
+		return nil, nil
+	}
+
+	data, err := storage.Backend().Get("reports/" + name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error reading stored report: %s", err)
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,331 @@
+// services/adminOperations.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+// ErrLegalHold is returned when erasing a user under legal hold.
+var ErrLegalHold = errors.New("user is under legal hold")
+
+// OperationReport is the outcome of a destructive admin operation, or on a dry run what it
+// would do: the users it changes, those of the request it leaves alone, and its effects beyond
+// the rows of the users.
+type OperationReport struct {
+	DryRun      bool           `json:"dry_run"`
+	Affected    []AffectedUser `json:"affected"`
+	Skipped     []SkippedUser  `json:"skipped"`
+	SideEffects []string       `json:"side_effects"`
+}
+
+// AffectedUser is a user changed by an operation, with its changed fields or its deleted records by table.
+type AffectedUser struct {
+	ID       uint                          `json:"id"`
+	Username string                        `json:"username"`
+	Changes  map[string]models.FieldChange `json:"changes,omitempty"`
+	Deleted  map[string]int64              `json:"deleted,omitempty"`
+}
+
+// SkippedUser is a user of the request left alone by an operation, and why.
+type SkippedUser struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// usersOfRequest fetches the users of the IDs, in the order of the request; the IDs used twice
+// are kept once and the unknown ones are skipped
+func usersOfRequest(ctx context.Context, ids []string, report *OperationReport) ([]*models.User, error) {
+	if len(ids) > initializers.GetEnvInt("BULK_USERS_MAX", 100) {
+		return nil, ErrBulkTooLarge
+	}
+
+	found, err := repository.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching users by IDs: %s", err)
+		return nil, err
+	}
+	byID := make(map[string]*models.User, len(found))
+	for _, user := range found {
+		byID[strconv.FormatUint(uint64(user.ID), 10)] = user
+	}
+
+	var users []*models.User
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		user, ok := byID[id]
+		if !ok {
+			report.Skipped = append(report.Skipped, SkippedUser{ID: id, Reason: "user not found"})
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// the side effect of an operation held for an approval
+const heldSideEffect = "the operation is held until another admin approves it"
+
+// userIDs returns the IDs of the users
+func userIDs(users []*models.User) []string {
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = strconv.FormatUint(uint64(user.ID), 10)
+	}
+	return ids
+}
+
+// syncSideEffects describes the directory sync of the change
+func syncSideEffects(change string) []string {
+	syncAdaptersMu.RLock()
+	defer syncAdaptersMu.RUnlock()
+
+	names := make([]string, 0, len(syncAdapters))
+	for name := range syncAdapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	effects := make([]string, len(names))
+	for i, name := range names {
+		effects[i] = "the " + change + " is synced to " + name
+	}
+	return effects
+}
+
+// DeleteUsersBulk soft deletes the users of the IDs in one statement, the actor can't delete
+// itself. On a dry run nothing is saved, the report lists what would be deleted. With bulk_delete
+// in APPROVAL_ACTIONS, or delete_admin and an admin among the users, the deletion is held for the
+// approval of another admin (ApprovalRequiredError).
+func DeleteUsersBulk(ctx context.Context, actor *models.User, ids []string, dryRun bool) (*OperationReport, error) {
+	report := &OperationReport{DryRun: dryRun, Affected: []AffectedUser{}, Skipped: []SkippedUser{}}
+	users, err := usersOfRequest(ctx, ids, report)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var deleted []*models.User
+	for _, user := range users {
+		if user.ID == actor.ID {
+			report.Skipped = append(report.Skipped, SkippedUser{ID: strconv.FormatUint(uint64(user.ID), 10), Reason: "can't delete yourself"})
+			continue
+		}
+		deleted = append(deleted, user)
+		report.Affected = append(report.Affected, AffectedUser{
+			ID:       user.ID,
+			Username: user.Username,
+			Changes:  map[string]models.FieldChange{"deleted_at": {From: nil, To: now}},
+		})
+	}
+
+	report.SideEffects = []string{}
+	if len(deleted) == 0 {
+		return report, nil
+	}
+	report.SideEffects = append([]string{
+		"the users can be restored until purged",
+		"the cached users and public profiles are dropped",
+	}, syncSideEffects("deletion")...)
+
+	action := ""
+	if approvalRequired(ctx, models.ApprovalBulkDelete) {
+		action = models.ApprovalBulkDelete
+	} else if approvalRequired(ctx, models.ApprovalDeleteAdmin) {
+		for _, user := range deleted {
+			if user.Role == models.Admin {
+				action = models.ApprovalDeleteAdmin
+			}
+		}
+	}
+	if dryRun {
+		if action != "" {
+			report.SideEffects = append(report.SideEffects, heldSideEffect)
+		}
+		return report, nil
+	}
+	if action != "" {
+		return nil, holdForApproval(ctx, action, fmt.Sprintf("delete %d users", len(deleted)), approvalPayload{UserIDs: userIDs(deleted)})
+	}
+
+	if err := repository.DeleteUsers(ctx, deleted); err != nil {
+		middleware.Logger.Printf("Error deleting %d users: %s", len(deleted), err)
+		return nil, err
+	}
+	for _, user := range deleted {
+		invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+		invalidatePublicProfile(ctx, user.ID)
+		enqueueUserSync(ctx, OperationDelete, user, "")
+	}
+
+	return report, nil
+}
+
+// ChangeRoleBulk gives the role to the users of the IDs in one statement, the actor can't change
+// its own role unless approved by another admin. The users rejected by the validation hooks are
+// skipped. On a dry run nothing is saved, the report lists the users whose role would change.
+// A role granting permissions the actor lacks is refused (ErrRoleEscalation). With role_escalation in APPROVAL_ACTIONS, a role granting a user permissions it lacks holds the
+// change for the approval of another admin (ApprovalRequiredError).
+func ChangeRoleBulk(ctx context.Context, actor *models.User, ids []string, role models.Role, dryRun bool) (*OperationReport, error) {
+	if err := checkRoleGrant(ctx, actor, role); err != nil {
+		return nil, err
+	}
+
+	report := &OperationReport{DryRun: dryRun, Affected: []AffectedUser{}, Skipped: []SkippedUser{}}
+	users, err := usersOfRequest(ctx, ids, report)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []*models.User
+	for _, user := range users {
+		id := strconv.FormatUint(uint64(user.ID), 10)
+		switch {
+		case user.ID == actor.ID && ctx.Value(approvedKey{}) == nil:
+			report.Skipped = append(report.Skipped, SkippedUser{ID: id, Reason: "can't change your own role"})
+			continue
+		case user.Role == role:
+			report.Skipped = append(report.Skipped, SkippedUser{ID: id, Reason: "user already has the role"})
+			continue
+		}
+
+		updated := *user
+		updated.Role = role
+		if err := runUserValidators(OperationUpdate, &updated); err != nil {
+			report.Skipped = append(report.Skipped, SkippedUser{ID: id, Reason: err.Error()})
+			continue
+		}
+
+		changed = append(changed, user)
+		report.Affected = append(report.Affected, AffectedUser{
+			ID:       user.ID,
+			Username: user.Username,
+			Changes:  map[string]models.FieldChange{"role": {From: user.Role, To: role}},
+		})
+	}
+
+	report.SideEffects = []string{}
+	if len(changed) == 0 {
+		return report, nil
+	}
+	report.SideEffects = append([]string{
+		"the permissions of the new role apply to the next requests of the users",
+		"the cached users are dropped",
+		"the change of each user is recorded in the audit log",
+	}, syncSideEffects("role change")...)
+
+	held := false
+	if approvalRequired(ctx, models.ApprovalRoleEscalation) {
+		escalated, err := escalatedUsers(ctx, changed, role)
+		if err != nil {
+			return nil, err
+		}
+		held = len(escalated) > 0
+	}
+	if dryRun {
+		if held {
+			report.SideEffects = append(report.SideEffects, heldSideEffect)
+		}
+		return report, nil
+	}
+	if held {
+		return nil, holdForApproval(ctx, models.ApprovalRoleEscalation, fmt.Sprintf("give the role %s to %d users", role, len(changed)),
+			approvalPayload{UserIDs: userIDs(changed), Role: role})
+	}
+
+	if err := repository.UpdateUsersRole(ctx, changed, role); err != nil {
+		middleware.Logger.Printf("Error changing the role of %d users: %s", len(changed), err)
+		return nil, err
+	}
+	client := middleware.ClientFromContext(ctx)
+	for i, user := range changed {
+		id := strconv.FormatUint(uint64(user.ID), 10)
+		user.Role = role
+		invalidateUserCache(ctx, id)
+		enqueueUserSync(ctx, OperationUpdate, user, user.Username)
+
+		// one entry per user, the history of each user is rebuilt from its own entries
+		diff, err := json.Marshal(report.Affected[i].Changes)
+		if err != nil {
+			middleware.Logger.Printf("Error encoding the audit diff: %s", err)
+			continue
+		}
+		entry := &models.AuditLog{
+			Action:   "bulk_role_change",
+			ActorID:  &actor.ID,
+			TargetID: id,
+			IP:       client.IP,
+			Diff:     string(diff),
+		}
+		if err := repository.CreateAuditLog(ctx, entry); err != nil {
+			middleware.Logger.Printf("Error writing audit log: %s", err)
+		}
+	}
+
+	return report, nil
+}
+
+// EraseUser permanently deletes the user and its records now, for a GDPR erasure request,
+// without waiting for the grace period of a requested deletion; the deleted users are erased
+// too. A user under legal hold is kept (ErrLegalHold). On a dry run nothing is deleted, the
+// report counts the records that would be. Nil is returned when the user is not found.
+func EraseUser(ctx context.Context, userID string, dryRun bool) (*OperationReport, error) {
+	user, err := repository.GetUserByIDWithDeleted(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil // User not found
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user by ID: %s", err)
+		return nil, err
+	}
+
+	if user.LegalHold {
+		return nil, ErrLegalHold
+	}
+
+	counts, err := repository.CountUserRecords(ctx, user)
+	if err != nil {
+		middleware.Logger.Printf("Error counting the records of user %d: %s", user.ID, err)
+		return nil, err
+	}
+
+	report := &OperationReport{
+		DryRun:   dryRun,
+		Affected: []AffectedUser{{ID: user.ID, Username: user.Username, Deleted: counts}},
+		Skipped:  []SkippedUser{},
+		SideEffects: append([]string{
+			"the user can't be restored",
+			"the cached user and public profile are dropped",
+			"the audit logs of the user are kept",
+		}, syncSideEffects("deletion")...),
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	if err := repository.PurgeUser(ctx, user); err != nil {
+		middleware.Logger.Printf("Error erasing user %d: %s", user.ID, err)
+		return nil, err
+	}
+	invalidateUserCache(ctx, userID)
+	invalidatePublicProfile(ctx, user.ID)
+	enqueueUserSync(ctx, OperationDelete, user, "")
+	middleware.Logger.Printf("User %d erased", user.ID)
+
+	return report, nil
+}
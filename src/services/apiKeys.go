@@ -0,0 +1,121 @@
+// services/apiKeys.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// prefix of every api key, makes leaked keys easy to recognize
+const apiKeyPrefix = "gk_"
+
+// ErrInvalidAPIKeyRequest wraps the validation errors of CreateAPIKey.
+var ErrInvalidAPIKeyRequest = errors.New("invalid api key request")
+
+// CreateAPIKey mints a key acting as the given user. The plain key is only returned here,
+// only its hash is stored.
+func CreateAPIKey(ctx context.Context, name string, userID uint, scopes []string, createdBy *models.User) (*models.APIKey, string, error) {
+	if name == "" || userID == 0 || len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: name, user ID and scopes must be provided", ErrInvalidAPIKeyRequest)
+	}
+
+	if err := validateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(userID), 10)); err != nil {
+		return nil, "", fmt.Errorf("%w: user not found", ErrInvalidAPIKeyRequest)
+	}
+
+	key := &models.APIKey{
+		Name:        name,
+		Scopes:      strings.Join(scopes, " "),
+		UserID:      userID,
+		CreatedByID: createdBy.ID,
+	}
+
+	plainKey, err := saveAPIKey(ctx, key, apiKeyPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, plainKey, nil
+}
+
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if scope != models.ScopeRead && scope != models.ScopeWrite {
+			return fmt.Errorf("%w: allowed scopes are read and write", ErrInvalidAPIKeyRequest)
+		}
+	}
+	return nil
+}
+
+// saveAPIKey generates the secret of the key, saves the key and returns the plain secret.
+func saveAPIKey(ctx context.Context, key *models.APIKey, prefix string) (string, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		middleware.Logger.Printf("Error generating api key: %s", err)
+		return "", err
+	}
+	plainKey := prefix + token
+
+	key.Prefix = plainKey[:len(prefix)+8]
+	key.KeyHash = utils.HashToken(plainKey)
+
+	if err := repository.CreateAPIKey(ctx, key); err != nil {
+		middleware.Logger.Printf("Error saving api key: %s", err)
+		return "", err
+	}
+
+	return plainKey, nil
+}
+
+// GetAllAPIKeys lists the api keys, without their secret part.
+func GetAllAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	keys, err := repository.GetAllAPIKeys(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving api keys: %s", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the key, it is rejected from then on.
+func RevokeAPIKey(ctx context.Context, keyID string) (*models.APIKey, error) {
+	key, err := repository.GetAPIKeyByID(ctx, keyID)
+	if err != nil {
+		return nil, nil // Key not found
+	}
+
+	if err := revokeAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func revokeAPIKey(ctx context.Context, key *models.APIKey) error {
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if err := repository.RevokeAPIKey(ctx, key, now); err != nil {
+		middleware.Logger.Printf("Error revoking api key: %s", err)
+		return err
+	}
+	key.RevokedAt = &now
+
+	return nil
+}
@@ -0,0 +1,232 @@
+// services/approvals.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrApprovalNotPending is returned when deciding an approval already decided or expired.
+	ErrApprovalNotPending = errors.New("approval is no longer pending")
+	// ErrSelfApproval is returned when the admin who requested an action approves it.
+	ErrSelfApproval = errors.New("an action must be approved by another admin")
+	// ErrInvalidApprovalStatus is returned when listing the approvals of an unknown status.
+	ErrInvalidApprovalStatus = errors.New("unknown approval status")
+)
+
+// ApprovalRequiredError is returned instead of running an action listed in APPROVAL_ACTIONS, the
+// approval holding it waits for another admin.
+type ApprovalRequiredError struct {
+	Approval *models.Approval
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return fmt.Sprintf("%s awaits the approval of another admin (approval %d)", e.Approval.Action, e.Approval.ID)
+}
+
+// the arguments of the held actions
+type approvalPayload struct {
+	UserIDs []string    `json:"user_ids"`
+	Role    models.Role `json:"role,omitempty"`
+}
+
+type approvedKey struct{}
+
+// approvalRequired reports whether the action must be held for an approval: it is listed in
+// APPROVAL_ACTIONS and requested by a user, not run by an approval
+func approvalRequired(ctx context.Context, action string) bool {
+	if ctx.Value(approvedKey{}) != nil || middleware.UserFromContext(ctx) == nil {
+		return false
+	}
+	for _, name := range initializers.GetEnvList("APPROVAL_ACTIONS") {
+		if name == action {
+			return true
+		}
+	}
+	return false
+}
+
+// holdForApproval records the action requested by the user of the request, to run once
+// approved within APPROVAL_TTL (24h by default), and returns the ApprovalRequiredError
+func holdForApproval(ctx context.Context, action, summary string, payload approvalPayload) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	approval := &models.Approval{
+		Action:        action,
+		Summary:       summary,
+		Payload:       string(encoded),
+		Status:        models.ApprovalPending,
+		RequestedByID: middleware.UserFromContext(ctx).ID,
+		ExpiresAt:     time.Now().Add(initializers.GetEnvDuration("APPROVAL_TTL", 24*time.Hour)),
+	}
+	if err := repository.CreateApproval(ctx, approval); err != nil {
+		middleware.Logger.Printf("Error saving the approval of %s: %s", action, err)
+		return err
+	}
+	middleware.Logger.Printf("User %d requested %s, held for approval %d", approval.RequestedByID, action, approval.ID)
+
+	return &ApprovalRequiredError{Approval: approval}
+}
+
+// escalatedUsers returns the users the role would give permissions they lack
+func escalatedUsers(ctx context.Context, users []*models.User, role models.Role) ([]string, error) {
+	var ids []string
+	for _, user := range users {
+		escalation, err := middleware.IsEscalation(ctx, user.Role, role)
+		if err != nil {
+			return nil, err
+		}
+		if escalation {
+			ids = append(ids, strconv.FormatUint(uint64(user.ID), 10))
+		}
+	}
+	return ids, nil
+}
+
+// GetApprovals returns a page of the approvals, of the status when set.
+func GetApprovals(ctx context.Context, status string, page, perPage int) ([]*models.Approval, int64, error) {
+	switch status {
+	case "", models.ApprovalPending, models.ApprovalApproved, models.ApprovalFailed, models.ApprovalRejected, models.ApprovalExpired:
+	default:
+		return nil, 0, ErrInvalidApprovalStatus
+	}
+
+	approvals, total, err := repository.GetApprovals(ctx, status, perPage, (page-1)*perPage)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching approvals: %s", err)
+		return nil, 0, err
+	}
+	for _, approval := range approvals {
+		if approval.Status == models.ApprovalPending && !approval.Pending() {
+			approval.Status = models.ApprovalExpired
+		}
+	}
+	return approvals, total, nil
+}
+
+// pendingApproval fetches the approval to decide, nil when not found
+func pendingApproval(ctx context.Context, id string) (*models.Approval, error) {
+	approval, err := repository.GetApprovalByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil // Approval not found
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching approval %s: %s", id, err)
+		return nil, err
+	}
+
+	if approval.Status == models.ApprovalPending && !approval.Pending() {
+		if err := repository.UpdateApprovalResult(ctx, approval, models.ApprovalExpired, ""); err != nil {
+			middleware.Logger.Printf("Error expiring approval %d: %s", approval.ID, err)
+		}
+	}
+	if !approval.Pending() {
+		return nil, ErrApprovalNotPending
+	}
+	return approval, nil
+}
+
+// ApproveAction approves the pending action and runs it on behalf of the admin who requested
+// it; the approver must be another admin. A failed execution leaves the approval failed, with
+// the error as its result. Nil is returned when the approval is not found.
+func ApproveAction(ctx context.Context, approver *models.User, id string) (*models.Approval, error) {
+	approval, err := pendingApproval(ctx, id)
+	if approval == nil || err != nil {
+		return nil, err
+	}
+	if approval.RequestedByID == approver.ID {
+		return nil, ErrSelfApproval
+	}
+
+	decided, err := repository.DecideApproval(ctx, approval, models.ApprovalApproved, approver.ID)
+	if err != nil {
+		middleware.Logger.Printf("Error approving approval %d: %s", approval.ID, err)
+		return nil, err
+	}
+	if !decided {
+		return nil, ErrApprovalNotPending // decided by a concurrent request
+	}
+
+	status, result := models.ApprovalApproved, ""
+	if err := executeApproval(ctx, approval); err != nil {
+		middleware.Logger.Printf("Error executing approval %d: %s", approval.ID, err)
+		status, result = models.ApprovalFailed, err.Error()
+	}
+	if err := repository.UpdateApprovalResult(ctx, approval, status, result); err != nil {
+		middleware.Logger.Printf("Error saving the result of approval %d: %s", approval.ID, err)
+	}
+
+	entry := &models.AuditLog{
+		Action:     "approval:" + approval.Action,
+		ActorID:    &approval.RequestedByID,
+		TargetID:   strconv.FormatUint(uint64(approval.ID), 10),
+		StatusCode: 200,
+		IP:         middleware.ClientFromContext(ctx).IP,
+		Details:    fmt.Sprintf("%s, approved by user %d: %s", approval.Summary, approver.ID, status),
+	}
+	if status == models.ApprovalFailed {
+		entry.StatusCode = 500
+	}
+	if err := repository.CreateAuditLog(ctx, entry); err != nil {
+		middleware.Logger.Printf("Error writing audit log: %s", err)
+	}
+
+	return approval, nil
+}
+
+// RejectAction rejects the pending action, the admin who requested it can withdraw it this way.
+// Nil is returned when the approval is not found.
+func RejectAction(ctx context.Context, decider *models.User, id string) (*models.Approval, error) {
+	approval, err := pendingApproval(ctx, id)
+	if approval == nil || err != nil {
+		return nil, err
+	}
+
+	decided, err := repository.DecideApproval(ctx, approval, models.ApprovalRejected, decider.ID)
+	if err != nil {
+		middleware.Logger.Printf("Error rejecting approval %d: %s", approval.ID, err)
+		return nil, err
+	}
+	if !decided {
+		return nil, ErrApprovalNotPending
+	}
+	return approval, nil
+}
+
+// executeApproval runs the approved action as the admin who requested it
+func executeApproval(ctx context.Context, approval *models.Approval) error {
+	var payload approvalPayload
+	if err := json.Unmarshal([]byte(approval.Payload), &payload); err != nil {
+		return err
+	}
+
+	requester, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(approval.RequestedByID), 10))
+	if err != nil {
+		return fmt.Errorf("the admin who requested the action is gone: %w", err)
+	}
+
+	ctx = context.WithValue(ctx, approvedKey{}, approval.ID)
+	switch approval.Action {
+	case models.ApprovalDeleteAdmin, models.ApprovalBulkDelete:
+		_, err = DeleteUsersBulk(ctx, requester, payload.UserIDs, false)
+	case models.ApprovalRoleEscalation:
+		_, err = ChangeRoleBulk(ctx, requester, payload.UserIDs, payload.Role, false)
+	default:
+		err = fmt.Errorf("unknown action %q", approval.Action)
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+// services/archive.go
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/storage"
+)
+
+// ArchiveFile is a gzipped JSON lines file of archived rows, listed in the manifest of its category.
+type ArchiveFile struct {
+	Key        string    `json:"key"`
+	Rows       int       `json:"rows"`
+	FirstID    uint      `json:"first_id"`
+	LastID     uint      `json:"last_id"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// ArchiveManifest lists the archive files of a category, <prefix>/<category>/manifest.json.
+type ArchiveManifest struct {
+	Category string        `json:"category"`
+	Files    []ArchiveFile `json:"files"`
+}
+
+// the rows past their retention window are archived before being purged when
+// RETENTION_ARCHIVE_ENABLED is set, under RETENTION_ARCHIVE_PREFIX ("archive" by default)
+func archiveEnabled() bool {
+	return initializers.GetEnvBool("RETENTION_ARCHIVE_ENABLED", false)
+}
+
+func archivePrefix(category string) string {
+	return initializers.GetEnv("RETENTION_ARCHIVE_PREFIX", "archive") + "/" + category + "/"
+}
+
+func loadArchiveManifest(category string) (*ArchiveManifest, error) {
+	data, err := storage.Backend().Get(archivePrefix(category) + "manifest.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return &ArchiveManifest{Category: category}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ArchiveManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func saveArchiveManifest(manifest *ArchiveManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.Backend().Put(archivePrefix(manifest.Category)+"manifest.json", data)
+}
+
+// archiveRows writes the rows with the IDs (in ID order) to a new archive file and lists it in the
+// manifest. Rows archived twice, when the purge failed after the archive, are restored once.
+func archiveRows(ctx context.Context, policy retentionPolicy, ids []uint) error {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	rows, err := policy.load(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(writer)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	file := ArchiveFile{
+		Key:        fmt.Sprintf("%s%d-%d.jsonl.gz", archivePrefix(policy.category), ids[0], ids[len(ids)-1]),
+		Rows:       len(rows),
+		FirstID:    ids[0],
+		LastID:     ids[len(ids)-1],
+		ArchivedAt: time.Now(),
+	}
+	if err := storage.Backend().Put(file.Key, buf.Bytes()); err != nil {
+		return err
+	}
+
+	manifest, err := loadArchiveManifest(policy.category)
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, file)
+	return saveArchiveManifest(manifest)
+}
+
+// RestoreArchive inserts the archived rows of the category back into the database, from the
+// file key or every file of the manifest when empty. It returns the number of restored rows,
+// the rows still in the database are skipped.
+func RestoreArchive(ctx context.Context, category, key string) (int64, error) {
+	var policy *retentionPolicy
+	for i := range retentionPolicies {
+		if retentionPolicies[i].category == category && retentionPolicies[i].restore != nil {
+			policy = &retentionPolicies[i]
+		}
+	}
+	if policy == nil {
+		return 0, fmt.Errorf("no archive for %q, the archived categories are audit_logs and login_events", category)
+	}
+
+	manifest, err := loadArchiveManifest(category)
+	if err != nil {
+		return 0, err
+	}
+
+	var restored int64
+	for _, file := range manifest.Files {
+		if key != "" && file.Key != key {
+			continue
+		}
+
+		data, err := storage.Backend().Get(file.Key)
+		if err != nil {
+			return restored, err
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return restored, fmt.Errorf("reading %s: %w", file.Key, err)
+		}
+
+		count, err := policy.restore(ctx, json.NewDecoder(reader))
+		reader.Close()
+		if err != nil {
+			return restored, fmt.Errorf("restoring %s: %w", file.Key, err)
+		}
+		restored += count
+		middleware.Logger.Printf("Restored %d %s from %s", count, category, file.Key)
+	}
+
+	return restored, nil
+}
@@ -0,0 +1,213 @@
+// services/authBackends.go
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCredentials is returned by the auth backends when they reject the credentials.
+var ErrInvalidCredentials = apierrors.New(apierrors.Unauthenticated, "invalid credentials")
+
+// AuthBackend verifies a username and password and returns the local user they belong to.
+type AuthBackend interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// authBackends returns the backends of AUTH_BACKENDS in order ("local" by default, e.g.
+// "ldap,local" tries the directory first and falls back to the local passwords).
+func authBackends() []AuthBackend {
+	names := initializers.GetEnvList("AUTH_BACKENDS")
+	if len(names) == 0 {
+		names = []string{"local"}
+	}
+
+	var backends []AuthBackend
+	for _, name := range names {
+		switch name {
+		case "local":
+			backends = append(backends, localAuthBackend{})
+		case "ldap":
+			backends = append(backends, &LDAPAuthBackend{
+				URL:          initializers.GetEnv("LDAP_URL", ""),
+				BindDN:       initializers.GetEnv("LDAP_BIND_DN", ""),
+				BindPassword: initializers.GetEnv("LDAP_BIND_PASSWORD", ""),
+				BaseDN:       initializers.GetEnv("LDAP_BASE_DN", ""),
+				UserFilter:   initializers.GetEnv("LDAP_USER_FILTER", "(uid=%s)"),
+				NameAttr:     initializers.GetEnv("LDAP_FULLNAME_ATTRIBUTE", "cn"),
+			})
+		default:
+			middleware.Logger.Printf("Unknown auth backend %s ignored", name)
+		}
+	}
+	return backends
+}
+
+// authenticateCredentials tries the backends in order, the first one accepting the credentials wins.
+// Backend errors other than rejected credentials stop the login.
+func authenticateCredentials(ctx context.Context, username, password string) (*models.User, error) {
+	for _, backend := range authBackends() {
+		user, err := backend.Authenticate(ctx, username, password)
+		if errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("Credentials of user %s rejected by the %s backend", username, backend.Name())
+			continue
+		}
+		if err != nil {
+			middleware.Logger.Printf("Error authenticating user %s with the %s backend: %s", username, backend.Name(), err)
+			return nil, err
+		}
+		return user, nil
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// localAuthBackend checks the bcrypt password hashes of the users table.
+type localAuthBackend struct{}
+
+func (localAuthBackend) Name() string { return "local" }
+
+func (localAuthBackend) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	// Find the user by username in the database
+	user, err := repository.GetUserByUsername(ctx, username)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user == nil) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare the provided password with the hashed password in the database,
+	// identical concurrent attempts share the comparison
+	if err := verifyPassword(ctx, user.Password, password); errors.Is(err, ErrPasswordHashingBusy) {
+		return nil, err
+	} else if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// LDAPAuthBackend verifies the credentials with a bind on an LDAP or Active Directory server:
+// the entry of the user is searched with the service account, then bound with the password.
+// A local operator linked to the entry is provisioned on the first successful login. The link
+// is the objectGUID (AD) or entryUUID (OpenLDAP) of the entry, else its DN, never the username
+// typed: AD matches it case-insensitively and the entry may be renamed.
+type LDAPAuthBackend struct {
+	URL          string
+	BindDN       string // service account used to search the users
+	BindPassword string
+	BaseDN       string
+	UserFilter   string // %s is replaced by the escaped username, e.g. (sAMAccountName=%s) for AD
+	NameAttr     string // attribute holding the full name
+}
+
+func (b *LDAPAuthBackend) Name() string { return "ldap" }
+
+func (b *LDAPAuthBackend) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	// an empty password would be an unauthenticated bind, which many servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := ldap.DialURL(b.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(b.BindDN, b.BindPassword); err != nil {
+		return nil, err
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		b.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		strings.ReplaceAll(b.UserFilter, "%s", ldap.EscapeFilter(username)),
+		[]string{b.NameAttr, "objectGUID", "entryUUID"}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	// Only an entry never seen creates a user, a deleted one isn't brought back
+	entryID := ldapEntryID(entry)
+	user, err := repository.GetUserByIdentity(ctx, b.Name(), entryID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user, err = b.relinkLegacyIdentity(ctx, username, entryID)
+	}
+	if errors.Is(err, repository.ErrIdentityUserDeleted) {
+		middleware.Logger.Printf("LDAP login of the deleted user of entry %s refused", entry.DN)
+		return nil, ErrInvalidCredentials
+	}
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// First login: provision a local user linked to the directory entry
+	fullName := entry.GetAttributeValue(b.NameAttr)
+	if fullName == "" {
+		fullName = username
+	}
+	user, err = createOAuthUser(ctx, b.Name(), &oauthProfile{ID: entryID, Login: username, FullName: fullName})
+	if err != nil {
+		return nil, fmt.Errorf("provisioning ldap user: %w", err)
+	}
+
+	return user, nil
+}
+
+// ldapEntryID returns the stable identifier of the entry: its objectGUID, its entryUUID, else
+// its DN lowercased as the directories compare DNs case-insensitively
+func ldapEntryID(entry *ldap.Entry) string {
+	if guid := entry.GetRawAttributeValue("objectGUID"); len(guid) > 0 {
+		return "guid:" + hex.EncodeToString(guid)
+	}
+	if uuid := entry.GetAttributeValue("entryUUID"); uuid != "" {
+		return "uuid:" + strings.ToLower(uuid)
+	}
+	return "dn:" + strings.ToLower(entry.DN)
+}
+
+// relinkLegacyIdentity moves the link made with the username typed, as the former versions
+// did, to the identifier of the entry
+func (b *LDAPAuthBackend) relinkLegacyIdentity(ctx context.Context, username, entryID string) (*models.User, error) {
+	user, err := repository.GetUserByIdentity(ctx, b.Name(), username)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := repository.GetIdentityByUser(ctx, b.Name(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.UpdateIdentityProviderID(ctx, identity, entryID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
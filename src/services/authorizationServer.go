@@ -0,0 +1,289 @@
+// services/authorizationServer.go
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// authorization codes are single-use and short-lived
+const authorizationCodePrefix = "oauth_code:"
+
+// ErrInvalidOAuthClient wraps the validation errors of CreateOAuthClient.
+var ErrInvalidOAuthClient = errors.New("invalid oauth client")
+
+// OAuthError is an error of the authorization server, Code being one of the RFC 6749 error codes.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// AuthorizeRequest holds the parameters of an authorization request.
+type AuthorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest holds the parameters of a token request.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+}
+
+type authorizationCode struct {
+	ClientID      string `json:"clientId"`
+	UserID        uint   `json:"userId"`
+	RedirectURI   string `json:"redirectUri"`
+	CodeChallenge string `json:"codeChallenge"`
+}
+
+// CreateOAuthClient registers an application. Confidential clients get a secret, only
+// returned here, public clients rely on PKCE alone.
+func CreateOAuthClient(ctx context.Context, name string, redirectURIs []string, confidential, trusted bool) (*models.OAuthClient, string, error) {
+	if name == "" || len(redirectURIs) == 0 {
+		return nil, "", fmt.Errorf("%w: name and redirect URIs must be provided", ErrInvalidOAuthClient)
+	}
+	for _, uri := range redirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+			return nil, "", fmt.Errorf("%w: invalid redirect URI %s", ErrInvalidOAuthClient, uri)
+		}
+	}
+
+	clientID, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		middleware.Logger.Printf("Error generating client ID: %s", err)
+		return nil, "", err
+	}
+
+	client := &models.OAuthClient{
+		ClientID:     clientID[:32],
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Trusted:      trusted,
+	}
+
+	var secret string
+	if confidential {
+		if secret, err = utils.GenerateOpaqueToken(); err != nil {
+			middleware.Logger.Printf("Error generating client secret: %s", err)
+			return nil, "", err
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	if err := repository.CreateOAuthClient(ctx, client); err != nil {
+		middleware.Logger.Printf("Error saving oauth client: %s", err)
+		return nil, "", err
+	}
+
+	return client, secret, nil
+}
+
+// GetAllOAuthClients lists the registered applications, without their secret.
+func GetAllOAuthClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	clients, err := repository.GetAllOAuthClients(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving oauth clients: %s", err)
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// RevokeOAuthClient stops the application from signing users in and revokes the sessions
+// opened for it, so none of its tokens stays usable.
+func RevokeOAuthClient(ctx context.Context, id string) (*models.OAuthClient, error) {
+	client, err := repository.GetOAuthClientByID(ctx, id)
+	if err != nil {
+		return nil, nil // Client not found
+	}
+
+	if client.RevokedAt == nil {
+		now := time.Now()
+		if err := repository.RevokeOAuthClient(ctx, client, now); err != nil {
+			middleware.Logger.Printf("Error revoking oauth client: %s", err)
+			return nil, err
+		}
+		client.RevokedAt = &now
+	}
+
+	sessions, err := repository.GetActiveSessionsByClient(ctx, client.ClientID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching the sessions of oauth client %s: %s", client.ClientID, err)
+		return nil, err
+	}
+	for _, session := range sessions {
+		if err := revokeSession(ctx, session); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// ValidateAuthorizeRequest checks the client and the redirect URI. Until it succeeds errors
+// must not be sent to the redirect URI, which can't be trusted yet.
+func ValidateAuthorizeRequest(ctx context.Context, req *AuthorizeRequest) (*models.OAuthClient, error) {
+	client, err := repository.GetOAuthClientByClientID(ctx, req.ClientID)
+	if err != nil || client.RevokedAt != nil {
+		return nil, &OAuthError{Code: "invalid_client", Description: "unknown client"}
+	}
+
+	if !client.AllowsRedirect(req.RedirectURI) {
+		return nil, &OAuthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}
+	}
+
+	return client, nil
+}
+
+// Authorize issues an authorization code for the signed in user and returns the redirect
+// URI of the client carrying it, or carrying the error when the request is rejected.
+func Authorize(ctx context.Context, user *models.User, client *models.OAuthClient, req *AuthorizeRequest) string {
+	redirect := func(params url.Values) string {
+		if req.State != "" {
+			params.Set("state", req.State)
+		}
+		separator := "?"
+		if strings.Contains(req.RedirectURI, "?") {
+			separator = "&"
+		}
+		return req.RedirectURI + separator + params.Encode()
+	}
+	reject := func(code, description string) string {
+		return redirect(url.Values{"error": {code}, "error_description": {description}})
+	}
+
+	switch {
+	case req.ResponseType != "code":
+		return reject("unsupported_response_type", "only the code response type is supported")
+	case req.CodeChallenge == "" || req.CodeChallengeMethod != "S256":
+		return reject("invalid_request", "PKCE with the S256 code challenge method is required")
+	case !client.Trusted:
+		// there is no consent screen, only trusted clients can sign users in
+		return reject("consent_required", "the client is not trusted")
+	case user.Status != models.Active:
+		return reject("access_denied", "the user is not active")
+	}
+
+	code, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		middleware.Logger.Printf("Error generating authorization code: %s", err)
+		return reject("server_error", "failed to generate the authorization code")
+	}
+
+	data, _ := json.Marshal(&authorizationCode{
+		ClientID:      client.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+	})
+	ttl := initializers.GetEnvDuration("OAUTH_CODE_TTL", time.Minute)
+	if err := initializers.RedisClient.Set(ctx, authorizationCodePrefix+utils.HashToken(code), data, ttl).Err(); err != nil {
+		middleware.Logger.Printf("Error storing authorization code: %s", err)
+		return reject("server_error", "failed to store the authorization code")
+	}
+
+	return redirect(url.Values{"code": {code}})
+}
+
+// ExchangeToken implements the token endpoint for the authorization_code and refresh_token
+// grants. The tokens are the usual access and refresh tokens, with the role claims.
+func ExchangeToken(ctx context.Context, req *TokenRequest) (*AuthTokens, error) {
+	client, err := authenticateOAuthClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		return exchangeAuthorizationCode(ctx, client, req)
+	case "refresh_token":
+		tokens, err := refreshSession(ctx, req.RefreshToken, client.ClientID)
+		if err != nil {
+			return nil, &OAuthError{Code: "invalid_grant", Description: "invalid refresh token"}
+		}
+		return tokens, nil
+	}
+
+	return nil, &OAuthError{Code: "unsupported_grant_type", Description: "supported grants are authorization_code and refresh_token"}
+}
+
+func authenticateOAuthClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	client, err := repository.GetOAuthClientByClientID(ctx, clientID)
+	if err != nil || client.RevokedAt != nil {
+		return nil, &OAuthError{Code: "invalid_client", Description: "unknown client"}
+	}
+
+	if client.Confidential() && subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, &OAuthError{Code: "invalid_client", Description: "invalid client credentials"}
+	}
+
+	return client, nil
+}
+
+func exchangeAuthorizationCode(ctx context.Context, client *models.OAuthClient, req *TokenRequest) (*AuthTokens, error) {
+	invalidGrant := &OAuthError{Code: "invalid_grant", Description: "invalid authorization code"}
+
+	// GETDEL makes the code single-use
+	data, err := initializers.RedisClient.GetDel(ctx, authorizationCodePrefix+utils.HashToken(req.Code)).Result()
+	if err == redis.Nil {
+		return nil, invalidGrant
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching authorization code: %s", err)
+		return nil, err
+	}
+
+	var code authorizationCode
+	if err := json.Unmarshal([]byte(data), &code); err != nil {
+		return nil, invalidGrant
+	}
+
+	if code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return nil, invalidGrant
+	}
+
+	// PKCE: the verifier must hash to the challenge sent with the authorization request
+	sum := sha256.Sum256([]byte(req.CodeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "code_verifier does not match the code challenge"}
+	}
+
+	user, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(code.UserID), 10))
+	if err != nil {
+		return nil, invalidGrant
+	}
+
+	return openSession(ctx, user, sessionOptions{ClientID: client.ClientID})
+}
@@ -0,0 +1,97 @@
+// services/bcryptPool.go
+package services
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordHashingBusy is returned when the bcrypt queue is full, the request should be retried later.
+var ErrPasswordHashingBusy = apierrors.New(apierrors.ServerBusy, "too many password operations in progress")
+
+// bcryptTask is a bcrypt operation waiting for a worker.
+type bcryptTask struct {
+	ctx      context.Context
+	run      func() error
+	queuedAt time.Time
+	done     chan error
+}
+
+var (
+	bcryptOnce  sync.Once
+	bcryptTasks chan *bcryptTask
+)
+
+// startBcryptPool starts BCRYPT_WORKERS workers (the number of CPUs by default) behind a
+// queue of BCRYPT_QUEUE_SIZE operations (100 by default), operations beyond are rejected.
+func startBcryptPool() {
+	workers := initializers.GetEnvInt("BCRYPT_WORKERS", runtime.NumCPU())
+	if workers <= 0 {
+		workers = 1
+	}
+	bcryptTasks = make(chan *bcryptTask, initializers.GetEnvInt("BCRYPT_QUEUE_SIZE", 100))
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for task := range bcryptTasks {
+				metrics.Add("bcrypt_queue_wait_ms_total", time.Since(task.queuedAt).Milliseconds())
+				// the caller gave up while the task was queued
+				if err := task.ctx.Err(); err != nil {
+					task.done <- err
+					continue
+				}
+				metrics.Inc("bcrypt_operations_total")
+				task.done <- task.run()
+			}
+		}()
+	}
+}
+
+// runBcrypt funnels a bcrypt operation through the worker pool, bounding the CPU spent
+// hashing when many logins come in at once.
+func runBcrypt(ctx context.Context, run func() error) error {
+	bcryptOnce.Do(startBcryptPool)
+
+	task := &bcryptTask{ctx: ctx, run: run, queuedAt: time.Now(), done: make(chan error, 1)}
+	select {
+	case bcryptTasks <- task:
+	default:
+		metrics.Inc("bcrypt_rejected_total")
+		return ErrPasswordHashingBusy
+	}
+
+	select {
+	case err := <-task.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hashPassword hashes the password with bcrypt at the default cost.
+func hashPassword(ctx context.Context, password string) (string, error) {
+	var hashed []byte
+	err := runBcrypt(ctx, func() error {
+		var err error
+		hashed, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// comparePassword compares the password with the bcrypt hash.
+func comparePassword(ctx context.Context, hash, password string) error {
+	return runBcrypt(ctx, func() error {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	})
+}
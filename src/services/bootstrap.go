@@ -0,0 +1,337 @@
+// services/bootstrap.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidBootstrap wraps the errors of a bootstrap document, nothing of it is applied.
+var ErrInvalidBootstrap = errors.New("invalid bootstrap document")
+
+// BootstrapDocument declares the initial state of an environment: its first admin, the roles
+// and the features granted to roles. It only adds or updates what it lists, applying it again
+// changes nothing.
+type BootstrapDocument struct {
+	Admin    *BootstrapAdmin    `json:"admin"`
+	Roles    []BootstrapRole    `json:"roles"`
+	Features []BootstrapFeature `json:"features"`
+}
+
+// BootstrapAdmin is the admin account, active with the admin role. The password is only set
+// when the account is created, from PasswordEnv when set so it stays out of the document.
+type BootstrapAdmin struct {
+	Username    string  `json:"username"`
+	FullName    string  `json:"full_name"`
+	Email       *string `json:"email"`
+	Password    string  `json:"password"`
+	PasswordEnv string  `json:"password_env"`
+}
+
+// BootstrapRole is a role with exactly the permissions listed; the admin role can't be listed,
+// it always grants every permission.
+type BootstrapRole struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// BootstrapFeature grants the feature to the roles for good, see GrantEntitlement.
+type BootstrapFeature struct {
+	Feature string   `json:"feature"`
+	Roles   []string `json:"roles"`
+}
+
+// BootstrapReport lists the changes a bootstrap applied, or on a dry run would apply; it is
+// empty when the environment already matches the document.
+type BootstrapReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Changes []BootstrapChange `json:"changes"`
+}
+
+// BootstrapChange is a created or updated object, with its changed fields.
+type BootstrapChange struct {
+	Kind    string                        `json:"kind"`   // user, role or entitlement
+	Name    string                        `json:"name"`   // the username, the role name or feature/role
+	Action  string                        `json:"action"` // create or update
+	Changes map[string]models.FieldChange `json:"changes,omitempty"`
+}
+
+// a change of the plan and how it is applied
+type bootstrapStep struct {
+	change BootstrapChange
+	apply  func(ctx context.Context) error
+}
+
+// ApplyBootstrap brings the environment to the document: the whole document is validated and
+// compared first, then the changes are applied in order, the roles before the admin and the
+// features. On a dry run nothing is saved. When a change fails the report lists those applied
+// before it, applying the document again completes it.
+func ApplyBootstrap(ctx context.Context, doc *BootstrapDocument, dryRun bool) (*BootstrapReport, error) {
+	steps, err := planBootstrap(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BootstrapReport{DryRun: dryRun, Changes: []BootstrapChange{}}
+	for _, step := range steps {
+		if !dryRun {
+			if err := step.apply(ctx); err != nil {
+				middleware.Logger.Printf("Error bootstrapping %s %s: %s", step.change.Kind, step.change.Name, err)
+				return report, fmt.Errorf("%s %s %s: %w", step.change.Action, step.change.Kind, step.change.Name, err)
+			}
+		}
+		report.Changes = append(report.Changes, step.change)
+	}
+	return report, nil
+}
+
+// planBootstrap compares the environment with the document, returning the steps applying
+// the differences
+func planBootstrap(ctx context.Context, doc *BootstrapDocument) ([]bootstrapStep, error) {
+	var steps []bootstrapStep
+
+	declared := map[string]bool{}
+	for _, role := range doc.Roles {
+		if declared[role.Name] {
+			return nil, fmt.Errorf("%w: the role %s is listed twice", ErrInvalidBootstrap, role.Name)
+		}
+		declared[role.Name] = true
+
+		step, err := planRole(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		if step != nil {
+			steps = append(steps, *step)
+		}
+	}
+
+	if doc.Admin != nil {
+		step, err := planAdmin(ctx, doc.Admin)
+		if err != nil {
+			return nil, err
+		}
+		if step != nil {
+			steps = append(steps, *step)
+		}
+	}
+
+	for _, feature := range doc.Features {
+		featureSteps, err := planFeature(ctx, feature, declared)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, featureSteps...)
+	}
+	return steps, nil
+}
+
+// planRole returns the step creating the role or updating its description and permissions,
+// nil when it matches
+func planRole(ctx context.Context, role BootstrapRole) (*bootstrapStep, error) {
+	if role.Name == string(models.Admin) {
+		return nil, fmt.Errorf("%w: the admin role always grants every permission, it can't be listed", ErrInvalidBootstrap)
+	}
+	if !roleNameRegex.MatchString(role.Name) {
+		return nil, fmt.Errorf("%w: the role name %q must be 2 to 32 lowercase letters, digits, - or _", ErrInvalidBootstrap, role.Name)
+	}
+	if _, err := findPermissions(ctx, role.Permissions); err != nil {
+		if errors.Is(err, ErrInvalidRole) {
+			return nil, fmt.Errorf("%w: role %s: %s", ErrInvalidBootstrap, role.Name, err)
+		}
+		return nil, err
+	}
+	permissions := append([]string{}, role.Permissions...)
+	sort.Strings(permissions)
+
+	existing, err := repository.GetRoleByName(ctx, role.Name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &bootstrapStep{
+			change: BootstrapChange{Kind: "role", Name: role.Name, Action: "create", Changes: map[string]models.FieldChange{
+				"description": {To: role.Description},
+				"permissions": {To: permissions},
+			}},
+			apply: func(ctx context.Context) error {
+				_, err := CreateRole(ctx, role.Name, role.Description, role.Permissions)
+				return err
+			},
+		}, nil
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching role %s: %s", role.Name, err)
+		return nil, err
+	}
+
+	changes := map[string]models.FieldChange{}
+	if existing.Description != role.Description {
+		changes["description"] = models.FieldChange{From: existing.Description, To: role.Description}
+	}
+	current := existing.PermissionNames()
+	sort.Strings(current)
+	if strings.Join(current, ",") != strings.Join(permissions, ",") {
+		changes["permissions"] = models.FieldChange{From: current, To: permissions}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	return &bootstrapStep{
+		change: BootstrapChange{Kind: "role", Name: role.Name, Action: "update", Changes: changes},
+		apply: func(ctx context.Context) error {
+			_, err := UpdateRole(ctx, role.Name, role.Description, role.Permissions)
+			return err
+		},
+	}, nil
+}
+
+// planAdmin returns the step creating the admin, or making it an active admin with the name
+// and email of the document, nil when it matches
+func planAdmin(ctx context.Context, admin *BootstrapAdmin) (*bootstrapStep, error) {
+	if admin.Username == "" {
+		return nil, fmt.Errorf("%w: the admin must have a username", ErrInvalidBootstrap)
+	}
+
+	existing, err := repository.GetUserByUsername(ctx, admin.Username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		password := admin.Password
+		if admin.PasswordEnv != "" {
+			password = initializers.GetEnv(admin.PasswordEnv, "")
+		}
+		user := &models.User{
+			FullName: admin.FullName,
+			Username: admin.Username,
+			Email:    admin.Email,
+			Password: password,
+			Status:   models.Active,
+			Role:     models.Admin,
+		}
+		if err := ValidateNewUser(user); err != nil {
+			return nil, err
+		}
+
+		return &bootstrapStep{
+			change: BootstrapChange{Kind: "user", Name: admin.Username, Action: "create", Changes: map[string]models.FieldChange{
+				"role":   {To: models.Admin},
+				"status": {To: models.Active},
+			}},
+			apply: func(ctx context.Context) error {
+				hashedPassword, err := hashPassword(ctx, user.Password)
+				if err != nil {
+					return err
+				}
+				user.Password = hashedPassword
+				if err := repository.CreateUser(ctx, user); err != nil {
+					return err
+				}
+				enqueueUserSync(ctx, OperationCreate, user, "")
+				return nil
+			},
+		}, nil
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user by username: %s", err)
+		return nil, err
+	}
+
+	// the password of an existing admin is left alone
+	var patch UserPatch
+	changes := map[string]models.FieldChange{}
+	if existing.Role != models.Admin {
+		role := models.Admin
+		patch.Role = &role
+		changes["role"] = models.FieldChange{From: existing.Role, To: role}
+	}
+	if existing.Status != models.Active {
+		status := models.Active
+		patch.Status = &status
+		changes["status"] = models.FieldChange{From: existing.Status, To: status}
+	}
+	if admin.FullName != "" && admin.FullName != existing.FullName {
+		patch.FullName = &admin.FullName
+		changes["full_name"] = models.FieldChange{From: existing.FullName, To: admin.FullName}
+	}
+	if admin.Email != nil && (existing.Email == nil || !strings.EqualFold(*existing.Email, *admin.Email)) {
+		patch.Email = admin.Email
+		changes["email"] = models.FieldChange{From: existing.Email, To: *admin.Email}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	before := *existing
+	user := existing
+	if err := ApplyUserPatch(ctx, user, &patch); err != nil {
+		return nil, err
+	}
+
+	return &bootstrapStep{
+		change: BootstrapChange{Kind: "user", Name: admin.Username, Action: "update", Changes: changes},
+		apply: func(ctx context.Context) error {
+			if err := repository.UpdateUser(ctx, user); err != nil {
+				return err
+			}
+			invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+			invalidatePublicProfile(ctx, user.ID)
+			recordUserDiff(ctx, &before, user)
+			enqueueUserSync(ctx, OperationUpdate, user, user.Username)
+			return nil
+		},
+	}, nil
+}
+
+// planFeature returns the steps granting the feature to the roles lacking a lasting grant,
+// the roles of the document count as known
+func planFeature(ctx context.Context, feature BootstrapFeature, declared map[string]bool) ([]bootstrapStep, error) {
+	if !featureNameRegex.MatchString(feature.Feature) {
+		return nil, fmt.Errorf("%w: the feature %q must be 1 to 64 lowercase letters, digits, ., - or _", ErrInvalidBootstrap, feature.Feature)
+	}
+	for _, role := range feature.Roles {
+		if !declared[role] && !models.Role(role).IsValid() {
+			return nil, fmt.Errorf("%w: the feature %s is granted to the unknown role %s", ErrInvalidBootstrap, feature.Feature, role)
+		}
+	}
+
+	grants, err := GetEntitlements(ctx, feature.Feature)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []bootstrapStep
+	for _, role := range feature.Roles {
+		var existing *models.Entitlement
+		for _, grant := range grants {
+			if grant.UserID == 0 && string(grant.Role) == role {
+				existing = grant
+			}
+		}
+		if existing != nil && existing.ExpiresAt == nil {
+			continue
+		}
+
+		change := BootstrapChange{Kind: "entitlement", Name: feature.Feature + "/" + role, Action: "create"}
+		if existing != nil {
+			change.Action = "update"
+			change.Changes = map[string]models.FieldChange{"expires_at": {From: existing.ExpiresAt, To: nil}}
+		}
+		featureName, roleName := feature.Feature, models.Role(role)
+		steps = append(steps, bootstrapStep{
+			change: change,
+			apply: func(ctx context.Context) error {
+				_, err := GrantEntitlement(ctx, featureName, 0, roleName, nil, 0)
+				return err
+			},
+		})
+	}
+	return steps, nil
+}
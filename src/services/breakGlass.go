@@ -0,0 +1,302 @@
+// services/breakGlass.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/notify"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/scheduler"
+	"github.com/nabazesmail/gopher/src/utils"
+	"gorm.io/gorm"
+)
+
+const breakGlassAlertJob = "break_glass_alert"
+
+var (
+	// ErrBreakGlassNotProvisioned is returned when activating or sealing before the account is provisioned.
+	ErrBreakGlassNotProvisioned = errors.New("the break-glass account is not provisioned")
+	// ErrBreakGlassTokenRejected wraps the reasons a signed break-glass token is refused.
+	ErrBreakGlassTokenRejected = errors.New("break-glass token rejected")
+)
+
+// breakGlassAlert is the break-glass event posted to BREAK_GLASS_ALERT_WEBHOOK_URL
+type breakGlassAlert struct {
+	Event    string    `json:"event"`
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	Details  string    `json:"details"`
+	IP       string    `json:"ip,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// InitBreakGlass registers the job posting the break-glass alerts.
+func InitBreakGlass() {
+	jobs.Register(breakGlassAlertJob, runBreakGlassAlert)
+}
+
+// runBreakGlassAlert posts the alert to the webhook
+func runBreakGlassAlert(ctx context.Context, payload []byte) error {
+	url := initializers.GetEnv("BREAK_GLASS_ALERT_WEBHOOK_URL", "")
+	if url == "" {
+		return nil
+	}
+	var alert breakGlassAlert
+	if err := json.Unmarshal(payload, &alert); err != nil {
+		return err
+	}
+	return notify.PostWebhook(ctx, url, alert)
+}
+
+// alertBreakGlass makes the event hard to miss: it is logged, audited, counted, posted to
+// BREAK_GLASS_ALERT_WEBHOOK_URL and notified to the admins with a high priority
+func alertBreakGlass(ctx context.Context, event string, user *models.User, details string) {
+	ip := middleware.ClientFromContext(ctx).IP
+	middleware.Logger.Printf("BREAK-GLASS %s: account %s (%d): %s", event, user.Username, user.ID, details)
+	metrics.Inc("break_glass_events_total", event)
+
+	entry := &models.AuditLog{
+		Action:     "break_glass:" + event,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		StatusCode: 200,
+		IP:         ip,
+		Details:    details,
+	}
+	if actor := middleware.UserFromContext(ctx); actor != nil {
+		entry.ActorID = &actor.ID
+	}
+	if err := repository.CreateAuditLog(ctx, entry); err != nil {
+		middleware.Logger.Printf("Error writing audit log: %s", err)
+	}
+
+	alert := breakGlassAlert{Event: event, UserID: user.ID, Username: user.Username, Details: details, IP: ip, At: time.Now()}
+	if initializers.GetEnv("BREAK_GLASS_ALERT_WEBHOOK_URL", "") != "" {
+		if err := jobs.Enqueue(ctx, breakGlassAlertJob, alert); err != nil {
+			middleware.Logger.Printf("Error queueing the break-glass alert: %s", err)
+		}
+	}
+
+	admins, err := repository.GetUsersToNotify(ctx, []string{string(models.Admin)})
+	if err != nil {
+		middleware.Logger.Printf("Error fetching the admins to alert: %s", err)
+		return
+	}
+	subject := fmt.Sprintf("Break-glass account %s: %s", user.Username, event)
+	for _, admin := range admins {
+		if admin.ID == user.ID {
+			continue
+		}
+		if err := NotifyUser(ctx, admin, subject, details, models.PriorityHigh); err != nil {
+			middleware.Logger.Printf("Error alerting admin %d: %s", admin.ID, err)
+		}
+	}
+}
+
+// breakGlassUser fetches the break-glass account
+func breakGlassUser(ctx context.Context) (*models.User, error) {
+	user, err := repository.GetBreakGlassUser(ctx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBreakGlassNotProvisioned
+	}
+	return user, err
+}
+
+// ProvisionBreakGlass creates the break-glass account, an inactive admin (BREAK_GLASS_USERNAME,
+// "breakglass" by default), or rotates its password and seals it when it exists. The random
+// password is returned, to be stored in the vault: it isn't shown again.
+func ProvisionBreakGlass(ctx context.Context) (string, error) {
+	password, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	hashed, err := hashPassword(ctx, password)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := breakGlassUser(ctx)
+	switch {
+	case errors.Is(err, ErrBreakGlassNotProvisioned):
+		user = &models.User{
+			FullName:   "Break-glass admin",
+			Username:   initializers.GetEnv("BREAK_GLASS_USERNAME", "breakglass"),
+			Password:   hashed,
+			Status:     models.Inactive,
+			Role:       models.Admin,
+			BreakGlass: true,
+		}
+		if err := repository.CreateUser(ctx, user); err != nil {
+			middleware.Logger.Printf("Error creating the break-glass account: %s", err)
+			return "", err
+		}
+		alertBreakGlass(ctx, "provisioned", user, "the account was created, sealed")
+		return password, nil
+	case err != nil:
+		middleware.Logger.Printf("Error fetching the break-glass account: %s", err)
+		return "", err
+	}
+
+	if err := sealBreakGlass(ctx, user); err != nil {
+		return "", err
+	}
+	user.Password = hashed
+	if err := repository.UpdateUser(ctx, user); err != nil {
+		middleware.Logger.Printf("Error rotating the break-glass password: %s", err)
+		return "", err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+
+	alertBreakGlass(ctx, "provisioned", user, "the password was rotated, the account sealed")
+	return password, nil
+}
+
+// ActivateBreakGlass opens the break-glass account for the hours of the token, signed with the
+// private key of BREAK_GLASS_PUBLIC_KEY less than BREAK_GLASS_TOKEN_TTL ago (15m by default). At
+// most BREAK_GLASS_MAX_HOURS (8 by default) are granted, and every token is used once.
+func ActivateBreakGlass(ctx context.Context, token string) (*models.BreakGlassActivation, error) {
+	key, err := utils.ParseBreakGlassPublicKey(initializers.GetEnv("BREAK_GLASS_PUBLIC_KEY", ""))
+	if err != nil {
+		return nil, err
+	}
+	claims, err := utils.VerifyBreakGlassToken(key, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBreakGlassTokenRejected, err)
+	}
+
+	user, err := breakGlassUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	switch {
+	case claims.Username != user.Username:
+		err = fmt.Errorf("%w: signed for the account %q", ErrBreakGlassTokenRejected, claims.Username)
+	case time.Since(issuedAt) > initializers.GetEnvDuration("BREAK_GLASS_TOKEN_TTL", 15*time.Minute) || time.Until(issuedAt) > time.Minute:
+		err = fmt.Errorf("%w: issued at %s, sign a new one", ErrBreakGlassTokenRejected, issuedAt.Format(time.RFC3339))
+	case claims.Hours <= 0 || claims.Hours > initializers.GetEnvInt("BREAK_GLASS_MAX_HOURS", 8):
+		err = fmt.Errorf("%w: %d hours is out of bounds", ErrBreakGlassTokenRejected, claims.Hours)
+	case claims.Reason == "" || claims.Nonce == "":
+		err = fmt.Errorf("%w: the reason and nonce are required", ErrBreakGlassTokenRejected)
+	}
+	if err != nil {
+		alertBreakGlass(ctx, "activation_rejected", user, err.Error())
+		return nil, err
+	}
+
+	now := time.Now()
+	activation := &models.BreakGlassActivation{
+		UserID:    user.ID,
+		Nonce:     claims.Nonce,
+		Reason:    claims.Reason,
+		IssuedAt:  issuedAt,
+		ExpiresAt: now.Add(time.Duration(claims.Hours) * time.Hour),
+	}
+	if err := repository.CreateBreakGlassActivation(ctx, activation); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			err = fmt.Errorf("%w: the token was already used", ErrBreakGlassTokenRejected)
+			alertBreakGlass(ctx, "activation_rejected", user, err.Error())
+			return nil, err
+		}
+		middleware.Logger.Printf("Error saving the break-glass activation: %s", err)
+		return nil, err
+	}
+
+	if err := repository.UpdateUserStatus(ctx, user, models.Active); err != nil {
+		middleware.Logger.Printf("Error activating the break-glass account: %s", err)
+		return nil, err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+
+	alertBreakGlass(ctx, "activated", user, fmt.Sprintf("activated for %d hours, until %s: %s",
+		claims.Hours, activation.ExpiresAt.Format(time.RFC3339), claims.Reason))
+	return activation, nil
+}
+
+// SealBreakGlass ends the activation of the break-glass account before it expires.
+func SealBreakGlass(ctx context.Context) error {
+	user, err := breakGlassUser(ctx)
+	if err != nil {
+		return err
+	}
+	if err := sealBreakGlass(ctx, user); err != nil {
+		return err
+	}
+
+	alertBreakGlass(ctx, "sealed", user, "the account was sealed")
+	return nil
+}
+
+// sealBreakGlass closes the activations of the account, deactivates it and revokes its sessions
+func sealBreakGlass(ctx context.Context, user *models.User) error {
+	if err := repository.SealBreakGlassActivations(ctx, user.ID, time.Now()); err != nil {
+		middleware.Logger.Printf("Error sealing the break-glass activations: %s", err)
+		return err
+	}
+	if err := repository.UpdateUserStatus(ctx, user, models.Inactive); err != nil {
+		middleware.Logger.Printf("Error deactivating the break-glass account: %s", err)
+		return err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+
+	return revokeOtherSessions(ctx, user.ID, 0)
+}
+
+// ScheduleBreakGlassExpiry registers the sealing of the break-glass activations past their
+// expiry, run every BREAK_GLASS_EXPIRY_INTERVAL (1m by default).
+func ScheduleBreakGlassExpiry() {
+	interval := initializers.GetEnvDuration("BREAK_GLASS_EXPIRY_INTERVAL", time.Minute)
+	if interval <= 0 {
+		return
+	}
+
+	scheduler.Every("break-glass-expiry", interval, func() error {
+		return ExpireBreakGlass(context.Background())
+	})
+}
+
+// ExpireBreakGlass seals the break-glass account whose activation expired.
+func ExpireBreakGlass(ctx context.Context) error {
+	activations, err := repository.GetExpiredBreakGlassActivations(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching the expired break-glass activations: %s", err)
+		return err
+	}
+
+	for _, activation := range activations {
+		user, err := repository.GetUserByIDWithDeleted(ctx, strconv.FormatUint(uint64(activation.UserID), 10))
+		if err != nil {
+			middleware.Logger.Printf("Error fetching break-glass account %d: %s", activation.UserID, err)
+			continue
+		}
+		if err := sealBreakGlass(ctx, user); err != nil {
+			continue
+		}
+		alertBreakGlass(ctx, "expired", user, fmt.Sprintf("the activation of %s expired", activation.ExpiresAt.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// breakGlassLogin lets the break-glass account log in only while activated, alerting either way
+func breakGlassLogin(ctx context.Context, method string, user *models.User) error {
+	_, err := repository.GetActiveBreakGlassActivation(ctx, user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		alertBreakGlass(ctx, "login_denied", user, "login attempt ("+method+") while sealed")
+		return ErrAccountInactive
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching the break-glass activation: %s", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// services/broadcasts.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+const broadcastJob = "notification_broadcast"
+
+var (
+	// ErrInvalidBroadcast wraps the validation errors of CreateBroadcast.
+	ErrInvalidBroadcast = errors.New("invalid broadcast")
+	// ErrBroadcastNotScheduled is returned when canceling a broadcast already sent or being sent.
+	ErrBroadcastNotScheduled = errors.New("only scheduled broadcasts can be canceled")
+)
+
+// BroadcastRequest is a message for every active user, or the users with one of the Roles,
+// sent at SendAt (right away when nil).
+type BroadcastRequest struct {
+	Subject  string
+	Body     string
+	Priority string
+	Roles    []string
+	SendAt   *time.Time
+}
+
+func (r *BroadcastRequest) validate() error {
+	if r.Subject == "" {
+		return fmt.Errorf("%w: the subject must be provided", ErrInvalidBroadcast)
+	}
+	if r.Priority == "" {
+		r.Priority = models.PriorityNormal
+	}
+	if r.Priority != models.PriorityLow && r.Priority != models.PriorityNormal && r.Priority != models.PriorityHigh {
+		return fmt.Errorf("%w: the priority must be low, normal or high", ErrInvalidBroadcast)
+	}
+	for _, role := range r.Roles {
+		if _, err := models.ParseRole(role); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidBroadcast, err)
+		}
+	}
+	return nil
+}
+
+// PreviewBroadcast counts the users a broadcast to the roles (every user when none) would reach now.
+func PreviewBroadcast(ctx context.Context, roles []string) (int64, error) {
+	request := &BroadcastRequest{Subject: "preview", Roles: roles}
+	if err := request.validate(); err != nil {
+		return 0, err
+	}
+
+	count, err := repository.CountUsersToNotify(ctx, roles)
+	if err != nil {
+		middleware.Logger.Printf("Error counting the broadcast audience: %s", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CreateBroadcast saves the broadcast and queues it for its send time. The audience is
+// resolved when it is sent, users joining meanwhile receive it too.
+func CreateBroadcast(ctx context.Context, request *BroadcastRequest, admin *models.User) (*models.Broadcast, error) {
+	if err := request.validate(); err != nil {
+		return nil, err
+	}
+
+	sendAt, scheduled := time.Now(), request.SendAt != nil && request.SendAt.After(time.Now())
+	if scheduled {
+		sendAt = *request.SendAt
+	}
+
+	broadcast := &models.Broadcast{
+		Subject:     request.Subject,
+		Body:        request.Body,
+		Priority:    request.Priority,
+		Roles:       strings.Join(request.Roles, " "),
+		Status:      models.BroadcastScheduled,
+		SendAt:      sendAt,
+		CreatedByID: admin.ID,
+	}
+	if err := repository.CreateBroadcast(ctx, broadcast); err != nil {
+		middleware.Logger.Printf("Error saving broadcast: %s", err)
+		return nil, err
+	}
+
+	payload := map[string]interface{}{"broadcast_id": broadcast.ID}
+	var err error
+	if scheduled {
+		err = jobs.EnqueueAt(ctx, broadcastJob, payload, sendAt)
+	} else {
+		err = jobs.Enqueue(ctx, broadcastJob, payload)
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error queueing broadcast %d: %s", broadcast.ID, err)
+		if _, cancelErr := repository.TransitionBroadcast(ctx, broadcast.ID, models.BroadcastScheduled, models.BroadcastCanceled); cancelErr != nil {
+			middleware.Logger.Printf("Error canceling broadcast %d: %s", broadcast.ID, cancelErr)
+		}
+		return nil, err
+	}
+
+	return broadcast, nil
+}
+
+// GetAllBroadcasts lists the broadcasts, most recent first, with the total count.
+func GetAllBroadcasts(ctx context.Context, page, perPage int) ([]*models.Broadcast, int64, error) {
+	broadcasts, total, err := repository.GetAllBroadcasts(ctx, perPage, (page-1)*perPage)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving broadcasts: %s", err)
+		return nil, 0, err
+	}
+
+	return broadcasts, total, nil
+}
+
+// GetBroadcast returns the broadcast with its delivery statistics and the number of
+// recipients who read it in-app, nil when not found.
+func GetBroadcast(ctx context.Context, broadcastID string) (*models.Broadcast, int64, error) {
+	broadcast, err := repository.GetBroadcastByID(ctx, broadcastID)
+	if err != nil {
+		return nil, 0, nil // Broadcast not found
+	}
+
+	reads, err := repository.CountBroadcastReads(ctx, broadcast.ID)
+	if err != nil {
+		middleware.Logger.Printf("Error counting the reads of broadcast %d: %s", broadcast.ID, err)
+		return nil, 0, err
+	}
+
+	return broadcast, reads, nil
+}
+
+// CancelBroadcast cancels a broadcast not sent yet, nil when not found.
+func CancelBroadcast(ctx context.Context, broadcastID string) (*models.Broadcast, error) {
+	broadcast, err := repository.GetBroadcastByID(ctx, broadcastID)
+	if err != nil {
+		return nil, nil // Broadcast not found
+	}
+
+	canceled, err := repository.TransitionBroadcast(ctx, broadcast.ID, models.BroadcastScheduled, models.BroadcastCanceled)
+	if err != nil {
+		middleware.Logger.Printf("Error canceling broadcast %d: %s", broadcast.ID, err)
+		return nil, err
+	}
+	if !canceled {
+		return nil, ErrBroadcastNotScheduled
+	}
+
+	broadcast.Status = models.BroadcastCanceled
+	return broadcast, nil
+}
+
+// runBroadcast notifies the audience of a broadcast on the channels of their preferences.
+func runBroadcast(ctx context.Context, payload []byte) error {
+	var job struct {
+		BroadcastID uint `json:"broadcast_id"`
+	}
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+
+	// only one run sends the broadcast, and canceled broadcasts are skipped
+	claimed, err := repository.TransitionBroadcast(ctx, job.BroadcastID, models.BroadcastScheduled, models.BroadcastSending)
+	if err != nil || !claimed {
+		return err
+	}
+
+	broadcast, err := repository.GetBroadcastByID(ctx, fmt.Sprint(job.BroadcastID))
+	var users []*models.User
+	if err == nil {
+		users, err = repository.GetUsersToNotify(ctx, broadcast.AudienceRoles())
+	}
+	if err != nil {
+		// nobody was notified yet, the retry can send it
+		if _, revertErr := repository.TransitionBroadcast(ctx, job.BroadcastID, models.BroadcastSending, models.BroadcastScheduled); revertErr != nil {
+			middleware.Logger.Printf("Error rescheduling broadcast %d: %s", job.BroadcastID, revertErr)
+		}
+		return err
+	}
+
+	// not retried as a whole, the users already notified would be notified twice
+	recipients := 0
+	for _, user := range users {
+		if err := notifyUser(ctx, user, broadcast.Subject, broadcast.Body, broadcast.Priority, &broadcast.ID); err != nil {
+			middleware.Logger.Printf("Error broadcasting to user %d: %s", user.ID, err)
+			continue
+		}
+		recipients++
+	}
+
+	return repository.MarkBroadcastSent(ctx, broadcast.ID, recipients, time.Now())
+}
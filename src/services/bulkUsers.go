@@ -0,0 +1,150 @@
+// services/bulkUsers.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// ErrBulkTooLarge is returned when a bulk creation has more users than BULK_USERS_MAX (100 by default).
+var ErrBulkTooLarge = errors.New("too many users in one request")
+
+// BulkUserResult is the outcome of one user of a bulk creation, in the order of the request.
+type BulkUserResult struct {
+	Index int          `json:"index"`
+	User  *models.User `json:"user,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// CreateUsersBulk creates the users that pass the validation, in a single transaction. The
+// passwords are hashed concurrently by BULK_HASH_WORKERS (4 by default) workers, sharing the
+// bcrypt pool with the logins. Every user gets a result, its error is the reason the user was
+// left out. An error is returned when the valid users couldn't be saved.
+func CreateUsersBulk(ctx context.Context, bodies []*models.User) ([]BulkUserResult, error) {
+	if len(bodies) > initializers.GetEnvInt("BULK_USERS_MAX", 100) {
+		return nil, ErrBulkTooLarge
+	}
+	return createUsers(ctx, bodies)
+}
+
+func createUsers(ctx context.Context, bodies []*models.User) ([]BulkUserResult, error) {
+	results := make([]BulkUserResult, len(bodies))
+	for i := range bodies {
+		results[i].Index = i
+	}
+
+	// the usernames used twice in the request or already taken
+	seen := map[string]int{}
+	usernames := make([]string, 0, len(bodies))
+	for _, body := range bodies {
+		seen[strings.ToLower(body.Username)]++
+		usernames = append(usernames, body.Username)
+	}
+	taken, err := repository.GetTakenUsernames(ctx, usernames)
+	if err != nil {
+		middleware.Logger.Printf("Error checking usernames: %s", err)
+		return nil, err
+	}
+	takenSet := make(map[string]bool, len(taken))
+	for _, username := range taken {
+		takenSet[strings.ToLower(username)] = true
+	}
+	for i, body := range bodies {
+		switch username := strings.ToLower(body.Username); {
+		case takenSet[username]:
+			results[i].Error = "username already taken"
+		case seen[username] > 1:
+			results[i].Error = "username used more than once in the request"
+		}
+	}
+
+	// validate and hash with a bounded pool, the breach check and bcrypt are slow
+	users := make([]*models.User, len(bodies))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	var busy error
+	var busyOnce sync.Once
+	workers := initializers.GetEnvInt("BULK_HASH_WORKERS", 4)
+	if workers <= 0 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				body := bodies[i]
+				if err := ValidateNewUser(body); err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+
+				hashedPassword, err := hashPassword(ctx, body.Password)
+				if err != nil {
+					middleware.Logger.Printf("Error hashing password: %s", err)
+					results[i].Error = "failed to hash password"
+					if errors.Is(err, ErrPasswordHashingBusy) {
+						busyOnce.Do(func() { busy = err })
+					}
+					continue
+				}
+
+				users[i] = &models.User{
+					FullName: body.FullName,
+					Username: body.Username,
+					Email:    body.Email,
+					Phone:    body.Phone,
+					Password: hashedPassword,
+					Status:   body.Status,
+					Role:     body.Role,
+					Metadata: body.Metadata,
+				}
+			}
+		}()
+	}
+	for i := range bodies {
+		if results[i].Error == "" {
+			indexes <- i
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	// the request is retried as a whole when the bcrypt queue is full
+	if busy != nil {
+		return nil, busy
+	}
+
+	var valid []*models.User
+	for _, user := range users {
+		if user != nil {
+			valid = append(valid, user)
+		}
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	if err := repository.CreateUsersBatch(ctx, valid); err != nil {
+		middleware.Logger.Printf("Error saving users in the database: %s", err)
+		return nil, fmt.Errorf("saving %d users: %w", len(valid), err)
+	}
+
+	for i, user := range users {
+		if user == nil {
+			continue
+		}
+		results[i].User = user
+		enqueueUserSync(ctx, OperationCreate, user, "")
+	}
+
+	return results, nil
+}
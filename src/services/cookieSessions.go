@@ -0,0 +1,67 @@
+// services/cookieSessions.go
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// CookieSession is the session of a browser, its token is the value of the httpOnly cookie
+// and its CSRF token must be sent back with every unsafe request.
+type CookieSession struct {
+	Token     string
+	CSRFToken string
+	ExpiresIn int64 // session lifetime in seconds
+}
+
+// StartCookieSession turns the session of a completed login into a cookie session, for the
+// browser clients. The refresh token of the login is deleted, the cookie session lives as long
+// as it would have.
+func StartCookieSession(ctx context.Context, tokens *AuthTokens) (*CookieSession, error) {
+	session, err := repository.GetSessionByID(ctx, strconv.FormatUint(uint64(tokens.sessionID), 10))
+	if err != nil {
+		middleware.Logger.Printf("Error fetching session %d: %s", tokens.sessionID, err)
+		return nil, errors.New("failed to start cookie session")
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	csrfToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Until(session.ExpiresAt)
+	key := utils.CookieSessionPrefix + utils.HashToken(token)
+	_, err = initializers.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "session_id", session.ID, "csrf", csrfToken)
+		pipe.Expire(ctx, key, ttl)
+		pipe.Del(ctx, refreshTokenPrefix+session.RefreshTokenHash)
+		return nil
+	})
+	if err != nil {
+		middleware.Logger.Printf("Error storing cookie session: %s", err)
+		return nil, errors.New("failed to start cookie session")
+	}
+
+	return &CookieSession{Token: token, CSRFToken: csrfToken, ExpiresIn: int64(ttl.Seconds())}, nil
+}
+
+// EndCookieSession forgets the cookie session, its session is revoked separately.
+func EndCookieSession(ctx context.Context, token string) error {
+	if err := initializers.RedisClient.Del(ctx, utils.CookieSessionPrefix+utils.HashToken(token)).Err(); err != nil {
+		middleware.Logger.Printf("Error deleting cookie session: %s", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// services/dashboard.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"golang.org/x/sync/errgroup"
+)
+
+const dashboardCacheKey = "dashboard:admin"
+
+// Dashboard gathers the widgets of the admin dashboard, the signups and failed logins are
+// those of the last 24 hours.
+type Dashboard struct {
+	Users         DashboardUsers   `json:"users"`
+	RecentSignups DashboardSignups `json:"recent_signups"`
+	FailedLogins  int64            `json:"failed_logins"`
+	Queue         jobs.Depth       `json:"queue"`
+	Cache         DashboardCache   `json:"cache"`
+	GeneratedAt   time.Time        `json:"generated_at"`
+}
+
+type DashboardUsers struct {
+	Total    int64                   `json:"total"`
+	ByStatus map[models.Status]int64 `json:"by_status"`
+}
+
+type DashboardSignups struct {
+	Total int64             `json:"total"`
+	Users []DashboardSignup `json:"users"` // the most recent ones
+}
+
+type DashboardSignup struct {
+	ID        uint        `json:"id"`
+	Username  string      `json:"username"`
+	FullName  string      `json:"full_name"`
+	Role      models.Role `json:"role"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// DashboardCache is the hit rate of the user cache of this instance since it started.
+type DashboardCache struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// GetDashboard assembles the widgets concurrently. The dashboard is cached for
+// ADMIN_DASHBOARD_CACHE_TTL (5s by default), the admin UIs polling it share one computation.
+func GetDashboard(ctx context.Context) (*Dashboard, error) {
+	ttl := initializers.GetEnvDuration("ADMIN_DASHBOARD_CACHE_TTL", 5*time.Second)
+	if ttl > 0 {
+		if cached, err := initializers.RedisClient.Get(ctx, dashboardCacheKey).Bytes(); err == nil {
+			var dashboard Dashboard
+			if err := json.Unmarshal(cached, &dashboard); err == nil {
+				return &dashboard, nil
+			}
+		}
+	}
+
+	dashboard := &Dashboard{GeneratedAt: time.Now()}
+	since := dashboard.GeneratedAt.Add(-24 * time.Hour)
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		counts, err := repository.CountUsersByStatus(groupCtx)
+		if err != nil {
+			return err
+		}
+		dashboard.Users.ByStatus = counts
+		for _, count := range counts {
+			dashboard.Users.Total += count
+		}
+		return nil
+	})
+	group.Go(func() error {
+		users, total, err := repository.GetRecentUsers(groupCtx, since, 10)
+		if err != nil {
+			return err
+		}
+		dashboard.RecentSignups.Total = total
+		dashboard.RecentSignups.Users = make([]DashboardSignup, len(users))
+		for i, user := range users {
+			dashboard.RecentSignups.Users[i] = DashboardSignup{
+				ID:        user.ID,
+				Username:  user.Username,
+				FullName:  user.FullName,
+				Role:      user.Role,
+				CreatedAt: user.CreatedAt,
+			}
+		}
+		return nil
+	})
+	group.Go(func() error {
+		failed, err := repository.CountLoginEvents(groupCtx, repository.LoginEventFilter{Outcome: models.LoginFailed, Since: since})
+		dashboard.FailedLogins = failed
+		return err
+	})
+	group.Go(func() error {
+		depth, err := jobs.QueueDepth(groupCtx)
+		dashboard.Queue = depth
+		return err
+	})
+
+	counters := metrics.Snapshot()
+	dashboard.Cache.Hits = counters["user_cache_total{hit}"]
+	dashboard.Cache.Misses = counters["user_cache_total{miss}"]
+	if lookups := dashboard.Cache.Hits + dashboard.Cache.Misses; lookups > 0 {
+		dashboard.Cache.HitRate = float64(dashboard.Cache.Hits) / float64(lookups)
+	}
+
+	if err := group.Wait(); err != nil {
+		middleware.Logger.Printf("Error building admin dashboard: %s", err)
+		return nil, err
+	}
+
+	if ttl > 0 {
+		if data, err := json.Marshal(dashboard); err == nil {
+			initializers.RedisClient.Set(ctx, dashboardCacheKey, data, ttl)
+		}
+	}
+
+	return dashboard, nil
+}
@@ -0,0 +1,56 @@
+// services/devices.go
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/notify"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// ErrInvalidDevice is returned when registering a device without token or with an unknown platform.
+var ErrInvalidDevice = errors.New("a token and the fcm or apns platform must be provided")
+
+// RegisterDevice registers the push token of the user's device, the notifications of normal
+// and high priority are then pushed to it.
+func RegisterDevice(ctx context.Context, user *models.User, platform, token, name string) (*models.DeviceToken, error) {
+	if token == "" || len(token) > 255 || (platform != notify.PlatformFCM && platform != notify.PlatformAPNs) {
+		return nil, ErrInvalidDevice
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+
+	device := &models.DeviceToken{UserID: user.ID, Platform: platform, Token: token, Name: name}
+	if err := repository.SaveDeviceToken(ctx, device); err != nil {
+		middleware.Logger.Printf("Error saving device token: %s", err)
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// GetDevices lists the devices the user registered for push notifications.
+func GetDevices(ctx context.Context, userID uint) ([]*models.DeviceToken, error) {
+	devices, err := repository.GetDeviceTokensByUser(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching devices: %s", err)
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// DeleteDevice unregisters one of the user's devices, reporting false when not found.
+func DeleteDevice(ctx context.Context, userID uint, deviceID string) (bool, error) {
+	found, err := repository.DeleteDeviceToken(ctx, userID, deviceID)
+	if err != nil {
+		middleware.Logger.Printf("Error deleting device: %s", err)
+		return false, err
+	}
+
+	return found, nil
+}
@@ -0,0 +1,222 @@
+// services/directorySync.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+const userSyncJob = "user_sync"
+
+// SyncedUser is the copy of a user pushed to the external directories, without credentials.
+type SyncedUser struct {
+	ID       uint          `json:"id"`
+	FullName string        `json:"fullName"`
+	Username string        `json:"username"`
+	Status   models.Status `json:"status"`
+	Role     models.Role   `json:"role"`
+}
+
+// UserChange is a user creation, update or deletion to replicate.
+type UserChange struct {
+	Operation        string     `json:"operation"`
+	User             SyncedUser `json:"user"`
+	PreviousUsername string     `json:"previousUsername,omitempty"` // set on updates renaming the user
+}
+
+// SyncAdapter pushes user changes to an external directory or CRM. A failing
+// SyncUser is retried through the job queue.
+type SyncAdapter interface {
+	Name() string
+	SyncUser(ctx context.Context, change *UserChange) error
+}
+
+var (
+	syncAdaptersMu sync.RWMutex
+	syncAdapters   = map[string]SyncAdapter{}
+)
+
+// RegisterSyncAdapter adds an adapter notified of every user creation, update and deletion.
+func RegisterSyncAdapter(a SyncAdapter) {
+	syncAdaptersMu.Lock()
+	defer syncAdaptersMu.Unlock()
+	syncAdapters[a.Name()] = a
+}
+
+// InitSyncAdapters registers the adapters enabled with DIRECTORY_SYNC_<ADAPTER>_ENABLED
+// and the job replaying the changes.
+func InitSyncAdapters() {
+	jobs.Register(userSyncJob, runUserSync)
+
+	if initializers.GetEnvBool("DIRECTORY_SYNC_HTTP_ENABLED", false) {
+		RegisterSyncAdapter(&HTTPSyncAdapter{
+			URL:    initializers.GetEnv("DIRECTORY_SYNC_HTTP_URL", ""),
+			Client: &http.Client{Timeout: initializers.GetEnvDuration("DIRECTORY_SYNC_HTTP_TIMEOUT", 5*time.Second)},
+		})
+	}
+
+	if initializers.GetEnvBool("DIRECTORY_SYNC_LDAP_ENABLED", false) {
+		RegisterSyncAdapter(&LDAPSyncAdapter{
+			URL:          initializers.GetEnv("DIRECTORY_SYNC_LDAP_URL", ""),
+			BindDN:       initializers.GetEnv("DIRECTORY_SYNC_LDAP_BIND_DN", ""),
+			BindPassword: initializers.GetEnv("DIRECTORY_SYNC_LDAP_BIND_PASSWORD", ""),
+			BaseDN:       initializers.GetEnv("DIRECTORY_SYNC_LDAP_BASE_DN", ""),
+		})
+	}
+}
+
+// enqueueUserSync queues one job per adapter, so every adapter retries on its own.
+// The change is already saved, a queueing error is only logged.
+func enqueueUserSync(ctx context.Context, operation string, user *models.User, previousUsername string) {
+	syncAdaptersMu.RLock()
+	defer syncAdaptersMu.RUnlock()
+
+	change := UserChange{
+		Operation: operation,
+		User: SyncedUser{
+			ID:       user.ID,
+			FullName: user.FullName,
+			Username: user.Username,
+			Status:   user.Status,
+			Role:     user.Role,
+		},
+	}
+	if previousUsername != user.Username {
+		change.PreviousUsername = previousUsername
+	}
+
+	for name := range syncAdapters {
+		payload := map[string]interface{}{"adapter": name, "change": change}
+		if err := jobs.Enqueue(ctx, userSyncJob, payload); err != nil {
+			middleware.Logger.Printf("Error queueing %s sync of user %d: %s", name, user.ID, err)
+		}
+	}
+}
+
+func runUserSync(ctx context.Context, payload []byte) error {
+	var job struct {
+		Adapter string     `json:"adapter"`
+		Change  UserChange `json:"change"`
+	}
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+
+	syncAdaptersMu.RLock()
+	adapter, ok := syncAdapters[job.Adapter]
+	syncAdaptersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("sync adapter %s is not enabled", job.Adapter)
+	}
+
+	return adapter.SyncUser(ctx, &job.Change)
+}
+
+// HTTPSyncAdapter posts every change as JSON to an external service, any non 2xx status is retried.
+type HTTPSyncAdapter struct {
+	URL    string
+	Client *http.Client
+}
+
+func (a *HTTPSyncAdapter) Name() string { return "http" }
+
+func (a *HTTPSyncAdapter) SyncUser(ctx context.Context, change *UserChange) error {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("directory sync answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// LDAPSyncAdapter keeps an inetOrgPerson entry uid=<username>,<BaseDN> for every user.
+type LDAPSyncAdapter struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+}
+
+func (a *LDAPSyncAdapter) Name() string { return "ldap" }
+
+func (a *LDAPSyncAdapter) dn(username string) string {
+	return "uid=" + ldap.EscapeDN(username) + "," + a.BaseDN
+}
+
+func (a *LDAPSyncAdapter) SyncUser(ctx context.Context, change *UserChange) error {
+	conn, err := ldap.DialURL(a.URL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(a.BindDN, a.BindPassword); err != nil {
+		return err
+	}
+
+	user := change.User
+	switch change.Operation {
+	case OperationCreate:
+		add := ldap.NewAddRequest(a.dn(user.Username), nil)
+		add.Attribute("objectClass", []string{"inetOrgPerson"})
+		add.Attribute("uid", []string{user.Username})
+		add.Attribute("cn", []string{user.FullName})
+		add.Attribute("sn", []string{user.FullName})
+		add.Attribute("employeeType", []string{string(user.Role)})
+		return ignoreLDAPResult(conn.Add(add), ldap.LDAPResultEntryAlreadyExists)
+
+	case OperationUpdate:
+		if change.PreviousUsername != "" {
+			rename := ldap.NewModifyDNRequest(a.dn(change.PreviousUsername), "uid="+ldap.EscapeDN(user.Username), true, "")
+			if err := conn.ModifyDN(rename); err != nil {
+				return err
+			}
+		}
+		modify := ldap.NewModifyRequest(a.dn(user.Username), nil)
+		modify.Replace("cn", []string{user.FullName})
+		modify.Replace("sn", []string{user.FullName})
+		modify.Replace("employeeType", []string{string(user.Role)})
+		return conn.Modify(modify)
+
+	case OperationDelete:
+		return ignoreLDAPResult(conn.Del(ldap.NewDelRequest(a.dn(user.Username), nil)), ldap.LDAPResultNoSuchObject)
+	}
+
+	return fmt.Errorf("unknown operation %s", change.Operation)
+}
+
+// ignoreLDAPResult treats the given result code as a success, so retried jobs are idempotent.
+func ignoreLDAPResult(err error, code uint16) error {
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) && ldapErr.ResultCode == code {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,311 @@
+// services/doctor.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/migrate"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+// the directory the profile pictures are uploaded to
+const uploadsDir = "src/public/uploads"
+
+// DoctorFinding is a problem found by an integrity check, Fixed when it was repaired.
+type DoctorFinding struct {
+	Check   string `json:"check"`
+	Subject string `json:"subject"` // the file, row or key at fault
+	Problem string `json:"problem"`
+	Fixed   bool   `json:"fixed"`
+}
+
+// an integrity check, repairing what it safely can when fix is set
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context, fix bool) ([]DoctorFinding, error)
+}
+
+var doctorChecks = []doctorCheck{
+	{"orphaned_avatars", checkOrphanedAvatars},
+	{"invalid_enums", checkInvalidEnums},
+	{"missing_indexes", checkMissingIndexes},
+	{"user_cache", checkUserCache},
+	{"dangling_tokens", checkDanglingTokens},
+}
+
+// RunDoctor checks the schema and data integrity and returns the findings. With fix the safe
+// repairs are made: unreferenced avatars deleted, missing indexes created, stale cache entries
+// evicted and dangling tokens deleted. The invalid enum values, which need a decision, are
+// only reported. A check that fails is reported as a finding, the others still run.
+func RunDoctor(ctx context.Context, fix bool) []DoctorFinding {
+	var findings []DoctorFinding
+	for _, check := range doctorChecks {
+		found, err := check.run(ctx, fix)
+		for i := range found {
+			found[i].Check = check.name
+		}
+		findings = append(findings, found...)
+		if err != nil {
+			middleware.Logger.Printf("Error running the %s check: %s", check.name, err)
+			findings = append(findings, DoctorFinding{Check: check.name, Problem: "the check failed: " + err.Error()})
+		}
+	}
+	return findings
+}
+
+// checkOrphanedAvatars reports the uploaded files no user references, deleted with fix, and
+// the users whose profile picture is missing
+func checkOrphanedAvatars(ctx context.Context, fix bool) ([]DoctorFinding, error) {
+	pictures, err := repository.GetProfilePictures(ctx)
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	for _, picture := range pictures {
+		referenced[picture] = true
+	}
+
+	entries, err := os.ReadDir(uploadsDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	files := map[string]bool{}
+	var findings []DoctorFinding
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		files[entry.Name()] = true
+		if referenced[entry.Name()] {
+			continue
+		}
+
+		finding := DoctorFinding{Subject: filepath.Join(uploadsDir, entry.Name()), Problem: "no user references the file"}
+		if fix {
+			if err := os.Remove(finding.Subject); err != nil {
+				return findings, err
+			}
+			finding.Fixed = true
+		}
+		findings = append(findings, finding)
+	}
+
+	for _, picture := range pictures {
+		if !files[picture] {
+			findings = append(findings, DoctorFinding{Subject: "profile picture " + picture, Problem: "referenced by a user, the file is missing"})
+		}
+	}
+	return findings, nil
+}
+
+// checkInvalidEnums reports the users with a status or a role the application doesn't know
+func checkInvalidEnums(ctx context.Context, fix bool) ([]DoctorFinding, error) {
+	users, err := repository.GetUsersWithInvalidEnums(ctx, models.Statuses)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []DoctorFinding
+	for _, user := range users {
+		finding := DoctorFinding{Subject: fmt.Sprintf("user %d", user.ID)}
+		if !models.Status(user.Status).IsValid() {
+			finding.Problem = fmt.Sprintf("invalid status %q", user.Status)
+		} else {
+			finding.Problem = fmt.Sprintf("role %q is not in the roles table", user.Role)
+		}
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
+
+// checkMissingIndexes reports the indexes of the models missing from the database, created with fix
+func checkMissingIndexes(ctx context.Context, fix bool) ([]DoctorFinding, error) {
+	db := initializers.DB.WithContext(ctx)
+
+	var findings []DoctorFinding
+	for _, model := range migrate.Models() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return findings, err
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if db.Migrator().HasIndex(model, index.Name) {
+				continue
+			}
+
+			finding := DoctorFinding{Subject: stmt.Schema.Table + "." + index.Name, Problem: "the index is missing"}
+			if fix {
+				if err := db.Migrator().CreateIndex(model, index.Name); err != nil {
+					return findings, err
+				}
+				finding.Fixed = true
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// checkUserCache reports the cached users that differ from the database, evicted with fix
+func checkUserCache(ctx context.Context, fix bool) ([]DoctorFinding, error) {
+	var findings []DoctorFinding
+	iter := initializers.RedisClient.Scan(ctx, 0, userCachePrefix+"[0-9]*", 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		fields, err := cachedUserDrift(ctx, strings.TrimPrefix(key, userCachePrefix))
+		if err != nil {
+			return findings, err
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		finding := DoctorFinding{Subject: key, Problem: "stale cache entry, differs on " + strings.Join(fields, ", ")}
+		if fix {
+			invalidateUserCache(ctx, strings.TrimPrefix(key, userCachePrefix))
+			finding.Fixed = true
+		}
+		findings = append(findings, finding)
+	}
+	return findings, iter.Err()
+}
+
+// the user fields updated without evicting the cached user, by design
+var uncachedUserFields = map[string]bool{"last_seen_at": true, "online": true}
+
+// cachedUserDrift returns the fields the cached user differs on from the database, none when
+// the user isn't cached. A user deleted since it was cached differs on "deleted_at".
+func cachedUserDrift(ctx context.Context, userID string) ([]string, error) {
+	cached, err := initializers.RedisClient.Get(ctx, userCachePrefix+userID).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := repository.GetUserByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []string{"deleted_at"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cachedUser, err := models.DeserializeUser(cached)
+	if err != nil {
+		return []string{"the whole entry, it can't be decoded"}, nil
+	}
+	from, err := userFieldMap(cachedUser)
+	if err != nil {
+		return nil, err
+	}
+	to, err := userFieldMap(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	for field, value := range to {
+		if !uncachedUserFields[field] && !reflect.DeepEqual(from[field], value) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// the tables of the tokens and credentials of the users
+var tokenRecords = []struct {
+	table string
+	model interface{}
+}{
+	{"sessions", &models.Session{}},
+	{"api_keys", &models.APIKey{}},
+	{"device_tokens", &models.DeviceToken{}},
+}
+
+// checkDanglingTokens reports the tokens of users purged from the database and the refresh
+// tokens of revoked or missing sessions, deleted with fix
+func checkDanglingTokens(ctx context.Context, fix bool) ([]DoctorFinding, error) {
+	var findings []DoctorFinding
+	for _, records := range tokenRecords {
+		count, err := repository.CountOrphanedRecords(ctx, records.model)
+		if err != nil {
+			return findings, err
+		}
+		if count == 0 {
+			continue
+		}
+
+		finding := DoctorFinding{Subject: records.table, Problem: fmt.Sprintf("%d rows belong to users that no longer exist", count)}
+		if fix {
+			if _, err := repository.DeleteOrphanedRecords(ctx, records.model); err != nil {
+				return findings, err
+			}
+			finding.Fixed = true
+		}
+		findings = append(findings, finding)
+	}
+
+	iter := initializers.RedisClient.Scan(ctx, 0, refreshTokenPrefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.HasPrefix(key, rotatedRefreshTokenPrefix) {
+			continue
+		}
+		problem, err := danglingRefreshToken(ctx, key)
+		if err != nil {
+			return findings, err
+		}
+		if problem == "" {
+			continue
+		}
+
+		finding := DoctorFinding{Subject: key, Problem: problem}
+		if fix {
+			if err := initializers.RedisClient.Del(ctx, key).Err(); err != nil {
+				return findings, err
+			}
+			finding.Fixed = true
+		}
+		findings = append(findings, finding)
+	}
+	return findings, iter.Err()
+}
+
+// danglingRefreshToken returns why the refresh token can't be used anymore, empty when it can
+func danglingRefreshToken(ctx context.Context, key string) (string, error) {
+	sessionID, err := initializers.RedisClient.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil // used meanwhile
+	}
+	if err != nil {
+		return "", err
+	}
+
+	session, err := repository.GetSessionByID(ctx, sessionID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return "the refresh token points to session " + sessionID + ", which no longer exists", nil
+	case err != nil:
+		return "", err
+	case session.RevokedAt != nil:
+		return "the refresh token belongs to the revoked session " + sessionID, nil
+	case refreshTokenPrefix+session.RefreshTokenHash != key:
+		return "the refresh token was replaced in session " + sessionID, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,85 @@
+// services/entitlements.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidEntitlement wraps the validation errors of GrantEntitlement.
+var ErrInvalidEntitlement = errors.New("invalid entitlement")
+
+var featureNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+
+// GrantEntitlement grants the feature to the user with the ID or to the role, one of them,
+// until expiresAt when set. Granting it again replaces the expiry.
+func GrantEntitlement(ctx context.Context, feature string, userID uint, role models.Role, expiresAt *time.Time, grantedBy uint) (*models.Entitlement, error) {
+	if !featureNameRegex.MatchString(feature) {
+		return nil, fmt.Errorf("%w: the feature must be 1 to 64 lowercase letters, digits, ., - or _", ErrInvalidEntitlement)
+	}
+	if (userID == 0) == (role == "") {
+		return nil, fmt.Errorf("%w: either user_id or role must be set", ErrInvalidEntitlement)
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidEntitlement)
+	}
+	if userID != 0 {
+		if _, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(userID), 10)); errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: there is no user %d", ErrInvalidEntitlement, userID)
+		} else if err != nil {
+			middleware.Logger.Printf("Error fetching user by ID: %s", err)
+			return nil, err
+		}
+	}
+	if role != "" {
+		if _, err := models.ParseRole(string(role)); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidEntitlement, err)
+		}
+	}
+
+	entitlement := &models.Entitlement{Feature: feature, UserID: userID, Role: role, ExpiresAt: expiresAt, GrantedBy: grantedBy}
+	if err := repository.SaveEntitlement(ctx, entitlement); err != nil {
+		middleware.Logger.Printf("Error saving entitlement: %s", err)
+		return nil, err
+	}
+	return entitlement, nil
+}
+
+// GetEntitlements lists the grants, of the feature when set.
+func GetEntitlements(ctx context.Context, feature string) ([]*models.Entitlement, error) {
+	entitlements, err := repository.GetEntitlements(ctx, feature)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving entitlements: %s", err)
+		return nil, err
+	}
+	return entitlements, nil
+}
+
+// RevokeEntitlement deletes the grant with the ID, false when there was none.
+func RevokeEntitlement(ctx context.Context, id string) (bool, error) {
+	deleted, err := repository.DeleteEntitlement(ctx, id)
+	if err != nil {
+		middleware.Logger.Printf("Error deleting entitlement: %s", err)
+		return false, err
+	}
+	return deleted, nil
+}
+
+// GetUserFeatures lists the features the user is entitled to, for the frontends to show them.
+func GetUserFeatures(ctx context.Context, user *models.User) ([]string, error) {
+	features, err := repository.GetUserFeatures(ctx, user)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving entitlements: %s", err)
+		return nil, err
+	}
+	return features, nil
+}
@@ -0,0 +1,67 @@
+// services/impersonation.go
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCannotImpersonate is returned when an admin tries to impersonate themselves.
+	ErrCannotImpersonate = errors.New("cannot impersonate yourself")
+	// ErrImpersonationForbidden is returned when the target is the break-glass account, or its
+	// role grants a permission the admin lacks.
+	ErrImpersonationForbidden = errors.New("not allowed to impersonate this user")
+)
+
+// ImpersonateUser mints an access token acting as the target user for IMPERSONATION_TTL
+// (15 minutes by default). The token carries the impersonated_by claim and can't be refreshed.
+// It returns nil when the user is not found.
+func ImpersonateUser(ctx context.Context, admin *models.User, targetID string) (*utils.AccessToken, *models.User, error) {
+	target, err := repository.GetUserByID(ctx, targetID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil // User not found
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user by ID: %s", err)
+		return nil, nil, err
+	}
+
+	if target.ID == admin.ID {
+		return nil, nil, ErrCannotImpersonate
+	}
+
+	// Impersonating can't give the admin more than their own permissions
+	if target.BreakGlass {
+		return nil, nil, ErrImpersonationForbidden
+	}
+	escalation, err := middleware.IsEscalation(ctx, admin.Role, target.Role)
+	if err != nil {
+		middleware.Logger.Printf("Error comparing the permissions of %s and %s: %s", admin.Role, target.Role, err)
+		return nil, nil, err
+	}
+	if escalation {
+		return nil, nil, ErrImpersonationForbidden
+	}
+
+	token, err := utils.GenerateJWTToken(target, utils.TokenOptions{
+		TTL:            initializers.GetEnvDuration("IMPERSONATION_TTL", 15*time.Minute),
+		ImpersonatedBy: admin.ID,
+	})
+	if err != nil {
+		middleware.Logger.Printf("Error generating impersonation token: %s", err)
+		return nil, nil, errors.New("failed to generate JWT token")
+	}
+
+	middleware.Logger.Printf("Admin %s impersonating user %s", admin.Username, target.Username)
+
+	return token, target, nil
+}
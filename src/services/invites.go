@@ -0,0 +1,94 @@
+// services/invites.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/notify"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+var (
+	// ErrInvalidInviteRequest wraps the validation errors of CreateInvite.
+	ErrInvalidInviteRequest = errors.New("invalid invite request")
+	// ErrInvalidInvite is returned for unknown, used or expired invites, and invites of another email.
+	ErrInvalidInvite = errors.New("invalid or expired invite")
+)
+
+// CreateInvite invites the owner of the email to register with the role. The token is
+// emailed and returned, only its hash is stored, and it expires after INVITE_TTL (7 days
+// by default). The email links to INVITE_URL followed by the token when configured.
+func CreateInvite(ctx context.Context, email string, role models.Role, admin *models.User) (*models.Invite, string, error) {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return nil, "", fmt.Errorf("%w: invalid email address", ErrInvalidInviteRequest)
+	}
+	if _, err := models.ParseRole(string(role)); err != nil {
+		return nil, "", err
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		middleware.Logger.Printf("Error generating invite token: %s", err)
+		return nil, "", err
+	}
+
+	ttl := initializers.GetEnvDuration("INVITE_TTL", 7*24*time.Hour)
+	invite := &models.Invite{
+		Email:       email,
+		Role:        role,
+		TokenHash:   utils.HashToken(token),
+		CreatedByID: admin.ID,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := repository.CreateInvite(ctx, invite); err != nil {
+		middleware.Logger.Printf("Error saving invite: %s", err)
+		return nil, "", err
+	}
+
+	// The invite stays usable when the email fails, the admin has the token
+	body := fmt.Sprintf("You have been invited to register, the invite expires in %s.\n\nInvite token: %s", ttl, token)
+	if inviteURL := initializers.GetEnv("INVITE_URL", ""); inviteURL != "" {
+		body = fmt.Sprintf("You have been invited to register, open this link within %s:\n\n%s", ttl, inviteURL+url.QueryEscape(token))
+	}
+	if err := notify.DefaultMailer().Send(&notify.Message{To: []string{email}, Subject: "Your invitation", Body: body}); err != nil {
+		middleware.Logger.Printf("Error sending invite to %s: %s", email, err)
+	}
+
+	return invite, token, nil
+}
+
+// GetAllInvites lists the invites, used and expired ones included.
+func GetAllInvites(ctx context.Context) ([]*models.Invite, error) {
+	invites, err := repository.GetAllInvites(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving invites: %s", err)
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// findInvite returns the usable invite of the token, which must have been sent to email.
+func findInvite(ctx context.Context, token, email string) (*models.Invite, error) {
+	if token == "" {
+		return nil, ErrInvalidInvite
+	}
+
+	invite, err := repository.GetInviteByTokenHash(ctx, utils.HashToken(token))
+	if err != nil || !invite.Usable() || !strings.EqualFold(invite.Email, email) {
+		return nil, ErrInvalidInvite
+	}
+
+	return invite, nil
+}
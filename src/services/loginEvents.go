@@ -0,0 +1,82 @@
+// services/loginEvents.go
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// Login methods recorded in the login history
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodMagicLink = "magic_link"
+	loginMethodOAuth     = "oauth:" // followed by the provider name
+)
+
+// recordLogin adds an attempt to the login history with the client of the request, loginErr
+// being nil for a successful login. Failures are linked to the user the username belongs to,
+// so users can see the attempts on their account. Errors are logged, never returned: the
+// history must not make logins fail.
+func recordLogin(ctx context.Context, method, username string, user *models.User, loginErr error) {
+	client := middleware.ClientFromContext(ctx)
+	if len(client.UserAgent) > 255 {
+		client.UserAgent = client.UserAgent[:255]
+	}
+	if len(username) > 191 {
+		username = username[:191]
+	}
+
+	event := &models.LoginEvent{
+		Username:  username,
+		Method:    method,
+		Outcome:   models.LoginSucceeded,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}
+	if loginErr != nil {
+		event.Outcome = models.LoginFailed
+		event.Reason = loginFailureReason(loginErr)
+		if user == nil && username != "" {
+			user, _ = repository.GetUserByUsername(ctx, username)
+		}
+	}
+	if user != nil {
+		event.UserID = &user.ID
+		event.Username = user.Username
+	}
+
+	if err := repository.CreateLoginEvent(ctx, event); err != nil {
+		middleware.Logger.Printf("Error recording login event: %s", err)
+	}
+}
+
+func loginFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, ErrInvalidMagicLink):
+		return "invalid_link"
+	case errors.Is(err, ErrInvalidCode):
+		return "invalid_code"
+	case errors.Is(err, ErrAccountInactive):
+		return "inactive"
+	case errors.Is(err, ErrPasswordHashingBusy):
+		return "busy"
+	}
+	return "error"
+}
+
+// GetLoginEvents lists the login history matching the filter, most recent first, with the total count.
+func GetLoginEvents(ctx context.Context, filter repository.LoginEventFilter, page, perPage int) ([]*models.LoginEvent, int64, error) {
+	events, total, err := repository.GetLoginEvents(ctx, filter, perPage, (page-1)*perPage)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching login events: %s", err)
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
@@ -0,0 +1,110 @@
+// services/magicLink.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/notify"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+const magicLinkPrefix = "magic_link:"
+
+// ErrInvalidMagicLink is returned for unknown, used or expired magic link tokens.
+var ErrInvalidMagicLink = errors.New("invalid or expired magic link")
+
+// ErrMagicLinkNotConfigured is returned when neither MAGIC_LINK_URL nor PUBLIC_BASE_URL is set.
+var ErrMagicLinkNotConfigured = errors.New("magic links are not configured")
+
+// magicLinkURL returns the link the token is appended to: MAGIC_LINK_URL, or the verify page
+// of PUBLIC_BASE_URL. It is never built from the request, whose Host the client chooses.
+func magicLinkURL() (string, error) {
+	if link := initializers.GetEnv("MAGIC_LINK_URL", ""); link != "" {
+		return link, nil
+	}
+	if baseURL := strings.TrimRight(initializers.GetEnv("PUBLIC_BASE_URL", ""), "/"); baseURL != "" {
+		return baseURL + "/login/magic/verify?token=", nil
+	}
+	return "", ErrMagicLinkNotConfigured
+}
+
+// SendMagicLink sends the user a single-use login link through the notifier. The link is
+// MAGIC_LINK_URL, or the verify page of PUBLIC_BASE_URL, followed by the token. Unknown
+// usernames are ignored so the endpoint can't be used to find accounts.
+func SendMagicLink(ctx context.Context, username string) error {
+	if username == "" {
+		return errors.New("username must be provided")
+	}
+
+	linkURL, err := magicLinkURL()
+	if err != nil {
+		return err
+	}
+
+	user, err := repository.GetUserByUsername(ctx, username)
+	if err != nil || user == nil {
+		middleware.Logger.Printf("Magic link requested for unknown user %s", username)
+		return nil
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		middleware.Logger.Printf("Error generating magic link token: %s", err)
+		return err
+	}
+
+	// Only the hash of the token is stored, it expires after MAGIC_LINK_TTL
+	ttl := initializers.GetEnvDuration("MAGIC_LINK_TTL", 10*time.Minute)
+	key := magicLinkPrefix + utils.HashToken(token)
+	err = initializers.RedisClient.Set(ctx, key, strconv.FormatUint(uint64(user.ID), 10), ttl).Err()
+	if err != nil {
+		middleware.Logger.Printf("Error storing magic link token: %s", err)
+		return err
+	}
+
+	link := linkURL + url.QueryEscape(token)
+	body := fmt.Sprintf("Open this link to log in, it expires in %s and can only be used once:\n\n%s", ttl, link)
+
+	if err := notify.DefaultNotifier().Notify(user, "Your login link", body); err != nil {
+		middleware.Logger.Printf("Error sending magic link: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// VerifyMagicLink consumes the magic link token and logs the user in.
+func VerifyMagicLink(ctx context.Context, token string) (*AuthTokens, error) {
+	if token == "" {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// GETDEL makes the token single-use
+	userID, err := initializers.RedisClient.GetDel(ctx, magicLinkPrefix+utils.HashToken(token)).Result()
+	if err == redis.Nil {
+		recordLogin(ctx, LoginMethodMagicLink, "", nil, ErrInvalidMagicLink)
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching magic link token: %s", err)
+		return nil, err
+	}
+
+	user, err := repository.GetUserByID(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user for magic link: %s", err)
+		return nil, ErrInvalidMagicLink
+	}
+
+	return completeLogin(ctx, LoginMethodMagicLink, user, false)
+}
@@ -0,0 +1,339 @@
+// services/notifications.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/notify"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/scheduler"
+)
+
+const notificationJob = "notification_delivery"
+
+// notification channels delivered through the job queue, the in-app inbox is the table itself
+const (
+	channelEmail   = "email"
+	channelWebhook = "webhook"
+	channelSMS     = "sms"
+	channelPush    = "push"
+)
+
+// ErrInvalidPreference wraps the validation errors of UpdateNotificationPreference.
+var ErrInvalidPreference = errors.New("invalid notification preference")
+
+// InitNotifications registers the jobs delivering the notifications and the broadcasts.
+func InitNotifications() {
+	jobs.Register(notificationJob, runNotificationDelivery)
+	jobs.Register(broadcastJob, runBroadcast)
+}
+
+// NotifyUser notifies the user on the channels of their preferences. Low priority notifications
+// wait for the daily digest when the user wants one, and during the quiet hours the email and
+// webhook deliveries are postponed to their end unless the priority is high. Only high priority
+// notifications are texted, to users with a verified phone, and low priority ones aren't pushed
+// to the user's devices.
+func NotifyUser(ctx context.Context, user *models.User, subject, body, priority string) error {
+	return notifyUser(ctx, user, subject, body, priority, nil)
+}
+
+// notifyUser notifies the user, for the broadcast when broadcastID is set.
+func notifyUser(ctx context.Context, user *models.User, subject, body, priority string, broadcastID *uint) error {
+	preference, err := repository.GetNotificationPreference(ctx, user.ID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching notification preferences of user %d: %s", user.ID, err)
+		return err
+	}
+
+	notification := &models.Notification{
+		UserID:        user.ID,
+		Subject:       subject,
+		Body:          body,
+		Priority:      priority,
+		InApp:         preference.InApp,
+		DigestPending: priority == models.PriorityLow && preference.Digest && preference.Email,
+		BroadcastID:   broadcastID,
+	}
+	if err := repository.CreateNotification(ctx, notification); err != nil {
+		middleware.Logger.Printf("Error saving notification: %s", err)
+		return err
+	}
+
+	var channels []string
+	if preference.Email && !notification.DigestPending {
+		channels = append(channels, channelEmail)
+	}
+	if preference.Webhook && preference.WebhookURL != "" {
+		channels = append(channels, channelWebhook)
+	}
+	if preference.SMS && priority == models.PriorityHigh && user.Phone != "" {
+		channels = append(channels, channelSMS)
+	}
+
+	payloads := make([]map[string]interface{}, 0, len(channels))
+	for _, channel := range channels {
+		payloads = append(payloads, map[string]interface{}{"notification_id": notification.ID, "channel": channel})
+	}
+	// one delivery per device, so a failing device doesn't push the others again on retry
+	if preference.Push && priority != models.PriorityLow {
+		devices, err := repository.GetDeviceTokensByUser(ctx, user.ID)
+		if err != nil {
+			middleware.Logger.Printf("Error fetching the devices of user %d: %s", user.ID, err)
+		}
+		for _, device := range devices {
+			payloads = append(payloads, map[string]interface{}{"notification_id": notification.ID, "channel": channelPush, "device_id": device.ID})
+		}
+	}
+
+	quietUntil, quiet := preference.QuietUntil(time.Now())
+	for _, payload := range payloads {
+		if quiet && priority != models.PriorityHigh {
+			err = jobs.EnqueueAt(ctx, notificationJob, payload, quietUntil)
+		} else {
+			err = jobs.Enqueue(ctx, notificationJob, payload)
+		}
+		if err != nil {
+			middleware.Logger.Printf("Error queueing %s notification %d: %s", payload["channel"], notification.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// runNotificationDelivery delivers a notification on one channel, a failure is retried.
+func runNotificationDelivery(ctx context.Context, payload []byte) error {
+	var job struct {
+		NotificationID uint   `json:"notification_id"`
+		Channel        string `json:"channel"`
+		DeviceID       uint   `json:"device_id"` // push deliveries only
+	}
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+
+	notification, err := repository.GetNotificationByID(ctx, job.NotificationID)
+	if err != nil {
+		return err
+	}
+	user, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(notification.UserID), 10))
+	if err != nil {
+		return err
+	}
+	// the preferences may have changed while the delivery waited for the quiet hours to end
+	preference, err := repository.GetNotificationPreference(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	delivered, err := deliverNotification(ctx, job.Channel, job.DeviceID, user, preference, notification)
+	if notification.BroadcastID != nil && (delivered || err != nil) {
+		failed := 0
+		if err != nil {
+			failed = 1
+		}
+		if err := repository.IncrementBroadcastStat(ctx, *notification.BroadcastID, job.Channel, 1-failed, failed); err != nil {
+			middleware.Logger.Printf("Error counting the delivery of broadcast %d: %s", *notification.BroadcastID, err)
+		}
+	}
+	return err
+}
+
+// deliverNotification delivers the notification on the channel, reporting false when the
+// preferences don't (or don't anymore) ask for it.
+func deliverNotification(ctx context.Context, channel string, deviceID uint, user *models.User, preference *models.NotificationPreference, notification *models.Notification) (bool, error) {
+	switch channel {
+	case channelEmail:
+		if !preference.Email {
+			return false, nil
+		}
+		return true, notify.DefaultNotifier().Notify(user, notification.Subject, notification.Body)
+	case channelWebhook:
+		if !preference.Webhook || preference.WebhookURL == "" {
+			return false, nil
+		}
+		return true, notify.PostWebhook(ctx, preference.WebhookURL, map[string]interface{}{
+			"id":         notification.ID,
+			"subject":    notification.Subject,
+			"body":       notification.Body,
+			"priority":   notification.Priority,
+			"created_at": notification.CreatedAt,
+		})
+	case channelSMS:
+		if !preference.SMS || user.Phone == "" {
+			return false, nil
+		}
+		return true, notify.DefaultSMSSender().SendSMS(ctx, user.Phone, notification.Subject)
+	case channelPush:
+		return pushNotification(ctx, preference, notification, deviceID)
+	}
+	return false, fmt.Errorf("unknown notification channel %s", channel)
+}
+
+// pushNotification pushes the notification to one of the user's devices, forgetting the device
+// token when the push provider rejects it.
+func pushNotification(ctx context.Context, preference *models.NotificationPreference, notification *models.Notification, deviceID uint) (bool, error) {
+	device, err := repository.GetDeviceTokenByID(ctx, deviceID)
+	if err != nil || device.UserID != notification.UserID || !preference.Push {
+		return false, nil // device removed or registered by another user meanwhile
+	}
+
+	sender := notify.DefaultPushSender(device.Platform)
+	if sender == nil {
+		return false, nil
+	}
+
+	err = sender.Push(ctx, device.Token, notification.Subject, notification.Body, map[string]string{
+		"notification_id": strconv.FormatUint(uint64(notification.ID), 10),
+		"priority":        notification.Priority,
+	})
+	if errors.Is(err, notify.ErrInvalidDeviceToken) {
+		middleware.Logger.Printf("Removing the rejected %s device token %d of user %d", device.Platform, device.ID, device.UserID)
+		return false, repository.DeleteInvalidDeviceToken(ctx, device)
+	}
+	return true, err
+}
+
+// ScheduleNotificationDigest registers the digest of the low priority notifications, sent
+// every NOTIFICATION_DIGEST_INTERVAL (24h by default).
+func ScheduleNotificationDigest() {
+	interval := initializers.GetEnvDuration("NOTIFICATION_DIGEST_INTERVAL", 24*time.Hour)
+	if interval <= 0 {
+		return
+	}
+
+	scheduler.Every("notification-digest", interval, func() error {
+		return SendNotificationDigests(context.Background())
+	})
+}
+
+// SendNotificationDigests batches the pending low priority notifications of each user into one email.
+func SendNotificationDigests(ctx context.Context) error {
+	pending, err := repository.GetPendingDigestNotifications(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching the notifications of the digest: %s", err)
+		return err
+	}
+
+	// the notifications are ordered by user
+	for start := 0; start < len(pending); {
+		end := start
+		for end < len(pending) && pending[end].UserID == pending[start].UserID {
+			end++
+		}
+		if err := sendDigest(ctx, pending[start:end]); err != nil {
+			middleware.Logger.Printf("Error sending the digest of user %d: %s", pending[start].UserID, err)
+		}
+		start = end
+	}
+
+	return nil
+}
+
+func sendDigest(ctx context.Context, notifications []*models.Notification) error {
+	user, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(notifications[0].UserID), 10))
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	ids := make([]uint, len(notifications))
+	for i, notification := range notifications {
+		ids[i] = notification.ID
+		fmt.Fprintf(&body, "%s (%s)\n%s\n\n", notification.Subject, notification.CreatedAt.Format(time.RFC1123), notification.Body)
+	}
+
+	subject := fmt.Sprintf("Your daily digest: %d notifications", len(notifications))
+	if err := notify.DefaultNotifier().Notify(user, subject, body.String()); err != nil {
+		return err
+	}
+
+	return repository.ClearDigestPending(ctx, ids)
+}
+
+// GetNotificationPreference returns the user's notification preferences.
+func GetNotificationPreference(ctx context.Context, userID uint) (*models.NotificationPreference, error) {
+	preference, err := repository.GetNotificationPreference(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching notification preferences: %s", err)
+		return nil, err
+	}
+
+	return preference, nil
+}
+
+// UpdateNotificationPreference validates and saves the user's notification preferences.
+func UpdateNotificationPreference(ctx context.Context, preference *models.NotificationPreference) error {
+	if preference.Timezone == "" {
+		preference.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(preference.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %s", ErrInvalidPreference, preference.Timezone)
+	}
+
+	if (preference.QuietHoursStart == "") != (preference.QuietHoursEnd == "") {
+		return fmt.Errorf("%w: quiet hours need a start and an end", ErrInvalidPreference)
+	}
+	for _, hour := range []string{preference.QuietHoursStart, preference.QuietHoursEnd} {
+		if _, err := time.Parse("15:04", hour); hour != "" && err != nil {
+			return fmt.Errorf("%w: quiet hours must be formatted as HH:MM", ErrInvalidPreference)
+		}
+	}
+
+	if preference.SMS {
+		user, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(preference.UserID), 10))
+		if err != nil {
+			middleware.Logger.Printf("Error fetching user: %s", err)
+			return err
+		}
+		if user.Phone == "" {
+			return fmt.Errorf("%w: SMS alerts need a verified phone number", ErrInvalidPreference)
+		}
+	}
+
+	if preference.Webhook {
+		parsed, err := url.Parse(preference.WebhookURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return fmt.Errorf("%w: the webhook needs an http or https URL", ErrInvalidPreference)
+		}
+	}
+
+	if err := repository.SaveNotificationPreference(ctx, preference); err != nil {
+		middleware.Logger.Printf("Error saving notification preferences: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetInAppNotifications lists the user's inbox, most recent first, with the total count.
+func GetInAppNotifications(ctx context.Context, userID uint, page, perPage int) ([]*models.Notification, int64, error) {
+	notifications, total, err := repository.GetInAppNotifications(ctx, userID, perPage, (page-1)*perPage)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching notifications: %s", err)
+		return nil, 0, err
+	}
+
+	return notifications, total, nil
+}
+
+// MarkNotificationRead marks one of the user's notifications as read, reporting false when not found.
+func MarkNotificationRead(ctx context.Context, userID uint, notificationID string) (bool, error) {
+	found, err := repository.MarkNotificationRead(ctx, userID, notificationID, time.Now())
+	if err != nil {
+		middleware.Logger.Printf("Error marking notification as read: %s", err)
+		return false, err
+	}
+
+	return found, nil
+}
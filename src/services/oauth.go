@@ -0,0 +1,210 @@
+// services/oauth.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const oauthStatePrefix = "oauth_state:"
+
+// ErrUnknownProvider is returned for providers that are not configured.
+var ErrUnknownProvider = errors.New("unknown or unconfigured OAuth provider")
+
+// oauthProfile is the part of the provider profile used to link and create users.
+type oauthProfile struct {
+	ID       string
+	Login    string
+	FullName string
+}
+
+// OAuthLoginURL returns the provider authorization URL, the state is kept in Redis for 10 minutes.
+func OAuthLoginURL(ctx context.Context, providerName string) (string, error) {
+	provider := initializers.GetOAuthProvider(providerName)
+	if provider == nil {
+		return "", ErrUnknownProvider
+	}
+
+	state, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := initializers.RedisClient.Set(ctx, oauthStatePrefix+state, providerName, 10*time.Minute).Err(); err != nil {
+		middleware.Logger.Printf("Error storing OAuth state: %s", err)
+		return "", err
+	}
+
+	return provider.Config.AuthCodeURL(state), nil
+}
+
+// OAuthCallback exchanges the authorization code, finds or creates the linked user and
+// returns the same tokens as the password login.
+func OAuthCallback(ctx context.Context, providerName, code, state string) (*AuthTokens, error) {
+	provider := initializers.GetOAuthProvider(providerName)
+	if provider == nil {
+		return nil, ErrUnknownProvider
+	}
+
+	// The state is single-use and must belong to this provider
+	stateProvider, err := initializers.RedisClient.GetDel(ctx, oauthStatePrefix+state).Result()
+	if err != nil && err != redis.Nil {
+		middleware.Logger.Printf("Error fetching OAuth state: %s", err)
+		return nil, err
+	}
+	if stateProvider != providerName {
+		return nil, errors.New("invalid OAuth state")
+	}
+
+	token, err := provider.Config.Exchange(ctx, code)
+	if err != nil {
+		middleware.Logger.Printf("Error exchanging %s OAuth code: %s", providerName, err)
+		recordLogin(ctx, loginMethodOAuth+providerName, "", nil, err)
+		return nil, errors.New("failed to exchange OAuth code")
+	}
+
+	profile, err := fetchOAuthProfile(ctx, provider, token)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching %s profile: %s", providerName, err)
+		recordLogin(ctx, loginMethodOAuth+providerName, "", nil, err)
+		return nil, errors.New("failed to fetch OAuth profile")
+	}
+
+	// Only an identity never seen creates a user, a deleted one isn't brought back
+	user, err := repository.GetUserByIdentity(ctx, providerName, profile.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user, err = createOAuthUser(ctx, providerName, profile)
+		if err != nil {
+			middleware.Logger.Printf("Error creating user for %s identity: %s", providerName, err)
+			return nil, err
+		}
+	} else if err != nil {
+		middleware.Logger.Printf("Error fetching user of %s identity: %s", providerName, err)
+		recordLogin(ctx, loginMethodOAuth+providerName, "", nil, err)
+		return nil, err
+	}
+
+	return completeLogin(ctx, loginMethodOAuth+providerName, user, false)
+}
+
+// fetchOAuthProfile reads the user profile from the provider user info endpoint.
+func fetchOAuthProfile(ctx context.Context, provider *initializers.OAuthProvider, token *oauth2.Token) (*oauthProfile, error) {
+	client := provider.Config.Client(ctx, token)
+	client.Timeout = 10 * time.Second
+
+	resp, err := client.Get(provider.UserInfoURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("user info endpoint answered with status %d", resp.StatusCode)
+	}
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	profile := &oauthProfile{}
+	switch provider.Name {
+	case "google":
+		profile.ID, _ = data["sub"].(string)
+		profile.FullName, _ = data["name"].(string)
+		email, _ := data["email"].(string)
+		profile.Login, _, _ = strings.Cut(email, "@")
+	case "github":
+		if id, ok := data["id"].(float64); ok {
+			profile.ID = fmt.Sprintf("%.0f", id)
+		}
+		profile.Login, _ = data["login"].(string)
+		profile.FullName, _ = data["name"].(string)
+	}
+
+	if profile.ID == "" {
+		return nil, errors.New("profile has no account ID")
+	}
+	if profile.FullName == "" {
+		profile.FullName = profile.Login
+	}
+
+	return profile, nil
+}
+
+// createOAuthUser creates a local operator linked to the provider account.
+func createOAuthUser(ctx context.Context, providerName string, profile *oauthProfile) (*models.User, error) {
+	username, err := availableUsername(ctx, profile.Login)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account can only log in through the provider until a password is set
+	randomPassword, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := hashPassword(ctx, randomPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		FullName: profile.FullName,
+		Username: username,
+		Password: hashedPassword,
+		Status:   models.Active,
+		Role:     models.Operator,
+	}
+	identity := &models.UserIdentity{Provider: providerName, ProviderID: profile.ID}
+
+	if err := repository.CreateUserWithIdentity(ctx, user, identity); err != nil {
+		return nil, err
+	}
+
+	enqueueUserSync(ctx, OperationCreate, user, "")
+
+	return user, nil
+}
+
+// availableUsername keeps the letters of the provider login (usernames only allow letters)
+// and appends letters until the username is free.
+func availableUsername(ctx context.Context, login string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			return r
+		}
+		return -1
+	}, login)
+	if base == "" {
+		base = "user"
+	}
+
+	username := base
+	for i := 0; i < 26*26; i++ {
+		exists, err := repository.UsernameExists(ctx, username)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return username, nil
+		}
+		username = base + string(rune('a'+i/26)) + string(rune('a'+i%26))
+	}
+
+	return "", errors.New("no username available")
+}
@@ -0,0 +1,95 @@
+// services/passwordBreach.go
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+)
+
+const pwnedRangeCachePrefix = "pwned:"
+
+var pwnedClient = &http.Client{Timeout: 5 * time.Second}
+
+// checkPasswordBreached rejects passwords found in the HaveIBeenPwned database when
+// PASSWORD_BREACH_CHECK is enabled. Only the first 5 characters of the SHA-1 hash are sent
+// (k-anonymity) and the range responses are cached in Redis. The check fails open when
+// the API cannot be reached.
+func checkPasswordBreached(password string) error {
+	if !initializers.GetEnvBool("PASSWORD_BREACH_CHECK", false) {
+		return nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	hashes, err := pwnedRange(prefix)
+	if err != nil {
+		middleware.Logger.Printf("Password breach check unavailable: %s", err)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(hashes))
+	for scanner.Scan() {
+		// each line is "SUFFIX:COUNT", padding entries have a count of 0
+		hashSuffix, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if found && hashSuffix == suffix && count != "0" {
+			return &PolicyError{Reason: "password has appeared in a data breach, please choose another one"}
+		}
+	}
+
+	return nil
+}
+
+// pwnedRange returns the hash suffixes for a prefix, from the cache or the range API.
+func pwnedRange(prefix string) (string, error) {
+	ctx := context.Background()
+	cacheKey := pwnedRangeCachePrefix + prefix
+
+	// the mock server runs without Redis, uncached
+	if initializers.RedisClient != nil {
+		if cached, err := initializers.RedisClient.Get(ctx, cacheKey).Result(); err == nil {
+			return cached, nil
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, initializers.GetEnv("PASSWORD_BREACH_API_URL", "https://api.pwnedpasswords.com/range/")+prefix, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := pwnedClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("range API answered with status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	ttl := initializers.GetEnvDuration("PASSWORD_BREACH_CACHE_TTL", 24*time.Hour)
+	if initializers.RedisClient != nil {
+		if err := initializers.RedisClient.Set(ctx, cacheKey, body, ttl).Err(); err != nil {
+			middleware.Logger.Printf("Error caching password breach range: %s", err)
+		}
+	}
+
+	return string(body), nil
+}
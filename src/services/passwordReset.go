@@ -0,0 +1,156 @@
+// services/passwordReset.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/notify"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+const passwordResetPrefix = "password_reset:"
+
+// ForgotPassword generates a single-use reset token for the user and sends it through the
+// notifier. Unknown usernames are ignored so the endpoint can't be used to find accounts.
+func ForgotPassword(ctx context.Context, username string) error {
+	if username == "" {
+		return errors.New("username must be provided")
+	}
+
+	user, err := repository.GetUserByUsername(ctx, username)
+	if err != nil || user == nil {
+		middleware.Logger.Printf("Password reset requested for unknown user %s", username)
+		return nil
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		middleware.Logger.Printf("Error generating password reset token: %s", err)
+		return err
+	}
+
+	// Only the hash of the token is stored, it expires after PASSWORD_RESET_TTL
+	ttl := initializers.GetEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute)
+	key := passwordResetPrefix + utils.HashToken(token)
+	err = initializers.RedisClient.Set(ctx, key, strconv.FormatUint(uint64(user.ID), 10), ttl).Err()
+	if err != nil {
+		middleware.Logger.Printf("Error storing password reset token: %s", err)
+		return err
+	}
+
+	body := fmt.Sprintf("Use this token to reset your password, it expires in %s:\n\n%s", ttl, token)
+	if resetURL := initializers.GetEnv("PASSWORD_RESET_URL", ""); resetURL != "" {
+		body = fmt.Sprintf("Open this link to reset your password, it expires in %s:\n\n%s%s", ttl, resetURL, token)
+	}
+
+	if err := notify.DefaultNotifier().Notify(user, "Password reset", body); err != nil {
+		middleware.Logger.Printf("Error sending password reset token: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword validates and consumes the reset token and sets the new password. As the
+// account may be recovered from someone else, every session and personal access token of the
+// user is revoked and the user is notified.
+func ResetPassword(ctx context.Context, token, password string) error {
+	if token == "" || password == "" {
+		return errors.New("token and password must be provided")
+	}
+
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	// Hash first so a busy hashing pool doesn't consume the token
+	hashedPassword, err := hashPassword(ctx, password)
+	if err != nil {
+		middleware.Logger.Printf("Error hashing password: %s", err)
+		return err
+	}
+
+	// GETDEL makes the token single-use
+	userID, err := initializers.RedisClient.GetDel(ctx, passwordResetPrefix+utils.HashToken(token)).Result()
+	if err == redis.Nil {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching password reset token: %s", err)
+		return err
+	}
+
+	user, err := repository.GetUserByID(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user for password reset: %s", err)
+		return ErrInvalidResetToken
+	}
+
+	if err := repository.UpdatePassword(ctx, user, hashedPassword); err != nil {
+		middleware.Logger.Printf("Error updating password: %s", err)
+		return err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+
+	if err := revokeOtherSessions(ctx, user.ID, 0); err != nil {
+		return err
+	}
+	if err := revokePersonalTokens(ctx, user.ID); err != nil {
+		return err
+	}
+
+	_ = NotifyUser(ctx, user, "Your password was reset",
+		"The password of your account was reset, all its sessions and personal access tokens were revoked. If you didn't reset it, contact an administrator.", models.PriorityHigh)
+
+	return nil
+}
+
+// ErrInvalidResetToken is returned for unknown, used or expired reset tokens.
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// ErrWrongPassword is returned when the current password doesn't match on a password change.
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// ChangePassword sets a new password after checking the current one, then signs out
+// every other session of the user, the session of the request stays signed in.
+func ChangePassword(ctx context.Context, user *models.User, currentSessionID uint, currentPassword, newPassword string) error {
+	if currentPassword == "" || newPassword == "" {
+		return errors.New("current and new password must be provided")
+	}
+
+	if err := comparePassword(ctx, user.Password, currentPassword); errors.Is(err, ErrPasswordHashingBusy) {
+		return err
+	} else if err != nil {
+		return ErrWrongPassword
+	}
+
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(ctx, newPassword)
+	if err != nil {
+		middleware.Logger.Printf("Error hashing password: %s", err)
+		return err
+	}
+
+	if err := repository.UpdatePassword(ctx, user, hashedPassword); err != nil {
+		middleware.Logger.Printf("Error updating password: %s", err)
+		return err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+
+	_ = NotifyUser(ctx, user, "Your password was changed",
+		"The password of your account was changed and your other sessions were signed out.", models.PriorityHigh)
+
+	return revokeOtherSessions(ctx, user.ID, currentSessionID)
+}
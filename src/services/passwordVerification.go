@@ -0,0 +1,53 @@
+// services/passwordVerification.go
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/nabazesmail/gopher/src/metrics"
+)
+
+// passwordCheck is a bcrypt verification in flight, whose result is shared with identical attempts.
+type passwordCheck struct {
+	done chan struct{}
+	err  error
+}
+
+var (
+	passwordChecksMu sync.Mutex
+	passwordChecks   = map[string]*passwordCheck{}
+)
+
+// verifyPassword compares the password with the bcrypt hash. Concurrent identical attempts
+// (same account hash and same password, e.g. credential stuffing replaying one pair) share
+// a single bcrypt comparison instead of each burning CPU on it.
+func verifyPassword(ctx context.Context, hash, password string) error {
+	// the key never leaves the process, it only identifies the (hash, password) pair
+	sum := sha256.Sum256([]byte(hash + "\x00" + password))
+	key := hex.EncodeToString(sum[:])
+
+	passwordChecksMu.Lock()
+	if check, ok := passwordChecks[key]; ok {
+		passwordChecksMu.Unlock()
+		<-check.done
+
+		metrics.Inc("coalesced_password_checks")
+		return check.err
+	}
+
+	check := &passwordCheck{done: make(chan struct{})}
+	passwordChecks[key] = check
+	passwordChecksMu.Unlock()
+
+	check.err = comparePassword(ctx, hash, password)
+
+	passwordChecksMu.Lock()
+	delete(passwordChecks, key)
+	passwordChecksMu.Unlock()
+	close(check.done)
+
+	return check.err
+}
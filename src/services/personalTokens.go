@@ -0,0 +1,97 @@
+// services/personalTokens.go
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// CreatePersonalToken mints a personal access token for the user. It expires after expiresIn,
+// PERSONAL_TOKEN_TTL (90 days) by default and at most PERSONAL_TOKEN_MAX_TTL (1 year).
+// The plain token is only returned here, only its hash is stored.
+func CreatePersonalToken(ctx context.Context, user *models.User, name string, scopes []string, expiresIn time.Duration) (*models.APIKey, string, error) {
+	if name == "" || len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: name and scopes must be provided", ErrInvalidAPIKeyRequest)
+	}
+
+	if err := validateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	if expiresIn <= 0 {
+		expiresIn = initializers.GetEnvDuration("PERSONAL_TOKEN_TTL", 90*24*time.Hour)
+	}
+	if maxTTL := initializers.GetEnvDuration("PERSONAL_TOKEN_MAX_TTL", 365*24*time.Hour); expiresIn > maxTTL {
+		return nil, "", fmt.Errorf("%w: tokens can't be valid for more than %s", ErrInvalidAPIKeyRequest, maxTTL)
+	}
+	expiresAt := time.Now().Add(expiresIn)
+
+	key := &models.APIKey{
+		Name:        name,
+		Scopes:      strings.Join(scopes, " "),
+		UserID:      user.ID,
+		CreatedByID: user.ID,
+		Personal:    true,
+		ExpiresAt:   &expiresAt,
+	}
+
+	plainToken, err := saveAPIKey(ctx, key, models.PersonalTokenPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_ = NotifyUser(ctx, user, "New personal access token",
+		fmt.Sprintf("The personal access token %q was created for your account.", key.Name), models.PriorityNormal)
+
+	return key, plainToken, nil
+}
+
+// GetPersonalTokens lists the personal access tokens of the user, without their secret part.
+func GetPersonalTokens(ctx context.Context, userID uint) ([]*models.APIKey, error) {
+	keys, err := repository.GetPersonalTokensByUser(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving personal access tokens: %s", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokePersonalToken revokes one of the user's own tokens, it returns nil when the token
+// doesn't exist or belongs to another user.
+func RevokePersonalToken(ctx context.Context, userID uint, tokenID string) (*models.APIKey, error) {
+	key, err := repository.GetAPIKeyByID(ctx, tokenID)
+	if err != nil || !key.Personal || key.UserID != userID {
+		return nil, nil // Token not found
+	}
+
+	if err := revokeAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// revokePersonalTokens revokes every personal access token of the user.
+func revokePersonalTokens(ctx context.Context, userID uint) error {
+	keys, err := repository.GetPersonalTokensByUser(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving personal access tokens: %s", err)
+		return err
+	}
+
+	for _, key := range keys {
+		if err := revokeAPIKey(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+// services/presence.go
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// users seen within PRESENCE_WINDOW (5 minutes by default) are online
+func presenceWindow() time.Duration {
+	return initializers.GetEnvDuration("PRESENCE_WINDOW", 5*time.Minute)
+}
+
+// ApplyOnline sets the Online flag of the given users from their last seen time.
+func ApplyOnline(ctx context.Context, users ...*models.User) {
+	if len(users) == 0 {
+		return
+	}
+
+	members := make([]string, len(users))
+	for i, user := range users {
+		members[i] = strconv.FormatUint(uint64(user.ID), 10)
+	}
+
+	scores, err := initializers.RedisClient.ZMScore(ctx, middleware.PresenceKey, members...).Result()
+	if err != nil {
+		middleware.Logger.Printf("Error fetching presence: %s", err)
+		return
+	}
+
+	since := float64(time.Now().Add(-presenceWindow()).Unix())
+	for i, user := range users {
+		user.Online = scores[i] >= since
+	}
+}
+
+// GetOnlineUsers returns the users seen within the presence window.
+func GetOnlineUsers(ctx context.Context) ([]*models.User, error) {
+	since := time.Now().Add(-presenceWindow()).Unix()
+
+	ids, err := initializers.RedisClient.ZRangeByScore(ctx, middleware.PresenceKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		middleware.Logger.Printf("Error fetching online users: %s", err)
+		return nil, err
+	}
+
+	users, err := repository.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching online users from the database: %s", err)
+		return nil, err
+	}
+
+	for _, user := range users {
+		user.Online = true
+	}
+
+	return users, nil
+}
@@ -0,0 +1,82 @@
+// services/publicProfile.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+const publicProfileCachePrefix = "user:public:"
+
+// PublicProfile is what anyone may know of a user, to show its name and avatar in other
+// products: nothing else of the user is exposed.
+type PublicProfile struct {
+	ID          uint   `json:"id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+// GetPublicProfile returns the public profile of the active user with the ID, nil when there
+// is none. The profiles are cached for PUBLIC_PROFILE_CACHE_TTL (10m by default), the updates
+// of the user drop its cached profile.
+func GetPublicProfile(ctx context.Context, userID string) (*PublicProfile, error) {
+	key := publicProfileCachePrefix + userID
+	if cached, err := initializers.RedisClient.Get(ctx, key).Bytes(); err == nil {
+		var profile PublicProfile
+		if err := json.Unmarshal(cached, &profile); err == nil {
+			return &profile, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		middleware.Logger.Printf("Error fetching public profile from cache: %s", err)
+	}
+
+	user, err := repository.GetUserByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil // User not found
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user by ID: %s", err)
+		return nil, err
+	}
+	if user.Status != models.Active {
+		return nil, nil // the inactive users have no public profile
+	}
+
+	profile := &PublicProfile{ID: user.ID, DisplayName: user.FullName}
+	if user.ProfilePicture != "" {
+		profile.AvatarURL = fmt.Sprintf("/users/%d/public/avatar", user.ID)
+	}
+
+	if data, err := json.Marshal(profile); err == nil {
+		ttl := initializers.GetEnvDuration("PUBLIC_PROFILE_CACHE_TTL", 10*time.Minute)
+		if err := initializers.RedisClient.Set(ctx, key, data, ttl).Err(); err != nil {
+			middleware.Logger.Printf("Error caching public profile: %s", err)
+		}
+	}
+	return profile, nil
+}
+
+// GetPublicAvatar returns the profile picture of the active user with the ID, nil when there
+// is no such user or it has no picture.
+func GetPublicAvatar(ctx context.Context, userID string) ([]byte, error) {
+	profile, err := GetPublicProfile(ctx, userID)
+	if err != nil || profile == nil || profile.AvatarURL == "" {
+		return nil, err
+	}
+	return GetProfilePictureByID(ctx, userID)
+}
+
+// dropping the cached public profile of the user after a change
+func invalidatePublicProfile(ctx context.Context, userID uint) {
+	initializers.RedisClient.Del(ctx, fmt.Sprintf("%s%d", publicProfileCachePrefix, userID))
+}
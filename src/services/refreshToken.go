@@ -0,0 +1,223 @@
+// services/refreshToken.go
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+const (
+	refreshTokenPrefix        = "refresh:"
+	rotatedRefreshTokenPrefix = "refresh:rotated:" // refresh tokens already exchanged, pointing to their session
+)
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again,
+// the session it belongs to is then revoked.
+var ErrRefreshTokenReused = apierrors.New(apierrors.Unauthenticated, "refresh token reused")
+
+// AuthTokens is the token pair handed to clients on login and refresh.
+type AuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64  // access token lifetime in seconds
+	OTPChallenge string // set instead of the tokens when the login waits for the SMS code, ExpiresIn is then the code lifetime
+
+	sessionID uint // session the tokens were issued for
+}
+
+// refresh tokens live for REFRESH_TOKEN_TTL (24 hours by default), or for
+// REMEMBER_ME_REFRESH_TOKEN_TTL (30 days by default) when the user asked to be remembered
+func refreshTokenTTL(rememberMe bool) time.Duration {
+	if rememberMe {
+		return initializers.GetEnvDuration("REMEMBER_ME_REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	}
+	return initializers.GetEnvDuration("REFRESH_TOKEN_TTL", 24*time.Hour)
+}
+
+// sessionOptions customize a new session.
+type sessionOptions struct {
+	ClientID   string // oauth client the session is opened for
+	RememberMe bool   // long-lived refresh tokens
+}
+
+// openSession opens a session for the user, on the client of the request, with the given
+// options and returns its first token pair.
+func openSession(ctx context.Context, user *models.User, opts sessionOptions) (*AuthTokens, error) {
+	client := middleware.ClientFromContext(ctx)
+	if len(client.UserAgent) > 255 {
+		client.UserAgent = client.UserAgent[:255]
+	}
+
+	session := &models.Session{
+		UserID:     user.ID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		ClientID:   opts.ClientID,
+		RememberMe: opts.RememberMe,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  time.Now().Add(refreshTokenTTL(opts.RememberMe)),
+	}
+	if err := repository.CreateSession(ctx, session); err != nil {
+		middleware.Logger.Printf("Error creating session: %s", err)
+		return nil, errors.New("failed to create session")
+	}
+
+	return rotateSession(ctx, user, session)
+}
+
+// rotateSession issues a new access token and refresh token for the session, the
+// previous refresh token of the session can't be used anymore.
+func rotateSession(ctx context.Context, user *models.User, session *models.Session) (*AuthTokens, error) {
+	accessToken, err := utils.GenerateJWTToken(user, utils.TokenOptions{SessionID: session.ID})
+	if err != nil {
+		middleware.Logger.Printf("Error generating JWT token: %s", err)
+		return nil, errors.New("failed to generate JWT token")
+	}
+
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		middleware.Logger.Printf("Error generating refresh token: %s", err)
+		return nil, errors.New("failed to generate refresh token")
+	}
+
+	// Only the hash of the refresh token is stored, it points to the session
+	ttl := refreshTokenTTL(session.RememberMe)
+	refreshHash := utils.HashToken(refreshToken)
+	sessionID := strconv.FormatUint(uint64(session.ID), 10)
+	if err := initializers.RedisClient.Set(ctx, refreshTokenPrefix+refreshHash, sessionID, ttl).Err(); err != nil {
+		middleware.Logger.Printf("Error storing refresh token: %s", err)
+		return nil, errors.New("failed to store refresh token")
+	}
+
+	now := time.Now()
+	session.RefreshTokenHash = refreshHash
+	session.AccessTokenID = accessToken.ID
+	session.AccessExpiresAt = accessToken.ExpiresAt
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(ttl)
+	if err := repository.UpdateSession(ctx, session); err != nil {
+		middleware.Logger.Printf("Error updating session: %s", err)
+		return nil, errors.New("failed to update session")
+	}
+
+	return &AuthTokens{
+		AccessToken:  accessToken.Token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(time.Until(accessToken.ExpiresAt).Seconds()),
+		sessionID:    session.ID,
+	}, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new token pair. The used refresh token
+// is deleted, so every refresh token can be used only once (rotation), and using it again
+// revokes the session (ErrRefreshTokenReused). The refresh tokens of the oauth clients are
+// refused, they are only refreshed by the token endpoint of their client.
+func RefreshTokens(ctx context.Context, refreshToken string) (*AuthTokens, error) {
+	return refreshSession(ctx, refreshToken, "")
+}
+
+// refreshSession rotates the session of the refresh token, which must be bound to the
+// oauth client clientID, or to none when empty.
+func refreshSession(ctx context.Context, refreshToken, clientID string) (*AuthTokens, error) {
+	if refreshToken == "" {
+		return nil, errors.New("refresh token must be provided")
+	}
+
+	refreshHash := utils.HashToken(refreshToken)
+	sessionID, err := initializers.RedisClient.GetDel(ctx, refreshTokenPrefix+refreshHash).Result()
+	if err == redis.Nil {
+		return nil, detectRefreshTokenReuse(ctx, refreshHash)
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching refresh token: %s", err)
+		return nil, err
+	}
+
+	session, err := repository.GetSessionByID(ctx, sessionID)
+	if err != nil || session.RevokedAt != nil || session.ClientID != clientID {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	// Remember the token for as long as it would have been valid, to detect its reuse
+	if err := initializers.RedisClient.Set(ctx, rotatedRefreshTokenPrefix+refreshHash, sessionID, refreshTokenTTL(session.RememberMe)).Err(); err != nil {
+		middleware.Logger.Printf("Error storing rotated refresh token: %s", err)
+	}
+
+	user, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(session.UserID), 10))
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user for refresh token: %s", err)
+		return nil, errors.New("invalid refresh token")
+	}
+
+	return rotateSession(ctx, user, session)
+}
+
+// detectRefreshTokenReuse checks whether the unknown refresh token was already rotated. A rotated
+// token presented again was stolen, or its legitimate client is the one replaying it: either way
+// the whole session (the token family) is revoked so both must log in again.
+func detectRefreshTokenReuse(ctx context.Context, refreshHash string) error {
+	sessionID, err := initializers.RedisClient.Get(ctx, rotatedRefreshTokenPrefix+refreshHash).Result()
+	if err == redis.Nil {
+		return errors.New("invalid refresh token")
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching rotated refresh token: %s", err)
+		return err
+	}
+
+	session, err := repository.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		return errors.New("invalid refresh token")
+	}
+
+	client := middleware.ClientFromContext(ctx)
+	middleware.Logger.Printf("Refresh token reuse on session %d of user %d from %s, revoking the session", session.ID, session.UserID, client.IP)
+	metrics.Inc("refresh_token_reuse_total")
+
+	entry := &models.AuditLog{
+		Action:   "refresh_token_reuse",
+		ActorID:  &session.UserID,
+		TargetID: sessionID,
+		IP:       client.IP,
+		Details:  "a rotated refresh token was presented again, the session was revoked",
+	}
+	if err := repository.CreateAuditLog(ctx, entry); err != nil {
+		middleware.Logger.Printf("Error writing audit log: %s", err)
+	}
+
+	if err := revokeSession(ctx, session); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// RevokeToken blacklists the access token identified by jti until it expires,
+// and deletes the refresh token when one is provided. Used for tokens without session.
+func RevokeToken(ctx context.Context, jti string, expiresAt time.Time, refreshToken string) error {
+	if ttl := time.Until(expiresAt); jti != "" && ttl > 0 {
+		if err := initializers.RedisClient.Set(ctx, utils.RevokedTokenPrefix+jti, "1", ttl).Err(); err != nil {
+			middleware.Logger.Printf("Error revoking token: %s", err)
+			return err
+		}
+	}
+
+	if refreshToken != "" {
+		if err := initializers.RedisClient.Del(ctx, refreshTokenPrefix+utils.HashToken(refreshToken)).Err(); err != nil {
+			middleware.Logger.Printf("Error deleting refresh token: %s", err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+// services/requestValidation.go
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// ValidationError lists the fields of a request breaking the rules of their validate tags,
+// answered with a 422 and the fields for the clients to show next to each input.
+type ValidationError struct {
+	Fields []dto.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return "invalid request: " + strings.Join(messages, "; ")
+}
+
+// Unwrap makes the error an apierrors.ErrValidation detailing the fields.
+func (e *ValidationError) Unwrap() error {
+	details := make([]interface{}, len(e.Fields))
+	for i, field := range e.Fields {
+		details[i] = field
+	}
+	return apierrors.New(apierrors.ValidationFailed, e.Error(), details...)
+}
+
+// the rules of the validate tags checked by the services, their error is the message of the field
+var customRules = map[string]func(value interface{}) error{
+	"username": func(value interface{}) error {
+		return LoadUsernamePolicy().Check(value.(string))
+	},
+	"email_address": func(value interface{}) error {
+		_, err := normalizeEmail(value.(string))
+		return err
+	},
+	"phone": func(value interface{}) error {
+		_, err := normalizePhone(value.(string))
+		return err
+	},
+	"metadata": func(value interface{}) error {
+		_, err := normalizeMetadata(value.(models.Metadata))
+		return err
+	},
+	"status": func(value interface{}) error {
+		_, err := models.ParseStatus(string(value.(models.Status)))
+		return err
+	},
+	"role": func(value interface{}) error {
+		_, err := models.ParseRole(string(value.(models.Role)))
+		return err
+	},
+}
+
+var (
+	requestValidator     *validator.Validate
+	requestValidatorOnce sync.Once
+)
+
+// getRequestValidator returns the validator of the requests, naming the fields by their JSON
+// names, with the custom rules registered
+func getRequestValidator() *validator.Validate {
+	requestValidatorOnce.Do(func() {
+		v := validator.New()
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		for tag, check := range customRules {
+			check := check
+			if err := v.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+				return check(fl.Field().Interface()) == nil
+			}); err != nil {
+				panic(fmt.Sprintf("registering the %s validation: %s", tag, err))
+			}
+		}
+		requestValidator = v
+	})
+	return requestValidator
+}
+
+// ValidateRequest checks the request against its validate tags, returning a *ValidationError
+// with every field breaking a rule.
+func ValidateRequest(request interface{}) error {
+	err := getRequestValidator().Struct(request)
+	if err == nil {
+		return nil
+	}
+	violations, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	fields := make([]dto.FieldError, 0, len(violations))
+	for _, violation := range violations {
+		fields = append(fields, dto.FieldError{
+			Field:   violation.Field(),
+			Rule:    violation.Tag(),
+			Message: fieldMessage(violation),
+		})
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// fieldMessage describes the rule the field breaks, the error of the check for the custom rules
+func fieldMessage(violation validator.FieldError) string {
+	if check, ok := customRules[violation.Tag()]; ok {
+		if err := check(violation.Value()); err != nil {
+			return err.Error()
+		}
+	}
+	switch violation.Tag() {
+	case "required":
+		return violation.Field() + " is required"
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters long", violation.Field(), violation.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters long", violation.Field(), violation.Param())
+	}
+	return fmt.Sprintf("%s breaks the %s rule", violation.Field(), violation.Tag())
+}
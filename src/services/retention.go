@@ -0,0 +1,176 @@
+// services/retention.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/scheduler"
+)
+
+// retentionPolicy keeps the rows of a data category for RETENTION_<CATEGORY>_DAYS, 0 keeps
+// them forever. The rows of the users under legal hold (userColumn) are always kept. The
+// categories with load and restore can be archived before being purged.
+type retentionPolicy struct {
+	category   string
+	env        string
+	model      interface{}
+	userColumn string
+	load       func(ctx context.Context, ids []string) ([]interface{}, error)
+	restore    func(ctx context.Context, decoder *json.Decoder) (int64, error)
+}
+
+var retentionPolicies = []retentionPolicy{
+	{
+		category: "audit_logs", env: "RETENTION_AUDIT_LOGS_DAYS", model: &models.AuditLog{}, userColumn: "actor_id",
+		load: func(ctx context.Context, ids []string) ([]interface{}, error) {
+			logs, err := repository.GetAuditLogsByIDs(ctx, ids)
+			rows := make([]interface{}, len(logs))
+			for i, entry := range logs {
+				rows[i] = entry
+			}
+			return rows, err
+		},
+		restore: func(ctx context.Context, decoder *json.Decoder) (int64, error) {
+			var logs []*models.AuditLog
+			for decoder.More() {
+				var entry models.AuditLog
+				if err := decoder.Decode(&entry); err != nil {
+					return 0, err
+				}
+				logs = append(logs, &entry)
+			}
+			if len(logs) == 0 {
+				return 0, nil
+			}
+			return repository.RestoreRows(ctx, &logs)
+		},
+	},
+	{
+		category: "login_events", env: "RETENTION_LOGIN_EVENTS_DAYS", model: &models.LoginEvent{}, userColumn: "user_id",
+		load: func(ctx context.Context, ids []string) ([]interface{}, error) {
+			events, err := repository.GetLoginEventsByIDs(ctx, ids)
+			rows := make([]interface{}, len(events))
+			for i, event := range events {
+				rows[i] = event
+			}
+			return rows, err
+		},
+		restore: func(ctx context.Context, decoder *json.Decoder) (int64, error) {
+			var events []*models.LoginEvent
+			for decoder.More() {
+				var event models.LoginEvent
+				if err := decoder.Decode(&event); err != nil {
+					return 0, err
+				}
+				events = append(events, &event)
+			}
+			if len(events) == 0 {
+				return 0, nil
+			}
+			return repository.RestoreRows(ctx, &events)
+		},
+	},
+	{category: "notifications", env: "RETENTION_NOTIFICATIONS_DAYS", model: &models.Notification{}, userColumn: "user_id"},
+}
+
+func (p retentionPolicy) window() time.Duration {
+	return time.Duration(initializers.GetEnvInt(p.env, 0)) * 24 * time.Hour
+}
+
+// PurgeExpiredData deletes the rows older than the retention window of their category, in
+// batches of RETENTION_PURGE_BATCH_SIZE (1000). It returns the purged row counts by category,
+// also counted in the retention_purged_rows_total metric.
+func PurgeExpiredData(ctx context.Context) (map[string]int64, error) {
+	batchSize := initializers.GetEnvInt("RETENTION_PURGE_BATCH_SIZE", 1000)
+
+	purged := map[string]int64{}
+	for _, policy := range retentionPolicies {
+		window := policy.window()
+		if window <= 0 {
+			continue
+		}
+
+		before := time.Now().Add(-window)
+		for {
+			ids, err := repository.GetExpiredRowIDs(ctx, policy.model, policy.userColumn, before, batchSize)
+			if err != nil {
+				middleware.Logger.Printf("Error fetching expired %s: %s", policy.category, err)
+				return purged, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+
+			// The rows are only deleted once archived
+			if archiveEnabled() && policy.load != nil {
+				if err := archiveRows(ctx, policy, ids); err != nil {
+					middleware.Logger.Printf("Error archiving expired %s: %s", policy.category, err)
+					return purged, err
+				}
+			}
+
+			deleted, err := repository.DeleteRowsByIDs(ctx, policy.model, ids)
+			if err != nil {
+				middleware.Logger.Printf("Error purging expired %s: %s", policy.category, err)
+				return purged, err
+			}
+			purged[policy.category] += deleted
+			metrics.Add("retention_purged_rows_total", deleted, policy.category)
+
+			if len(ids) < batchSize {
+				break
+			}
+		}
+
+		if purged[policy.category] > 0 {
+			middleware.Logger.Printf("Purged %d %s past their retention window", purged[policy.category], policy.category)
+		}
+	}
+
+	return purged, nil
+}
+
+// ScheduleRetentionPurge registers the purge, run every RETENTION_PURGE_INTERVAL (24h by
+// default), when a retention window is configured.
+func ScheduleRetentionPurge() {
+	interval := initializers.GetEnvDuration("RETENTION_PURGE_INTERVAL", 24*time.Hour)
+	if interval <= 0 {
+		return
+	}
+
+	for _, policy := range retentionPolicies {
+		if policy.window() > 0 {
+			scheduler.Every("retention-purge", interval, func() error {
+				_, err := PurgeExpiredData(context.Background())
+				return err
+			})
+			return
+		}
+	}
+}
+
+// SetLegalHold places the user under legal hold or lifts it, nil when not found. Under legal
+// hold the retention purge keeps the user's history and a requested account deletion waits.
+func SetLegalHold(ctx context.Context, userID string, hold bool) (*models.User, error) {
+	user, err := repository.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, nil // User not found
+	}
+
+	if err := repository.UpdateLegalHold(ctx, user, hold); err != nil {
+		middleware.Logger.Printf("Error updating the legal hold of user %d: %s", user.ID, err)
+		return nil, err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+	user.LegalHold = hold
+
+	return user, nil
+}
@@ -0,0 +1,163 @@
+// services/roles.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+var (
+	// ErrInvalidRole wraps the validation errors of CreateRole and UpdateRole.
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrRoleExists is returned when creating a role with the name of an existing one.
+	ErrRoleExists = errors.New("role already exists")
+	// ErrBuiltInRole is returned when deleting a built-in role or changing the admin role.
+	ErrBuiltInRole = errors.New("built-in role can't be changed")
+	// ErrRoleInUse is returned when deleting a role some users still have.
+	ErrRoleInUse = errors.New("role is assigned to users")
+)
+
+var roleNameRegex = regexp.MustCompile("^[a-z][a-z0-9_-]{1,31}$")
+
+// LoadRoles loads the roles and their permissions from the database.
+func LoadRoles(ctx context.Context) error {
+	return middleware.LoadPermissions(ctx)
+}
+
+// GetAllRoles lists the roles with their permissions.
+func GetAllRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	roles, err := repository.GetAllRoles(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving roles: %s", err)
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetAllPermissions lists the permissions roles can grant.
+func GetAllPermissions(ctx context.Context) ([]*models.Permission, error) {
+	permissions, err := repository.GetAllPermissions(ctx)
+	if err != nil {
+		middleware.Logger.Printf("Error retrieving permissions: %s", err)
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// CreateRole defines a custom role granting the permissions.
+func CreateRole(ctx context.Context, name, description string, permissionNames []string) (*models.RoleDefinition, error) {
+	if !roleNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("%w: the name must be 2 to 32 lowercase letters, digits, - or _", ErrInvalidRole)
+	}
+	if _, err := repository.GetRoleByName(ctx, name); err == nil {
+		return nil, ErrRoleExists
+	}
+
+	permissions, err := findPermissions(ctx, permissionNames)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &models.RoleDefinition{Name: name, Description: description, Permissions: permissions}
+	if err := repository.CreateRole(ctx, role); err != nil {
+		middleware.Logger.Printf("Error saving role: %s", err)
+		return nil, err
+	}
+
+	reloadRoles(ctx)
+	return role, nil
+}
+
+// UpdateRole replaces the description and the permissions of a role. The admin role always
+// grants every permission, it can't be changed.
+func UpdateRole(ctx context.Context, name, description string, permissionNames []string) (*models.RoleDefinition, error) {
+	role, err := repository.GetRoleByName(ctx, name)
+	if err != nil {
+		return nil, nil // Role not found
+	}
+	if role.Name == string(models.Admin) {
+		return nil, ErrBuiltInRole
+	}
+
+	permissions, err := findPermissions(ctx, permissionNames)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Description = description
+	if err := repository.UpdateRole(ctx, role, permissions); err != nil {
+		middleware.Logger.Printf("Error updating role: %s", err)
+		return nil, err
+	}
+
+	reloadRoles(ctx)
+	return role, nil
+}
+
+// DeleteRole deletes a custom role no user has anymore.
+func DeleteRole(ctx context.Context, name string) (*models.RoleDefinition, error) {
+	role, err := repository.GetRoleByName(ctx, name)
+	if err != nil {
+		return nil, nil // Role not found
+	}
+	if role.BuiltIn {
+		return nil, ErrBuiltInRole
+	}
+
+	users, err := repository.CountUsersWithRole(ctx, role.Name)
+	if err != nil {
+		middleware.Logger.Printf("Error counting users with role %s: %s", role.Name, err)
+		return nil, err
+	}
+	if users > 0 {
+		return nil, ErrRoleInUse
+	}
+
+	if err := repository.DeleteRole(ctx, role); err != nil {
+		middleware.Logger.Printf("Error deleting role: %s", err)
+		return nil, err
+	}
+
+	reloadRoles(ctx)
+	return role, nil
+}
+
+// findPermissions returns the permissions of the names, all of which must exist.
+func findPermissions(ctx context.Context, names []string) ([]models.Permission, error) {
+	if len(names) == 0 {
+		return []models.Permission{}, nil
+	}
+
+	permissions, err := repository.GetPermissionsByName(ctx, names)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching permissions: %s", err)
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		found[p.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, fmt.Errorf("%w: unknown permission %s", ErrInvalidRole, name)
+		}
+	}
+
+	return permissions, nil
+}
+
+// reloadRoles applies a change on this instance right away, the others pick it up with the cache TTL.
+func reloadRoles(ctx context.Context) {
+	if err := middleware.LoadPermissions(ctx); err != nil {
+		middleware.Logger.Printf("Error reloading role permissions: %s", err)
+	}
+}
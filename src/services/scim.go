@@ -0,0 +1,214 @@
+// services/scim.go
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// users provisioned by the identity provider are linked to its userName with an identity of this provider
+const scimProvider = "scim"
+
+var (
+	// ErrInvalidProvisioning is returned for provisioning requests without userName.
+	ErrInvalidProvisioning = errors.New("userName must be provided")
+	// ErrAlreadyProvisioned is returned when provisioning a userName twice.
+	ErrAlreadyProvisioned = errors.New("a user with this userName is already provisioned")
+)
+
+// ProvisionedUser is a user managed by the identity provider, known there by UserName.
+type ProvisionedUser struct {
+	User     *models.User
+	UserName string
+	identity *models.UserIdentity
+}
+
+// ProvisioningChanges are the attributes the identity provider changes, nil ones are kept.
+type ProvisioningChanges struct {
+	UserName *string
+	FullName *string
+	Active   *bool
+}
+
+// ProvisionUser creates the user known as userName by the identity provider. Its username
+// keeps the letters of the userName, the role is SCIM_DEFAULT_ROLE (operator by default), and
+// it can only log in without password (identity provider, magic link) until one is set.
+func ProvisionUser(ctx context.Context, userName, fullName string, active bool) (*ProvisionedUser, error) {
+	if userName == "" {
+		return nil, ErrInvalidProvisioning
+	}
+	if _, err := repository.GetUserByIdentity(ctx, scimProvider, userName); err == nil {
+		return nil, ErrAlreadyProvisioned
+	}
+
+	role, err := models.ParseRole(initializers.GetEnv("SCIM_DEFAULT_ROLE", string(models.Operator)))
+	if err != nil {
+		return nil, err
+	}
+
+	username, err := availableUsername(ctx, strings.SplitN(userName, "@", 2)[0])
+	if err != nil {
+		return nil, err
+	}
+
+	randomPassword, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := hashPassword(ctx, randomPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if fullName == "" {
+		fullName = userName
+	}
+	user := &models.User{
+		FullName: fullName,
+		Username: username,
+		Password: hashedPassword,
+		Status:   models.Active,
+		Role:     role,
+	}
+	if !active {
+		user.Status = models.Inactive
+	}
+
+	if err := runUserValidators(OperationCreate, user); err != nil {
+		return nil, err
+	}
+
+	identity := &models.UserIdentity{Provider: scimProvider, ProviderID: userName}
+	if err := repository.CreateUserWithIdentity(ctx, user, identity); err != nil {
+		middleware.Logger.Printf("Error saving provisioned user %s: %s", userName, err)
+		return nil, err
+	}
+
+	enqueueUserSync(ctx, OperationCreate, user, "")
+
+	return &ProvisionedUser{User: user, UserName: userName, identity: identity}, nil
+}
+
+// GetProvisionedUser returns the provisioned user of the ID, nil when not found or not provisioned.
+func GetProvisionedUser(ctx context.Context, userID string) (*ProvisionedUser, error) {
+	id, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	identity, err := repository.GetIdentityByUser(ctx, scimProvider, uint(id))
+	if err != nil {
+		return nil, nil // User not provisioned
+	}
+	user, err := repository.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, nil // User not found
+	}
+
+	return &ProvisionedUser{User: user, UserName: identity.ProviderID, identity: identity}, nil
+}
+
+// FindProvisionedUsers lists the provisioned users, only the one of userName when set, with the total count.
+func FindProvisionedUsers(ctx context.Context, userName string, offset, limit int) ([]*ProvisionedUser, int64, error) {
+	identities, total, err := repository.GetIdentitiesByProvider(ctx, scimProvider, userName, limit, offset)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching provisioned users: %s", err)
+		return nil, 0, err
+	}
+
+	userIDs := make([]string, len(identities))
+	for i, identity := range identities {
+		userIDs[i] = strconv.FormatUint(uint64(identity.UserID), 10)
+	}
+	users, err := repository.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching provisioned users: %s", err)
+		return nil, 0, err
+	}
+
+	byID := make(map[uint]*models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	provisioned := make([]*ProvisionedUser, 0, len(identities))
+	for _, identity := range identities {
+		if user, ok := byID[identity.UserID]; ok {
+			provisioned = append(provisioned, &ProvisionedUser{User: user, UserName: identity.ProviderID, identity: identity})
+		}
+	}
+
+	return provisioned, total, nil
+}
+
+// UpdateProvisionedUser applies the changes of the identity provider. Deactivating the user
+// signs out all its sessions.
+func UpdateProvisionedUser(ctx context.Context, provisioned *ProvisionedUser, changes ProvisioningChanges) error {
+	user := provisioned.User
+
+	if changes.UserName != nil && *changes.UserName != provisioned.UserName {
+		if *changes.UserName == "" {
+			return ErrInvalidProvisioning
+		}
+		if _, err := repository.GetUserByIdentity(ctx, scimProvider, *changes.UserName); err == nil {
+			return ErrAlreadyProvisioned
+		}
+		if err := repository.UpdateIdentityProviderID(ctx, provisioned.identity, *changes.UserName); err != nil {
+			middleware.Logger.Printf("Error updating provisioned userName: %s", err)
+			return err
+		}
+		provisioned.UserName = *changes.UserName
+	}
+
+	if changes.FullName != nil && *changes.FullName != "" {
+		user.FullName = *changes.FullName
+	}
+	deactivated := false
+	if changes.Active != nil {
+		status := models.Inactive
+		if *changes.Active {
+			status = models.Active
+		}
+		deactivated = status == models.Inactive && user.Status != models.Inactive
+		user.Status = status
+	}
+
+	if err := runUserValidators(OperationUpdate, user); err != nil {
+		return err
+	}
+	if err := repository.UpdateUser(ctx, user); err != nil {
+		middleware.Logger.Printf("Error updating provisioned user: %s", err)
+		return err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+	invalidatePublicProfile(ctx, user.ID)
+
+	enqueueUserSync(ctx, OperationUpdate, user, user.Username)
+
+	if deactivated {
+		return revokeOtherSessions(ctx, user.ID, 0)
+	}
+	return nil
+}
+
+// DeprovisionUser deletes the provisioned user, its userName can then be provisioned again.
+func DeprovisionUser(ctx context.Context, provisioned *ProvisionedUser) error {
+	if err := repository.DeleteIdentity(ctx, provisioned.identity); err != nil {
+		middleware.Logger.Printf("Error deleting provisioned identity: %s", err)
+		return err
+	}
+
+	// a user deleted meanwhile is deprovisioned with its identity
+	err := DeleteUserByID(ctx, strconv.FormatUint(uint64(provisioned.User.ID), 10))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	return err
+}
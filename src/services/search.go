@@ -0,0 +1,166 @@
+// services/search.go
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/search"
+)
+
+// SearchGroup is a typed, paginated group of search results.
+type SearchGroup struct {
+	Type    string      `json:"type"`
+	Total   int64       `json:"total"`
+	Exact   bool        `json:"total_exact"` // false when the total comes from the count cache
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Items   interface{} `json:"items"`
+}
+
+// AdminSearch searches users, audit logs and active sessions, returning one result group per type.
+func AdminSearch(ctx context.Context, query string, page, perPage int) ([]SearchGroup, error) {
+	if query == "" {
+		return nil, errors.New("search query must be provided")
+	}
+
+	users, err := SearchUsers(ctx, query, page, perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	auditLogs, err := SearchAuditLogs(ctx, query, page, perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := (page - 1) * perPage
+	sessions, sessionsTotal, err := repository.SearchSessions(ctx, query, perPage, offset)
+	if err != nil {
+		middleware.Logger.Printf("Error searching sessions: %s", err)
+		return nil, err
+	}
+
+	return []SearchGroup{
+		*users,
+		*auditLogs,
+		{Type: "sessions", Total: sessionsTotal, Exact: true, Page: page, PerPage: perPage, Items: sessions},
+	}, nil
+}
+
+// SearchUsers searches users by full name or username, in the search index when SEARCH_URL
+// is set, otherwise (or when the index cannot be reached) in the database.
+func SearchUsers(ctx context.Context, query string, page, perPage int) (*SearchGroup, error) {
+	offset := (page - 1) * perPage
+
+	users, count, err := searchIndexedUsers(ctx, query, perPage, offset)
+	if err != nil || users == nil {
+		users, count, err = repository.SearchUsers(ctx, query, perPage, offset)
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error searching users: %s", err)
+		return nil, err
+	}
+
+	ApplyOnline(ctx, users...)
+	userItems := make([]dto.UserSummary, 0, len(users))
+	for _, u := range users {
+		userItems = append(userItems, dto.UserSummary{
+			ID:       u.ID,
+			FullName: u.FullName,
+			Username: u.Username,
+			Status:   string(u.Status),
+			Role:     string(u.Role),
+			Online:   u.Online,
+		})
+	}
+
+	return &SearchGroup{Type: "users", Total: count.Total, Exact: count.Exact, Page: page, PerPage: perPage, Items: userItems}, nil
+}
+
+// searchIndexedUsers returns nil users when search is disabled or failed.
+func searchIndexedUsers(ctx context.Context, query string, limit, offset int) ([]*models.User, repository.Count, error) {
+	client := search.Default()
+	if client == nil {
+		return nil, repository.Count{}, nil
+	}
+
+	ids, total, err := client.Search(ctx, search.UsersIndex, query, []string{"full_name", "username"}, limit, offset)
+	if err != nil {
+		middleware.Logger.Printf("Error searching the users index, falling back to the database: %s", err)
+		return nil, repository.Count{}, nil
+	}
+
+	found, err := repository.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, repository.Count{}, err
+	}
+
+	// keep the relevance order, the users deleted meanwhile are skipped
+	byID := make(map[string]*models.User, len(found))
+	for _, user := range found {
+		byID[strconv.FormatUint(uint64(user.ID), 10)] = user
+	}
+	users := make([]*models.User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			users = append(users, user)
+		}
+	}
+
+	return users, repository.Count{Total: total, Exact: true}, nil
+}
+
+// SearchAuditLogs searches audit logs by action, target, ip or details, in the search index
+// when SEARCH_URL is set, otherwise (or when the index cannot be reached) in the database.
+func SearchAuditLogs(ctx context.Context, query string, page, perPage int) (*SearchGroup, error) {
+	offset := (page - 1) * perPage
+
+	logs, total, err := searchIndexedAuditLogs(ctx, query, perPage, offset)
+	if err != nil || logs == nil {
+		logs, total, err = repository.SearchAuditLogs(ctx, query, perPage, offset)
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error searching audit logs: %s", err)
+		return nil, err
+	}
+
+	return &SearchGroup{Type: "audit_logs", Total: total, Exact: true, Page: page, PerPage: perPage, Items: logs}, nil
+}
+
+// searchIndexedAuditLogs returns nil logs when search is disabled or failed.
+func searchIndexedAuditLogs(ctx context.Context, query string, limit, offset int) ([]*models.AuditLog, int64, error) {
+	client := search.Default()
+	if client == nil {
+		return nil, 0, nil
+	}
+
+	ids, total, err := client.Search(ctx, search.AuditLogsIndex, query, []string{"action", "target_id", "ip", "details"}, limit, offset)
+	if err != nil {
+		middleware.Logger.Printf("Error searching the audit logs index, falling back to the database: %s", err)
+		return nil, 0, nil
+	}
+
+	found, err := repository.GetAuditLogsByIDs(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	byID := make(map[string]*models.AuditLog, len(found))
+	for _, entry := range found {
+		byID[strconv.FormatUint(uint64(entry.ID), 10)] = entry
+	}
+	logs := make([]*models.AuditLog, 0, len(ids))
+	for _, id := range ids {
+		if entry, ok := byID[id]; ok {
+			logs = append(logs, entry)
+		}
+	}
+
+	return logs, total, nil
+}
@@ -0,0 +1,128 @@
+// services/searchIndex.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/nabazesmail/gopher/src/jobs"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/search"
+)
+
+// the number of rows read and indexed at once by a reindex
+const reindexBatchSize = 500
+
+// InitSearchIndex mirrors the users and the audit logs into the search cluster when
+// SEARCH_URL is set: the user changes go through the directory sync (as the "search"
+// adapter) and every audit log entry is queued by the audit middleware.
+func InitSearchIndex() {
+	if !search.Enabled() {
+		return
+	}
+
+	RegisterSyncAdapter(searchIndexAdapter{})
+	jobs.Register(search.AuditLogJob, runAuditLogIndex)
+}
+
+// searchIndexAdapter keeps the user documents of the search index in sync.
+type searchIndexAdapter struct{}
+
+func (searchIndexAdapter) Name() string { return "search" }
+
+func (searchIndexAdapter) SyncUser(ctx context.Context, change *UserChange) error {
+	id := strconv.FormatUint(uint64(change.User.ID), 10)
+	if change.Operation == OperationDelete {
+		return search.Default().Delete(ctx, search.UsersIndex, id)
+	}
+	return search.Default().Index(ctx, search.UsersIndex, search.Document{ID: id, Source: userDocument(change.User)})
+}
+
+func userDocument(user SyncedUser) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        user.ID,
+		"full_name": user.FullName,
+		"username":  user.Username,
+		"status":    user.Status,
+		"role":      user.Role,
+	}
+}
+
+func auditLogDocument(entry *models.AuditLog) search.Document {
+	return search.Document{ID: strconv.FormatUint(uint64(entry.ID), 10), Source: entry}
+}
+
+func runAuditLogIndex(ctx context.Context, payload []byte) error {
+	var entry models.AuditLog
+	if err := json.Unmarshal(payload, &entry); err != nil {
+		return err
+	}
+
+	return search.Default().Index(ctx, search.AuditLogsIndex, auditLogDocument(&entry))
+}
+
+// ReindexSearch rebuilds the user and audit log indexes from the database, to fill them
+// the first time or after changes missed by the mirroring.
+func ReindexSearch(ctx context.Context) error {
+	client := search.Default()
+	if client == nil {
+		return fmt.Errorf("search is disabled, SEARCH_URL must be set")
+	}
+
+	if err := client.DeleteIndex(ctx, search.UsersIndex); err != nil {
+		return err
+	}
+	indexed := 0
+	for afterID := uint(0); ; {
+		users, err := repository.GetUsersAfter(ctx, afterID, reindexBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		docs := make([]search.Document, len(users))
+		for i, user := range users {
+			synced := SyncedUser{ID: user.ID, FullName: user.FullName, Username: user.Username, Status: user.Status, Role: user.Role}
+			docs[i] = search.Document{ID: strconv.FormatUint(uint64(user.ID), 10), Source: userDocument(synced)}
+		}
+		if err := client.BulkIndex(ctx, search.UsersIndex, docs); err != nil {
+			return err
+		}
+		indexed += len(users)
+		afterID = users[len(users)-1].ID
+	}
+	middleware.Logger.Printf("Reindexed %d users", indexed)
+
+	if err := client.DeleteIndex(ctx, search.AuditLogsIndex); err != nil {
+		return err
+	}
+	indexed = 0
+	for afterID := uint(0); ; {
+		logs, err := repository.GetAuditLogsAfter(ctx, afterID, reindexBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			break
+		}
+
+		docs := make([]search.Document, len(logs))
+		for i, entry := range logs {
+			docs[i] = auditLogDocument(entry)
+		}
+		if err := client.BulkIndex(ctx, search.AuditLogsIndex, docs); err != nil {
+			return err
+		}
+		indexed += len(logs)
+		afterID = logs[len(logs)-1].ID
+	}
+	middleware.Logger.Printf("Reindexed %d audit logs", indexed)
+
+	return nil
+}
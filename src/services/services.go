@@ -3,61 +3,74 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
+	"net/mail"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/dto"
 	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
 	"github.com/nabazesmail/gopher/src/middleware"
 	"github.com/nabazesmail/gopher/src/models"
 	"github.com/nabazesmail/gopher/src/repository"
-	"github.com/nabazesmail/gopher/src/utils"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 const (
-	userCachePrefix = "user:"
-	cacheExpiration = 10 * time.Minute // Cache expiration time
+	userCachePrefix            = "user:v2:"             // v2: users cached with the snake_case field names
+	userPreferencesCachePrefix = "user:v2:preferences:" // next to the user entry, evicted with it
+	cacheExpiration            = 10 * time.Minute       // Cache expiration time
 )
 
-// Registering user
-func CreateUser(body *models.User) (*models.User, error) {
-	// Validate the input
-	if body.FullName == "" || body.Username == "" || body.Password == "" {
-		return nil, errors.New("all fields must be provided")
-	}
+// invalidateUserCache evicts the cached user and its preferences, after every write of the user
+// so GET /users/:id never serves a former ETag
+func invalidateUserCache(ctx context.Context, userID string) {
+	initializers.RedisClient.Del(ctx, userCachePrefix+userID, userPreferencesCachePrefix+userID)
+}
 
-	// Validate username using regex (allow only characters)
-	usernameRegex := regexp.MustCompile("^[a-zA-Z]+$")
-	if !usernameRegex.MatchString(body.Username) {
-		middleware.Logger.Printf("username must contain only characters")
-		return nil, errors.New("username must contain only characters")
+// Registering user, with an invite when inviteToken is set or REGISTRATION_REQUIRES_INVITE
+// is enabled: the invite must have been sent to email, it sets the role and is consumed
+func CreateUser(ctx context.Context, body *models.User, inviteToken, email string) (*models.User, error) {
+	var invite *models.Invite
+	if inviteToken != "" || initializers.GetEnvBool("REGISTRATION_REQUIRES_INVITE", false) {
+		var err error
+		if invite, err = findInvite(ctx, inviteToken, email); err != nil {
+			return nil, err
+		}
+		body.Role = invite.Role
+		if body.Status == "" {
+			body.Status = models.Active
+		}
 	}
 
-	if len(body.Password) < 8 || len(body.Password) > 15 {
-		middleware.Logger.Printf("password must be between 8 and 15 characters")
-		return nil, errors.New("password must be between 8 and 15 characters")
+	// Self registrations go through the abuse controls, the invited ones are trusted
+	if invite == nil {
+		if err := checkSignupAbuse(ctx, email); err != nil {
+			return nil, err
+		}
 	}
 
-	// Validate status and role (if provided)
-	if body.Status != models.Active && body.Status != models.Inactive {
-		middleware.Logger.Printf("invalid status value")
-		return nil, errors.New("invalid status value")
+	// The address of the invite or of the signup is the user's email
+	if email != "" {
+		body.Email = &email
 	}
-
-	if body.Role != models.Admin && body.Role != models.Operator {
-		middleware.Logger.Printf("invalid Role value")
-		return nil, errors.New("invalid role value")
+	if err := ValidateNewUser(body); err != nil {
+		return nil, err
 	}
 
 	// Hash the password using bcrypt
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(ctx, body.Password)
 	if err != nil {
 		middleware.Logger.Printf("Error hashing password: %s", err)
 		return nil, err
@@ -67,40 +80,178 @@ func CreateUser(body *models.User) (*models.User, error) {
 	user := &models.User{
 		FullName: body.FullName,
 		Username: body.Username,
-		Password: string(hashedPassword),
+		Email:    body.Email,
+		Phone:    body.Phone,
+		Password: hashedPassword,
 		Status:   body.Status,
 		Role:     body.Role,
+		Metadata: body.Metadata,
 	}
 
-	// Save the user in the database
-	err = repository.CreateUser(user)
+	// Save the user in the database, consuming the invite
+	if invite != nil {
+		err = repository.CreateUserWithInvite(ctx, user, invite)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidInvite // used by a concurrent signup or expired meanwhile
+		}
+	} else {
+		err = repository.CreateUser(ctx, user)
+	}
 	if err != nil {
 		middleware.Logger.Printf("Error saving user in the database: %s", err)
 		return nil, err
 	}
+	if invite == nil {
+		recordSignup(ctx)
+	}
+
+	enqueueUserSync(ctx, OperationCreate, user, "")
+
+	// Let the admin who sent the invite know it was accepted
+	if invite != nil {
+		if admin, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(invite.CreatedByID), 10)); err == nil {
+			_ = NotifyUser(ctx, admin, "Invite accepted",
+				fmt.Sprintf("%s registered as %s with the invite sent to %s.", user.Username, user.Role, invite.Email), models.PriorityLow)
+		}
+	}
 
 	return user, nil
 }
 
-// getting all users
-func GetAllUsers() ([]*models.User, error) {
-	users, err := repository.GetAllUsers()
+// ValidateNewUser checks the fields of a user to create against the validate tags of
+// dto.UserRequest, a *ValidationError listing the fields breaking them, then normalizes its
+// email, phone and metadata and runs the validation hooks
+func ValidateNewUser(body *models.User) error {
+	body.Username = NormalizeUsername(body.Username)
+	if err := ValidateRequest(dto.RequestFromUser(body)); err != nil {
+		middleware.Logger.Printf("%s", err)
+		return err
+	}
+
+	if err := checkPasswordBreached(body.Password); err != nil {
+		return err
+	}
+
+	if body.Email != nil {
+		email, err := normalizeEmail(*body.Email)
+		if err != nil {
+			return err
+		}
+		body.Email = &email
+	}
+
+	// The phone is optional, it is unverified until confirmed by an SMS code
+	if body.Phone != "" {
+		phone, err := normalizePhone(body.Phone)
+		if err != nil {
+			return err
+		}
+		body.Phone = phone
+	}
+
+	metadata, err := normalizeMetadata(body.Metadata)
+	if err != nil {
+		return err
+	}
+	body.Metadata = metadata
+
+	// Run the custom validation hooks
+	return runUserValidators(OperationCreate, body)
+}
+
+// ErrInvalidEmail is returned for an email address that isn't a plain address (user@example.com).
+var ErrInvalidEmail = apierrors.New(apierrors.InvalidRequest, "invalid email address")
+
+// ErrInvalidProfilePicture is returned when a profile picture doesn't name an uploaded file.
+var ErrInvalidProfilePicture = apierrors.New(apierrors.InvalidRequest, "profile_picture must name an uploaded picture")
+
+// uploadPath returns the path of the upload with the name, which must be a plain file name so
+// the path can't leave the uploads directory
+func uploadPath(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return "", ErrInvalidProfilePicture
+	}
+	dir, err := filepath.Abs(uploadsDir)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidProfilePicture
+	}
+	return path, nil
+}
+
+// normalizeEmail checks the email address, returned lowercased so the unique index ignores the case
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(email), nil
+}
+
+// ErrPasswordLength is returned when a password doesn't fit the length policy.
+var ErrPasswordLength = errors.New("password must be between 8 and 15 characters")
+
+// validatePassword checks the password policy on password creation and change
+func validatePassword(password string) error {
+	if len(password) < 8 || len(password) > 15 {
+		middleware.Logger.Printf("password must be between 8 and 15 characters")
+		return ErrPasswordLength
+	}
+
+	return checkPasswordBreached(password)
+}
+
+// StreamUsers hands the users matching the filter to fn by batches of 100, as they are read
+// from the database, for listings too big to hold in memory.
+func StreamUsers(ctx context.Context, filter repository.UserFilter, fn func([]*models.User) error) error {
+	err := repository.StreamUsers(ctx, filter, 100, func(users []*models.User) error {
+		ApplyOnline(ctx, users...)
+		return fn(users)
+	})
+	if err != nil {
+		middleware.Logger.Printf("Error streaming users from the database: %s", err)
+	}
+	return err
+}
+
+// getting a page of the users matching the filter
+func GetAllUsers(ctx context.Context, filter repository.UserFilter, page, perPage int) ([]*models.User, repository.Count, error) {
+	users, count, err := repository.GetAllUsers(ctx, filter, perPage, (page-1)*perPage)
 	if err != nil {
 		middleware.Logger.Printf("Error retrieving users from the database: %s", err)
-		return nil, err
+		return nil, repository.Count{}, err
+	}
+
+	ApplyOnline(ctx, users...)
+
+	return users, count, nil
+}
+
+// getting the users matching the filter after the cursor of the previous page, with the cursor of the next one
+func GetUsersByCursor(ctx context.Context, filter repository.UserFilter, cursor string, perPage int) ([]*models.User, string, error) {
+	users, next, err := repository.GetUsersByCursor(ctx, filter, cursor, perPage)
+	if err != nil {
+		if !errors.Is(err, repository.ErrInvalidCursor) {
+			middleware.Logger.Printf("Error retrieving users from the database: %s", err)
+		}
+		return nil, "", err
 	}
 
-	return users, nil
+	ApplyOnline(ctx, users...)
+
+	return users, next, nil
 }
 
 // getting user by Id
-func GetUserByID(userID string) (*models.User, error) {
+func GetUserByID(ctx context.Context, userID string) (*models.User, error) {
 	if userID == "" {
 		return nil, errors.New("user ID must be provided")
 	}
 
 	// Check if the user is cached in Redis
-	ctx := context.Background()
 	cacheKey := userCachePrefix + userID
 	cachedUser, err := initializers.RedisClient.Get(ctx, cacheKey).Result()
 	if err == nil {
@@ -111,6 +262,8 @@ func GetUserByID(userID string) (*models.User, error) {
 			// Proceed to fetch from the database
 		} else {
 			log.Printf("User with ID %s fetched from cache.", userID)
+			metrics.Inc("user_cache_total", "hit")
+			ApplyOnline(ctx, user)
 			return user, nil
 		}
 	} else if err != redis.Nil {
@@ -119,16 +272,16 @@ func GetUserByID(userID string) (*models.User, error) {
 	}
 
 	// User not found in cache, fetch from the database
-	user, err := repository.GetUserByID(userID)
+	metrics.Inc("user_cache_total", "miss")
+	user, err := repository.GetUserByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		log.Printf("Error fetching user by ID: %s", err)
 		return nil, err
 	}
 
-	if user == nil {
-		return nil, nil // User not found
-	}
-
 	// Cache the user data in Redis
 	serializedUser, err := user.Serialize()
 	if err != nil {
@@ -142,121 +295,438 @@ func GetUserByID(userID string) (*models.User, error) {
 		}
 	}
 
+	ApplyOnline(ctx, user)
+
 	return user, nil
 }
 
-// updating user
-func UpdateUserByID(userID string, body *models.User) (*models.User, error) {
+// ErrUserNotFound is returned when no user has the ID, or it is deleted.
+var ErrUserNotFound = apierrors.New(apierrors.NotFound, "User not found")
+
+// ErrPreconditionFailed is returned when the user changed since the client read it, its
+// If-Match header no longer matches the ETag of the user.
+var ErrPreconditionFailed = apierrors.New(apierrors.PreconditionFailed, "the user was modified, its ETag no longer matches If-Match")
+
+// ErrRoleEscalation is returned when a user gives a role granting permissions it lacks itself.
+var ErrRoleEscalation = apierrors.New(apierrors.AccessDenied, "the role grants permissions you lack")
+
+// checkRoleGrant rejects giving the role when it grants a permission the actor lacks, whatever
+// the approval settings. The changes made without a user (commands, directory sync) pass.
+func checkRoleGrant(ctx context.Context, actor *models.User, role models.Role) error {
+	if actor == nil {
+		return nil
+	}
+	escalation, err := middleware.IsEscalation(ctx, actor.Role, role)
+	if err != nil {
+		return err
+	}
+	if escalation {
+		return ErrRoleEscalation
+	}
+	return nil
+}
+
+// UserPatch holds the changes of a user update, the nil fields are left as they are. An
+// empty Email or ProfilePicture clears it.
+type UserPatch struct {
+	FullName       *string
+	Username       *string
+	Email          *string
+	Phone          *string
+	Password       *string
+	Status         *models.Status
+	Role           *models.Role
+	ProfilePicture *string
+	Metadata       *models.Metadata // merged into the metadata by key, a key set to null is removed; nil metadata clears it
+}
+
+// ParseUserMergePatch reads the patch of a JSON Merge Patch (RFC 7386) document: the members
+// set change the fields, null clears the email, the phone, the profile picture or the
+// metadata. A profile picture can only be set to the name of an uploaded file. The error, an EnumError for an unknown status or role, is for the client to read.
+func ParseUserMergePatch(document map[string]json.RawMessage) (*UserPatch, error) {
+	var patch UserPatch
+	for field, value := range document {
+		null := string(value) == "null"
+
+		var target interface{}
+		switch field {
+		case "full_name":
+			patch.FullName = new(string)
+			target = patch.FullName
+		case "username":
+			patch.Username = new(string)
+			target = patch.Username
+		case "email":
+			patch.Email = new(string)
+			if null {
+				continue
+			}
+			target = patch.Email
+		case "phone":
+			patch.Phone = new(string)
+			if null {
+				continue
+			}
+			target = patch.Phone
+		case "password":
+			patch.Password = new(string)
+			target = patch.Password
+		case "status":
+			patch.Status = new(models.Status)
+			target = patch.Status
+		case "role":
+			patch.Role = new(models.Role)
+			target = patch.Role
+		case "profile_picture":
+			patch.ProfilePicture = new(string)
+			if null {
+				continue
+			}
+			target = patch.ProfilePicture
+		case "metadata":
+			patch.Metadata = new(models.Metadata)
+			if null {
+				continue
+			}
+			target = patch.Metadata
+		default:
+			return nil, fmt.Errorf("%s can't be patched", field)
+		}
+
+		if null {
+			return nil, fmt.Errorf("%s can't be cleared", field)
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			var enumErr *models.EnumError
+			if errors.As(err, &enumErr) {
+				return nil, enumErr
+			}
+			return nil, fmt.Errorf("Invalid %s", field)
+		}
+	}
+
+	return &patch, nil
+}
+
+// updating user with the fields provided in the body, the empty ones are left as they are,
+// unless the If-Match of the request misses its ETag
+func UpdateUserByID(ctx context.Context, userID string, body *models.User) (*models.User, error) {
+	return PatchUserByID(ctx, userID, PatchFromUser(body))
+}
+
+// PatchFromUser returns the patch of an update with the fields of the body, the empty ones are
+// left out.
+func PatchFromUser(body *models.User) *UserPatch {
+	var patch UserPatch
+	if body.FullName != "" {
+		patch.FullName = &body.FullName
+	}
+	if body.Username != "" {
+		patch.Username = &body.Username
+	}
+	if body.Email != nil && *body.Email != "" {
+		patch.Email = body.Email
+	}
+	if body.Phone != "" {
+		patch.Phone = &body.Phone
+	}
+	if body.Metadata != nil {
+		patch.Metadata = &body.Metadata
+	}
+	if body.Password != "" {
+		patch.Password = &body.Password
+	}
+	if body.Status != "" {
+		patch.Status = &body.Status
+	}
+	if body.Role != "" {
+		patch.Role = &body.Role
+	}
+	return &patch
+}
+
+// patching user with the set fields of the patch, unless the If-Match of the request misses its ETag;
+// a role with permissions the user of the request lacks is refused (ErrRoleEscalation), a role
+// escalation may be held for an approval (ApprovalRequiredError)
+func PatchUserByID(ctx context.Context, userID string, patch *UserPatch) (*models.User, error) {
 	if userID == "" {
 		return nil, errors.New("user ID must be provided")
 	}
 
-	user, err := repository.GetUserByID(userID)
+	user, err := repository.GetUserByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		middleware.Logger.Printf("Error fetching user by ID: %s", err)
 		return nil, err
 	}
 
-	if user == nil {
-		return nil, nil // User not found
-	}
-
-	// Update user fields if they are provided in the request body
-	if body.FullName != "" {
-		user.FullName = body.FullName
+	if !middleware.IfMatchFromContext(ctx, user.ETag()) {
+		return nil, ErrPreconditionFailed
 	}
 
-	if body.Username != "" {
-		user.Username = body.Username
+	if patch.Role != nil && *patch.Role != user.Role {
+		if err := checkRoleGrant(ctx, middleware.UserFromContext(ctx), *patch.Role); err != nil {
+			return nil, err
+		}
 	}
 
-	if body.Password != "" {
-		// Hash the password using bcrypt
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	// Giving a role with more permissions may need the approval of another admin, then none of
+	// the patch is applied until approved
+	if patch.Role != nil && *patch.Role != user.Role && approvalRequired(ctx, models.ApprovalRoleEscalation) {
+		escalation, err := middleware.IsEscalation(ctx, user.Role, *patch.Role)
 		if err != nil {
-			log.Printf("Error hashing password: %s", err)
 			return nil, err
 		}
-		user.Password = string(hashedPassword)
+		if escalation {
+			return nil, holdForApproval(ctx, models.ApprovalRoleEscalation, fmt.Sprintf("give the role %s to %s", *patch.Role, user.Username),
+				approvalPayload{UserIDs: userIDs([]*models.User{user}), Role: *patch.Role})
+		}
 	}
 
-	if body.Status != "" {
-		user.Status = body.Status
-	}
+	previousUsername := user.Username
+	before := *user
 
-	if body.Role != "" {
-		user.Role = body.Role
+	if err := ApplyUserPatch(ctx, user, patch); err != nil {
+		return nil, err
 	}
 
-	// Save the updated user in the database
-	err = repository.UpdateUser(user)
+	// Save the updated user in the database, a rename keeps the former username
+	if user.Username != previousUsername {
+		err = repository.RenameUser(ctx, user, previousUsername)
+	} else {
+		err = repository.UpdateUser(ctx, user)
+	}
 	if err != nil {
 		log.Printf("Error updating user: %s", err)
 		return nil, err
 	}
 
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+	invalidatePublicProfile(ctx, user.ID)
+	recordUserDiff(ctx, &before, user)
+	enqueueUserSync(ctx, OperationUpdate, user, previousUsername)
+
 	return user, nil
 }
 
-// deleting user
-func DeleteUserByID(userID string) error {
+// ApplyUserPatch validates the set fields of the patch and applies them to the user, the
+// password hashed, then runs the validation hooks; the user isn't saved.
+func ApplyUserPatch(ctx context.Context, user *models.User, patch *UserPatch) error {
+	var err error
+	if patch.FullName != nil {
+		user.FullName = *patch.FullName
+	}
+
+	if patch.Username != nil && NormalizeUsername(*patch.Username) != user.Username {
+		username := NormalizeUsername(*patch.Username)
+		if err := LoadUsernamePolicy().Check(username); err != nil {
+			return err
+		}
+		user.Username = username
+	}
+
+	if patch.Email != nil {
+		if *patch.Email == "" {
+			user.Email = nil
+		} else {
+			email, err := normalizeEmail(*patch.Email)
+			if err != nil {
+				return err
+			}
+			user.Email = &email
+		}
+	}
+
+	if patch.Phone != nil {
+		phone := ""
+		if *patch.Phone != "" {
+			phone, err = normalizePhone(*patch.Phone)
+			if err != nil {
+				return err
+			}
+		}
+		// A new phone is unverified, the SMS second factor needs it confirmed again
+		if phone != user.Phone {
+			user.Phone = phone
+			user.PhoneVerifiedAt = nil
+			user.SMSOTPEnabled = false
+		}
+	}
+
+	if patch.Password != nil {
+		if err := validatePassword(*patch.Password); err != nil {
+			return err
+		}
+
+		// Hash the password using bcrypt
+		hashedPassword, err := hashPassword(ctx, *patch.Password)
+		if err != nil {
+			log.Printf("Error hashing password: %s", err)
+			return err
+		}
+		user.Password = hashedPassword
+	}
+
+	if patch.Status != nil {
+		user.Status = *patch.Status
+	}
+
+	if patch.Role != nil {
+		user.Role = *patch.Role
+	}
+
+	if patch.ProfilePicture != nil {
+		// Only an uploaded picture can be set, the files are written by the upload endpoints
+		if *patch.ProfilePicture != "" {
+			path, err := uploadPath(*patch.ProfilePicture)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(path); err != nil {
+				return ErrInvalidProfilePicture
+			}
+		}
+		user.ProfilePicture = *patch.ProfilePicture
+	}
+
+	if patch.Metadata != nil {
+		if *patch.Metadata == nil {
+			user.Metadata = nil
+		} else {
+			user.Metadata, err = mergeMetadata(user.Metadata, *patch.Metadata)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Run the custom validation hooks on the updated user
+	return runUserValidators(OperationUpdate, user)
+}
+
+// deleting user, unless the If-Match of the request misses its ETag; deleting an admin may be
+// held for an approval (ApprovalRequiredError)
+func DeleteUserByID(ctx context.Context, userID string) error {
 	if userID == "" {
 		return errors.New("user ID must be provided")
 	}
 
-	user, err := repository.GetUserByID(userID)
+	user, err := repository.GetUserByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
 	if err != nil {
 		log.Printf("Error fetching user by ID: %s", err)
 		return err
 	}
 
-	if user == nil {
-		return nil // User not found
+	if !middleware.IfMatchFromContext(ctx, user.ETag()) {
+		return ErrPreconditionFailed
+	}
+
+	// Deleting an admin may need the approval of another admin
+	if user.Role == models.Admin && approvalRequired(ctx, models.ApprovalDeleteAdmin) {
+		return holdForApproval(ctx, models.ApprovalDeleteAdmin, "delete the admin "+user.Username, approvalPayload{UserIDs: userIDs([]*models.User{user})})
 	}
 
-	// Delete the user from the database
-	err = repository.DeleteUser(user)
+	// Soft delete the user, it can be restored until purged
+	err = repository.DeleteUser(ctx, user)
 	if err != nil {
 		log.Printf("Error deleting user: %s", err)
 		return err
 	}
+	invalidateUserCache(ctx, userID)
+	invalidatePublicProfile(ctx, user.ID)
+
+	enqueueUserSync(ctx, OperationDelete, user, "")
 
 	return nil
 }
 
-// authentication user
-func AuthenticateUser(body *models.User) (string, error) {
-	// Find the user by username in the database
-	user, err := repository.GetUserByUsername(body.Username)
+// restoring a deleted user, nil when there is no deleted user with the ID
+func RestoreUserByID(ctx context.Context, userID string) (*models.User, error) {
+	user, err := repository.RestoreUser(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil // Deleted user not found
+	}
 	if err != nil {
-		middleware.Logger.Printf("Error fetching user by username: %s", err)
-		return "", err
+		log.Printf("Error restoring user: %s", err)
+		return nil, err
 	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
 
-	if user == nil {
-		return "", errors.New("user not found")
+	// the directories and the search index get the user back
+	enqueueUserSync(ctx, OperationCreate, user, "")
+
+	return user, nil
+}
+
+// authentication user, rememberMe opens a session with long-lived refresh tokens
+func AuthenticateUser(ctx context.Context, body *models.User, rememberMe bool) (*AuthTokens, error) {
+	// Verify the credentials with the configured backends (AUTH_BACKENDS)
+	user, err := authenticateCredentials(ctx, body.Username, body.Password)
+	if err != nil {
+		recordLogin(ctx, LoginMethodPassword, body.Username, nil, err)
+		return nil, err
 	}
 
-	// Compare the provided password with the hashed password in the database
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)); err != nil {
-		log.Printf("Password verification failed for user %s: %s", user.Username, err)
-		return "", errors.New("incorrect password")
+	// The second factor completes the login with VerifyLoginOTP
+	if user.SMSOTPEnabled && user.Phone != "" {
+		return startOTPChallenge(ctx, user, rememberMe)
 	}
 
-	// Generate a JWT token using the utils package
-	tokenString, err := utils.GenerateJWTToken(user, []byte(os.Getenv("JWT_SECRET_KEY")))
+	return completeLogin(ctx, LoginMethodPassword, user, rememberMe)
+}
+
+// ErrAccountInactive is returned when an inactive user logs in.
+var ErrAccountInactive = errors.New("account is inactive")
+
+// completeLogin opens the session of an authenticated user
+func completeLogin(ctx context.Context, method string, user *models.User, rememberMe bool) (*AuthTokens, error) {
+	// The break-glass account logs in only while activated
+	if user.BreakGlass {
+		if err := breakGlassLogin(ctx, method, user); err != nil {
+			recordLogin(ctx, method, user.Username, user, err)
+			return nil, err
+		}
+	}
+
+	// Deactivated accounts (by an admin or the identity provider) can't log in
+	if user.Status == models.Inactive {
+		recordLogin(ctx, method, user.Username, user, ErrAccountInactive)
+		return nil, ErrAccountInactive
+	}
+
+	// Logging in during the grace period keeps an account whose deletion was requested
+	if err := reactivateAccount(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// Generate the access and refresh tokens
+	tokens, err := openSession(ctx, user, sessionOptions{RememberMe: rememberMe})
 	if err != nil {
-		log.Printf("Error generating JWT token: %s", err)
-		return "", errors.New("failed to generate JWT token")
+		return nil, err
+	}
+	recordLogin(ctx, method, user.Username, user, nil)
+	if user.BreakGlass {
+		alertBreakGlass(ctx, "login", user, "logged in ("+method+")")
 	}
 
-	return tokenString, nil
+	// Record the login time for access reviews
+	if err := repository.UpdateLastLogin(ctx, user, time.Now()); err != nil {
+		log.Printf("Error updating last login for user %s: %s", user.Username, err)
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+
+	return tokens, nil
 }
 
 // UpdateUserProfilePicture updates the user's profile picture.
-func UpdateUserProfilePicture(userID string, fileHeader *multipart.FileHeader) (*models.User, error) {
+func UpdateUserProfilePicture(ctx context.Context, userID string, fileHeader *multipart.FileHeader) (*models.User, error) {
 	// Find the user by ID in the database
-	user, err := repository.GetUserByID(userID)
+	user, err := repository.GetUserByID(ctx, userID)
 	if err != nil {
 		middleware.Logger.Printf("Error fetching user by ID: %s", err)
 		return nil, err
@@ -272,7 +742,10 @@ func UpdateUserProfilePicture(userID string, fileHeader *multipart.FileHeader) (
 	}
 
 	// Create the file path for storing the uploaded image with the original filename
-	filePath := filepath.Join("src/public/uploads", fileHeader.Filename)
+	filePath, err := uploadPath(fileHeader.Filename)
+	if err != nil {
+		return nil, err
+	}
 
 	// Open the uploaded file
 	file, err := fileHeader.Open()
@@ -298,19 +771,23 @@ func UpdateUserProfilePicture(userID string, fileHeader *multipart.FileHeader) (
 	}
 
 	// Update the user's profile picture URL in the database with the original filename
+	before := *user
 	user.ProfilePicture = fileHeader.Filename
-	if err := repository.UpdateUser(user); err != nil {
+	if err := repository.UpdateUser(ctx, user); err != nil {
 		middleware.Logger.Printf("Error updating user's profile picture: %s", err)
 		return nil, err
 	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+	invalidatePublicProfile(ctx, user.ID)
+	recordUserDiff(ctx, &before, user)
 
 	return user, nil
 }
 
 // GetProfilePictureByID retrieves the user's profile picture by ID.
-func GetProfilePictureByID(userID string) ([]byte, error) {
+func GetProfilePictureByID(ctx context.Context, userID string) ([]byte, error) {
 	// Find the user by ID in the database
-	user, err := repository.GetUserByID(userID)
+	user, err := repository.GetUserByID(ctx, userID)
 	if err != nil {
 		middleware.Logger.Printf("Error fetching user by ID: %s", err)
 		return nil, err
@@ -320,16 +797,13 @@ func GetProfilePictureByID(userID string) ([]byte, error) {
 		return nil, nil // User not found
 	}
 
-	// Get the current working directory
-	wd, err := os.Getwd()
+	// Get the absolute file path for the user's profile picture, kept inside the uploads directory
+	absoluteFilePath, err := uploadPath(user.ProfilePicture)
 	if err != nil {
-		middleware.Logger.Printf("Error getting current working directory: %s", err)
+		middleware.Logger.Printf("Error resolving profile picture %q: %s", user.ProfilePicture, err)
 		return nil, err
 	}
 
-	// Get the absolute file path for the user's profile picture
-	absoluteFilePath := filepath.Join(wd, "src/public/uploads", user.ProfilePicture)
-
 	// Open the file
 	file, err := os.Open(absoluteFilePath)
 	if err != nil {
@@ -349,9 +823,9 @@ func GetProfilePictureByID(userID string) ([]byte, error) {
 }
 
 // PreviewProfilePicture fetches the binary data of the user's profile picture.
-func PreviewProfilePicture(userID string) ([]byte, error) {
+func PreviewProfilePicture(ctx context.Context, userID string) ([]byte, error) {
 	// Find the user by ID in the database
-	user, err := repository.GetUserByID(userID)
+	user, err := repository.GetUserByID(ctx, userID)
 	if err != nil {
 		middleware.Logger.Printf("Error fetching user by ID: %s", err)
 		return nil, err
@@ -361,8 +835,12 @@ func PreviewProfilePicture(userID string) ([]byte, error) {
 		return nil, nil // User not found
 	}
 
-	// Construct the file path for the user's profile picture
-	filePath := filepath.Join("src/public/uploads", user.ProfilePicture)
+	// Construct the file path for the user's profile picture, kept inside the uploads directory
+	filePath, err := uploadPath(user.ProfilePicture)
+	if err != nil {
+		middleware.Logger.Printf("Error resolving profile picture %q: %s", user.ProfilePicture, err)
+		return nil, err
+	}
 
 	// Read the file data
 	fileData, err := os.ReadFile(filePath)
@@ -0,0 +1,93 @@
+// services/sessions.go
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+// GetUserSessions lists the active sessions of the user, flagging the current one.
+func GetUserSessions(ctx context.Context, userID, currentSessionID uint) ([]*models.Session, error) {
+	sessions, err := repository.GetActiveSessionsByUser(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching sessions: %s", err)
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeUserSession revokes one of the user's own sessions, it returns nil when the
+// session doesn't exist or belongs to another user.
+func RevokeUserSession(ctx context.Context, userID uint, sessionID string) (*models.Session, error) {
+	session, err := repository.GetSessionByID(ctx, sessionID)
+	if err != nil || session.UserID != userID {
+		return nil, nil // Session not found
+	}
+
+	if err := revokeSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// revokeSession ends the session: its refresh token is deleted and every access token
+// issued for it is rejected by the auth middleware.
+func revokeSession(ctx context.Context, session *models.Session) error {
+	if session.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	session.RevokedAt = &now
+	if err := repository.UpdateSession(ctx, session); err != nil {
+		middleware.Logger.Printf("Error revoking session: %s", err)
+		return err
+	}
+
+	if err := initializers.RedisClient.Del(ctx, refreshTokenPrefix+session.RefreshTokenHash).Err(); err != nil {
+		middleware.Logger.Printf("Error deleting refresh token: %s", err)
+		return err
+	}
+
+	// No access token of the session outlives the access token TTL
+	sessionID := strconv.FormatUint(uint64(session.ID), 10)
+	if err := initializers.RedisClient.Set(ctx, utils.RevokedSessionPrefix+sessionID, "1", utils.AccessTokenTTL()).Err(); err != nil {
+		middleware.Logger.Printf("Error revoking session tokens: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// revokeOtherSessions revokes every active session of the user except keepSessionID (0 keeps none).
+func revokeOtherSessions(ctx context.Context, userID, keepSessionID uint) error {
+	sessions, err := repository.GetActiveSessionsByUser(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching sessions: %s", err)
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == keepSessionID {
+			continue
+		}
+		if err := revokeSession(ctx, session); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+// services/signupAbuse.go
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/middleware"
+)
+
+const signupRateLimitPrefix = "ratelimit:signup:"
+
+// SignupRejectedError is returned when a registration is refused by the abuse controls, Code
+// tells the clients why: signup_rate_limited (retry after RetryAfter) or disposable_email.
+type SignupRejectedError struct {
+	Code       string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *SignupRejectedError) Error() string {
+	return "signup rejected: " + e.Reason
+}
+
+// the disposable email providers blocked out of the box, SIGNUP_BLOCKED_DOMAINS and
+// SIGNUP_BLOCKED_DOMAINS_FILE (one domain per line) add to them
+var defaultBlockedDomains = []string{
+	"10minutemail.com", "discard.email", "dispostable.com", "getnada.com", "guerrillamail.com",
+	"maildrop.cc", "mailinator.com", "mintemail.com", "sharklasers.com", "temp-mail.org",
+	"tempmail.com", "throwawaymail.com", "trashmail.com", "yopmail.com",
+}
+
+var (
+	blockedDomainsMu   sync.RWMutex
+	blockedDomains     map[string]bool
+	blockedDomainsOnce sync.Once
+)
+
+func loadBlockedDomains() {
+	blockedDomainsMu.Lock()
+	defer blockedDomainsMu.Unlock()
+
+	if blockedDomains == nil {
+		blockedDomains = map[string]bool{}
+	}
+	for _, domain := range defaultBlockedDomains {
+		blockedDomains[domain] = true
+	}
+	for _, domain := range initializers.GetEnvList("SIGNUP_BLOCKED_DOMAINS") {
+		blockedDomains[strings.ToLower(domain)] = true
+	}
+
+	path := initializers.GetEnv("SIGNUP_BLOCKED_DOMAINS_FILE", "")
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		middleware.Logger.Printf("Error reading blocked email domains from %s: %s", path, err)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		domain := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if domain != "" && !strings.HasPrefix(domain, "#") {
+			blockedDomains[domain] = true
+		}
+	}
+}
+
+// BlockEmailDomains adds domains to the deny-list of the registrations, their subdomains are
+// blocked too. It can be called at startup to plug in another list of disposable providers.
+func BlockEmailDomains(domains ...string) {
+	blockedDomainsOnce.Do(loadBlockedDomains)
+
+	blockedDomainsMu.Lock()
+	defer blockedDomainsMu.Unlock()
+	for _, domain := range domains {
+		blockedDomains[strings.ToLower(strings.TrimSpace(domain))] = true
+	}
+}
+
+// emailDomainBlocked reports whether the domain of the address, or one of its parents, is on the deny-list
+func emailDomainBlocked(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSuffix(email[at+1:], "."))
+
+	blockedDomainsOnce.Do(loadBlockedDomains)
+	blockedDomainsMu.RLock()
+	defer blockedDomainsMu.RUnlock()
+	for domain != "" {
+		if blockedDomains[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+	return false
+}
+
+// the accounts registered from an IP within SIGNUP_RATE_LIMIT_WINDOW (1h by default) are
+// limited to SIGNUP_RATE_LIMIT_IP (5 by default, 0 disables the limit)
+func signupRateLimit() (int, time.Duration) {
+	return initializers.GetEnvInt("SIGNUP_RATE_LIMIT_IP", 5),
+		initializers.GetEnvDuration("SIGNUP_RATE_LIMIT_WINDOW", time.Hour)
+}
+
+// checkSignupAbuse runs the abuse controls of a self registration from the client of the
+// context with the email address. Redis errors let the registration through.
+func checkSignupAbuse(ctx context.Context, email string) error {
+	if email != "" && emailDomainBlocked(email) {
+		metrics.Inc("signup_rejected_total", "disposable_email")
+		return &SignupRejectedError{Code: apierrors.DisposableEmail.Code, Reason: "disposable email addresses are not allowed"}
+	}
+
+	limit, window := signupRateLimit()
+	ip := middleware.ClientFromContext(ctx).IP
+	if limit <= 0 || ip == "" {
+		return nil
+	}
+
+	key := signupRateLimitPrefix + ip
+	count, err := initializers.RedisClient.Get(ctx, key).Int()
+	if err != nil && err != redis.Nil {
+		middleware.Logger.Printf("Error checking signup rate limit: %s", err)
+		return nil
+	}
+	if count < limit {
+		return nil
+	}
+
+	retryAfter, err := initializers.RedisClient.PTTL(ctx, key).Result()
+	if err != nil || retryAfter <= 0 {
+		retryAfter = window
+	}
+	metrics.Inc("signup_rejected_total", "signup_rate_limited")
+	return &SignupRejectedError{
+		Code:       apierrors.SignupRateLimited.Code,
+		Reason:     fmt.Sprintf("too many accounts registered from this address, try again in %s", retryAfter.Round(time.Second)),
+		RetryAfter: retryAfter,
+	}
+}
+
+// recordSignup counts a completed self registration against the limit of its client IP,
+// the window starts with the first one
+func recordSignup(ctx context.Context) {
+	limit, window := signupRateLimit()
+	ip := middleware.ClientFromContext(ctx).IP
+	if limit <= 0 || ip == "" {
+		return
+	}
+
+	key := signupRateLimitPrefix + ip
+	count, err := initializers.RedisClient.Incr(ctx, key).Result()
+	if err == nil && count == 1 {
+		err = initializers.RedisClient.Expire(ctx, key, window).Err()
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error recording signup for rate limit: %s", err)
+	}
+}
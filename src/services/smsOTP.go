@@ -0,0 +1,248 @@
+// services/smsOTP.go
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/notify"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+)
+
+const (
+	phoneVerificationPrefix = "phone_verification:" // followed by the user ID
+	otpChallengePrefix      = "otp_challenge:"      // followed by the hash of the challenge token
+)
+
+var (
+	// ErrInvalidPhone is returned for phone numbers not in the E.164 format.
+	ErrInvalidPhone = apierrors.New(apierrors.InvalidRequest, "phone number must be in the E.164 format, e.g. +15551234567")
+	// ErrInvalidCode is returned for wrong, used or expired SMS codes.
+	ErrInvalidCode = errors.New("invalid or expired code")
+	// ErrPhoneNotVerified is returned when enabling the SMS second factor without a verified phone.
+	ErrPhoneNotVerified = errors.New("a verified phone number is required")
+)
+
+var (
+	phoneRegex       = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+	phonePrefixRegex = regexp.MustCompile(`^\+[1-9][0-9]{0,14}$`)
+
+	// the separators people write phone numbers with, e.g. +1 (555) 123-4567
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+)
+
+// normalizePhone returns the phone number in the E.164 format: the separators are dropped and
+// the international 00 prefix becomes a +
+func normalizePhone(phone string) (string, error) {
+	phone = phoneSeparators.Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	if !phoneRegex.MatchString(phone) {
+		return "", ErrInvalidPhone
+	}
+	return phone, nil
+}
+
+// NormalizePhonePrefix returns the start of a phone number in the E.164 format, like
+// normalizePhone but of any length, e.g. +44 for the numbers of the United Kingdom. The + can
+// be left out, an unescaped + of a query string is read as a space.
+func NormalizePhonePrefix(prefix string) (string, error) {
+	prefix = phoneSeparators.Replace(strings.TrimSpace(prefix))
+	if strings.HasPrefix(prefix, "00") {
+		prefix = "+" + prefix[2:]
+	} else if !strings.HasPrefix(prefix, "+") {
+		prefix = "+" + prefix
+	}
+	if !phonePrefixRegex.MatchString(prefix) {
+		return "", ErrInvalidPhone
+	}
+	return prefix, nil
+}
+
+// StartPhoneVerification texts a code to the phone, which becomes the user's phone once
+// VerifyPhone confirms the code. The code expires after SMS_CODE_TTL (10 minutes by default).
+func StartPhoneVerification(ctx context.Context, user *models.User, phone string) error {
+	phone, err := normalizePhone(phone)
+	if err != nil {
+		return err
+	}
+
+	code, err := storeSMSCode(ctx, phoneVerificationPrefix+strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{"phone": phone})
+	if err != nil {
+		middleware.Logger.Printf("Error storing phone verification code: %s", err)
+		return err
+	}
+
+	if err := notify.DefaultSMSSender().SendSMS(ctx, phone, fmt.Sprintf("Your verification code is %s", code)); err != nil {
+		middleware.Logger.Printf("Error sending phone verification code: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// VerifyPhone checks the code texted by StartPhoneVerification and saves the verified phone.
+func VerifyPhone(ctx context.Context, user *models.User, code string) error {
+	fields, err := consumeSMSCode(ctx, phoneVerificationPrefix+strconv.FormatUint(uint64(user.ID), 10), code)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := repository.UpdatePhone(ctx, user, fields["phone"], now); err != nil {
+		middleware.Logger.Printf("Error saving phone number: %s", err)
+		return err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+	user.Phone, user.PhoneVerifiedAt = fields["phone"], &now
+
+	return nil
+}
+
+// SetSMSOTP enables or disables the code texted to the user's phone as a second login factor.
+func SetSMSOTP(ctx context.Context, user *models.User, enabled bool) error {
+	if enabled && (user.Phone == "" || user.PhoneVerifiedAt == nil) {
+		return ErrPhoneNotVerified
+	}
+
+	if err := repository.UpdateSMSOTP(ctx, user, enabled); err != nil {
+		middleware.Logger.Printf("Error updating the SMS second factor: %s", err)
+		return err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(user.ID), 10))
+	user.SMSOTPEnabled = enabled
+
+	return nil
+}
+
+// startOTPChallenge texts a login code to the user, the login completes with VerifyLoginOTP
+// and the returned challenge token.
+func startOTPChallenge(ctx context.Context, user *models.User, rememberMe bool) (*AuthTokens, error) {
+	challenge, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		middleware.Logger.Printf("Error generating login challenge: %s", err)
+		return nil, err
+	}
+
+	code, err := storeSMSCode(ctx, otpChallengePrefix+utils.HashToken(challenge), map[string]interface{}{
+		"user_id":     user.ID,
+		"remember_me": rememberMe,
+	})
+	if err != nil {
+		middleware.Logger.Printf("Error storing login code: %s", err)
+		return nil, err
+	}
+
+	if err := notify.DefaultSMSSender().SendSMS(ctx, user.Phone, fmt.Sprintf("Your login code is %s", code)); err != nil {
+		middleware.Logger.Printf("Error sending login code: %s", err)
+		return nil, err
+	}
+
+	return &AuthTokens{OTPChallenge: challenge, ExpiresIn: int64(smsCodeTTL().Seconds())}, nil
+}
+
+// VerifyLoginOTP checks the code texted for the login challenge and logs the user in.
+func VerifyLoginOTP(ctx context.Context, challenge, code string) (*AuthTokens, error) {
+	if challenge == "" {
+		return nil, ErrInvalidCode
+	}
+
+	fields, err := consumeSMSCode(ctx, otpChallengePrefix+utils.HashToken(challenge), code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			recordLogin(ctx, LoginMethodPassword, "", nil, err)
+		}
+		return nil, err
+	}
+
+	user, err := repository.GetUserByID(ctx, fields["user_id"])
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user for login code: %s", err)
+		return nil, ErrInvalidCode
+	}
+
+	rememberMe, _ := strconv.ParseBool(fields["remember_me"])
+	return completeLogin(ctx, LoginMethodPassword, user, rememberMe)
+}
+
+func smsCodeTTL() time.Duration {
+	return initializers.GetEnvDuration("SMS_CODE_TTL", 10*time.Minute)
+}
+
+// storeSMSCode generates a 6 digit code and stores its hash with the fields under key.
+func storeSMSCode(ctx context.Context, key string, fields map[string]interface{}) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	fields["code_hash"] = utils.HashToken(code)
+	fields["attempts"] = 0
+
+	pipe := initializers.RedisClient.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, smsCodeTTL())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// consumeSMSCode checks the code stored under key and deletes it once verified. The code is
+// also deleted after SMS_CODE_MAX_ATTEMPTS (5 by default) wrong guesses.
+func consumeSMSCode(ctx context.Context, key, code string) (map[string]string, error) {
+	attempts, err := initializers.RedisClient.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		middleware.Logger.Printf("Error checking SMS code: %s", err)
+		return nil, err
+	}
+
+	fields, err := initializers.RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		middleware.Logger.Printf("Error fetching SMS code: %s", err)
+		return nil, err
+	}
+	// HINCRBY creates the hash of an unknown or expired key: only the attempts field is there
+	if fields["code_hash"] == "" {
+		initializers.RedisClient.Del(ctx, key)
+		return nil, ErrInvalidCode
+	}
+
+	if attempts > int64(initializers.GetEnvInt("SMS_CODE_MAX_ATTEMPTS", 5)) {
+		initializers.RedisClient.Del(ctx, key)
+		return nil, ErrInvalidCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(fields["code_hash"]), []byte(utils.HashToken(code))) != 1 {
+		return nil, ErrInvalidCode
+	}
+
+	// DEL makes the code single-use, a concurrent verification of the same code loses
+	deleted, err := initializers.RedisClient.Del(ctx, key).Result()
+	if err != nil {
+		middleware.Logger.Printf("Error deleting SMS code: %s", err)
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidCode
+	}
+
+	return fields, nil
+}
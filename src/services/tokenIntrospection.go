@@ -0,0 +1,103 @@
+// services/tokenIntrospection.go
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/utils"
+	"gorm.io/gorm"
+)
+
+// TokenIntrospection describes an access token (RFC 7662), only Active is set for the
+// tokens that are invalid, expired, revoked or whose user can't use them anymore.
+type TokenIntrospection struct {
+	Active    bool        `json:"active"`
+	Subject   string      `json:"sub,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	Role      models.Role `json:"role,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+	IssuedAt  int64       `json:"iat,omitempty"`
+	TokenID   string      `json:"jti,omitempty"`
+}
+
+// IntrospectToken reports whether the access token is active, for the services that validate
+// tokens without the signing keys. Only confidential oauth clients may introspect tokens.
+func IntrospectToken(ctx context.Context, clientID, clientSecret, token string) (*TokenIntrospection, error) {
+	client, err := authenticateOAuthClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.Confidential() {
+		return nil, &OAuthError{Code: "invalid_client", Description: "public clients can't introspect tokens"}
+	}
+	if token == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "token must be provided"}
+	}
+
+	inactive := &TokenIntrospection{Active: false}
+
+	claims, err := utils.VerifyJWTToken(token)
+	if err != nil {
+		return inactive, nil
+	}
+
+	// the checks of the auth middleware: revocation, then the user
+	var revocationKeys []string
+	jti, _ := claims["jti"].(string)
+	if jti != "" {
+		revocationKeys = append(revocationKeys, utils.RevokedTokenPrefix+jti)
+	}
+	if sid, ok := claims["sid"].(float64); ok {
+		revocationKeys = append(revocationKeys, utils.RevokedSessionPrefix+strconv.FormatUint(uint64(sid), 10))
+	}
+	if len(revocationKeys) > 0 {
+		revoked, err := initializers.RedisClient.Exists(ctx, revocationKeys...).Result()
+		if err != nil {
+			middleware.Logger.Printf("Error checking token revocation: %s", err)
+			return nil, err
+		}
+		if revoked > 0 {
+			return inactive, nil
+		}
+	}
+
+	userID, ok := claims["sub"].(float64)
+	if !ok {
+		return inactive, nil
+	}
+	user, err := repository.GetUserByID(ctx, strconv.FormatUint(uint64(userID), 10))
+	if err != nil || user.Status == models.Inactive || user.DeletionRequestedAt != nil {
+		return inactive, nil
+	}
+	// the break-glass account is only active while activated
+	if user.BreakGlass {
+		_, err := repository.GetActiveBreakGlassActivation(ctx, user.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return inactive, nil
+		}
+		if err != nil {
+			middleware.Logger.Printf("Error fetching the break-glass activation: %s", err)
+			return nil, err
+		}
+	}
+
+	exp, _ := claims["exp"].(float64)
+	iat, _ := claims["iat"].(float64)
+	return &TokenIntrospection{
+		Active:    true,
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		Username:  user.Username,
+		Role:      user.Role,
+		TokenType: "Bearer",
+		ExpiresAt: int64(exp),
+		IssuedAt:  int64(iat),
+		TokenID:   jti,
+	}, nil
+}
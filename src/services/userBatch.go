@@ -0,0 +1,93 @@
+// services/userBatch.go
+package services
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// GetUsersByIDs returns the users of the IDs in their order, and the IDs not found, with at most
+// BULK_USERS_MAX IDs (100 by default). The cached users are read with one MGET, the others with
+// one query and cached.
+func GetUsersByIDs(ctx context.Context, ids []string) ([]*models.User, []string, error) {
+	var unique []string
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > initializers.GetEnvInt("BULK_USERS_MAX", 100) {
+		return nil, nil, ErrBulkTooLarge
+	}
+	if len(unique) == 0 {
+		return []*models.User{}, nil, nil
+	}
+
+	keys := make([]string, len(unique))
+	for i, id := range unique {
+		keys[i] = userCachePrefix + id
+	}
+	cached, err := initializers.RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		middleware.Logger.Printf("Error fetching users from cache: %s", err)
+		cached = make([]interface{}, len(unique)) // fetched from the database
+	}
+
+	byID := make(map[string]*models.User, len(unique))
+	var uncached []string
+	for i, id := range unique {
+		if value, ok := cached[i].(string); ok {
+			if user, err := models.DeserializeUser(value); err == nil {
+				metrics.Inc("user_cache_total", "hit")
+				byID[id] = user
+				continue
+			}
+		}
+		metrics.Inc("user_cache_total", "miss")
+		uncached = append(uncached, id)
+	}
+
+	if len(uncached) > 0 {
+		found, err := repository.GetUsersByIDs(ctx, uncached)
+		if err != nil {
+			middleware.Logger.Printf("Error fetching users by IDs: %s", err)
+			return nil, nil, err
+		}
+
+		pipe := initializers.RedisClient.Pipeline()
+		for _, user := range found {
+			serialized, err := user.Serialize()
+			if err != nil {
+				middleware.Logger.Printf("Error serializing user data for cache: %s", err)
+				continue
+			}
+			id := strconv.FormatUint(uint64(user.ID), 10)
+			pipe.Set(ctx, userCachePrefix+id, serialized, cacheExpiration)
+			byID[id] = user
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			middleware.Logger.Printf("Error caching user data: %s", err)
+		}
+	}
+
+	users := make([]*models.User, 0, len(unique))
+	var missing []string
+	for _, id := range unique {
+		if user, ok := byID[id]; ok {
+			users = append(users, user)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	ApplyOnline(ctx, users...)
+
+	return users, missing, nil
+}
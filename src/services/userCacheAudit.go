@@ -0,0 +1,87 @@
+// services/userCacheAudit.go
+package services
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/scheduler"
+)
+
+// ScheduleUserCacheAudit registers the comparison of a sample of the cached users with the
+// database, run every USER_CACHE_AUDIT_INTERVAL (5m by default).
+func ScheduleUserCacheAudit() {
+	interval := initializers.GetEnvDuration("USER_CACHE_AUDIT_INTERVAL", 5*time.Minute)
+	if interval <= 0 {
+		return
+	}
+
+	scheduler.Every("user-cache-audit", interval, func() error {
+		return AuditUserCache(context.Background())
+	})
+}
+
+// AuditUserCache compares USER_CACHE_AUDIT_SAMPLE cached users (50 by default), picked at
+// random, with the database and evicts the stale ones. The divergences are counted by field in
+// user_cache_stale_fields_total: a field that keeps showing up is updated somewhere without
+// evicting the cached user.
+func AuditUserCache(ctx context.Context) error {
+	sample, err := sampleCachedUsers(ctx, initializers.GetEnvInt("USER_CACHE_AUDIT_SAMPLE", 50))
+	if err != nil {
+		middleware.Logger.Printf("Error sampling the cached users: %s", err)
+		return err
+	}
+
+	stale := 0
+	for _, userID := range sample {
+		fields, err := cachedUserDrift(ctx, userID)
+		if err == nil && len(fields) > 0 {
+			// checked again, an update may have been between its write and the eviction
+			fields, err = cachedUserDrift(ctx, userID)
+		}
+		if err != nil {
+			middleware.Logger.Printf("Error auditing cached user %s: %s", userID, err)
+			continue
+		}
+		if len(fields) == 0 {
+			metrics.Inc("user_cache_audit_total", "consistent")
+			continue
+		}
+
+		stale++
+		metrics.Inc("user_cache_audit_total", "stale")
+		for _, field := range fields {
+			metrics.Inc("user_cache_stale_fields_total", field)
+		}
+		middleware.Logger.Printf("Cached user %s was stale, it differed on %s: evicted", userID, strings.Join(fields, ", "))
+		invalidateUserCache(ctx, userID)
+	}
+
+	if stale > 0 {
+		middleware.Logger.Printf("User cache audit: %d of %d sampled users were stale", stale, len(sample))
+	}
+	return nil
+}
+
+// sampleCachedUsers returns the IDs of up to size cached users picked at random, by reservoir
+// sampling over a scan of the cached users
+func sampleCachedUsers(ctx context.Context, size int) ([]string, error) {
+	var sample []string
+	seen := 0
+	iter := initializers.RedisClient.Scan(ctx, 0, userCachePrefix+"[0-9]*", 1000).Iterator()
+	for iter.Next(ctx) {
+		userID := strings.TrimPrefix(iter.Val(), userCachePrefix)
+		seen++
+		if len(sample) < size {
+			sample = append(sample, userID)
+		} else if i := rand.Intn(seen); i < size {
+			sample[i] = userID
+		}
+	}
+	return sample, iter.Err()
+}
@@ -0,0 +1,193 @@
+// services/userCacheCDC.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	sqldriver "github.com/go-sql-driver/mysql"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/metrics"
+	"github.com/nabazesmail/gopher/src/middleware"
+)
+
+// the binlog position the listener resumes from after a restart
+const userCacheCDCPositionKey = "user-cache-cdc:position"
+
+// the tables whose rows are cached, and the column of the user they belong to
+var cdcTables = map[string]string{
+	"users":            "id",
+	"user_preferences": "user_id",
+}
+
+var (
+	cdcMu    sync.Mutex
+	cdcCanal *canal.Canal
+	cdcDone  chan struct{}
+)
+
+// StartUserCacheCDC follows the MySQL binlog when USER_CACHE_CDC_ENABLED is set, and evicts the
+// cached users changed by anyone, the services writing to the users table directly included.
+// With USER_CACHE_CDC_MODE=refresh the changed users are cached again right away.
+//
+// The binlog is read as USER_CACHE_CDC_USER / USER_CACHE_CDC_PASSWORD (the DB_URL ones by
+// default), who needs the REPLICATION SLAVE and REPLICATION CLIENT privileges, with the
+// replica server ID USER_CACHE_CDC_SERVER_ID (1001 by default), unique among the replicas: one
+// listener runs per deployment. The binlog must be in ROW format.
+func StartUserCacheCDC() error {
+	if !initializers.GetEnvBool("USER_CACHE_CDC_ENABLED", false) {
+		return nil
+	}
+
+	dsn, err := sqldriver.ParseDSN(os.Getenv("DB_URL"))
+	if err != nil {
+		return fmt.Errorf("parsing DB_URL: %w", err)
+	}
+
+	cfg := canal.NewDefaultConfig()
+	cfg.Addr = dsn.Addr
+	cfg.User = initializers.GetEnv("USER_CACHE_CDC_USER", dsn.User)
+	cfg.Password = initializers.GetEnv("USER_CACHE_CDC_PASSWORD", dsn.Passwd)
+	cfg.ServerID = uint32(initializers.GetEnvInt("USER_CACHE_CDC_SERVER_ID", 1001))
+	cfg.Dump.ExecutionPath = "" // the changes from now on, the cache holds nothing older
+	for table := range cdcTables {
+		cfg.IncludeTableRegex = append(cfg.IncludeTableRegex, regexp.QuoteMeta(dsn.DBName+"."+table)+"$")
+	}
+
+	c, err := canal.NewCanal(cfg)
+	if err != nil {
+		return fmt.Errorf("connecting to the binlog: %w", err)
+	}
+	c.SetEventHandler(&userCacheCDCHandler{refresh: initializers.GetEnv("USER_CACHE_CDC_MODE", "evict") == "refresh"})
+
+	position, err := cdcStartPosition(c)
+	if err != nil {
+		c.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		middleware.Logger.Printf("User cache CDC following the binlog from %s", position)
+		if err := c.RunFrom(position); err != nil {
+			middleware.Logger.Printf("User cache CDC stopped: %s", err)
+		}
+	}()
+
+	cdcMu.Lock()
+	cdcCanal, cdcDone = c, done
+	cdcMu.Unlock()
+	return nil
+}
+
+// StopUserCacheCDC stops following the binlog, the position reached is saved for the next start.
+func StopUserCacheCDC(ctx context.Context) error {
+	cdcMu.Lock()
+	c, done := cdcCanal, cdcDone
+	cdcCanal, cdcDone = nil, nil
+	cdcMu.Unlock()
+	if c == nil {
+		return nil
+	}
+
+	c.Close()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return saveCDCPosition(ctx, c.SyncedPosition())
+}
+
+// cdcStartPosition returns the saved position, or the current one on the first start
+func cdcStartPosition(c *canal.Canal) (mysql.Position, error) {
+	var position mysql.Position
+	saved, err := initializers.RedisClient.Get(context.Background(), userCacheCDCPositionKey).Bytes()
+	if err == nil && json.Unmarshal(saved, &position) == nil && position.Name != "" {
+		return position, nil
+	}
+
+	position, err = c.GetMasterPos()
+	if err != nil {
+		return position, fmt.Errorf("reading the binlog position: %w", err)
+	}
+	return position, nil
+}
+
+// saveCDCPosition records the position the listener reached
+func saveCDCPosition(ctx context.Context, position mysql.Position) error {
+	encoded, err := json.Marshal(position)
+	if err != nil {
+		return err
+	}
+	return initializers.RedisClient.Set(ctx, userCacheCDCPositionKey, encoded, 0).Err()
+}
+
+// userCacheCDCHandler evicts the cached users of the changed rows
+type userCacheCDCHandler struct {
+	canal.DummyEventHandler
+	refresh   bool
+	lastSaved time.Time
+}
+
+func (h *userCacheCDCHandler) OnRow(e *canal.RowsEvent) error {
+	column, ok := cdcTables[e.Table.Name]
+	if !ok {
+		return nil
+	}
+	index := e.Table.FindColumn(column)
+	if index < 0 {
+		return fmt.Errorf("the %s table has no %s column", e.Table.Name, column)
+	}
+
+	ctx := context.Background()
+	seen := map[string]bool{}
+	for _, row := range e.Rows {
+		if index >= len(row) || row[index] == nil {
+			continue
+		}
+		userID := fmt.Sprint(row[index])
+		if seen[userID] {
+			continue // the before and after images of an update
+		}
+		seen[userID] = true
+
+		invalidateUserCache(ctx, userID)
+		if id, err := strconv.ParseUint(userID, 10, 64); err == nil {
+			invalidatePublicProfile(ctx, uint(id))
+		}
+		metrics.Inc("user_cache_cdc_evictions_total", e.Table.Name)
+
+		if h.refresh && e.Action != canal.DeleteAction {
+			if _, err := GetUserByID(ctx, userID); err != nil && !errors.Is(err, ErrUserNotFound) {
+				middleware.Logger.Printf("Error refreshing cached user %s: %s", userID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// OnPosSynced saves the position at most every 10 seconds, or when forced by a rotation
+func (h *userCacheCDCHandler) OnPosSynced(header *replication.EventHeader, position mysql.Position, set mysql.GTIDSet, force bool) error {
+	if !force && time.Since(h.lastSaved) < 10*time.Second {
+		return nil
+	}
+	h.lastSaved = time.Now()
+	if err := saveCDCPosition(context.Background(), position); err != nil {
+		middleware.Logger.Printf("Error saving the binlog position: %s", err)
+	}
+	return nil
+}
+
+func (h *userCacheCDCHandler) String() string { return "userCacheCDCHandler" }
@@ -0,0 +1,201 @@
+// services/userExport.go
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// the formats of the users export
+const (
+	ExportCSV  = "csv"
+	ExportXLSX = "xlsx"
+)
+
+// ExportContentTypes maps the formats of the users export to their content type.
+var ExportContentTypes = map[string]string{
+	ExportCSV:  "text/csv",
+	ExportXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// ErrUnknownExportFormat is returned for an export format other than csv and xlsx.
+var ErrUnknownExportFormat = errors.New("unknown export format, the formats are csv and xlsx")
+
+// the columns of the export, the password hash is left out
+var exportColumns = []string{"id", "full_name", "username", "email", "role", "status", "phone", "legal_hold", "last_login_at", "last_seen_at", "created_at", "updated_at", "deleted_at"}
+
+func exportRecord(user *models.User) []string {
+	timestamp := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	email := ""
+	if user.Email != nil {
+		email = *user.Email
+	}
+	deletedAt := ""
+	if user.DeletedAt.Valid {
+		deletedAt = user.DeletedAt.Time.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		strconv.FormatUint(uint64(user.ID), 10),
+		user.FullName,
+		user.Username,
+		email,
+		string(user.Role),
+		string(user.Status),
+		user.Phone,
+		strconv.FormatBool(user.LegalHold),
+		timestamp(user.LastLoginAt),
+		timestamp(user.LastSeenAt),
+		timestamp(&user.CreatedAt),
+		timestamp(&user.UpdatedAt),
+		deletedAt,
+	}
+}
+
+// ExportUsers writes the users matching the filter to w in the format, as they are read from
+// the database by batches, so the table is never held in memory.
+func ExportUsers(ctx context.Context, w io.Writer, format string, filter repository.UserFilter) error {
+	var writer exportWriter
+	switch format {
+	case ExportCSV:
+		writer = &csvExportWriter{writer: csv.NewWriter(w)}
+	case ExportXLSX:
+		writer = &xlsxExportWriter{zip: zip.NewWriter(w)}
+	default:
+		return ErrUnknownExportFormat
+	}
+
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+	err := repository.StreamUsers(ctx, filter, 100, func(users []*models.User) error {
+		for _, user := range users {
+			if err := writer.Write(exportRecord(user)); err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	})
+	if err != nil {
+		middleware.Logger.Printf("Error exporting users: %s", err)
+		return err
+	}
+	return writer.Close()
+}
+
+// exportWriter writes the rows of an export
+type exportWriter interface {
+	Write(record []string) error
+	Flush() error // sends the rows written so far
+	Close() error
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvExportWriter) Write(record []string) error {
+	return w.writer.Write(record)
+}
+
+func (w *csvExportWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvExportWriter) Close() error {
+	return w.Flush()
+}
+
+// xlsxExportWriter writes a workbook of a single sheet, the cells are inline strings so the
+// rows can be streamed without a shared strings table
+type xlsxExportWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	rows  int
+}
+
+// the parts of the workbook around its sheet
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Users" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+func (w *xlsxExportWriter) Write(record []string) error {
+	if w.sheet == nil {
+		for _, part := range xlsxParts {
+			f, err := w.zip.Create(part.name)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(f, part.content); err != nil {
+				return err
+			}
+		}
+		sheet, err := w.zip.Create("xl/worksheets/sheet1.xml")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(sheet, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+			return err
+		}
+		w.sheet = sheet
+	}
+
+	w.rows++
+	if _, err := fmt.Fprintf(w.sheet, `<row r="%d">`, w.rows); err != nil {
+		return err
+	}
+	for _, value := range record {
+		if _, err := io.WriteString(w.sheet, `<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(w.sheet, []byte(value)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w.sheet, `</t></is></c>`); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w.sheet, `</row>`)
+	return err
+}
+
+func (w *xlsxExportWriter) Flush() error {
+	return w.zip.Flush()
+}
+
+func (w *xlsxExportWriter) Close() error {
+	if _, err := io.WriteString(w.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
@@ -0,0 +1,48 @@
+// services/userFields.go
+package services
+
+import (
+	"encoding/json"
+
+	"github.com/nabazesmail/gopher/src/dto"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// ProjectUser keeps only the fields of the user response, for the sparse fieldsets (?fields=).
+// Every field is kept when fields is empty.
+func ProjectUser(user *models.User, fields []string) (interface{}, error) {
+	response := dto.FromUser(user)
+	if len(fields) == 0 {
+		return response, nil
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected, nil
+}
+
+// ProjectUsers keeps only the fields of each user, see ProjectUser.
+func ProjectUsers(users []*models.User, fields []string) ([]interface{}, error) {
+	projected := make([]interface{}, len(users))
+	for i, user := range users {
+		p, err := ProjectUser(user, fields)
+		if err != nil {
+			return nil, err
+		}
+		projected[i] = p
+	}
+	return projected, nil
+}
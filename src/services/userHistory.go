@@ -0,0 +1,115 @@
+// services/userHistory.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+// the fields of a user whose changes are kept in the audit log, by their JSON name; the password
+// hash is left out of the log
+var historyFields = []string{"full_name", "username", "email", "phone", "status", "role", "profile_picture", "metadata"}
+
+// UserAsOf is a user as it was at a point in time.
+type UserAsOf struct {
+	User *models.User `json:"user"`
+	AsOf time.Time    `json:"as_of"`
+	// the changes undone to get back to the time, the ones made after it
+	ChangesUndone int `json:"changes_undone"`
+}
+
+// userFieldMap returns the JSON fields of the user
+func userFieldMap(user *models.User) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// recordUserDiff adds the history fields changed from before to after to the audit log entry of the request
+func recordUserDiff(ctx context.Context, before, after *models.User) {
+	from, err := userFieldMap(before)
+	if err != nil {
+		middleware.Logger.Printf("Error recording the changes of user %d: %s", after.ID, err)
+		return
+	}
+	to, err := userFieldMap(after)
+	if err != nil {
+		middleware.Logger.Printf("Error recording the changes of user %d: %s", after.ID, err)
+		return
+	}
+
+	changes := map[string]models.FieldChange{}
+	for _, field := range historyFields {
+		if !reflect.DeepEqual(from[field], to[field]) {
+			changes[field] = models.FieldChange{From: from[field], To: to[field]}
+		}
+	}
+	middleware.RecordAuditDiff(ctx, strconv.FormatUint(uint64(after.ID), 10), changes)
+}
+
+// GetUserAsOf rebuilds the user as it was at the time: the changes recorded in the audit log since
+// then are undone, newest first, from the current user. The changes made before the audit log
+// recorded diffs, and the fields out of historyFields, keep their current value. Nil is returned
+// when the user didn't exist at the time, or was deleted.
+func GetUserAsOf(ctx context.Context, userID string, asOf time.Time) (*UserAsOf, error) {
+	user, err := repository.GetUserByIDWithDeleted(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil // User not found
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user by ID: %s", err)
+		return nil, err
+	}
+
+	if asOf.Before(user.CreatedAt) || (user.DeletedAt.Valid && !asOf.Before(user.DeletedAt.Time)) {
+		return nil, nil
+	}
+
+	logs, err := repository.GetAuditDiffsSince(ctx, userID, asOf)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching the audit diffs of user %s: %s", userID, err)
+		return nil, err
+	}
+
+	fields, err := userFieldMap(user)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range logs {
+		var changes map[string]models.FieldChange
+		if err := json.Unmarshal([]byte(entry.Diff), &changes); err != nil {
+			middleware.Logger.Printf("Error reading the diff of audit log %d: %s", entry.ID, err)
+			return nil, err
+		}
+		for field, change := range changes {
+			fields[field] = change.From
+		}
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	past := &models.User{}
+	if err := json.Unmarshal(encoded, past); err != nil {
+		return nil, err
+	}
+	past.DeletedAt = gorm.DeletedAt{} // deleted later, if at all
+
+	return &UserAsOf{User: past, AsOf: asOf, ChangesUndone: len(logs)}, nil
+}
@@ -0,0 +1,139 @@
+// services/userImport.go
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// ErrInvalidCSV is returned when the CSV of an import can't be read.
+var ErrInvalidCSV = errors.New("invalid CSV")
+
+// the columns of an import, the header row names them in any order
+var importColumns = []string{"full_name", "username", "password", "status", "role", "email", "phone"}
+
+// ImportFailure is a line of the CSV that wasn't imported.
+type ImportFailure struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportReport sums up an import: the rows created and the lines that failed.
+type ImportReport struct {
+	Rows     int             `json:"rows"`
+	Created  int             `json:"created"`
+	Failures []ImportFailure `json:"failures"`
+}
+
+// ImportUsersCSV creates the users of the CSV, read as a stream: the rows are validated and
+// inserted by batches of IMPORT_BATCH_SIZE (100 by default), each batch in a transaction. A
+// batch that can't be saved fails its lines, the next ones are still imported.
+func ImportUsersCSV(ctx context.Context, r io.Reader) (*ImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1 // the missing trailing fields are empty
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading the header: %s", ErrInvalidCSV, err)
+	}
+	positions := map[string]int{}
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, column := range importColumns[:3] {
+		if _, ok := positions[column]; !ok {
+			return nil, fmt.Errorf("%w: missing the %s column, the columns are %s", ErrInvalidCSV, column, strings.Join(importColumns, ", "))
+		}
+	}
+
+	batchSize := initializers.GetEnvInt("IMPORT_BATCH_SIZE", 100)
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	report := &ImportReport{Failures: []ImportFailure{}}
+	var batch []*models.User
+	var lines []int
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		results, err := createUsers(ctx, batch)
+		if err != nil {
+			middleware.Logger.Printf("Error importing lines %d to %d: %s", lines[0], lines[len(lines)-1], err)
+			for _, line := range lines {
+				report.Failures = append(report.Failures, ImportFailure{Line: line, Error: "failed to save the batch of this line"})
+			}
+		} else {
+			for i, result := range results {
+				if result.User != nil {
+					report.Created++
+				} else {
+					report.Failures = append(report.Failures, ImportFailure{Line: lines[i], Error: result.Error})
+				}
+			}
+		}
+		batch, lines = nil, nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			report.Rows++
+			report.Failures = append(report.Failures, ImportFailure{Line: parseErr.Line, Error: parseErr.Err.Error()})
+			continue
+		}
+		report.Rows++
+		line, _ := reader.FieldPos(0)
+
+		field := func(column string) string {
+			if i, ok := positions[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		user := &models.User{
+			FullName: field("full_name"),
+			Username: field("username"),
+			Phone:    field("phone"),
+			Password: field("password"),
+			Status:   models.Status(field("status")),
+			Role:     models.Role(field("role")),
+		}
+		if user.Status == "" {
+			user.Status = models.Active
+		}
+		if user.Role == "" {
+			user.Role = models.Operator
+		}
+		if email := field("email"); email != "" {
+			user.Email = &email
+		}
+
+		batch = append(batch, user)
+		lines = append(lines, line)
+		if len(batch) == batchSize {
+			flush()
+		}
+	}
+	flush()
+
+	return report, nil
+}
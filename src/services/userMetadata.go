@@ -0,0 +1,70 @@
+// services/userMetadata.go
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// ErrInvalidMetadata is returned for metadata with a key that isn't allowed or too large to store.
+var ErrInvalidMetadata = apierrors.New(apierrors.InvalidRequest, "invalid metadata")
+
+var metadataKeyRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]{0,63}$`)
+
+// normalizeMetadata checks the metadata of a user: its keys must be listed in USER_METADATA_KEYS
+// (comma separated), any key of up to 64 letters, digits, _, . and - being allowed when it is
+// empty, and its JSON must fit in USER_METADATA_MAX_BYTES (4096 by default). The keys set to
+// null are dropped, nil is returned for empty metadata.
+func normalizeMetadata(metadata models.Metadata) (models.Metadata, error) {
+	allowed := initializers.GetEnvList("USER_METADATA_KEYS")
+	for key, value := range metadata {
+		if value == nil {
+			delete(metadata, key)
+			continue
+		}
+		if len(allowed) == 0 {
+			if !metadataKeyRegex.MatchString(key) {
+				return nil, fmt.Errorf("%w: key %q must start with a letter and have up to 64 letters, digits, _, . and -", ErrInvalidMetadata, key)
+			}
+			continue
+		}
+		known := false
+		for _, name := range allowed {
+			known = known || key == name
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: key %q is not allowed, the keys are %s", ErrInvalidMetadata, key, strings.Join(allowed, ", "))
+		}
+	}
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetadata, err)
+	}
+	if max := initializers.GetEnvInt("USER_METADATA_MAX_BYTES", 4096); len(encoded) > max {
+		return nil, fmt.Errorf("%w: %d bytes of JSON, at most %d", ErrInvalidMetadata, len(encoded), max)
+	}
+	return metadata, nil
+}
+
+// mergeMetadata applies the keys of the patch to the metadata: the keys set to null are removed,
+// the others replace their value
+func mergeMetadata(metadata, patch models.Metadata) (models.Metadata, error) {
+	merged := models.Metadata{}
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		merged[key] = value
+	}
+	return normalizeMetadata(merged)
+}
@@ -0,0 +1,100 @@
+// services/userPreferences.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+)
+
+// ErrInvalidUserPreferences wraps the validation errors of UpdateUserPreferences.
+var ErrInvalidUserPreferences = errors.New("invalid preferences")
+
+// a BCP 47 language tag, checked when USER_LANGUAGES is empty
+var languageRegex = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// GetUserPreferences returns the user's preferences, cached next to the user.
+func GetUserPreferences(ctx context.Context, userID uint) (*models.UserPreferences, error) {
+	cacheKey := userPreferencesCachePrefix + strconv.FormatUint(uint64(userID), 10)
+	cached, err := initializers.RedisClient.Get(ctx, cacheKey).Bytes()
+	if err == nil {
+		var preferences models.UserPreferences
+		if err := json.Unmarshal(cached, &preferences); err == nil {
+			preferences.UserID = userID
+			return &preferences, nil
+		}
+		middleware.Logger.Printf("Error decoding the cached preferences of user %d: %s", userID, err)
+	} else if err != redis.Nil {
+		middleware.Logger.Printf("Error fetching the cached preferences of user %d: %s", userID, err)
+	}
+
+	preferences, err := repository.GetUserPreferences(ctx, userID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching preferences: %s", err)
+		return nil, err
+	}
+
+	if encoded, err := json.Marshal(preferences); err == nil {
+		if err := initializers.RedisClient.Set(ctx, cacheKey, encoded, cacheExpiration).Err(); err != nil {
+			middleware.Logger.Printf("Error caching the preferences of user %d: %s", userID, err)
+		}
+	}
+	return preferences, nil
+}
+
+// UpdateUserPreferences validates and saves the user's preferences, see ValidateUserPreferences.
+func UpdateUserPreferences(ctx context.Context, preferences *models.UserPreferences) error {
+	if err := ValidateUserPreferences(preferences); err != nil {
+		return err
+	}
+
+	if err := repository.SaveUserPreferences(ctx, preferences); err != nil {
+		middleware.Logger.Printf("Error saving preferences: %s", err)
+		return err
+	}
+	invalidateUserCache(ctx, strconv.FormatUint(uint64(preferences.UserID), 10))
+
+	return nil
+}
+
+// ValidateUserPreferences checks the preferences, the theme and language left empty get the
+// defaults. The language must be listed in USER_LANGUAGES when set, a BCP 47 tag otherwise.
+func ValidateUserPreferences(preferences *models.UserPreferences) error {
+	if preferences.Theme == "" {
+		preferences.Theme = models.ThemeSystem
+	}
+	if !listed(models.Themes, preferences.Theme) {
+		return fmt.Errorf("%w: the theme must be system, light or dark", ErrInvalidUserPreferences)
+	}
+
+	if preferences.Language == "" {
+		preferences.Language = models.DefaultUserPreferences(preferences.UserID).Language
+	}
+	if languages := initializers.GetEnvList("USER_LANGUAGES"); len(languages) > 0 {
+		if !listed(languages, preferences.Language) {
+			return fmt.Errorf("%w: unsupported language %s", ErrInvalidUserPreferences, preferences.Language)
+		}
+	} else if len(preferences.Language) > 35 || !languageRegex.MatchString(preferences.Language) {
+		return fmt.Errorf("%w: the language must be a BCP 47 tag like en or pt-BR", ErrInvalidUserPreferences)
+	}
+	return nil
+}
+
+// listed reports whether the value is one of the values
+func listed(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
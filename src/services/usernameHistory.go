@@ -0,0 +1,62 @@
+// services/usernameHistory.go
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+	"github.com/nabazesmail/gopher/src/repository"
+	"gorm.io/gorm"
+)
+
+// GetUserByUsername returns the user with the username, nil when there is none. With
+// USERNAME_ALIASES_ENABLED=true a former username resolves to the user who last went by it,
+// movedFrom is then the username asked for; a current username always wins over a former one.
+func GetUserByUsername(ctx context.Context, username string) (user *models.User, movedFrom string, err error) {
+	user, err = repository.GetUserByUsername(ctx, username)
+	if err == nil {
+		ApplyOnline(ctx, user)
+		return user, "", nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		middleware.Logger.Printf("Error fetching user by username: %s", err)
+		return nil, "", err
+	}
+	if !initializers.GetEnvBool("USERNAME_ALIASES_ENABLED", false) {
+		return nil, "", nil // User not found
+	}
+
+	user, err = repository.GetUserByFormerUsername(ctx, username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", nil // User not found
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user by former username: %s", err)
+		return nil, "", err
+	}
+
+	ApplyOnline(ctx, user)
+	return user, username, nil
+}
+
+// GetUsernameHistory returns the former usernames of the user, the latest first.
+func GetUsernameHistory(ctx context.Context, userID string) ([]models.UsernameHistory, error) {
+	user, err := repository.GetUserByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil // User not found
+	}
+	if err != nil {
+		middleware.Logger.Printf("Error fetching user by ID: %s", err)
+		return nil, err
+	}
+
+	history, err := repository.GetUsernameHistory(ctx, user.ID)
+	if err != nil {
+		middleware.Logger.Printf("Error fetching username history: %s", err)
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,178 @@
+// services/usernamePolicy.go
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInvalidUsername wraps the rules of the username policy a username breaks.
+var ErrInvalidUsername = apierrors.New(apierrors.InvalidRequest, "invalid username")
+
+// the character classes USERNAME_CHARACTERS can list
+const (
+	usernameLetters    = "letters"
+	usernameDigits     = "digits"
+	usernameUnderscore = "underscore"
+	usernameDot        = "dot"
+	usernameHyphen     = "hyphen"
+)
+
+// the names USERNAME_RESERVED denies by default, they read as the system or clash with routes
+var defaultReservedUsernames = []string{"admin", "administrator", "root", "system", "support", "me", "api", "null"}
+
+// UsernamePolicy is the rules of the usernames chosen through the API, on create and update.
+// The usernames of the accounts provisioned by an identity provider (SCIM, OAuth) follow the
+// provider's.
+type UsernamePolicy struct {
+	MinLength int             // in characters, USERNAME_MIN_LENGTH (3 by default)
+	MaxLength int             // USERNAME_MAX_LENGTH (32 by default)
+	Classes   map[string]bool // USERNAME_CHARACTERS: letters, digits, underscore, dot, hyphen (letters,digits by default)
+	ASCIIOnly bool            // USERNAME_ASCII_ONLY, the letters and digits are otherwise any script's
+	Reserved  []string        // USERNAME_RESERVED, compared ignoring the case
+}
+
+// LoadUsernamePolicy reads the username policy from the environment.
+func LoadUsernamePolicy() UsernamePolicy {
+	policy := UsernamePolicy{
+		MinLength: initializers.GetEnvInt("USERNAME_MIN_LENGTH", 3),
+		MaxLength: initializers.GetEnvInt("USERNAME_MAX_LENGTH", 32),
+		Classes:   map[string]bool{},
+		ASCIIOnly: initializers.GetEnvBool("USERNAME_ASCII_ONLY", false),
+		Reserved:  initializers.GetEnvList("USERNAME_RESERVED"),
+	}
+
+	classes := initializers.GetEnvList("USERNAME_CHARACTERS")
+	if len(classes) == 0 {
+		classes = []string{usernameLetters, usernameDigits}
+	}
+	for _, class := range classes {
+		policy.Classes[strings.ToLower(class)] = true
+	}
+	if len(policy.Reserved) == 0 {
+		policy.Reserved = defaultReservedUsernames
+	}
+	return policy
+}
+
+// NormalizeUsername returns the NFKC form of the username, the one validated and stored, so
+// the precomposed and decomposed "é" or a fullwidth "ａ" don't make distinct usernames.
+func NormalizeUsername(username string) string {
+	return norm.NFKC.String(username)
+}
+
+// Check returns the rule the normalized username breaks, wrapping ErrInvalidUsername. When
+// letters are allowed the username starts with one, so it never reads as an ID. Its letters
+// are of one script, or Latin and CJK, so a Cyrillic "а" can't pass for a Latin "a".
+func (p UsernamePolicy) Check(username string) error {
+	username = NormalizeUsername(username)
+	length := utf8.RuneCountInString(username)
+	if length < p.MinLength || length > p.MaxLength {
+		return fmt.Errorf("%w: it must be %d to %d characters long", ErrInvalidUsername, p.MinLength, p.MaxLength)
+	}
+	if !utf8.ValidString(username) {
+		return fmt.Errorf("%w: it isn't valid UTF-8", ErrInvalidUsername)
+	}
+
+	for i, r := range username {
+		if i == 0 && p.Classes[usernameLetters] && !p.letter(r) {
+			return fmt.Errorf("%w: it must start with a letter", ErrInvalidUsername)
+		}
+		if !p.allowed(r) {
+			return fmt.Errorf("%w: %q is not allowed, it may contain %s", ErrInvalidUsername, r, p.describe())
+		}
+	}
+
+	if mixedScripts(username) {
+		return fmt.Errorf("%w: it mixes the letters of several scripts", ErrInvalidUsername)
+	}
+
+	for _, reserved := range p.Reserved {
+		if strings.EqualFold(username, NormalizeUsername(reserved)) {
+			return fmt.Errorf("%w: %s is reserved", ErrInvalidUsername, username)
+		}
+	}
+	return nil
+}
+
+// the scripts of the CJK languages, written together and with Latin letters (the highly
+// restrictive profile of Unicode TS #39)
+var cjkScripts = []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo}
+
+// scriptOf returns the script of r, "CJK" for the CJK ones and "" for the characters shared by
+// the scripts (digits, punctuation, combining marks)
+func scriptOf(r rune) string {
+	for _, table := range cjkScripts {
+		if unicode.Is(table, r) {
+			return "CJK"
+		}
+	}
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// mixedScripts reports whether the username mixes the characters of several scripts, Latin
+// and CJK excepted
+func mixedScripts(username string) bool {
+	scripts := map[string]bool{}
+	for _, r := range username {
+		if script := scriptOf(r); script != "" {
+			scripts[script] = true
+		}
+	}
+	switch len(scripts) {
+	case 0, 1:
+		return false
+	case 2:
+		return !scripts["Latin"] || !scripts["CJK"]
+	}
+	return true
+}
+
+// letter reports whether r is a letter of the policy
+func (p UsernamePolicy) letter(r rune) bool {
+	if p.ASCIIOnly {
+		return r < utf8.RuneSelf && unicode.IsLetter(r)
+	}
+	return unicode.IsLetter(r)
+}
+
+// allowed reports whether r is of one of the character classes of the policy
+func (p UsernamePolicy) allowed(r rune) bool {
+	switch {
+	case p.letter(r):
+		return p.Classes[usernameLetters]
+	case unicode.IsMark(r): // the combining marks of the scripts written with them
+		return p.Classes[usernameLetters] && !p.ASCIIOnly
+	case unicode.IsDigit(r):
+		return p.Classes[usernameDigits] && (r < utf8.RuneSelf || !p.ASCIIOnly)
+	case r == '_':
+		return p.Classes[usernameUnderscore]
+	case r == '.':
+		return p.Classes[usernameDot]
+	case r == '-':
+		return p.Classes[usernameHyphen]
+	}
+	return false
+}
+
+// describe lists the character classes of the policy, for the error messages
+func (p UsernamePolicy) describe() string {
+	var classes []string
+	for _, class := range []string{usernameLetters, usernameDigits, usernameUnderscore, usernameDot, usernameHyphen} {
+		if p.Classes[class] {
+			classes = append(classes, class)
+		}
+	}
+	return strings.Join(classes, ", ")
+}
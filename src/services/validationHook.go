@@ -0,0 +1,145 @@
+// services/validationHook.go
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/apierrors"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/models"
+)
+
+// operations passed to the user validators and the sync adapters
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// UserValidator is a hook invoked on registration and update that can reject a user
+// according to custom policies (corporate domains, employee ID formats...).
+type UserValidator interface {
+	ValidateUser(operation string, user *models.User) error
+}
+
+// UserValidatorFunc adapts a function to the UserValidator interface.
+type UserValidatorFunc func(operation string, user *models.User) error
+
+func (f UserValidatorFunc) ValidateUser(operation string, user *models.User) error {
+	return f(operation, user)
+}
+
+// PolicyError is returned when a user validator rejects a user.
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return "policy violation: " + e.Reason
+}
+
+// Unwrap makes the error an apierrors.ErrValidation with the reason.
+func (e *PolicyError) Unwrap() error {
+	return apierrors.New(apierrors.ValidationFailed, e.Reason)
+}
+
+var (
+	validatorsMu   sync.RWMutex
+	userValidators []UserValidator
+)
+
+// RegisterUserValidator adds a validator run on every user creation and update.
+func RegisterUserValidator(v UserValidator) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	userValidators = append(userValidators, v)
+}
+
+// InitUserValidators registers the external validation hook when USER_VALIDATION_HOOK_URL is set.
+func InitUserValidators() {
+	url := initializers.GetEnv("USER_VALIDATION_HOOK_URL", "")
+	if url == "" {
+		return
+	}
+
+	RegisterUserValidator(&HTTPUserValidator{
+		URL:      url,
+		FailOpen: initializers.GetEnvBool("USER_VALIDATION_HOOK_FAIL_OPEN", false),
+		Client:   &http.Client{Timeout: initializers.GetEnvDuration("USER_VALIDATION_HOOK_TIMEOUT", 3*time.Second)},
+	})
+}
+
+// runUserValidators runs all registered validators and returns the first rejection.
+func runUserValidators(operation string, user *models.User) error {
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+
+	for _, v := range userValidators {
+		if err := v.ValidateUser(operation, user); err != nil {
+			middleware.Logger.Printf("User %s rejected by validation hook on %s: %s", user.Username, operation, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// HTTPUserValidator delegates the validation to an external service. The service receives
+// the operation and the user as JSON and rejects the user by answering with a 4xx status
+// and an optional {"error": "reason"} body.
+type HTTPUserValidator struct {
+	URL      string
+	FailOpen bool // accept the user when the hook cannot be reached
+	Client   *http.Client
+}
+
+func (v *HTTPUserValidator) ValidateUser(operation string, user *models.User) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"operation": operation,
+		"user": map[string]interface{}{
+			"id":       user.ID,
+			"fullName": user.FullName,
+			"username": user.Username,
+			"status":   user.Status,
+			"role":     user.Role,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.Client.Post(v.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return v.unavailable(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if body.Error == "" {
+			body.Error = "rejected by the validation hook"
+		}
+		return &PolicyError{Reason: body.Error}
+	default:
+		return v.unavailable(fmt.Errorf("validation hook answered with status %d", resp.StatusCode))
+	}
+}
+
+func (v *HTTPUserValidator) unavailable(err error) error {
+	middleware.Logger.Printf("User validation hook unavailable: %s", err)
+	if v.FailOpen {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+// services/warehouseExport.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/middleware"
+	"github.com/nabazesmail/gopher/src/repository"
+	"github.com/nabazesmail/gopher/src/scheduler"
+	"github.com/nabazesmail/gopher/src/storage"
+)
+
+// WarehouseSink receives the exported rows of a table for long-term analytics. A failing
+// Write is retried with the same rows on the next run.
+type WarehouseSink interface {
+	Name() string
+	Write(ctx context.Context, table string, rows []interface{}) error
+}
+
+// exportStream reads the rows of a table after an ID, it returns the rows and the ID of the last one.
+type exportStream struct {
+	table string
+	fetch func(ctx context.Context, afterID uint, before time.Time, limit int) ([]interface{}, uint, error)
+}
+
+var exportStreams = []exportStream{
+	{table: "audit_logs", fetch: func(ctx context.Context, afterID uint, before time.Time, limit int) ([]interface{}, uint, error) {
+		logs, err := repository.GetAuditLogsToExport(ctx, afterID, before, limit)
+		if err != nil || len(logs) == 0 {
+			return nil, afterID, err
+		}
+		rows := make([]interface{}, len(logs))
+		for i, entry := range logs {
+			rows[i] = entry
+		}
+		return rows, logs[len(logs)-1].ID, nil
+	}},
+	{table: "login_events", fetch: func(ctx context.Context, afterID uint, before time.Time, limit int) ([]interface{}, uint, error) {
+		events, err := repository.GetLoginEventsToExport(ctx, afterID, before, limit)
+		if err != nil || len(events) == 0 {
+			return nil, afterID, err
+		}
+		rows := make([]interface{}, len(events))
+		for i, event := range events {
+			rows[i] = event
+		}
+		return rows, events[len(events)-1].ID, nil
+	}},
+}
+
+// DefaultWarehouseSink returns the sink of WAREHOUSE_EXPORT_SINK: "clickhouse" inserts into
+// WAREHOUSE_CLICKHOUSE_URL, "storage" writes JSON lines files to the storage backend, nil otherwise.
+func DefaultWarehouseSink() WarehouseSink {
+	switch initializers.GetEnv("WAREHOUSE_EXPORT_SINK", "") {
+	case "clickhouse":
+		return &ClickHouseSink{
+			URL:      initializers.GetEnv("WAREHOUSE_CLICKHOUSE_URL", "http://localhost:8123"),
+			Database: initializers.GetEnv("WAREHOUSE_CLICKHOUSE_DATABASE", "default"),
+			Username: initializers.GetEnv("WAREHOUSE_CLICKHOUSE_USERNAME", ""),
+			Password: initializers.GetEnv("WAREHOUSE_CLICKHOUSE_PASSWORD", ""),
+			Client:   &http.Client{Timeout: initializers.GetEnvDuration("WAREHOUSE_CLICKHOUSE_TIMEOUT", 30*time.Second)},
+		}
+	case "storage":
+		return &StorageSink{Prefix: initializers.GetEnv("WAREHOUSE_STORAGE_PREFIX", "warehouse")}
+	}
+	return nil
+}
+
+// ExportToWarehouse ships the audit logs and login events created since the last export to
+// the sink. The watermark of every table moves after each written batch, so an export
+// interrupted by a failure or a shutdown resumes where it stopped (a batch may be sent twice).
+// The rows of the last WAREHOUSE_EXPORT_LAG (1m) wait for the next run, as rows with lower
+// IDs may still be committing.
+func ExportToWarehouse(ctx context.Context, sink WarehouseSink) (int, error) {
+	batchSize := initializers.GetEnvInt("WAREHOUSE_EXPORT_BATCH_SIZE", 1000)
+	before := time.Now().Add(-initializers.GetEnvDuration("WAREHOUSE_EXPORT_LAG", time.Minute))
+
+	exported := 0
+	for _, stream := range exportStreams {
+		watermark, err := repository.GetExportWatermark(ctx, sink.Name()+":"+stream.table)
+		if err != nil {
+			middleware.Logger.Printf("Error fetching the %s export watermark: %s", stream.table, err)
+			return exported, err
+		}
+
+		for {
+			rows, lastID, err := stream.fetch(ctx, watermark.LastID, before, batchSize)
+			if err != nil {
+				middleware.Logger.Printf("Error fetching %s to export: %s", stream.table, err)
+				return exported, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			if err := sink.Write(ctx, stream.table, rows); err != nil {
+				middleware.Logger.Printf("Error exporting %s to %s: %s", stream.table, sink.Name(), err)
+				return exported, err
+			}
+
+			watermark.LastID, watermark.ExportedAt = lastID, time.Now()
+			if err := repository.SaveExportWatermark(ctx, watermark); err != nil {
+				middleware.Logger.Printf("Error saving the %s export watermark: %s", stream.table, err)
+				return exported, err
+			}
+			exported += len(rows)
+
+			if len(rows) < batchSize {
+				break
+			}
+		}
+	}
+
+	return exported, nil
+}
+
+// ScheduleWarehouseExport registers the periodic export every WAREHOUSE_EXPORT_INTERVAL
+// (1h by default) when a sink is configured.
+func ScheduleWarehouseExport() {
+	sink := DefaultWarehouseSink()
+	interval := initializers.GetEnvDuration("WAREHOUSE_EXPORT_INTERVAL", time.Hour)
+	if sink == nil || interval <= 0 {
+		return
+	}
+
+	scheduler.Every("warehouse-export", interval, func() error {
+		exported, err := ExportToWarehouse(context.Background(), sink)
+		if exported > 0 {
+			middleware.Logger.Printf("Exported %d rows to %s", exported, sink.Name())
+		}
+		return err
+	})
+}
+
+// ClickHouseSink inserts the rows through the HTTP interface of ClickHouse, into the tables of
+// the same name in Database. The tables are created beforehand, e.g. with the MergeTree engine.
+type ClickHouseSink struct {
+	URL      string
+	Database string
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+func (s *ClickHouseSink) Name() string { return "clickhouse" }
+
+func (s *ClickHouseSink) Write(ctx context.Context, table string, rows []interface{}) error {
+	body, err := jsonLines(rows)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"query":                            {fmt.Sprintf("INSERT INTO `%s`.`%s` FORMAT JSONEachRow", s.Database, table)},
+		"date_time_input_format":           {"best_effort"}, // the RFC 3339 times of the JSON
+		"input_format_skip_unknown_fields": {"1"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/?"+query.Encode(), body)
+	if err != nil {
+		return err
+	}
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("clickhouse answered %s: %s", resp.Status, message)
+	}
+	return nil
+}
+
+// StorageSink writes every batch as a JSON lines file <Prefix>/<table>/<time>.jsonl of the
+// storage backend, to be loaded by the warehouse (S3 external tables, BigQuery, Athena...).
+type StorageSink struct {
+	Prefix string
+}
+
+func (s *StorageSink) Name() string { return "storage" }
+
+func (s *StorageSink) Write(ctx context.Context, table string, rows []interface{}) error {
+	body, err := jsonLines(rows)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s/%s/%s.jsonl", s.Prefix, table, time.Now().UTC().Format("20060102-150405.000000000"))
+	return storage.Backend().Put(key, body.Bytes())
+}
+
+func jsonLines(rows []interface{}) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return nil, err
+		}
+	}
+	return &buf, nil
+}
@@ -0,0 +1,60 @@
+// storage/storage.go
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/nabazesmail/gopher/src/initializers"
+)
+
+// Storage is a backend for files generated by the application (reports, exports...).
+type Storage interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+var (
+	backend     Storage
+	backendOnce sync.Once
+)
+
+// Backend returns the configured storage backend (local disk under STORAGE_PATH by default).
+func Backend() Storage {
+	backendOnce.Do(func() {
+		backend = NewLocalStorage(initializers.GetEnv("STORAGE_PATH", "storage"))
+	})
+	return backend
+}
+
+// LocalStorage stores files on the local disk under a root directory.
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage creates a storage backend rooted at the given directory.
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+func (s *LocalStorage) Put(key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *LocalStorage) Get(key string) ([]byte, error) {
+	return os.ReadFile(s.path(key))
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	return os.Remove(s.path(key))
+}
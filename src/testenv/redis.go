@@ -0,0 +1,834 @@
+// testenv/redis.go
+package testenv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisServer is an in-process Redis speaking RESP on a loopback port, with the commands the
+// services send: strings, hashes, lists, sorted sets, expirations, SCAN and MULTI/EXEC. The
+// blocking commands return at once and the Lua scripts (the rate limits) aren't run, EVALSHA
+// failing like an unreachable Redis.
+type redisServer struct {
+	listener net.Listener
+
+	mu   sync.Mutex
+	keys map[string]*redisValue
+}
+
+// redisValue is a key, only the field of its type is set
+type redisValue struct {
+	str     *string
+	hash    map[string]string
+	list    []string
+	zset    map[string]float64
+	expires time.Time
+}
+
+// the replies of the commands are statuses (+OK), errors, integers, strings (bulk), arrays and
+// nil; the statuses and errors have their own types
+type (
+	redisStatus string
+	redisError  string
+)
+
+func startRedis() (*redisServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &redisServer{listener: listener, keys: map[string]*redisValue{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, nil
+}
+
+func (s *redisServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *redisServer) Close() error {
+	return s.listener.Close()
+}
+
+// serve answers the commands of a connection, queueing those of a transaction until EXEC
+func (s *redisServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	var queued [][]string
+	inMulti := false
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		var reply interface{}
+		switch name := strings.ToUpper(args[0]); {
+		case name == "MULTI":
+			inMulti, queued = true, nil
+			reply = redisStatus("OK")
+		case name == "DISCARD":
+			inMulti, queued = false, nil
+			reply = redisStatus("OK")
+		case name == "EXEC":
+			s.mu.Lock()
+			replies := make([]interface{}, len(queued))
+			for i, command := range queued {
+				replies[i] = s.run(command)
+			}
+			s.mu.Unlock()
+			inMulti, queued = false, nil
+			reply = replies
+		case inMulti:
+			queued = append(queued, args)
+			reply = redisStatus("QUEUED")
+		default:
+			s.mu.Lock()
+			reply = s.run(args)
+			s.mu.Unlock()
+		}
+
+		writeReply(writer, reply)
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads an array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil // inline command
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("invalid array header %q", line)
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		header, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) == 0 || header[0] != '$' {
+			return nil, fmt.Errorf("invalid bulk header %q", header)
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid bulk header %q", header)
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch r := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case redisStatus:
+		fmt.Fprintf(w, "+%s\r\n", r)
+	case redisError:
+		fmt.Fprintf(w, "-%s\r\n", r)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", r)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", r)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(r), r)
+	case []interface{}:
+		if r == nil {
+			w.WriteString("*-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(r))
+		for _, item := range r {
+			writeReply(w, item)
+		}
+	default:
+		panic(fmt.Sprintf("testenv: unknown redis reply %T", reply))
+	}
+}
+
+var (
+	errWrongType = redisError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = redisError("ERR value is not an integer or out of range")
+	errNotFloat  = redisError("ERR value is not a valid float")
+	errSyntax    = redisError("ERR syntax error")
+)
+
+// get returns the live value of a key, nil when missing or expired
+func (s *redisServer) get(key string) *redisValue {
+	value, ok := s.keys[key]
+	if !ok {
+		return nil
+	}
+	if !value.expires.IsZero() && !time.Now().Before(value.expires) {
+		delete(s.keys, key)
+		return nil
+	}
+	return value
+}
+
+// run runs a command, s.mu held
+func (s *redisServer) run(args []string) interface{} {
+	name, args := strings.ToUpper(args[0]), args[1:]
+	if minArgs, ok := redisArity[name]; !ok {
+		return redisError(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(name)))
+	} else if len(args) < minArgs {
+		return redisError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+	}
+
+	switch name {
+	case "PING":
+		return redisStatus("PONG")
+	case "SELECT", "CLIENT":
+		return redisStatus("OK")
+	case "FLUSHALL", "FLUSHDB":
+		s.keys = map[string]*redisValue{}
+		return redisStatus("OK")
+
+	case "GET", "GETDEL":
+		value := s.get(args[0])
+		if value == nil {
+			return nil
+		}
+		if value.str == nil {
+			return errWrongType
+		}
+		if name == "GETDEL" {
+			delete(s.keys, args[0])
+		}
+		return *value.str
+	case "MGET":
+		values := make([]interface{}, len(args))
+		for i, key := range args {
+			if value := s.get(key); value != nil && value.str != nil {
+				values[i] = *value.str
+			}
+		}
+		return values
+	case "SET":
+		return s.set(args)
+	case "SETNX":
+		if s.get(args[0]) != nil {
+			return 0
+		}
+		s.keys[args[0]] = &redisValue{str: &args[1]}
+		return 1
+	case "INCR", "INCRBY", "DECR":
+		by := int64(1)
+		if name == "DECR" {
+			by = -1
+		}
+		if name == "INCRBY" {
+			if len(args) < 2 {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return errNotInt
+			}
+			by = n
+		}
+		value := s.get(args[0])
+		if value == nil {
+			value = &redisValue{str: new(string)}
+			*value.str = "0"
+			s.keys[args[0]] = value
+		}
+		if value.str == nil {
+			return errWrongType
+		}
+		n, err := strconv.ParseInt(*value.str, 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		n += by
+		*value.str = strconv.FormatInt(n, 10)
+		return n
+
+	case "DEL", "UNLINK", "EXISTS":
+		count := 0
+		for _, key := range args {
+			if s.get(key) != nil {
+				count++
+				if name != "EXISTS" {
+					delete(s.keys, key)
+				}
+			}
+		}
+		return count
+	case "EXPIRE", "PEXPIRE":
+		value := s.get(args[0])
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		if value == nil {
+			return 0
+		}
+		unit := time.Second
+		if name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		value.expires = time.Now().Add(time.Duration(n) * unit)
+		return 1
+	case "TTL", "PTTL":
+		value := s.get(args[0])
+		switch {
+		case value == nil:
+			return -2
+		case value.expires.IsZero():
+			return -1
+		case name == "TTL":
+			return int64(time.Until(value.expires).Round(time.Second) / time.Second)
+		}
+		return int64(time.Until(value.expires) / time.Millisecond)
+	case "SCAN":
+		return s.scan(args)
+
+	case "HSET", "HGETALL", "HDEL", "HINCRBY", "HLEN", "HGET":
+		return s.hash(name, args)
+	case "LPUSH", "RPUSH", "LLEN", "LRANGE", "LREM", "RPOP", "BRPOP":
+		return s.listCommand(name, args)
+	case "ZADD", "ZREM", "ZCARD", "ZRANGE", "ZRANGEBYSCORE", "ZMSCORE", "ZSCORE":
+		return s.sortedSet(name, args)
+	}
+	return redisError("ERR unknown command")
+}
+
+// the commands served and their minimum number of arguments
+var redisArity = map[string]int{
+	"PING": 0, "SELECT": 1, "CLIENT": 1, "FLUSHALL": 0, "FLUSHDB": 0,
+	"GET": 1, "GETDEL": 1, "MGET": 1, "SET": 2, "SETNX": 2, "INCR": 1, "INCRBY": 2, "DECR": 1,
+	"DEL": 1, "UNLINK": 1, "EXISTS": 1, "EXPIRE": 2, "PEXPIRE": 2, "TTL": 1, "PTTL": 1, "SCAN": 1,
+	"HSET": 3, "HGETALL": 1, "HDEL": 2, "HINCRBY": 3, "HLEN": 1, "HGET": 2,
+	"LPUSH": 2, "RPUSH": 2, "LLEN": 1, "LRANGE": 3, "LREM": 3, "RPOP": 1, "BRPOP": 2,
+	"ZADD": 3, "ZREM": 2, "ZCARD": 1, "ZRANGE": 3, "ZRANGEBYSCORE": 3, "ZMSCORE": 2, "ZSCORE": 2,
+}
+
+// set runs SET key value [EX s | PX ms | KEEPTTL] [NX | XX] [GET]
+func (s *redisServer) set(args []string) interface{} {
+	key, str := args[0], args[1]
+	var (
+		expires        time.Time
+		keepTTL        bool
+		nx, xx, getOld bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return errNotInt
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expires = time.Now().Add(time.Duration(n) * unit)
+			i++
+		case "KEEPTTL":
+			keepTTL = true
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			getOld = true
+		default:
+			return errSyntax
+		}
+	}
+
+	old := s.get(key)
+	var previous interface{}
+	if old != nil && old.str != nil {
+		previous = *old.str
+	}
+	if (nx && old != nil) || (xx && old == nil) {
+		if getOld {
+			return previous
+		}
+		return nil
+	}
+	if keepTTL && old != nil {
+		expires = old.expires
+	}
+	s.keys[key] = &redisValue{str: &str, expires: expires}
+	if getOld {
+		return previous
+	}
+	return redisStatus("OK")
+}
+
+// scan runs SCAN cursor [MATCH pattern] [COUNT n] [TYPE type], returning every key at once
+func (s *redisServer) scan(args []string) interface{} {
+	pattern := "*"
+	for i := 1; i+1 < len(args); i += 2 {
+		if strings.ToUpper(args[i]) == "MATCH" {
+			pattern = args[i+1]
+		}
+	}
+	keys := []interface{}{}
+	names := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		if s.get(key) == nil {
+			continue
+		}
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return []interface{}{"0", keys}
+}
+
+// hash runs the hash commands
+func (s *redisServer) hash(name string, args []string) interface{} {
+	value := s.get(args[0])
+	if value != nil && value.hash == nil {
+		return errWrongType
+	}
+	if value == nil {
+		if name != "HSET" && name != "HINCRBY" {
+			switch name {
+			case "HGETALL":
+				return []interface{}{}
+			case "HGET":
+				return nil
+			}
+			return 0
+		}
+		value = &redisValue{hash: map[string]string{}}
+		s.keys[args[0]] = value
+	}
+
+	switch name {
+	case "HSET":
+		if len(args)%2 != 1 {
+			return redisError("ERR wrong number of arguments for 'hset' command")
+		}
+		added := 0
+		for i := 1; i < len(args); i += 2 {
+			if _, ok := value.hash[args[i]]; !ok {
+				added++
+			}
+			value.hash[args[i]] = args[i+1]
+		}
+		return added
+	case "HGET":
+		if field, ok := value.hash[args[1]]; ok {
+			return field
+		}
+		return nil
+	case "HGETALL":
+		fields := make([]string, 0, len(value.hash))
+		for field := range value.hash {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		reply := make([]interface{}, 0, 2*len(fields))
+		for _, field := range fields {
+			reply = append(reply, field, value.hash[field])
+		}
+		return reply
+	case "HDEL":
+		removed := 0
+		for _, field := range args[1:] {
+			if _, ok := value.hash[field]; ok {
+				delete(value.hash, field)
+				removed++
+			}
+		}
+		if len(value.hash) == 0 {
+			delete(s.keys, args[0])
+		}
+		return removed
+	case "HINCRBY":
+		by, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		n, err := strconv.ParseInt(valueOr(value.hash, args[1], "0"), 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		value.hash[args[1]] = strconv.FormatInt(n+by, 10)
+		return n + by
+	}
+	return len(value.hash) // HLEN
+}
+
+func valueOr(hash map[string]string, field, fallback string) string {
+	if value, ok := hash[field]; ok {
+		return value
+	}
+	return fallback
+}
+
+// listCommand runs the list commands
+func (s *redisServer) listCommand(name string, args []string) interface{} {
+	key := args[0]
+	if name == "BRPOP" {
+		// BRPOP key... timeout, the first non empty list, nil at once when all are empty
+		for _, key := range args[:len(args)-1] {
+			if value := s.get(key); value != nil && len(value.list) > 0 {
+				item := s.pop(key, value)
+				return []interface{}{key, item}
+			}
+		}
+		return []interface{}(nil)
+	}
+
+	value := s.get(key)
+	if value != nil && value.list == nil {
+		return errWrongType
+	}
+
+	switch name {
+	case "LPUSH", "RPUSH":
+		if value == nil {
+			value = &redisValue{list: []string{}}
+			s.keys[key] = value
+		}
+		for _, item := range args[1:] {
+			if name == "LPUSH" {
+				value.list = append([]string{item}, value.list...)
+			} else {
+				value.list = append(value.list, item)
+			}
+		}
+		return len(value.list)
+	case "LLEN":
+		if value == nil {
+			return 0
+		}
+		return len(value.list)
+	case "RPOP":
+		if value == nil || len(value.list) == 0 {
+			return nil
+		}
+		return s.pop(key, value)
+	case "LRANGE":
+		if value == nil {
+			return []interface{}{}
+		}
+		start, stop, err := rangeBounds(args[1], args[2], len(value.list))
+		if err != nil {
+			return errNotInt
+		}
+		items := []interface{}{}
+		for i := start; i <= stop; i++ {
+			items = append(items, value.list[i])
+		}
+		return items
+	case "LREM":
+		count, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errNotInt
+		}
+		if value == nil {
+			return 0
+		}
+		removed, kept := 0, value.list[:0:0]
+		for _, item := range value.list {
+			if item == args[2] && (count == 0 || removed < abs(count)) {
+				removed++
+				continue
+			}
+			kept = append(kept, item)
+		}
+		value.list = kept
+		if len(kept) == 0 {
+			delete(s.keys, key)
+		}
+		return removed
+	}
+	return nil
+}
+
+// pop removes the last item of a list, the key with it when the list is emptied
+func (s *redisServer) pop(key string, value *redisValue) string {
+	item := value.list[len(value.list)-1]
+	value.list = value.list[:len(value.list)-1]
+	if len(value.list) == 0 {
+		delete(s.keys, key)
+	}
+	return item
+}
+
+// rangeBounds resolves the inclusive start and stop of LRANGE and ZRANGE, negative from the end;
+// stop < start when the range is empty
+func rangeBounds(startArg, stopArg string, length int) (int, int, error) {
+	start, err := strconv.Atoi(startArg)
+	if err != nil {
+		return 0, 0, err
+	}
+	stop, err := strconv.Atoi(stopArg)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return start, stop, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// sortedSet runs the sorted set commands
+func (s *redisServer) sortedSet(name string, args []string) interface{} {
+	key := args[0]
+	value := s.get(key)
+	if value != nil && value.zset == nil {
+		return errWrongType
+	}
+
+	switch name {
+	case "ZADD":
+		// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member...
+		i := 1
+		var nx, xx bool
+		for ; i < len(args); i++ {
+			flag := strings.ToUpper(args[i])
+			if flag == "NX" {
+				nx = true
+			} else if flag == "XX" {
+				xx = true
+			} else if flag != "GT" && flag != "LT" && flag != "CH" {
+				break
+			}
+		}
+		if (len(args)-i)%2 != 0 || i == len(args) {
+			return errSyntax
+		}
+		if value == nil {
+			value = &redisValue{zset: map[string]float64{}}
+			s.keys[key] = value
+		}
+		added := 0
+		for ; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return errNotFloat
+			}
+			_, exists := value.zset[args[i+1]]
+			if (nx && exists) || (xx && !exists) {
+				continue
+			}
+			if !exists {
+				added++
+			}
+			value.zset[args[i+1]] = score
+		}
+		if len(value.zset) == 0 {
+			delete(s.keys, key)
+		}
+		return added
+	case "ZREM":
+		removed := 0
+		if value == nil {
+			return 0
+		}
+		for _, member := range args[1:] {
+			if _, ok := value.zset[member]; ok {
+				delete(value.zset, member)
+				removed++
+			}
+		}
+		if len(value.zset) == 0 {
+			delete(s.keys, key)
+		}
+		return removed
+	case "ZCARD":
+		if value == nil {
+			return 0
+		}
+		return len(value.zset)
+	case "ZSCORE":
+		if value == nil {
+			return nil
+		}
+		if score, ok := value.zset[args[1]]; ok {
+			return formatScore(score)
+		}
+		return nil
+	case "ZMSCORE":
+		scores := make([]interface{}, len(args)-1)
+		for i, member := range args[1:] {
+			if value == nil {
+				continue
+			}
+			if score, ok := value.zset[member]; ok {
+				scores[i] = formatScore(score)
+			}
+		}
+		return scores
+	}
+
+	// ZRANGE key start stop [WITHSCORES], ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+	members := sortedMembers(value)
+	withScores := false
+	offset, count := 0, -1
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			var err1, err2 error
+			offset, err1 = strconv.Atoi(args[i+1])
+			count, err2 = strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return errNotInt
+			}
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+
+	var selected []string
+	if name == "ZRANGE" {
+		start, stop, err := rangeBounds(args[1], args[2], len(members))
+		if err != nil {
+			return errNotInt
+		}
+		for i := start; i <= stop; i++ {
+			selected = append(selected, members[i])
+		}
+	} else {
+		min, minExclusive, err := parseScoreBound(args[1])
+		if err != nil {
+			return errNotFloat
+		}
+		max, maxExclusive, err := parseScoreBound(args[2])
+		if err != nil {
+			return errNotFloat
+		}
+		for _, member := range members {
+			score := value.zset[member]
+			if score < min || score > max || (minExclusive && score == min) || (maxExclusive && score == max) {
+				continue
+			}
+			selected = append(selected, member)
+		}
+		if offset > len(selected) {
+			offset = len(selected)
+		}
+		selected = selected[offset:]
+		if count >= 0 && count < len(selected) {
+			selected = selected[:count]
+		}
+	}
+
+	reply := []interface{}{}
+	for _, member := range selected {
+		reply = append(reply, member)
+		if withScores {
+			reply = append(reply, formatScore(value.zset[member]))
+		}
+	}
+	return reply
+}
+
+// sortedMembers returns the members by score, then by name
+func sortedMembers(value *redisValue) []string {
+	if value == nil {
+		return nil
+	}
+	members := make([]string, 0, len(value.zset))
+	for member := range value.zset {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := value.zset[members[i]], value.zset[members[j]]
+		if a != b {
+			return a < b
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// parseScoreBound parses a bound of ZRANGEBYSCORE: a score, (score for an exclusive one, -inf or
+// +inf
+func parseScoreBound(bound string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(bound, "(")
+	bound = strings.TrimPrefix(bound, "(")
+	switch strings.ToLower(bound) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	score, err := strconv.ParseFloat(bound, 64)
+	return score, exclusive, err
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
@@ -0,0 +1,146 @@
+// testenv/testenv.go
+
+// Package testenv runs the services on an in-memory SQLite database and an in-process Redis, so
+// the tests and benchmarks of the API serve its real handlers without MySQL or Redis servers.
+// The schema is the one of the models (migrate.Models) with the built-in roles seeded, the
+// MySQL specific constraints and indexes left out.
+package testenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"github.com/nabazesmail/gopher/src/initializers"
+	"github.com/nabazesmail/gopher/src/migrate"
+	"github.com/nabazesmail/gopher/src/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	// the databases of the tests, each in memory under its own name
+	databases int64
+	// the password hashes by password, bcrypt being slow by design
+	hashes sync.Map
+)
+
+// Setup points initializers.DB and initializers.RedisClient to a new migrated database and an
+// empty Redis for the test, the previous ones are restored when it ends. JWT_SECRET_KEY is set
+// when missing so tokens can be signed.
+func Setup(tb testing.TB) {
+	tb.Helper()
+
+	name := fmt.Sprintf("file:testenv%d?mode=memory&cache=shared", atomic.AddInt64(&databases, 1))
+	db, err := gorm.Open(sqlite.Open(name), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		tb.Fatalf("opening the test database: %s", err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		tb.Fatalf("migrating the test database: %s", err)
+	}
+	if err := registerMySQLErrors(db); err != nil {
+		tb.Fatalf("registering the MySQL errors: %s", err)
+	}
+	if err := migrate.SeedRoles(db); err != nil {
+		tb.Fatalf("seeding the test database: %s", err)
+	}
+
+	server, err := startRedis()
+	if err != nil {
+		tb.Fatalf("starting the test redis: %s", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	previousDB, previousRedis := initializers.DB, initializers.RedisClient
+	initializers.DB, initializers.RedisClient = db, client
+	tb.Cleanup(func() {
+		initializers.DB, initializers.RedisClient = previousDB, previousRedis
+		client.Close()
+		server.Close()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if initializers.GetEnv("JWT_SECRET_KEY", "") == "" {
+		tb.Setenv("JWT_SECRET_KEY", "testenv")
+	}
+}
+
+// migrateSQLite creates the tables of the models, the ENUM columns of MySQL as text
+func migrateSQLite(db *gorm.DB) error {
+	for _, model := range migrate.Models() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		for _, field := range stmt.Schema.Fields {
+			if len(field.DataType) >= 4 && (field.DataType[:4] == "ENUM" || field.DataType[:4] == "enum") {
+				field.DataType = "text"
+			}
+		}
+		if err := db.AutoMigrate(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerMySQLErrors returns the unique constraint violations of SQLite as the duplicate entry
+// error of MySQL, the one the repository translates
+func registerMySQLErrors(db *gorm.DB) error {
+	translate := func(db *gorm.DB) {
+		var sqliteErr sqlite3.Error
+		if errors.As(db.Error, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			db.Error = &mysql.MySQLError{Number: 1062, Message: sqliteErr.Error()}
+		}
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("testenv:mysql_errors", translate); err != nil {
+		return err
+	}
+	return db.Callback().Update().After("gorm:update").Register("testenv:mysql_errors", translate)
+}
+
+// FlushRedis drops every key of the Redis of the test, e.g. the cached users.
+func FlushRedis(tb testing.TB) {
+	tb.Helper()
+
+	if err := initializers.RedisClient.FlushAll(context.Background()).Err(); err != nil {
+		tb.Fatalf("flushing the test redis: %s", err)
+	}
+}
+
+// CreateUser saves the user with the password hashed like the services do, defaulting its
+// status to active and its role to operator.
+func CreateUser(tb testing.TB, user *models.User, password string) *models.User {
+	tb.Helper()
+
+	hashed, ok := hashes.Load(password)
+	if !ok {
+		data, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		hashed, _ = hashes.LoadOrStore(password, string(data))
+	}
+	user.Password = hashed.(string)
+	if user.Status == "" {
+		user.Status = models.Active
+	}
+	if user.Role == "" {
+		user.Role = models.Operator
+	}
+	if err := initializers.DB.Create(user).Error; err != nil {
+		tb.Fatalf("creating the user %s: %s", user.Username, err)
+	}
+	return user
+}
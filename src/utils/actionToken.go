@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// actions that can be delegated with an action token
+const (
+	ActionUploadAvatar   = "upload_avatar"   // resource: ID of the user
+	ActionDownloadReport = "download_report" // resource: file name of the stored report
+)
+
+// ActionClaims are the claims of a verified action token.
+type ActionClaims struct {
+	ID        string // jti claim, used to allow a single use
+	UserID    uint   // user who minted the token
+	Action    string
+	Resource  string
+	ExpiresAt time.Time
+}
+
+// GenerateActionToken signs a short-lived token granting the action on the resource only.
+func GenerateActionToken(userID uint, action, resource string, ttl time.Duration) (*AccessToken, error) {
+	key, err := activeSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"jti": hex.EncodeToString(jti),
+		"act": action,
+		"res": resource,
+	}
+	setRegisteredClaims(claims, expiresAt)
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.kid != "" {
+		token.Header["kid"] = key.kid
+	}
+
+	tokenString, err := token.SignedString(key.private)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessToken{Token: tokenString, ID: claims["jti"].(string), ExpiresAt: expiresAt}, nil
+}
+
+// VerifyActionToken verifies an action token, access tokens are rejected.
+func VerifyActionToken(tokenString string) (*ActionClaims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	action, ok := claims["act"].(string)
+	if !ok {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	resource, _ := claims["res"].(string)
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims["sub"].(float64)
+	exp, _ := claims["exp"].(float64)
+
+	return &ActionClaims{
+		ID:        jti,
+		UserID:    uint(sub),
+		Action:    action,
+		Resource:  resource,
+		ExpiresAt: time.Unix(int64(exp), 0),
+	}, nil
+}
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"os"
 	"time"
 
@@ -8,39 +11,115 @@ import (
 	"github.com/nabazesmail/gopher/src/models"
 )
 
-// JWTSecretKey is your JWT secret key.
-var JWTSecretKey = []byte(os.Getenv("JWT_SECRET_KEY"))
+// Redis key prefixes of revoked token IDs (jti) and revoked session IDs (sid).
+const (
+	RevokedTokenPrefix   = "revoked:"
+	RevokedSessionPrefix = "revoked_session:"
+)
+
+// CookieSessionPrefix is the Redis key prefix of the cookie sessions, by hash of the cookie value.
+const CookieSessionPrefix = "cookie_session:"
+
+// AccessTokenTTL returns the lifetime of access tokens, configured with ACCESS_TOKEN_TTL (24h by default).
+func AccessTokenTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL"))
+	if err != nil || ttl <= 0 {
+		return 24 * time.Hour
+	}
+	return ttl
+}
+
+// TokenOptions customize a generated access token.
+type TokenOptions struct {
+	SessionID      uint          // "sid" claim, 0 for tokens not bound to a session
+	TTL            time.Duration // lifetime of the token, AccessTokenTTL() when zero
+	ImpersonatedBy uint          // "impersonated_by" claim, admin acting as the user
+}
+
+// AccessToken is a signed access token with the claims needed to track or revoke it.
+type AccessToken struct {
+	Token     string
+	ID        string // jti claim
+	ExpiresAt time.Time
+}
+
+// this generates a new JWT token for the provided user, signed with the active signing key.
+func GenerateJWTToken(user *models.User, opts TokenOptions) (*AccessToken, error) {
+	key, err := activeSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// a random token ID (jti) so the token can be revoked
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = AccessTokenTTL()
+	}
+	expiresAt := time.Now().Add(ttl)
 
-// this generates a new JWT token for the provided user.
-func GenerateJWTToken(user *models.User, secretKey []byte) (string, error) {
 	// a new token with the user's ID as the subject (sub) claim.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"sub": user.ID,
+		"jti": hex.EncodeToString(jti),
 		// You can add more user information to the token as needed.
 		"username": user.Username,
 		"fullName": user.FullName,
 		"role":     user.Role,
 		"status":   user.Status,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(), // Token expiration time (24 hours from now).
-	})
+	}
+	setRegisteredClaims(claims, expiresAt) // Token expiration time (24 hours from now by default).
+	if opts.SessionID != 0 {
+		claims["sid"] = opts.SessionID
+	}
+	if opts.ImpersonatedBy != 0 {
+		claims["impersonated_by"] = opts.ImpersonatedBy
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+
+	// the kid tells the verifiers which key signed the token
+	if key.kid != "" {
+		token.Header["kid"] = key.kid
+	}
 
-	// Sign the token with the provided secret key.
-	tokenString, err := token.SignedString(secretKey)
+	// Sign the token with the active key.
+	tokenString, err := token.SignedString(key.private)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return tokenString, nil
+	return &AccessToken{Token: tokenString, ID: claims["jti"].(string), ExpiresAt: expiresAt}, nil
 }
 
 // VerifyJWTToken verifies the JWT token and returns the claims if the token is valid.
-func VerifyJWTToken(tokenString string, secretKey []byte) (jwt.MapClaims, error) {
+// Action tokens are rejected, they only grant the action they were minted for.
+func VerifyJWTToken(tokenString string) (jwt.MapClaims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := claims["act"]; ok {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	return claims, nil
+}
+
+// parseToken checks the signature, the expiration (exp, nbf) and the issuer and audience of
+// a token signed with one of the loaded keys.
+func parseToken(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Check the signing method of the token.
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
+		// Find the key from the kid, it also checks the signing method of the token.
+		key, err := verificationKey(token)
+		if err != nil {
+			return nil, err
 		}
-		return secretKey, nil
+		return key.public, nil
 	})
 
 	if err != nil {
@@ -48,18 +127,40 @@ func VerifyJWTToken(tokenString string, secretKey []byte) (jwt.MapClaims, error)
 	}
 
 	// Check if the token is valid and contains valid claims.
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	// Reject the tokens minted for other services sharing the signing key
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" && !claims.VerifyIssuer(issuer, true) {
+		return nil, ErrTokenIssuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" && !claims.VerifyAudience(audience, true) {
+		return nil, ErrTokenAudience
 	}
 
-	return nil, jwt.ErrSignatureInvalid
+	return claims, nil
 }
 
-// UserResponse represents the user information to be returned in the API response
-type UserResponse struct {
-	ID       uint   `json:"id"`
-	FullName string `json:"fullName"`
-	Username string `json:"username"`
-	Status   string `json:"status"`
-	Role     string `json:"role"`
+// Errors of the tokens minted by another issuer or for another audience.
+var (
+	ErrTokenIssuer   = errors.New("token issued by another issuer")
+	ErrTokenAudience = errors.New("token minted for another audience")
+)
+
+// setRegisteredClaims sets the expiration, issued at and not before claims, and the issuer
+// (JWT_ISSUER) and audience (JWT_AUDIENCE) claims when configured.
+func setRegisteredClaims(claims jwt.MapClaims, expiresAt time.Time) {
+	now := time.Now().Unix()
+	claims["exp"] = expiresAt.Unix()
+	claims["iat"] = now
+	claims["nbf"] = now
+
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		claims["iss"] = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		claims["aud"] = audience
+	}
 }
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// signingKey is a key tokens are signed or verified with.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private interface{} // []byte for HMAC, *rsa.PrivateKey or *ecdsa.PrivateKey
+	public  interface{} // []byte for HMAC, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// keySet holds the key new tokens are signed with and every key still accepted.
+type keySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+var (
+	keys     *keySet
+	keysErr  error
+	keysOnce sync.Once
+)
+
+// LoadSigningKeys loads the token signing keys, it is called at startup to fail early.
+//
+// JWT_SIGNING_METHOD selects HS256 (default, signed with JWT_SECRET_KEY), RS256 or ES256.
+// For RS256/ES256 every PEM private key of JWT_KEYS_DIR is loaded, its file name (without
+// .pem) being the kid. New tokens are signed with JWT_ACTIVE_KID (the last kid in sorted
+// order by default) and tokens signed with any loaded key are accepted, so a key can be
+// rotated by adding the new key, switching the active kid and removing the old key once
+// its tokens expired.
+func LoadSigningKeys() error {
+	keysOnce.Do(func() {
+		keys, keysErr = loadKeySet()
+	})
+	return keysErr
+}
+
+func loadKeySet() (*keySet, error) {
+	method := os.Getenv("JWT_SIGNING_METHOD")
+	if method == "" || method == "HS256" {
+		key := &signingKey{
+			method:  jwt.SigningMethodHS256,
+			private: []byte(os.Getenv("JWT_SECRET_KEY")),
+			public:  []byte(os.Getenv("JWT_SECRET_KEY")),
+		}
+		return &keySet{active: key, keys: map[string]*signingKey{}}, nil
+	}
+
+	if method != "RS256" && method != "ES256" {
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_METHOD %s", method)
+	}
+
+	files, err := filepath.Glob(filepath.Join(os.Getenv("JWT_KEYS_DIR"), "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no signing keys found in JWT_KEYS_DIR")
+	}
+	sort.Strings(files)
+
+	set := &keySet{keys: map[string]*signingKey{}}
+	for _, file := range files {
+		pemData, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &signingKey{kid: strings.TrimSuffix(filepath.Base(file), ".pem")}
+		if method == "RS256" {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pemData)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RSA key %s: %w", file, err)
+			}
+			key.method, key.private, key.public = jwt.SigningMethodRS256, private, &private.PublicKey
+		} else {
+			private, err := jwt.ParseECPrivateKeyFromPEM(pemData)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EC key %s: %w", file, err)
+			}
+			if private.Curve != elliptic.P256() {
+				return nil, fmt.Errorf("EC key %s must use the P-256 curve", file)
+			}
+			key.method, key.private, key.public = jwt.SigningMethodES256, private, &private.PublicKey
+		}
+
+		set.keys[key.kid] = key
+		set.active = key
+	}
+
+	if kid := os.Getenv("JWT_ACTIVE_KID"); kid != "" {
+		active, ok := set.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("JWT_ACTIVE_KID %s has no key in JWT_KEYS_DIR", kid)
+		}
+		set.active = active
+	}
+
+	return set, nil
+}
+
+// activeSigningKey returns the key new tokens are signed with.
+func activeSigningKey() (*signingKey, error) {
+	if err := LoadSigningKeys(); err != nil {
+		return nil, err
+	}
+	return keys.active, nil
+}
+
+// verificationKey returns the key a token must be verified with, from its kid header.
+func verificationKey(token *jwt.Token) (*signingKey, error) {
+	if err := LoadSigningKeys(); err != nil {
+		return nil, err
+	}
+
+	key := keys.active
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok = keys.keys[kid]; !ok {
+			return nil, errors.New("unknown signing key")
+		}
+	}
+
+	// The algorithm of the token must be the one of the key (no algorithm confusion)
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	return key, nil
+}
+
+// JWKS returns the public keys tokens may be signed with, as JSON Web Keys (empty for HS256).
+func JWKS() []map[string]string {
+	jwks := []map[string]string{}
+	if err := LoadSigningKeys(); err != nil {
+		return jwks
+	}
+
+	kids := make([]string, 0, len(keys.keys))
+	for kid := range keys.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := keys.keys[kid]
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": key.method.Alg(),
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "EC",
+				"use": "sig",
+				"alg": key.method.Alg(),
+				"kid": kid,
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+
+	return jwks
+}